@@ -13,3 +13,5 @@ QEMUCMD := qemu-lite-system-x86_64
 
 # Firecracker binary name
 FCCMD := firecracker
+# Firecracker's jailer binary name
+FCJAILERCMD := jailer
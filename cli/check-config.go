@@ -0,0 +1,87 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/kata-containers/runtime/pkg/katautils"
+	"github.com/urfave/cli"
+)
+
+const checkConfigCmd = "check-config"
+
+// writeConfigIssues writes the issues found in the configuration, one per
+// line or as JSON, and returns the number of errors.
+func writeConfigIssues(w io.Writer, issues []katautils.ConfigIssue, asJSON bool) (int, error) {
+	errorCount := 0
+	for _, issue := range issues {
+		if issue.Level == katautils.ConfigError {
+			errorCount++
+		}
+	}
+
+	if asJSON {
+		// Always an array
+		if issues == nil {
+			issues = []katautils.ConfigIssue{}
+		}
+
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+
+		return errorCount, encoder.Encode(issues)
+	}
+
+	for _, issue := range issues {
+		if _, err := fmt.Fprintln(w, issue); err != nil {
+			return errorCount, err
+		}
+	}
+
+	return errorCount, nil
+}
+
+var checkConfigCLICommand = cli.Command{
+	Name:  checkConfigCmd,
+	Usage: "validate the configuration file and its drop-in fragments",
+	Description: `The configuration is checked for unknown keys, values which
+   cannot work together and values the host cannot support. The errors and
+   warnings found are reported with the file and line they come from.`,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "Format output as JSON",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		span, _ := katautils.Trace(ctx, "check-config")
+		defer span.Finish()
+
+		issues, err := katautils.CheckConfiguration(context.GlobalString(configFilePathOption))
+		if err != nil {
+			return err
+		}
+
+		errorCount, err := writeConfigIssues(defaultOutputFile, issues, context.Bool("json"))
+		if err != nil {
+			return err
+		}
+
+		if errorCount > 0 {
+			return fmt.Errorf("ERROR: configuration has %d error(s)", errorCount)
+		}
+
+		return nil
+	},
+}
@@ -0,0 +1,58 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/kata-containers/runtime/pkg/katautils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteConfigIssues(t *testing.T) {
+	assert := assert.New(t)
+
+	issues := []katautils.ConfigIssue{
+		{
+			Level:   katautils.ConfigError,
+			File:    "/etc/kata-containers/configuration.toml",
+			Line:    12,
+			Key:     "hypervisor.qemu.default_memroy",
+			Message: "unknown configuration key",
+		},
+		{
+			Level:   katautils.ConfigWarning,
+			File:    "/etc/kata-containers/config.d/10-vsock.toml",
+			Key:     "hypervisor.qemu.use_vsock",
+			Message: "the host does not support vsock, the legacy serial port is used",
+		},
+	}
+
+	var buf bytes.Buffer
+	errorCount, err := writeConfigIssues(&buf, issues, false)
+	assert.NoError(err)
+	assert.Equal(1, errorCount)
+	assert.Equal(`/etc/kata-containers/configuration.toml:12: error: hypervisor.qemu.default_memroy: unknown configuration key
+/etc/kata-containers/config.d/10-vsock.toml: warning: hypervisor.qemu.use_vsock: the host does not support vsock, the legacy serial port is used
+`, buf.String())
+
+	buf.Reset()
+	errorCount, err = writeConfigIssues(&buf, issues, true)
+	assert.NoError(err)
+	assert.Equal(1, errorCount)
+
+	var decoded []katautils.ConfigIssue
+	assert.NoError(json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(issues, decoded)
+
+	buf.Reset()
+	errorCount, err = writeConfigIssues(&buf, nil, true)
+	assert.NoError(err)
+	assert.Zero(errorCount)
+	assert.Equal("[]\n", buf.String())
+}
@@ -0,0 +1,70 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/kata-containers/runtime/pkg/katautils"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/urfave/cli"
+)
+
+var consoleLogCLICommand = cli.Command{
+	Name:  "console-log",
+	Usage: "output the guest console log collected for a sandbox",
+	ArgsUsage: `<sandbox-id>
+
+   <sandbox-id> is the ID of the sandbox, which is also the ID of its
+   sandbox container`,
+	Description: `The console-log command outputs the guest console log of a
+sandbox, including the guest kernel panics. The log remains available once
+the sandbox is deleted.`,
+	Flags: []cli.Flag{
+		cli.Int64Flag{
+			Name:  "tail",
+			Usage: "only output the last `BYTES` bytes of the log",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		args := context.Args()
+		if len(args) != 1 {
+			return fmt.Errorf("Expecting only one sandbox ID, got %d: %v", len(args), []string(args))
+		}
+
+		return consoleLog(ctx, args.First(), context.Int64("tail"))
+	},
+}
+
+func consoleLog(ctx context.Context, sandboxID string, tail int64) error {
+	span, _ := katautils.Trace(ctx, "console-log")
+	defer span.Finish()
+
+	span.SetTag("sandbox", sandboxID)
+
+	if tail < 0 {
+		return fmt.Errorf("Invalid tail size %d", tail)
+	}
+
+	log, err := vc.ConsoleLog(sandboxID, tail)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("No console log found for sandbox %s", sandboxID)
+		}
+		return err
+	}
+
+	_, err = defaultOutputFile.Write(log)
+
+	return err
+}
@@ -0,0 +1,66 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleLog(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedConsoleStoragePath := store.RunConsoleStoragePath
+	savedOutputFile := defaultOutputFile
+	defer func() {
+		store.RunConsoleStoragePath = savedConsoleStoragePath
+		defaultOutputFile = savedOutputFile
+	}()
+
+	store.RunConsoleStoragePath = filepath.Join(tmpdir, "console")
+
+	output, err := os.Create(filepath.Join(tmpdir, "output"))
+	assert.NoError(err)
+	defer output.Close()
+	defaultOutputFile = output
+
+	ctx := context.Background()
+
+	err = consoleLog(ctx, testSandboxID, 0)
+	assert.Error(err)
+
+	logDir := filepath.Join(store.RunConsoleStoragePath, testSandboxID)
+	err = os.MkdirAll(logDir, testDirMode)
+	assert.NoError(err)
+
+	err = ioutil.WriteFile(filepath.Join(logDir, "console.log.1"), []byte("boot\n"), testFileMode)
+	assert.NoError(err)
+	err = ioutil.WriteFile(filepath.Join(logDir, "console.log"), []byte("Kernel panic\n"), testFileMode)
+	assert.NoError(err)
+
+	err = consoleLog(ctx, testSandboxID, -1)
+	assert.Error(err)
+
+	err = consoleLog(ctx, testSandboxID, 0)
+	assert.NoError(err)
+
+	err = consoleLog(ctx, testSandboxID, 6)
+	assert.NoError(err)
+
+	data, err := ioutil.ReadFile(output.Name())
+	assert.NoError(err)
+	assert.Equal("boot\nKernel panic\npanic\n", string(data))
+}
@@ -123,6 +123,12 @@ func create(ctx context.Context, containerID, bundlePath, console, pidFilePath s
 		return err
 	}
 
+	if containerType == vc.PodSandbox {
+		if runtimeConfig, err = katautils.SelectProfile(ociSpec, runtimeConfig, ""); err != nil {
+			return err
+		}
+	}
+
 	katautils.HandleFactory(ctx, vci, &runtimeConfig)
 
 	disableOutput := noNeedForOutput(detach, ociSpec.Process.Terminal)
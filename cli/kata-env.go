@@ -26,7 +26,7 @@ import (
 //
 // XXX: Increment for every change to the output format
 // (meaning any change to the EnvInfo type).
-const formatVersion = "1.0.20"
+const formatVersion = "1.0.21"
 
 // MetaInfo stores information on the format of the output itself
 type MetaInfo struct {
@@ -58,7 +58,9 @@ type CPUInfo struct {
 
 // RuntimeConfigInfo stores runtime config details.
 type RuntimeConfigInfo struct {
-	Path string
+	Path     string
+	DropIns  []string
+	Settings []katautils.ConfigSetting
 }
 
 // RuntimeInfo stores runtime details.
@@ -172,6 +174,13 @@ func getRuntimeInfo(configFile string, config oci.RuntimeConfig) RuntimeInfo {
 		Path: configFile,
 	}
 
+	// The effective configuration, merged with the drop-in fragments
+	settings, files, err := katautils.GetConfigSettings(configFile)
+	if err == nil {
+		runtimeConfig.DropIns = files[1:]
+		runtimeConfig.Settings = settings
+	}
+
 	runtimePath, _ := os.Executable()
 
 	return RuntimeInfo{
@@ -357,6 +357,8 @@ func getExpectedKernel(config oci.RuntimeConfig) KernelInfo {
 func getExpectedRuntimeDetails(config oci.RuntimeConfig, configFile string) RuntimeInfo {
 	runtimePath, _ := os.Executable()
 
+	settings, files, _ := katautils.GetConfigSettings(configFile)
+
 	return RuntimeInfo{
 		Version: RuntimeVersionInfo{
 			Semver: version,
@@ -364,7 +366,9 @@ func getExpectedRuntimeDetails(config oci.RuntimeConfig, configFile string) Runt
 			OCI:    specs.Version,
 		},
 		Config: RuntimeConfigInfo{
-			Path: configFile,
+			Path:     configFile,
+			DropIns:  files[1:],
+			Settings: settings,
 		},
 		Path:            runtimePath,
 		Debug:           config.Debug,
@@ -666,6 +670,34 @@ func TestEnvGetRuntimeInfo(t *testing.T) {
 	assert.Equal(t, expectedRuntime, runtime)
 }
 
+func TestEnvGetRuntimeInfoDropIns(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir("", "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	configFile, config, err := makeRuntimeConfig(tmpdir)
+	assert.NoError(err)
+
+	dropInDir := filepath.Join(tmpdir, "config.d")
+	assert.NoError(os.MkdirAll(dropInDir, testDirMode))
+
+	dropIn := filepath.Join(dropInDir, "10-debug.toml")
+	assert.NoError(createConfig(dropIn, "[runtime]\nenable_debug = false\n"))
+
+	runtime := getRuntimeInfo(configFile, config)
+	assert.Equal([]string{dropIn}, runtime.Config.DropIns)
+
+	sources := make(map[string]string)
+	for _, s := range runtime.Config.Settings {
+		sources[s.Key] = s.Source
+	}
+
+	assert.Equal(dropIn, sources["runtime.enable_debug"])
+	assert.Equal(configFile, sources["hypervisor.qemu.path"])
+}
+
 func TestEnvGetProxyInfo(t *testing.T) {
 	tmpdir, err := ioutil.TempDir("", "")
 	if err != nil {
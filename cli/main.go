@@ -132,8 +132,12 @@ var runtimeCommands = []cli.Command{
 	// Kata Containers specific extensions
 	kataCheckCLICommand,
 	kataEnvCLICommand,
+	checkConfigCLICommand,
 	kataNetworkCLICommand,
 	factoryCLICommand,
+	storeCLICommand,
+	consoleLogCLICommand,
+	metricsCLICommand,
 }
 
 // runtimeBeforeSubcommands is the function to run before command-line
@@ -262,6 +266,12 @@ func beforeSubcommands(c *cli.Context) error {
 		return nil
 	}
 
+	if c.Args().First() == checkConfigCmd {
+		// The configuration is checked by the command, it
+		// must not be loaded first.
+		return nil
+	}
+
 	if path := c.GlobalString("log"); path != "" {
 		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_SYNC, 0640)
 		if err != nil {
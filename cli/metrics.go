@@ -0,0 +1,138 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/kata-containers/runtime/pkg/katautils"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/urfave/cli"
+)
+
+const (
+	// metricsSandboxLabel is the label identifying the sandbox of the
+	// metrics scraped from a shim.
+	metricsSandboxLabel = "sandbox"
+
+	defaultMetricsTimeout = 5 * time.Second
+)
+
+var metricsCLICommand = cli.Command{
+	Name:  "metrics",
+	Usage: "output the Prometheus metrics of all the sandboxes of the host",
+	Description: `The metrics command scrapes the metrics endpoint of every shim
+running on the host, and outputs them in the Prometheus text format, each
+metric labelled with its sandbox ID.`,
+	Flags: []cli.Flag{
+		cli.DurationFlag{
+			Name:  "timeout",
+			Value: defaultMetricsTimeout,
+			Usage: "the `DURATION` after which a shim scrape is abandoned",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		return metrics(ctx, defaultOutputFile, context.Duration("timeout"))
+	},
+}
+
+func metrics(ctx context.Context, w io.Writer, timeout time.Duration) error {
+	span, _ := katautils.Trace(ctx, "metrics")
+	defer span.Finish()
+
+	sockets, err := vc.MetricsSockets()
+	if err != nil {
+		return err
+	}
+
+	families := make(map[string]*dto.MetricFamily)
+
+	for sandboxID, socket := range sockets {
+		scraped, err := scrapeMetrics(socket, timeout)
+		if err != nil {
+			// The shim may be exiting, or may have left a stale socket.
+			kataLog.WithError(err).WithField("sandbox", sandboxID).Warn("Could not scrape the sandbox metrics")
+			continue
+		}
+
+		mergeMetrics(families, scraped, sandboxID)
+	}
+
+	names := make([]string, 0, len(families))
+	for name := range families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := expfmt.MetricFamilyToText(w, families[name]); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// scrapeMetrics returns the metrics served by a shim on its metrics socket.
+func scrapeMetrics(socket string, timeout time.Duration) (map[string]*dto.MetricFamily, error) {
+	client := &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	resp, err := client.Get("http://shim/metrics")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Unexpected metrics endpoint status: %s", resp.Status)
+	}
+
+	var parser expfmt.TextParser
+	return parser.TextToMetricFamilies(resp.Body)
+}
+
+// mergeMetrics adds the metrics scraped from the shim of a sandbox to
+// families, labelling them with the sandbox ID.
+func mergeMetrics(families, scraped map[string]*dto.MetricFamily, sandboxID string) {
+	for name, family := range scraped {
+		for _, m := range family.Metric {
+			m.Label = append(m.Label, &dto.LabelPair{
+				Name:  proto.String(metricsSandboxLabel),
+				Value: proto.String(sandboxID),
+			})
+		}
+
+		merged, ok := families[name]
+		if !ok {
+			families[name] = family
+			continue
+		}
+
+		merged.Metric = append(merged.Metric, family.Metric...)
+	}
+}
@@ -0,0 +1,65 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedMetricsStoragePath := store.RunMetricsStoragePath
+	defer func() {
+		store.RunMetricsStoragePath = savedMetricsStoragePath
+	}()
+
+	store.RunMetricsStoragePath = filepath.Join(tmpdir, "metrics")
+	err = os.MkdirAll(store.RunMetricsStoragePath, testDirMode)
+	assert.NoError(err)
+
+	for _, sandboxID := range []string{"sandbox1", "sandbox2"} {
+		listener, err := net.Listen("unix", vc.MetricsSocketPath(sandboxID))
+		assert.NoError(err)
+		defer listener.Close()
+
+		rss := len(sandboxID)
+		go http.Serve(listener, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprintf(w, "# HELP kata_hypervisor_resident_memory_bytes RSS.\n# TYPE kata_hypervisor_resident_memory_bytes gauge\nkata_hypervisor_resident_memory_bytes %d\n", rss)
+		}))
+	}
+
+	// A socket left behind by a dead shim is skipped.
+	err = ioutil.WriteFile(vc.MetricsSocketPath("stale"), nil, testFileMode)
+	assert.NoError(err)
+
+	var output bytes.Buffer
+	err = metrics(context.Background(), &output, time.Second)
+	assert.NoError(err)
+
+	text := output.String()
+	assert.Equal(1, bytes.Count(output.Bytes(), []byte("# TYPE kata_hypervisor_resident_memory_bytes gauge")))
+	assert.Contains(text, `kata_hypervisor_resident_memory_bytes{sandbox="sandbox1"} 8`)
+	assert.Contains(text, `kata_hypervisor_resident_memory_bytes{sandbox="sandbox2"} 8`)
+	assert.NotContains(text, "stale")
+}
@@ -11,6 +11,7 @@ import (
 	"fmt"
 	"os"
 
+	"github.com/kata-containers/runtime/pkg/netapi"
 	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
 	"github.com/kata-containers/runtime/virtcontainers/types"
 	"github.com/sirupsen/logrus"
@@ -35,6 +36,7 @@ var kataNetworkCLICommand = cli.Command{
 		listIfacesCommand,
 		updateRoutesCommand,
 		listRoutesCommand,
+		applyCommand,
 	},
 	Action: func(context *cli.Context) error {
 		return cli.ShowSubcommandHelp(context)
@@ -116,6 +118,93 @@ var listRoutesCommand = cli.Command{
 	},
 }
 
+var applyCommand = cli.Command{
+	Name:      "apply",
+	Usage:     "apply a batch of network operations to a container",
+	ArgsUsage: `apply <container-id> file or - for stdin`,
+	Flags:     []cli.Flag{},
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		return networkApplyCommand(ctx, context.Args().First(), context.Args().Get(1))
+	},
+}
+
+// vciNetwork manages the network of a sandbox through the virtcontainers
+// API, for the network operations applied by the runtime CLI.
+type vciNetwork struct {
+	ctx       context.Context
+	sandboxID string
+}
+
+func (n vciNetwork) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	return vci.AddInterface(n.ctx, n.sandboxID, inf)
+}
+
+func (n vciNetwork) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	return vci.RemoveInterface(n.ctx, n.sandboxID, inf)
+}
+
+func (n vciNetwork) UpdateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	return vci.UpdateInterface(n.ctx, n.sandboxID, inf)
+}
+
+func (n vciNetwork) UpdateBandwidth(bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	return vci.UpdateBandwidth(n.ctx, n.sandboxID, bw)
+}
+
+func (n vciNetwork) UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+	return vci.UpdateRoutes(n.ctx, n.sandboxID, routes)
+}
+
+func networkApplyCommand(ctx context.Context, containerID, input string) (err error) {
+	status, sandboxID, err := getExistingContainerInfo(ctx, containerID)
+	if err != nil {
+		return err
+	}
+
+	containerID = status.ID
+
+	kataLog = kataLog.WithFields(logrus.Fields{
+		"container": containerID,
+		"sandbox":   sandboxID,
+	})
+
+	setExternalLoggers(ctx, kataLog)
+
+	// container MUST be running
+	if status.State.State != types.StateRunning {
+		return fmt.Errorf("container %s is not running", containerID)
+	}
+
+	f := os.Stdin
+	if input != "-" {
+		f, err = os.Open(input)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+	}
+
+	var ops []netapi.Operation
+	if err = json.NewDecoder(f).Decode(&ops); err != nil {
+		return err
+	}
+
+	results, err := netapi.Apply(vciNetwork{ctx: ctx, sandboxID: sandboxID}, ops)
+	if err != nil {
+		kataLog.WithField("results", fmt.Sprintf("%+v", results)).
+			WithError(err).Error("network operations failed")
+	}
+
+	json.NewEncoder(defaultOutputFile).Encode(results)
+
+	return err
+}
+
 func networkModifyCommand(ctx context.Context, containerID, input string, opType networkType, add bool) (err error) {
 	status, sandboxID, err := getExistingContainerInfo(ctx, containerID)
 	if err != nil {
@@ -60,6 +60,8 @@ func TestNetworkCliFunction(t *testing.T) {
 	defer func() {
 		testingImpl.AddInterfaceFunc = nil
 		testingImpl.RemoveInterfaceFunc = nil
+		testingImpl.UpdateInterfaceFunc = nil
+		testingImpl.UpdateBandwidthFunc = nil
 		testingImpl.ListInterfacesFunc = nil
 		testingImpl.UpdateRoutesFunc = nil
 		testingImpl.ListRoutesFunc = nil
@@ -87,4 +89,44 @@ func TestNetworkCliFunction(t *testing.T) {
 	f.WriteString("[{}]")
 	f.Close()
 	execCLICommandFunc(assert, updateRoutesCommand, set, false)
+
+	ops, err := ioutil.TempFile("", "operations")
+	defer os.Remove(ops.Name())
+	assert.NoError(err)
+	ops.WriteString(`[{"op":"AddInterface","interface":{"name":"eth1"}},{"op":"UpdateInterface","interface":{"name":"eth1"}},{"op":"UpdateBandwidth","bandwidth":{"ingress":1000000}},{"op":"UpdateRoutes"}]`)
+	ops.Close()
+
+	var added []string
+	testingImpl.AddInterfaceFunc = func(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+		added = append(added, inf.Name)
+		return inf, nil
+	}
+
+	var updated []string
+	testingImpl.UpdateInterfaceFunc = func(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+		updated = append(updated, inf.Name)
+		return inf, nil
+	}
+
+	var bandwidth *vcTypes.Bandwidth
+	testingImpl.UpdateBandwidthFunc = func(ctx context.Context, sandboxID string, bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+		bandwidth = bw
+		return bw, nil
+	}
+
+	set.Parse([]string{testContainerID, ops.Name()})
+	execCLICommandFunc(assert, applyCommand, set, false)
+	assert.Equal([]string{"eth1"}, added)
+	assert.Equal([]string{"eth1"}, updated)
+	assert.Equal(&vcTypes.Bandwidth{Ingress: 1000000}, bandwidth)
+
+	// An unknown operation
+	ops, err = ioutil.TempFile("", "operations")
+	defer os.Remove(ops.Name())
+	assert.NoError(err)
+	ops.WriteString(`[{"op":"Foo"}]`)
+	ops.Close()
+
+	set.Parse([]string{testContainerID, ops.Name()})
+	execCLICommandFunc(assert, applyCommand, set, true)
 }
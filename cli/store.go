@@ -0,0 +1,135 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/kata-containers/runtime/pkg/katautils"
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/urfave/cli"
+)
+
+var storeSubCmds = []cli.Command{
+	migrateStoreCommand,
+	statusStoreCommand,
+	upgradeStoreCommand,
+}
+
+var storeCLICommand = cli.Command{
+	Name:        "store",
+	Usage:       "manage the sandboxes and containers store",
+	Subcommands: storeSubCmds,
+	Action: func(context *cli.Context) {
+		cli.ShowSubcommandHelp(context)
+	},
+}
+
+var migrateStoreCommand = cli.Command{
+	Name:  "migrate",
+	Usage: "convert the filesystem stores into bolt stores",
+	Description: `All the sandboxes must be stopped before being migrated.
+   Set store_backend = "bolt" in the runtime configuration once migrated.`,
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		span, ctx := katautils.Trace(ctx, "store-migrate")
+		defer span.Finish()
+
+		migrated, err := store.MigrateToBolt(ctx)
+		for _, id := range migrated {
+			fmt.Fprintf(defaultOutputFile, "sandbox %s migrated\n", id)
+		}
+
+		return err
+	},
+}
+
+var statusStoreCommand = cli.Command{
+	Name:  "status",
+	Usage: "report the version of the items stored for every sandbox and container",
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		span, ctx := katautils.Trace(ctx, "store-status")
+		defer span.Finish()
+
+		reports, err := store.CheckVersions(ctx)
+		printVersionReports(reports)
+
+		return err
+	},
+}
+
+var upgradeStoreCommand = cli.Command{
+	Name:  "upgrade",
+	Usage: "upgrade the items stored for every sandbox and container to the current version",
+	Description: `The sandboxes which are not stopped are skipped, their runtime
+   upgrades their items as it stores them.`,
+	Action: func(context *cli.Context) error {
+		ctx, err := cliContextToContext(context)
+		if err != nil {
+			return err
+		}
+
+		span, ctx := katautils.Trace(ctx, "store-upgrade")
+		defer span.Finish()
+
+		reports, err := store.UpgradeVersions(ctx)
+		for _, r := range reports {
+			if !r.Outdated() {
+				continue
+			}
+
+			if r.Skipped {
+				fmt.Fprintf(defaultOutputFile, "%s skipped, upgraded by its runtime while live\n", versionReportName(r))
+				continue
+			}
+
+			fmt.Fprintf(defaultOutputFile, "%s upgraded to version %d\n", versionReportName(r), store.CurrentVersion)
+		}
+
+		return err
+	},
+}
+
+func versionReportName(r store.VersionReport) string {
+	if r.ContainerID == "" {
+		return fmt.Sprintf("sandbox %s", r.SandboxID)
+	}
+
+	return fmt.Sprintf("container %s/%s", r.SandboxID, r.ContainerID)
+}
+
+func printVersionReports(reports []store.VersionReport) {
+	fmt.Fprintf(defaultOutputFile, "store version %d\n", store.CurrentVersion)
+
+	for _, r := range reports {
+		status := "up to date"
+		if r.Outdated() {
+			status = "outdated"
+		}
+
+		fmt.Fprintf(defaultOutputFile, "%s: %s\n", versionReportName(r), status)
+
+		items := make([]string, 0, len(r.Versions))
+		for item, version := range r.Versions {
+			items = append(items, fmt.Sprintf("  %s: %d", item, version))
+		}
+		sort.Strings(items)
+
+		for _, item := range items {
+			fmt.Fprintln(defaultOutputFile, item)
+		}
+	}
+}
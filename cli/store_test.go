@@ -0,0 +1,107 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/urfave/cli"
+)
+
+func TestStoreCLIFunctionMigrate(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedConfigStoragePath := store.ConfigStoragePath
+	savedRunStoragePath := store.RunStoragePath
+	defer func() {
+		store.ConfigStoragePath = savedConfigStoragePath
+		store.RunStoragePath = savedRunStoragePath
+	}()
+
+	store.ConfigStoragePath = filepath.Join(tmpdir, "config")
+	store.RunStoragePath = filepath.Join(tmpdir, "run")
+
+	ctx := createCLIContext(nil)
+	ctx.App.Name = "foo"
+
+	fn, ok := migrateStoreCommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// nothing to migrate
+	err = fn(ctx)
+	assert.NoError(err)
+
+	err = os.MkdirAll(filepath.Join(store.ConfigStoragePath, testSandboxID), testDirMode)
+	assert.NoError(err)
+
+	err = ioutil.WriteFile(filepath.Join(store.ConfigStoragePath, testSandboxID, store.ConfigurationFile), []byte("{}"), testFileMode)
+	assert.NoError(err)
+
+	err = fn(ctx)
+	assert.NoError(err)
+
+	_, err = os.Stat(filepath.Join(store.ConfigStoragePath, testSandboxID, store.ConfigurationFile))
+	assert.True(os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(store.ConfigStoragePath, testSandboxID+".db"))
+	assert.NoError(err)
+}
+
+func TestStoreCLIFunctionStatusUpgrade(t *testing.T) {
+	assert := assert.New(t)
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	savedConfigStoragePath := store.ConfigStoragePath
+	savedRunStoragePath := store.RunStoragePath
+	defer func() {
+		store.ConfigStoragePath = savedConfigStoragePath
+		store.RunStoragePath = savedRunStoragePath
+	}()
+
+	store.ConfigStoragePath = filepath.Join(tmpdir, "config")
+	store.RunStoragePath = filepath.Join(tmpdir, "run")
+
+	ctx := createCLIContext(nil)
+	ctx.App.Name = "foo"
+
+	status, ok := statusStoreCommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	upgrade, ok := upgradeStoreCommand.Action.(func(context *cli.Context) error)
+	assert.True(ok)
+
+	// nothing to report
+	assert.NoError(status(ctx))
+	assert.NoError(upgrade(ctx))
+
+	err = os.MkdirAll(filepath.Join(store.ConfigStoragePath, testSandboxID), testDirMode)
+	assert.NoError(err)
+
+	// An item stored before versioning
+	err = ioutil.WriteFile(filepath.Join(store.ConfigStoragePath, testSandboxID, store.ConfigurationFile), []byte("{}"), testFileMode)
+	assert.NoError(err)
+
+	assert.NoError(status(ctx))
+	assert.NoError(upgrade(ctx))
+
+	reports, err := store.CheckVersions(context.Background())
+	assert.NoError(err)
+	assert.Len(reports, 1)
+	assert.False(reports[0].Outdated())
+}
@@ -0,0 +1,60 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"context"
+	"syscall"
+
+	"github.com/containerd/containerd/errdefs"
+	"github.com/containerd/containerd/runtime/linux/runctypes"
+	taskAPI "github.com/containerd/containerd/runtime/v2/task"
+	"github.com/containerd/typeurl"
+)
+
+func checkpoint(ctx context.Context, s *service, c *container, r *taskAPI.CheckpointTaskRequest) error {
+	// The whole sandbox VM gets checkpointed, which can only be
+	// requested through its sandbox container.
+	if !c.cType.IsSandbox() {
+		return errdefs.ToGRPCf(errdefs.ErrNotImplemented, "only the sandbox container %s can be checkpointed", s.sandbox.ID())
+	}
+
+	if r.Path == "" {
+		return errdefs.ToGRPCf(errdefs.ErrInvalidArgument, "missing checkpoint path")
+	}
+
+	exit := false
+	if r.Options != nil {
+		v, err := typeurl.UnmarshalAny(r.Options)
+		if err != nil {
+			return err
+		}
+		if opts, ok := v.(*runctypes.CheckpointOptions); ok {
+			exit = opts.Exit
+		}
+	}
+
+	if err := s.sandbox.Checkpoint(r.Path); err != nil {
+		return err
+	}
+
+	if !exit {
+		return nil
+	}
+
+	// The checkpoint has been taken so that the sandbox can be
+	// restored elsewhere, stop all the containers running here.
+	for _, cont := range s.containers {
+		if cont.cType.IsSandbox() {
+			continue
+		}
+		if err := s.sandbox.SignalProcess(cont.id, cont.id, syscall.SIGKILL, true); err != nil {
+			return err
+		}
+	}
+
+	return s.sandbox.SignalProcess(c.id, c.id, syscall.SIGKILL, true)
+}
@@ -35,6 +35,7 @@ type container struct {
 	exit     uint32
 	status   task.Status
 	terminal bool
+	restored bool
 }
 
 func newContainer(s *service, r *taskAPI.CreateTaskRequest, containerType vc.ContainerType, spec *oci.CompatOCISpec) (*container, error) {
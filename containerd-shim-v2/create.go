@@ -78,11 +78,38 @@ func create(ctx context.Context, s *service, r *taskAPI.CreateTaskRequest, netns
 			return nil, fmt.Errorf("cannot create another sandbox in sandbox: %s", s.sandbox.ID())
 		}
 
-		_, err := loadRuntimeConfig(s, r)
+		_, err := loadRuntimeConfig(s, r, ociSpec)
 		if err != nil {
 			return nil, err
 		}
 
+		// The network monitor cannot call the runtime CLI, which is
+		// the shim, so it goes through the sandbox network API.
+		if s.config.NetmonConfig.Enable {
+			path, err := startNetworkServer(s, r.ID)
+			if err != nil {
+				return nil, fmt.Errorf("Could not serve the sandbox network API: %v", err)
+			}
+			s.config.NetmonConfig.APISocket = path
+
+			defer func() {
+				if s.sandbox == nil {
+					stopNetworkServer(s)
+				}
+			}()
+		}
+
+		// A sandbox restored from a checkpoint does not boot a new VM,
+		// so the factory is not needed.
+		if r.Checkpoint != "" {
+			sandbox, err := katautils.RestoreSandbox(ctx, vci, ociSpec, *s.config, r.ID, bundlePath, r.Checkpoint, "", disableOutput, false, true)
+			if err != nil {
+				return nil, err
+			}
+			s.sandbox = sandbox
+			break
+		}
+
 		katautils.HandleFactory(ctx, vci, s.config)
 		sandbox, _, err := katautils.CreateSandbox(ctx, vci, ociSpec, *s.config, r.ID, bundlePath, "", disableOutput, false, true)
 		if err != nil {
@@ -95,6 +122,15 @@ func create(ctx context.Context, s *service, r *taskAPI.CreateTaskRequest, netns
 			return nil, fmt.Errorf("BUG: Cannot start the container, since the sandbox hasn't been created")
 		}
 
+		// The containers are restored along with their sandbox, there
+		// is nothing left to create.
+		if r.Checkpoint != "" {
+			if s.sandbox.GetContainer(r.ID) == nil {
+				return nil, fmt.Errorf("container %s is not part of the restored sandbox %s", r.ID, s.sandbox.ID())
+			}
+			break
+		}
+
 		_, err = katautils.CreateContainer(ctx, vci, s.sandbox, ociSpec, r.ID, bundlePath, "", disableOutput, true)
 		if err != nil {
 			return nil, err
@@ -106,11 +142,13 @@ func create(ctx context.Context, s *service, r *taskAPI.CreateTaskRequest, netns
 		return nil, err
 	}
 
+	container.restored = r.Checkpoint != ""
+
 	return container, nil
 }
 
-func loadRuntimeConfig(s *service, r *taskAPI.CreateTaskRequest) (*oci.RuntimeConfig, error) {
-	var configPath string
+func loadRuntimeConfig(s *service, r *taskAPI.CreateTaskRequest, ociSpec oci.CompatOCISpec) (*oci.RuntimeConfig, error) {
+	var configPath, profile string
 
 	if r.Options != nil {
 		v, err := typeurl.UnmarshalAny(r.Options)
@@ -130,11 +168,20 @@ func loadRuntimeConfig(s *service, r *taskAPI.CreateTaskRequest) (*oci.RuntimeCo
 		configPath = os.Getenv("KATA_CONF_FILE")
 	}
 
+	// The profile may be selected by the runtime option, as
+	// "<config path>#<profile>".
+	configPath, profile = katautils.SplitConfigProfile(configPath)
+
 	_, runtimeConfig, err := katautils.LoadConfiguration(configPath, false, true)
 	if err != nil {
 		return nil, err
 	}
 
+	runtimeConfig, err = katautils.SelectProfile(ociSpec, runtimeConfig, profile)
+	if err != nil {
+		return nil, err
+	}
+
 	// For the unit test, the config will be predefined
 	if s.config == nil {
 		s.config = &runtimeConfig
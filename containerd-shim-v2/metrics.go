@@ -6,6 +6,8 @@
 package containerdshim
 
 import (
+	"sort"
+
 	"github.com/containerd/cgroups"
 	"github.com/containerd/typeurl"
 
@@ -30,14 +32,27 @@ func marshalMetrics(s *service, containerID string) (*google_protobuf.Any, error
 }
 
 func statsToMetrics(cgStats *vc.CgroupStats) *cgroups.Metrics {
+	if cgStats == nil {
+		return &cgroups.Metrics{}
+	}
+
+	// Sort the page sizes, for the metrics to be stable.
+	var pageSizes []string
+	for pageSize := range cgStats.HugetlbStats {
+		pageSizes = append(pageSizes, pageSize)
+	}
+	sort.Strings(pageSizes)
+
 	var hugetlb []*cgroups.HugetlbStat
-	for _, v := range cgStats.HugetlbStats {
+	for _, pageSize := range pageSizes {
+		v := cgStats.HugetlbStats[pageSize]
 		hugetlb = append(
 			hugetlb,
 			&cgroups.HugetlbStat{
-				Usage:   v.Usage,
-				Max:     v.MaxUsage,
-				Failcnt: v.Failcnt,
+				Usage:    v.Usage,
+				Max:      v.MaxUsage,
+				Failcnt:  v.Failcnt,
+				Pagesize: pageSize,
 			})
 	}
 
@@ -55,16 +70,95 @@ func statsToMetrics(cgStats *vc.CgroupStats) *cgroups.Metrics {
 		CPU: &cgroups.CPUStat{
 			Usage: &cgroups.CPUUsage{
 				Total:  cgStats.CPUStats.CPUUsage.TotalUsage,
+				Kernel: cgStats.CPUStats.CPUUsage.UsageInKernelmode,
+				User:   cgStats.CPUStats.CPUUsage.UsageInUsermode,
 				PerCPU: perCPU,
 			},
-		},
-		Memory: &cgroups.MemoryStat{
-			Cache: cgStats.MemoryStats.Cache,
-			Usage: &cgroups.MemoryEntry{
-				Limit: cgStats.MemoryStats.Usage.Limit,
-				Usage: cgStats.MemoryStats.Usage.Usage,
+			Throttling: &cgroups.Throttle{
+				Periods:          cgStats.CPUStats.ThrottlingData.Periods,
+				ThrottledPeriods: cgStats.CPUStats.ThrottlingData.ThrottledPeriods,
+				ThrottledTime:    cgStats.CPUStats.ThrottlingData.ThrottledTime,
 			},
 		},
+		Memory: memoryStatsToMetrics(&cgStats.MemoryStats),
+		Blkio: &cgroups.BlkIOStat{
+			IoServiceBytesRecursive: blkioEntriesToMetrics(cgStats.BlkioStats.IoServiceBytesRecursive),
+			IoServicedRecursive:     blkioEntriesToMetrics(cgStats.BlkioStats.IoServicedRecursive),
+			IoQueuedRecursive:       blkioEntriesToMetrics(cgStats.BlkioStats.IoQueuedRecursive),
+			IoServiceTimeRecursive:  blkioEntriesToMetrics(cgStats.BlkioStats.IoServiceTimeRecursive),
+			IoWaitTimeRecursive:     blkioEntriesToMetrics(cgStats.BlkioStats.IoWaitTimeRecursive),
+			IoMergedRecursive:       blkioEntriesToMetrics(cgStats.BlkioStats.IoMergedRecursive),
+			IoTimeRecursive:         blkioEntriesToMetrics(cgStats.BlkioStats.IoTimeRecursive),
+			SectorsRecursive:        blkioEntriesToMetrics(cgStats.BlkioStats.SectorsRecursive),
+		},
+	}
+
+	return metrics
+}
+
+func memoryEntryToMetrics(data vc.MemoryData) *cgroups.MemoryEntry {
+	return &cgroups.MemoryEntry{
+		Limit:   data.Limit,
+		Usage:   data.Usage,
+		Max:     data.MaxUsage,
+		Failcnt: data.Failcnt,
+	}
+}
+
+// memoryStatsToMetrics maps the guest memory cgroup stats, the detailed
+// ones being the raw memory.stat entries, as parsed by cgroups for runc.
+func memoryStatsToMetrics(memStats *vc.MemoryStats) *cgroups.MemoryStat {
+	raw := memStats.Stats
+
+	return &cgroups.MemoryStat{
+		Cache:                   memStats.Cache,
+		RSS:                     raw["rss"],
+		RSSHuge:                 raw["rss_huge"],
+		MappedFile:              raw["mapped_file"],
+		Dirty:                   raw["dirty"],
+		Writeback:               raw["writeback"],
+		PgPgIn:                  raw["pgpgin"],
+		PgPgOut:                 raw["pgpgout"],
+		PgFault:                 raw["pgfault"],
+		PgMajFault:              raw["pgmajfault"],
+		InactiveAnon:            raw["inactive_anon"],
+		ActiveAnon:              raw["active_anon"],
+		InactiveFile:            raw["inactive_file"],
+		ActiveFile:              raw["active_file"],
+		Unevictable:             raw["unevictable"],
+		HierarchicalMemoryLimit: raw["hierarchical_memory_limit"],
+		HierarchicalSwapLimit:   raw["hierarchical_memsw_limit"],
+		TotalCache:              raw["total_cache"],
+		TotalRSS:                raw["total_rss"],
+		TotalRSSHuge:            raw["total_rss_huge"],
+		TotalMappedFile:         raw["total_mapped_file"],
+		TotalDirty:              raw["total_dirty"],
+		TotalWriteback:          raw["total_writeback"],
+		TotalPgPgIn:             raw["total_pgpgin"],
+		TotalPgPgOut:            raw["total_pgpgout"],
+		TotalPgFault:            raw["total_pgfault"],
+		TotalPgMajFault:         raw["total_pgmajfault"],
+		TotalInactiveAnon:       raw["total_inactive_anon"],
+		TotalActiveAnon:         raw["total_active_anon"],
+		TotalInactiveFile:       raw["total_inactive_file"],
+		TotalActiveFile:         raw["total_active_file"],
+		TotalUnevictable:        raw["total_unevictable"],
+		Usage:                   memoryEntryToMetrics(memStats.Usage),
+		Swap:                    memoryEntryToMetrics(memStats.SwapUsage),
+		Kernel:                  memoryEntryToMetrics(memStats.KernelUsage),
+		KernelTCP:               memoryEntryToMetrics(memStats.KernelTCPUsage),
+	}
+}
+
+func blkioEntriesToMetrics(entries []vc.BlkioStatEntry) []*cgroups.BlkIOEntry {
+	var metrics []*cgroups.BlkIOEntry
+	for _, e := range entries {
+		metrics = append(metrics, &cgroups.BlkIOEntry{
+			Op:    e.Op,
+			Major: e.Major,
+			Minor: e.Minor,
+			Value: e.Value,
+		})
 	}
 
 	return metrics
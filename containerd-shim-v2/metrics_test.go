@@ -0,0 +1,98 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"testing"
+
+	"github.com/containerd/cgroups"
+	"github.com/containerd/typeurl"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/vcmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStatsToMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(&cgroups.Metrics{}, statsToMetrics(nil))
+
+	cgStats := &vc.CgroupStats{
+		CPUStats: vc.CPUStats{
+			CPUUsage: vc.CPUUsage{
+				TotalUsage:        30,
+				UsageInKernelmode: 10,
+				UsageInUsermode:   20,
+			},
+			ThrottlingData: vc.ThrottlingData{
+				Periods: 5,
+			},
+		},
+		MemoryStats: vc.MemoryStats{
+			Usage: vc.MemoryData{
+				Usage:    100,
+				MaxUsage: 200,
+			},
+			SwapUsage: vc.MemoryData{
+				Failcnt: 1,
+			},
+			Stats: map[string]uint64{
+				"rss":              300,
+				"total_pgmajfault": 4,
+			},
+		},
+		BlkioStats: vc.BlkioStats{
+			IoServiceBytesRecursive: []vc.BlkioStatEntry{
+				{Major: 8, Minor: 0, Op: "Read", Value: 4096},
+			},
+			SectorsRecursive: []vc.BlkioStatEntry{
+				{Major: 8, Minor: 0, Value: 8},
+			},
+		},
+		HugetlbStats: map[string]vc.HugetlbStats{
+			"2MB": {Usage: 2},
+			"1GB": {Usage: 1},
+		},
+	}
+
+	metrics := statsToMetrics(cgStats)
+
+	assert.Equal(uint64(10), metrics.CPU.Usage.Kernel)
+	assert.Equal(uint64(20), metrics.CPU.Usage.User)
+	assert.Equal(uint64(5), metrics.CPU.Throttling.Periods)
+
+	assert.Equal(uint64(200), metrics.Memory.Usage.Max)
+	assert.Equal(uint64(1), metrics.Memory.Swap.Failcnt)
+	assert.Equal(uint64(300), metrics.Memory.RSS)
+	assert.Equal(uint64(4), metrics.Memory.TotalPgMajFault)
+
+	assert.Equal([]*cgroups.BlkIOEntry{{Major: 8, Op: "Read", Value: 4096}}, metrics.Blkio.IoServiceBytesRecursive)
+	assert.Equal([]*cgroups.BlkIOEntry{{Major: 8, Value: 8}}, metrics.Blkio.SectorsRecursive)
+	assert.Empty(metrics.Blkio.IoQueuedRecursive)
+
+	assert.Equal([]*cgroups.HugetlbStat{
+		{Usage: 1, Pagesize: "1GB"},
+		{Usage: 2, Pagesize: "2MB"},
+	}, metrics.Hugetlb)
+}
+
+func TestMarshalMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &service{
+		id:      testSandboxID,
+		sandbox: &vcmock.Sandbox{MockID: testSandboxID},
+	}
+
+	data, err := marshalMetrics(s, testContainerID)
+	assert.NoError(err)
+
+	// containerd CRI expects the cgroups metrics of runc.
+	v, err := typeurl.UnmarshalAny(data)
+	assert.NoError(err)
+	_, ok := v.(*cgroups.Metrics)
+	assert.True(ok)
+}
@@ -0,0 +1,84 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"time"
+
+	"github.com/containerd/containerd/api/types/task"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/sirupsen/logrus"
+)
+
+// consoleLogTail is the size of the guest console log tail reported when
+// the sandbox dies.
+const consoleLogTail = 4096
+
+// startSandboxMonitor starts watching the sandbox health, the sandbox
+// must be running.
+func startSandboxMonitor(s *service) {
+	monitor, err := s.sandbox.Monitor()
+	if err != nil {
+		logrus.WithError(err).WithField("sandbox", s.sandbox.ID()).Warn("Could not monitor the sandbox")
+		return
+	}
+
+	if monitor != nil {
+		go watchSandbox(s, monitor)
+	}
+}
+
+// watchSandbox waits for the sandbox monitor to report the sandbox as
+// dead, and then reports all its running processes as exited. The monitor
+// channel is closed when the sandbox is stopped on purpose.
+func watchSandbox(s *service, monitor chan error) {
+	err, ok := <-monitor
+	if !ok || err == nil {
+		return
+	}
+
+	reason := "unknown"
+	if merr, ok := err.(*vc.MonitorError); ok {
+		reason = string(merr.Reason)
+	}
+
+	fields := logrus.Fields{
+		"sandbox": s.id,
+		"reason":  reason,
+	}
+
+	// Attach the end of the guest console, for post-mortem analysis.
+	if console, err := vc.ConsoleLog(s.id, consoleLogTail); err == nil {
+		fields["console"] = string(console)
+	}
+
+	logrus.WithError(err).WithFields(fields).Error("Sandbox died unexpectedly")
+
+	timeStamp := time.Now()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, c := range s.containers {
+		c.mu.Lock()
+		running := c.status == task.StatusRunning || c.status == task.StatusPaused
+		var execIDs []string
+		for id, e := range c.execs {
+			if e.status == task.StatusRunning {
+				execIDs = append(execIDs, id)
+			}
+		}
+		c.mu.Unlock()
+
+		for _, id := range execIDs {
+			processExited(s, c, id, exitCode255, timeStamp)
+		}
+
+		if running {
+			processExited(s, c, "", exitCode255, timeStamp)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/containerd/containerd/api/types/task"
+	taskAPI "github.com/containerd/containerd/runtime/v2/task"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/vcmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWatchSandboxDied(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &service{
+		id: testSandboxID,
+		sandbox: &vcmock.Sandbox{
+			MockID: testSandboxID,
+		},
+		containers: make(map[string]*container),
+		ec:         make(chan exit, bufferSize),
+	}
+
+	reqCreate := &taskAPI.CreateTaskRequest{
+		ID: testContainerID,
+	}
+	c, err := newContainer(s, reqCreate, vc.PodSandbox, nil)
+	assert.NoError(err)
+	c.status = task.StatusRunning
+	c.execs[TestID] = &exec{
+		status: task.StatusRunning,
+		exitCh: make(chan uint32, 1),
+	}
+	s.containers[testContainerID] = c
+
+	monitor := make(chan error, 1)
+	monitor <- &vc.MonitorError{
+		Reason: vc.MonitorVMMExited,
+		Err:    errors.New("VMM exited"),
+	}
+
+	watchSandbox(s, monitor)
+
+	assert.Equal(task.StatusStopped, c.status)
+	assert.Equal(uint32(exitCode255), <-c.exitCh)
+	assert.Equal(task.StatusStopped, c.execs[TestID].status)
+	assert.Equal(uint32(exitCode255), <-c.execs[TestID].exitCh)
+
+	exits := map[string]bool{}
+	for i := 0; i < 2; i++ {
+		e := <-s.ec
+		assert.Equal(exitCode255, e.status)
+		exits[e.execid] = true
+	}
+	assert.Equal(map[string]bool{"": true, TestID: true}, exits)
+
+	// Already reported exits are not reported again.
+	processExited(s, c, "", 0, c.time)
+	assert.Equal(uint32(exitCode255), c.exit)
+	assert.Len(c.exitCh, 0)
+}
+
+func TestWatchSandboxStopped(t *testing.T) {
+	s := &service{
+		id:         testSandboxID,
+		containers: make(map[string]*container),
+	}
+
+	monitor := make(chan error)
+	close(monitor)
+
+	// Returns without reporting anything
+	watchSandbox(s, monitor)
+}
@@ -0,0 +1,120 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/kata-containers/runtime/pkg/netapi"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/sirupsen/logrus"
+)
+
+// sandboxNetwork manages the network of the shim sandbox, under the
+// service lock as the other sandbox operations.
+type sandboxNetwork struct {
+	s *service
+}
+
+func (n sandboxNetwork) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	n.s.mu.Lock()
+	defer n.s.mu.Unlock()
+
+	return n.s.sandbox.AddInterface(inf)
+}
+
+func (n sandboxNetwork) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	n.s.mu.Lock()
+	defer n.s.mu.Unlock()
+
+	return n.s.sandbox.RemoveInterface(inf)
+}
+
+func (n sandboxNetwork) UpdateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	n.s.mu.Lock()
+	defer n.s.mu.Unlock()
+
+	return n.s.sandbox.UpdateInterface(inf)
+}
+
+func (n sandboxNetwork) UpdateBandwidth(bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	n.s.mu.Lock()
+	defer n.s.mu.Unlock()
+
+	return n.s.sandbox.UpdateBandwidth(bw)
+}
+
+func (n sandboxNetwork) UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+	n.s.mu.Lock()
+	defer n.s.mu.Unlock()
+
+	return n.s.sandbox.UpdateRoutes(routes)
+}
+
+// networkSandbox returns the network of the shim sandbox, or nil until the
+// sandbox is created. The requests received while the sandbox is created
+// wait for the service lock.
+func (s *service) networkSandbox() netapi.Sandbox {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.sandbox == nil {
+		return nil
+	}
+
+	return sandboxNetwork{s: s}
+}
+
+// startNetworkServer serves the network API of the sandbox sandboxID, used
+// by the network monitor, and returns the socket it is served on. It is
+// called with the service lock held.
+func startNetworkServer(s *service, sandboxID string) (string, error) {
+	path := vc.NetworkSocketPath(sandboxID)
+
+	if err := os.MkdirAll(filepath.Dir(path), store.DirMode); err != nil {
+		return "", err
+	}
+
+	// Remove the socket left behind by a shim which did not exit cleanly.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return "", err
+	}
+
+	s.networkListener = listener
+
+	go func() {
+		if err := http.Serve(listener, netapi.NewHandler(s.networkSandbox)); err != nil {
+			logrus.WithError(err).WithField("socket", path).Debug("Network server stopped")
+		}
+	}()
+
+	return path, nil
+}
+
+// stopNetworkServer stops serving the sandbox network API and removes its
+// socket. It is called with the service lock held.
+func stopNetworkServer(s *service) {
+	if s.networkListener == nil {
+		return
+	}
+
+	// Closing a unix listener removes its socket.
+	if err := s.networkListener.Close(); err != nil {
+		logrus.WithError(err).Warn("Could not stop the network server")
+	}
+
+	s.networkListener = nil
+}
@@ -0,0 +1,61 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/kata-containers/runtime/pkg/netapi"
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/types"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/vcmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNetworkServer(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &service{
+		id:         testSandboxID,
+		containers: make(map[string]*container),
+	}
+
+	s.mu.Lock()
+	path, err := startNetworkServer(s, testSandboxID)
+	s.mu.Unlock()
+	assert.NoError(err)
+	assert.Equal(vc.NetworkSocketPath(testSandboxID), path)
+
+	client := netapi.NewClient(path)
+	client.Retries = 0
+	client.RetryDelay = time.Millisecond
+
+	ops := []netapi.Operation{
+		{Op: netapi.AddInterface, Interface: &types.Interface{Name: "eth1"}},
+		{Op: netapi.UpdateRoutes},
+	}
+
+	// The sandbox is not created yet
+	_, err = client.Apply(ops)
+	assert.Error(err)
+
+	s.mu.Lock()
+	s.sandbox = &vcmock.Sandbox{MockID: testSandboxID}
+	s.mu.Unlock()
+
+	results, err := client.Apply(ops)
+	assert.NoError(err)
+	assert.Len(results, 2)
+
+	s.mu.Lock()
+	stopNetworkServer(s)
+	s.mu.Unlock()
+
+	_, err = os.Stat(path)
+	assert.True(os.IsNotExist(err))
+}
@@ -0,0 +1,262 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/procfs"
+	"github.com/sirupsen/logrus"
+)
+
+var (
+	hypervisorRSSDesc = prometheus.NewDesc(
+		"kata_hypervisor_resident_memory_bytes",
+		"Resident memory size of the hypervisor process in bytes.",
+		nil, nil)
+
+	hypervisorCPUDesc = prometheus.NewDesc(
+		"kata_hypervisor_cpu_seconds_total",
+		"Total user and system CPU time of the hypervisor process in seconds.",
+		nil, nil)
+
+	vcpuCPUDesc = prometheus.NewDesc(
+		"kata_hypervisor_vcpu_cpu_seconds_total",
+		"Total user and system CPU time of the hypervisor vCPU threads in seconds.",
+		[]string{"vcpu"}, nil)
+)
+
+// guestNetworkMetrics are the statistics of the guest network interfaces.
+var guestNetworkMetrics = []struct {
+	desc  *prometheus.Desc
+	value func(*vc.NetworkStats) uint64
+}{
+	{newGuestNetworkDesc("receive_bytes", "Bytes received"), func(n *vc.NetworkStats) uint64 { return n.RxBytes }},
+	{newGuestNetworkDesc("receive_packets", "Packets received"), func(n *vc.NetworkStats) uint64 { return n.RxPackets }},
+	{newGuestNetworkDesc("receive_errors", "Receive errors"), func(n *vc.NetworkStats) uint64 { return n.RxErrors }},
+	{newGuestNetworkDesc("receive_drops", "Received packets dropped"), func(n *vc.NetworkStats) uint64 { return n.RxDropped }},
+	{newGuestNetworkDesc("transmit_bytes", "Bytes transmitted"), func(n *vc.NetworkStats) uint64 { return n.TxBytes }},
+	{newGuestNetworkDesc("transmit_packets", "Packets transmitted"), func(n *vc.NetworkStats) uint64 { return n.TxPackets }},
+	{newGuestNetworkDesc("transmit_errors", "Transmit errors"), func(n *vc.NetworkStats) uint64 { return n.TxErrors }},
+	{newGuestNetworkDesc("transmit_drops", "Transmitted packets dropped"), func(n *vc.NetworkStats) uint64 { return n.TxDropped }},
+}
+
+func newGuestNetworkDesc(name, help string) *prometheus.Desc {
+	return prometheus.NewDesc(
+		"kata_guest_network_"+name+"_total",
+		help+" by the guest network interface.",
+		[]string{"interface"}, nil)
+}
+
+// sandboxCollector collects the host resources used by the hypervisor of
+// the shim sandbox.
+type sandboxCollector struct {
+	s *service
+}
+
+func (c *sandboxCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- hypervisorRSSDesc
+	ch <- hypervisorCPUDesc
+	ch <- vcpuCPUDesc
+}
+
+func (c *sandboxCollector) Collect(ch chan<- prometheus.Metric) {
+	pid, vcpus := c.threads()
+	if pid <= 0 {
+		return
+	}
+
+	proc, err := procfs.NewProc(pid)
+	if err != nil {
+		logrus.WithError(err).WithField("pid", pid).Debug("Could not read the hypervisor process")
+		return
+	}
+
+	stat, err := proc.NewStat()
+	if err != nil {
+		logrus.WithError(err).WithField("pid", pid).Debug("Could not read the hypervisor process stat")
+		return
+	}
+
+	ch <- prometheus.MustNewConstMetric(hypervisorRSSDesc, prometheus.GaugeValue, float64(stat.ResidentMemory()))
+	ch <- prometheus.MustNewConstMetric(hypervisorCPUDesc, prometheus.CounterValue, stat.CPUTime())
+
+	// The threads stats have the same format as the processes ones.
+	tasks, err := procfs.NewFS(filepath.Join(procfs.DefaultMountPoint, strconv.Itoa(pid), "task"))
+	if err != nil {
+		logrus.WithError(err).WithField("pid", pid).Debug("Could not read the hypervisor threads")
+		return
+	}
+
+	for i, tid := range vcpus {
+		thread, err := tasks.NewProc(tid)
+		if err != nil {
+			continue
+		}
+
+		stat, err := thread.NewStat()
+		if err != nil {
+			continue
+		}
+
+		ch <- prometheus.MustNewConstMetric(vcpuCPUDesc, prometheus.CounterValue, stat.CPUTime(), strconv.Itoa(i))
+	}
+}
+
+// threads returns the last snapshot of the hypervisor pid and vCPU thread
+// IDs. The service lock is only held to copy it, so that collecting the
+// metrics never waits on the hypervisor.
+func (c *sandboxCollector) threads() (int, []int) {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+
+	return c.s.hypervisorThreads.pid, c.s.hypervisorThreads.vcpus
+}
+
+// hypervisorThreads is a snapshot of the hypervisor pid and vCPU thread
+// IDs of the shim sandbox.
+type hypervisorThreads struct {
+	pid   int
+	vcpus []int
+}
+
+// updateHypervisorThreads refreshes the snapshot of the hypervisor threads
+// read by the metrics collector. It must be called with the service lock
+// held, whenever the sandbox vCPUs may have changed.
+func (s *service) updateHypervisorThreads() {
+	s.hypervisorThreads = hypervisorThreads{}
+
+	if s.sandbox == nil {
+		return
+	}
+
+	pid, err := s.sandbox.GetHypervisorPid()
+	if err != nil {
+		logrus.WithError(err).Debug("Could not get the hypervisor pid")
+		return
+	}
+
+	vcpus, err := s.sandbox.GetVCPUThreadIDs()
+	if err != nil {
+		logrus.WithError(err).Debug("Could not get the hypervisor vCPU threads")
+	}
+
+	s.hypervisorThreads = hypervisorThreads{
+		pid:   pid,
+		vcpus: vcpus,
+	}
+}
+
+// guestNetworkCollector collects the statistics of the guest network
+// interfaces of the shim sandbox, which the container stats returned to
+// containerd have no room for.
+type guestNetworkCollector struct {
+	s *service
+}
+
+func (c *guestNetworkCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, m := range guestNetworkMetrics {
+		ch <- m.desc
+	}
+}
+
+func (c *guestNetworkCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, n := range c.networkStats() {
+		for _, m := range guestNetworkMetrics {
+			ch <- prometheus.MustNewConstMetric(m.desc, prometheus.CounterValue, float64(m.value(n)), n.Name)
+		}
+	}
+}
+
+// networkStats returns the statistics of the guest network interfaces, as
+// reported by the agent. The agent is called with the service lock held, as
+// for the other sandbox operations.
+func (c *guestNetworkCollector) networkStats() []*vc.NetworkStats {
+	c.s.mu.Lock()
+	defer c.s.mu.Unlock()
+
+	if c.s.sandbox == nil {
+		return nil
+	}
+
+	stats, err := c.s.sandbox.StatsContainer(c.s.sandbox.ID())
+	if err != nil {
+		logrus.WithError(err).Debug("Could not get the guest network statistics")
+		return nil
+	}
+
+	return stats.NetworkStats
+}
+
+// startMetricsServer serves the Prometheus metrics of the shim, of the
+// runtime, of the sandbox hypervisor and of the guest network on the sandbox
+// metrics socket.
+func startMetricsServer(s *service) error {
+	path := vc.MetricsSocketPath(s.sandbox.ID())
+
+	if err := os.MkdirAll(filepath.Dir(path), store.DirMode); err != nil {
+		return err
+	}
+
+	// Remove the socket left behind by a shim which did not exit cleanly.
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return err
+	}
+
+	registry := prometheus.NewRegistry()
+	if err := registry.Register(&sandboxCollector{s: s}); err != nil {
+		listener.Close()
+		return err
+	}
+
+	if err := registry.Register(&guestNetworkCollector{s: s}); err != nil {
+		listener.Close()
+		return err
+	}
+
+	gatherers := prometheus.Gatherers{prometheus.DefaultGatherer, registry}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.HandlerFor(gatherers, promhttp.HandlerOpts{}))
+
+	s.metricsListener = listener
+
+	go func() {
+		if err := http.Serve(listener, mux); err != nil {
+			logrus.WithError(err).WithField("socket", path).Debug("Metrics server stopped")
+		}
+	}()
+
+	return nil
+}
+
+// stopMetricsServer stops serving the sandbox metrics and removes its
+// socket.
+func stopMetricsServer(s *service) {
+	if s.metricsListener == nil {
+		return
+	}
+
+	// Closing a unix listener removes its socket.
+	if err := s.metricsListener.Close(); err != nil {
+		logrus.WithError(err).Warn("Could not stop the metrics server")
+	}
+
+	s.metricsListener = nil
+}
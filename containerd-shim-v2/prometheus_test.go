@@ -0,0 +1,71 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package containerdshim
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"testing"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/vcmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsServer(t *testing.T) {
+	assert := assert.New(t)
+
+	// Use the test process as the hypervisor, its main thread as a vCPU.
+	s := &service{
+		id: testSandboxID,
+		sandbox: &vcmock.Sandbox{
+			MockID:            testSandboxID,
+			MockHypervisorPid: os.Getpid(),
+			MockVCPUThreadIDs: []int{os.Getpid()},
+			MockNetworkStats: []*vc.NetworkStats{
+				{Name: "eth0", RxBytes: 42, TxDropped: 1},
+			},
+		},
+		containers: make(map[string]*container),
+	}
+
+	s.updateHypervisorThreads()
+	assert.Equal(os.Getpid(), s.hypervisorThreads.pid)
+
+	err := startMetricsServer(s)
+	assert.NoError(err)
+
+	socket := vc.MetricsSocketPath(testSandboxID)
+
+	client := &http.Client{
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				var d net.Dialer
+				return d.DialContext(ctx, "unix", socket)
+			},
+		},
+	}
+
+	resp, err := client.Get("http://shim/metrics")
+	assert.NoError(err)
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(err)
+	assert.Contains(string(body), "kata_hypervisor_resident_memory_bytes ")
+	assert.Contains(string(body), "kata_hypervisor_cpu_seconds_total ")
+	assert.Contains(string(body), `kata_hypervisor_vcpu_cpu_seconds_total{vcpu="0"} `)
+	assert.Contains(string(body), `kata_guest_network_receive_bytes_total{interface="eth0"} 42`)
+	assert.Contains(string(body), `kata_guest_network_transmit_drops_total{interface="eth0"} 1`)
+
+	stopMetricsServer(s)
+
+	_, err = os.Stat(socket)
+	assert.True(os.IsNotExist(err))
+}
@@ -8,6 +8,7 @@ package containerdshim
 import (
 	"context"
 	"io/ioutil"
+	"net"
 	"os"
 	sysexec "os/exec"
 	"path/filepath"
@@ -105,6 +106,16 @@ type service struct {
 	config     *oci.RuntimeConfig
 	events     chan interface{}
 
+	// metricsListener is the listener of the sandbox metrics socket.
+	metricsListener net.Listener
+
+	// hypervisorThreads is the snapshot of the hypervisor threads the
+	// sandbox metrics are collected from.
+	hypervisorThreads hypervisorThreads
+
+	// networkListener is the listener of the sandbox network API socket.
+	networkListener net.Listener
+
 	ec chan exit
 	id string
 }
@@ -344,6 +355,15 @@ func (s *service) Create(ctx context.Context, r *taskAPI.CreateTaskRequest) (_ *
 
 	s.containers[r.ID] = container
 
+	// a new container may have hot added vCPUs
+	s.updateHypervisorThreads()
+
+	if container.cType.IsSandbox() {
+		if err := startMetricsServer(s); err != nil {
+			logrus.WithError(err).WithField("sandbox", s.sandbox.ID()).Warn("Could not serve the sandbox metrics")
+		}
+	}
+
 	s.send(&eventstypes.TaskCreate{
 		ContainerID: r.ID,
 		Bundle:      r.Bundle,
@@ -435,6 +455,11 @@ func (s *service) Delete(ctx context.Context, r *taskAPI.DeleteRequest) (*taskAP
 				logrus.WithField("sandbox", s.sandbox.ID()).Error("failed to delete sandbox")
 				return nil, err
 			}
+
+			stopMetricsServer(s)
+			stopNetworkServer(s)
+		} else {
+			s.updateHypervisorThreads()
 		}
 
 		s.send(&eventstypes.TaskDelete{
@@ -708,7 +733,24 @@ func (s *service) CloseIO(ctx context.Context, r *taskAPI.CloseIORequest) (*ptyp
 
 // Checkpoint the container
 func (s *service) Checkpoint(ctx context.Context, r *taskAPI.CheckpointTaskRequest) (*ptypes.Empty, error) {
-	return nil, errdefs.ToGRPCf(errdefs.ErrNotImplemented, "service Checkpoint")
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, err := s.getContainer(r.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := checkpoint(ctx, s, c, r); err != nil {
+		return nil, errdefs.ToGRPC(err)
+	}
+
+	s.send(&eventstypes.TaskCheckpointed{
+		ContainerID: c.id,
+		Checkpoint:  r.Path,
+	})
+
+	return empty, nil
 }
 
 // Connect returns shim information such as the shim's pid
@@ -777,6 +819,8 @@ func (s *service) Update(ctx context.Context, r *taskAPI.UpdateTaskRequest) (*pt
 		return nil, errdefs.ToGRPC(err)
 	}
 
+	s.updateHypervisorThreads()
+
 	return empty, nil
 }
 
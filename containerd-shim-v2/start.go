@@ -25,28 +25,36 @@ func startContainer(ctx context.Context, s *service, c *container) error {
 		return err
 	}
 
-	if c.cType.IsSandbox() {
-		err := s.sandbox.Start()
-		if err != nil {
-			return err
+	// A container restored from a checkpoint is already running in the
+	// guest, only its IO streams need to be set up again.
+	if !c.restored {
+		if c.cType.IsSandbox() {
+			err := s.sandbox.Start()
+			if err != nil {
+				return err
+			}
+		} else {
+			_, err := s.sandbox.StartContainer(c.id)
+			if err != nil {
+				return err
+			}
 		}
-	} else {
-		_, err := s.sandbox.StartContainer(c.id)
+
+		// Run post-start OCI hooks.
+		err := katautils.EnterNetNS(s.sandbox.GetNetNs(), func() error {
+			return katautils.PostStartHooks(ctx, *c.spec, s.sandbox.ID(), c.bundle)
+		})
 		if err != nil {
 			return err
 		}
 	}
 
-	// Run post-start OCI hooks.
-	err := katautils.EnterNetNS(s.sandbox.GetNetNs(), func() error {
-		return katautils.PostStartHooks(ctx, *c.spec, s.sandbox.ID(), c.bundle)
-	})
-	if err != nil {
-		return err
-	}
-
 	c.status = task.StatusRunning
 
+	if c.cType.IsSandbox() {
+		startSandboxMonitor(s)
+	}
+
 	stdin, stdout, stderr, err := s.sandbox.IOStream(c.id, c.id)
 	if err != nil {
 		return err
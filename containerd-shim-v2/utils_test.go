@@ -21,6 +21,7 @@ import (
 	vc "github.com/kata-containers/runtime/virtcontainers"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/vcmock"
+	"github.com/kata-containers/runtime/virtcontainers/store"
 )
 
 const (
@@ -75,6 +76,9 @@ func init() {
 
 	fmt.Printf("INFO: test directory is %v\n", testDir)
 
+	store.RunMetricsStoragePath = filepath.Join(testDir, "metrics")
+	store.RunNetworkStoragePath = filepath.Join(testDir, "network")
+
 	fmt.Printf("INFO: ensuring docker is running\n")
 	output, err := katautils.RunCommandFull([]string{"docker", "version"}, true)
 	if err != nil {
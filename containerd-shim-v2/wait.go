@@ -41,26 +41,42 @@ func wait(s *service, c *container, execID string) (int32, error) {
 		}).Error("Wait for process failed")
 	}
 
-	if execID == "" {
-		c.exitCh <- uint32(ret)
-	} else {
-		execs.exitCh <- uint32(ret)
-	}
+	processExited(s, c, execID, ret, time.Now())
+
+	return ret, nil
+}
+
+// processExited records the exit of a container, or exec, process and
+// reports it, unless it has already been reported.
+func processExited(s *service, c *container, execID string, ret int32, timeStamp time.Time) {
+	var execs *exec
 
-	timeStamp := time.Now()
 	c.mu.Lock()
 	if execID == "" {
+		if c.status == task.StatusStopped {
+			c.mu.Unlock()
+			return
+		}
 		c.status = task.StatusStopped
 		c.exit = uint32(ret)
 		c.time = timeStamp
 	} else {
+		execs = c.execs[execID]
+		if execs == nil || execs.status == task.StatusStopped {
+			c.mu.Unlock()
+			return
+		}
 		execs.status = task.StatusStopped
 		execs.exitCode = ret
 		execs.exitTime = timeStamp
 	}
 	c.mu.Unlock()
 
-	go cReap(s, int(ret), c.id, execID, timeStamp)
+	if execID == "" {
+		c.exitCh <- uint32(ret)
+	} else {
+		execs.exitCh <- uint32(ret)
+	}
 
-	return ret, nil
+	go cReap(s, int(ret), c.id, execID, timeStamp)
 }
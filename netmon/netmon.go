@@ -21,8 +21,10 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/kata-containers/runtime/pkg/netapi"
 	"github.com/kata-containers/runtime/pkg/signals"
 	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
+	"github.com/safchain/ethtool"
 	"github.com/sirupsen/logrus"
 	lSyslog "github.com/sirupsen/logrus/hooks/syslog"
 	"github.com/vishvananda/netlink"
@@ -32,49 +34,135 @@ import (
 const (
 	netmonName = "kata-netmon"
 
-	kataCmd              = "kata-network"
-	kataCLIAddIfaceCmd   = "add-iface"
-	kataCLIDelIfaceCmd   = "del-iface"
-	kataCLIUpdtRoutesCmd = "update-routes"
+	kataCmd         = "kata-network"
+	kataCLIApplyCmd = "apply"
 
 	kataSuffix = "kata"
 
+	// physicalLinkType is the type of the links of the physical network
+	// interfaces.
+	physicalLinkType = "device"
+
+	// vfioDriver is the driver the runtime binds a physical network
+	// interface to, to pass it to the sandbox.
+	vfioDriver = "vfio-pci"
+
 	// sharedFile is the name of the file that will be used to share
 	// the data between this process and the kata-runtime process
 	// responsible for updating the network.
 	sharedFile      = "shared.json"
 	storageFilePerm = os.FileMode(0640)
 	storageDirPerm  = os.FileMode(0750)
+
+	// The events of a burst, received less than batchQuietDelay apart,
+	// are sent in a single batch of operations, at most batchMaxDelay
+	// after the first one.
+	batchQuietDelay = 50 * time.Millisecond
+	batchMaxDelay   = 500 * time.Millisecond
 )
 
 var (
 	// version is the netmon version. This variable is populated at build time.
 	version = "unknown"
 
-	// For simplicity the code will only focus on IPv4 addresses for now.
+	// For simplicity the code will only focus on IPv4 routes for now.
 	netlinkFamily = netlink.FAMILY_V4
 
+	// The interfaces are replicated with both their IPv4 and IPv6
+	// addresses.
+	addrFamily = netlink.FAMILY_ALL
+
 	storageParentPath = "/var/run/kata-containers/netmon/sbs"
+
+	sysPCIDevicesPath = "/sys/bus/pci/devices"
 )
 
 type netmonParams struct {
 	sandboxID   string
 	runtimePath string
+	apiSocket   string
 	debug       bool
 	logLevel    string
 }
 
+// netIface is an interface of the network namespace, as replicated into
+// the sandbox, along with the current flags of its link.
+type netIface struct {
+	vcTypes.Interface
+
+	flags uint32
+
+	// bdf is the PCI address of a physical interface.
+	bdf string
+}
+
+// ignored tells if the changes of the interface are not replicated, as for
+// the loopback and the interfaces created by Kata Containers.
+func (iface netIface) ignored() bool {
+	return iface.flags&unix.IFF_LOOPBACK != 0 || strings.HasSuffix(iface.Name, kataSuffix)
+}
+
+// pciAddress returns the PCI address of the link, if physical.
+func pciAddress(linkAttrs *netlink.LinkAttrs, linkType string) string {
+	if linkType != physicalLinkType || linkAttrs.RawFlags&unix.IFF_LOOPBACK != 0 {
+		return ""
+	}
+
+	ethHandle, err := ethtool.NewEthtool()
+	if err != nil {
+		netmonLog.WithError(err).Warn("Could not get an ethtool handle")
+		return ""
+	}
+	defer ethHandle.Close()
+
+	bdf, err := ethHandle.BusInfo(linkAttrs.Name)
+	if err != nil {
+		netmonLog.WithError(err).WithField("interface", linkAttrs.Name).Warn("Could not get the PCI address")
+		return ""
+	}
+
+	return bdf
+}
+
+// boundToVFIO tells if the physical interface left the network namespace as
+// the runtime bound it to VFIO, rather than being removed.
+func (iface netIface) boundToVFIO() bool {
+	if iface.bdf == "" {
+		return false
+	}
+
+	driver, err := os.Readlink(filepath.Join(sysPCIDevicesPath, iface.bdf, "driver"))
+	if err != nil {
+		return false
+	}
+
+	return filepath.Base(driver) == vfioDriver
+}
+
+func isUpAndRunning(flags uint32) bool {
+	return flags&(unix.IFF_UP|unix.IFF_RUNNING) == unix.IFF_UP|unix.IFF_RUNNING
+}
+
 type netmon struct {
 	netmonParams
 
 	storagePath string
 	sharedFile  string
 
-	netIfaces map[int]vcTypes.Interface
+	netIfaces map[int]netIface
+
+	// The operations to send in the next batch.
+	pendingOps    []netapi.Operation
+	routesChanged bool
+
+	apiClient *netapi.Client
 
 	linkUpdateCh chan netlink.LinkUpdate
 	linkDoneCh   chan struct{}
 
+	addrUpdateCh chan netlink.AddrUpdate
+	addrDoneCh   chan struct{}
+
 	rtUpdateCh chan netlink.RouteUpdate
 	rtDoneCh   chan struct{}
 
@@ -89,9 +177,9 @@ func printVersion() {
 
 const componentDescription = `is a network monitoring process that is intended to be started in the
 appropriate network namespace so that it can listen to any event related to
-link and routes. Whenever a new interface or route is created/updated, it is
-responsible for calling into the kata-runtime CLI to ask for the actual
-creation/update of the given interface or route.
+link, addresses and routes. Whenever a new interface or route is created/updated, it is
+responsible for asking the runtime, through its network API socket or its
+CLI, for the actual creation/update of the given interface or route.
 `
 
 func printComponentDescription() {
@@ -109,7 +197,8 @@ func parseOptions() netmonParams {
 	flag.BoolVar(&version, "v", false, "display program version and exit")
 	flag.BoolVar(&version, "version", false, "")
 	flag.StringVar(&params.sandboxID, "s", "", "sandbox id (required)")
-	flag.StringVar(&params.runtimePath, "r", "", "runtime path (required)")
+	flag.StringVar(&params.runtimePath, "r", "", "runtime path (required without -a)")
+	flag.StringVar(&params.apiSocket, "a", "", "runtime network API socket")
 	flag.StringVar(&params.logLevel, "log", "warn",
 		"log messages above specified level: debug, warn, error, fatal or panic")
 
@@ -132,8 +221,8 @@ func parseOptions() netmonParams {
 		os.Exit(1)
 	}
 
-	if params.runtimePath == "" {
-		fmt.Fprintf(os.Stderr, "Error: runtime path is empty, one must be provided\n")
+	if params.runtimePath == "" && params.apiSocket == "" {
+		fmt.Fprintf(os.Stderr, "Error: runtime path and API socket are empty, one must be provided\n")
 		flag.PrintDefaults()
 		os.Exit(1)
 	}
@@ -151,14 +240,20 @@ func newNetmon(params netmonParams) (*netmon, error) {
 		netmonParams: params,
 		storagePath:  filepath.Join(storageParentPath, params.sandboxID),
 		sharedFile:   filepath.Join(storageParentPath, params.sandboxID, sharedFile),
-		netIfaces:    make(map[int]vcTypes.Interface),
+		netIfaces:    make(map[int]netIface),
 		linkUpdateCh: make(chan netlink.LinkUpdate),
 		linkDoneCh:   make(chan struct{}),
+		addrUpdateCh: make(chan netlink.AddrUpdate),
+		addrDoneCh:   make(chan struct{}),
 		rtUpdateCh:   make(chan netlink.RouteUpdate),
 		rtDoneCh:     make(chan struct{}),
 		netHandler:   handler,
 	}
 
+	if params.apiSocket != "" {
+		n.apiClient = netapi.NewClient(params.apiSocket)
+	}
+
 	if err := os.MkdirAll(n.storagePath, storageDirPerm); err != nil {
 		return nil, err
 	}
@@ -170,6 +265,7 @@ func (n *netmon) cleanup() {
 	os.RemoveAll(n.storagePath)
 	n.netHandler.Delete()
 	close(n.linkDoneCh)
+	close(n.addrDoneCh)
 	close(n.rtDoneCh)
 }
 
@@ -239,6 +335,7 @@ func (n *netmon) setupLogger() error {
 
 	announceFields := logrus.Fields{
 		"runtime-path": n.runtimePath,
+		"api-socket":   n.apiSocket,
 		"debug":        n.debug,
 		"log-level":    n.logLevel,
 	}
@@ -253,9 +350,35 @@ func (n *netmon) listenNetlinkEvents() error {
 		return err
 	}
 
+	if err := netlink.AddrSubscribe(n.addrUpdateCh, n.addrDoneCh); err != nil {
+		return err
+	}
+
 	return netlink.RouteSubscribe(n.rtUpdateCh, n.rtDoneCh)
 }
 
+// convertAddress converts an IP address as defined by netlink package, into
+// the IPAddress structure format expected by kata-runtime. It returns nil
+// for the IPv6 link-local addresses, which the guest generates itself.
+func convertAddress(ipNet net.IPNet) *vcTypes.IPAddress {
+	if ipNet.IP.To4() == nil && ipNet.IP.IsLinkLocalUnicast() {
+		return nil
+	}
+
+	family := netlink.FAMILY_V4
+	if ipNet.IP.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+
+	netMask, _ := ipNet.Mask.Size()
+
+	return &vcTypes.IPAddress{
+		Family:  family,
+		Address: ipNet.IP.String(),
+		Mask:    fmt.Sprintf("%d", netMask),
+	}
+}
+
 // convertInterface converts a link and its IP addresses as defined by netlink
 // package, into the Interface structure format expected by kata-runtime to
 // describe an interface and its associated IP addresses.
@@ -272,15 +395,9 @@ func convertInterface(linkAttrs *netlink.LinkAttrs, linkType string, addrs []net
 			continue
 		}
 
-		netMask, _ := addr.Mask.Size()
-
-		ipAddr := &vcTypes.IPAddress{
-			Family:  netlinkFamily,
-			Address: addr.IP.String(),
-			Mask:    fmt.Sprintf("%d", netMask),
+		if ipAddr := convertAddress(*addr.IPNet); ipAddr != nil {
+			ipAddrs = append(ipAddrs, ipAddr)
 		}
-
-		ipAddrs = append(ipAddrs, ipAddr)
 	}
 
 	iface := vcTypes.Interface{
@@ -360,7 +477,7 @@ func (n *netmon) scanNetwork() error {
 	}
 
 	for _, link := range links {
-		addrs, err := n.netHandler.AddrList(link, netlinkFamily)
+		addrs, err := n.netHandler.AddrList(link, addrFamily)
 		if err != nil {
 			return err
 		}
@@ -370,8 +487,11 @@ func (n *netmon) scanNetwork() error {
 			continue
 		}
 
-		iface := convertInterface(linkAttrs, link.Type(), addrs)
-		n.netIfaces[linkAttrs.Index] = iface
+		n.netIfaces[linkAttrs.Index] = netIface{
+			Interface: convertInterface(linkAttrs, link.Type(), addrs),
+			flags:     linkAttrs.RawFlags,
+			bdf:       pciAddress(linkAttrs, link.Type()),
+		}
 	}
 
 	n.logger().Debug("Network scanned")
@@ -407,51 +527,187 @@ func (n *netmon) execKataCmd(subCmd string) error {
 	return os.Remove(n.sharedFile)
 }
 
-func (n *netmon) addInterfaceCLI(iface vcTypes.Interface) error {
-	if err := n.storeDataToSend(iface); err != nil {
+// applyCLI applies the operations through the runtime CLI.
+func (n *netmon) applyCLI(ops []netapi.Operation) error {
+	if err := n.storeDataToSend(ops); err != nil {
 		return err
 	}
 
-	return n.execKataCmd(kataCLIAddIfaceCmd)
+	return n.execKataCmd(kataCLIApplyCmd)
 }
 
-func (n *netmon) delInterfaceCLI(iface vcTypes.Interface) error {
-	if err := n.storeDataToSend(iface); err != nil {
-		return err
+// apply applies the operations through the runtime network API if it is
+// served, and through the runtime CLI otherwise.
+func (n *netmon) apply(ops []netapi.Operation) error {
+	if n.apiClient == nil {
+		return n.applyCLI(ops)
 	}
 
-	return n.execKataCmd(kataCLIDelIfaceCmd)
+	_, err := n.apiClient.Apply(ops)
+	return err
 }
 
-func (n *netmon) updateRoutesCLI(routes []vcTypes.Route) error {
-	if err := n.storeDataToSend(routes); err != nil {
-		return err
-	}
-
-	return n.execKataCmd(kataCLIUpdtRoutesCmd)
+// addOperation adds an operation to the next batch.
+func (n *netmon) addOperation(op string, iface vcTypes.Interface) {
+	n.pendingOps = append(n.pendingOps, netapi.Operation{
+		Op:        op,
+		Interface: &iface,
+	})
 }
 
-func (n *netmon) updateRoutes() error {
+// updateRoutesOperation returns the operation updating the routes to the
+// current ones.
+func (n *netmon) updateRoutesOperation() (netapi.Operation, error) {
 	// Get all the routes.
 	netlinkRoutes, err := n.netHandler.RouteList(nil, netlinkFamily)
 	if err != nil {
-		return err
+		return netapi.Operation{}, err
 	}
 
 	// Translate them into Route structures.
-	routes := convertRoutes(netlinkRoutes)
+	var routes []*vcTypes.Route
+	for _, route := range convertRoutes(netlinkRoutes) {
+		r := route
+		routes = append(routes, &r)
+	}
+
+	return netapi.Operation{
+		Op:     netapi.UpdateRoutes,
+		Routes: routes,
+	}, nil
+}
+
+// flush sends the operations of the batch, followed by the update of the
+// routes when they changed.
+func (n *netmon) flush() error {
+	ops := n.pendingOps
+
+	if n.routesChanged {
+		op, err := n.updateRoutesOperation()
+		if err != nil {
+			return err
+		}
+
+		ops = append(ops, op)
+	}
+
+	n.pendingOps = nil
+	n.routesChanged = false
+
+	if len(ops) == 0 {
+		return nil
+	}
+
+	n.logger().WithField("operations", len(ops)).Debug("Sending network operations")
+
+	return n.apply(ops)
+}
+
+// updateInterface records the new state of the interface of index, and
+// updates it with the next batch. An operation of the batch already adding
+// or updating the interface sends it as a whole, and is updated instead.
+func (n *netmon) updateInterface(index int, iface netIface) {
+	n.netIfaces[index] = iface
+
+	for i := len(n.pendingOps) - 1; i >= 0; i-- {
+		op := n.pendingOps[i]
+		if op.Interface == nil || op.Interface.Name != iface.Name ||
+			op.Interface.HwAddr != iface.HwAddr {
+			continue
+		}
+
+		if op.Op == netapi.AddInterface || op.Op == netapi.UpdateInterface {
+			inf := iface.Interface
+			n.pendingOps[i].Interface = &inf
+			return
+		}
+
+		break
+	}
+
+	n.addOperation(netapi.UpdateInterface, iface.Interface)
+
+	// Updating the addresses can drop the routes using them.
+	n.routesChanged = true
+}
+
+func (n *netmon) handleRTMNewAddr(ev netlink.AddrUpdate) error {
+	iface, exist := n.netIfaces[ev.LinkIndex]
+	if !exist || iface.ignored() {
+		n.logger().Debugf("Ignoring address %s of interface %d",
+			ev.LinkAddress.String(), ev.LinkIndex)
+		return nil
+	}
 
-	// Update the routes through the Kata CLI.
-	return n.updateRoutesCLI(routes)
+	addr := convertAddress(ev.LinkAddress)
+	if addr == nil {
+		return nil
+	}
+
+	for _, ipAddr := range iface.IPAddresses {
+		if ipAddr.Address == addr.Address && ipAddr.Mask == addr.Mask {
+			return nil
+		}
+	}
+
+	// The replicated state is never modified in place, it can be
+	// referenced by a pending operation.
+	ipAddrs := make([]*vcTypes.IPAddress, 0, len(iface.IPAddresses)+1)
+	iface.IPAddresses = append(append(ipAddrs, iface.IPAddresses...), addr)
+
+	n.updateInterface(ev.LinkIndex, iface)
+
+	return nil
 }
 
-func (n *netmon) handleRTMNewAddr(ev netlink.LinkUpdate) error {
-	n.logger().Debug("Interface update not supported")
+func (n *netmon) handleRTMDelAddr(ev netlink.AddrUpdate) error {
+	iface, exist := n.netIfaces[ev.LinkIndex]
+	if !exist || iface.ignored() {
+		n.logger().Debugf("Ignoring address %s of interface %d",
+			ev.LinkAddress.String(), ev.LinkIndex)
+		return nil
+	}
+
+	addr := convertAddress(ev.LinkAddress)
+	if addr == nil {
+		return nil
+	}
+
+	var ipAddrs []*vcTypes.IPAddress
+	for _, ipAddr := range iface.IPAddresses {
+		if ipAddr.Address != addr.Address || ipAddr.Mask != addr.Mask {
+			ipAddrs = append(ipAddrs, ipAddr)
+		}
+	}
+
+	if len(ipAddrs) == len(iface.IPAddresses) {
+		return nil
+	}
+
+	iface.IPAddresses = ipAddrs
+
+	n.updateInterface(ev.LinkIndex, iface)
+
 	return nil
 }
 
-func (n *netmon) handleRTMDelAddr(ev netlink.LinkUpdate) error {
-	n.logger().Debug("Interface update not supported")
+// handleLinkChange handles the change of a link already in the internal
+// list. Its MTU is updated once the link is UP and RUNNING, as the link
+// is not expected to change further then.
+func (n *netmon) handleLinkChange(ev netlink.LinkUpdate, iface netIface) error {
+	linkAttrs := ev.Link.Attrs()
+
+	iface.flags = ev.Flags
+
+	if iface.ignored() || !isUpAndRunning(ev.Flags) || uint64(linkAttrs.MTU) == iface.Mtu {
+		n.netIfaces[linkAttrs.Index] = iface
+		return nil
+	}
+
+	iface.Mtu = uint64(linkAttrs.MTU)
+
+	n.updateInterface(linkAttrs.Index, iface)
+
 	return nil
 }
 
@@ -476,23 +732,21 @@ func (n *netmon) handleRTMNewLink(ev netlink.LinkUpdate) error {
 		return nil
 	}
 
-	// Check if the interface exist in the internal list.
-	if _, exist := n.netIfaces[int(ev.Index)]; exist {
-		n.logger().Debugf("Ignoring interface %s because already exist",
-			linkAttrs.Name)
-		return nil
+	// Check if the interface exist in the internal list, in which case
+	// this is a change of the interface.
+	if iface, exist := n.netIfaces[int(ev.Index)]; exist {
+		return n.handleLinkChange(ev, iface)
 	}
 
 	// Now, check if the interface has been enabled to UP and RUNNING.
-	if (ev.Flags&unix.IFF_UP) != unix.IFF_UP ||
-		(ev.Flags&unix.IFF_RUNNING) != unix.IFF_RUNNING {
+	if !isUpAndRunning(ev.Flags) {
 		n.logger().Debugf("Ignore the interface %s because not UP and RUNNING",
 			linkAttrs.Name)
 		return nil
 	}
 
 	// Get the list of IP addresses associated with this interface.
-	addrs, err := n.netHandler.AddrList(ev.Link, netlinkFamily)
+	addrs, err := n.netHandler.AddrList(ev.Link, addrFamily)
 	if err != nil {
 		return err
 	}
@@ -500,16 +754,20 @@ func (n *netmon) handleRTMNewLink(ev netlink.LinkUpdate) error {
 	// Convert the interfaces in the appropriate structure format.
 	iface := convertInterface(linkAttrs, ev.Link.Type(), addrs)
 
-	// Add the interface through the Kata CLI.
-	if err := n.addInterfaceCLI(iface); err != nil {
-		return err
-	}
+	// Add the interface, with the next batch.
+	n.addOperation(netapi.AddInterface, iface)
 
 	// Add the interface to the internal list.
-	n.netIfaces[linkAttrs.Index] = iface
+	n.netIfaces[linkAttrs.Index] = netIface{
+		Interface: iface,
+		flags:     ev.Flags,
+		bdf:       pciAddress(linkAttrs, ev.Link.Type()),
+	}
 
 	// Complete by updating the routes.
-	return n.updateRoutes()
+	n.routesChanged = true
+
+	return nil
 }
 
 func (n *netmon) handleRTMDelLink(ev netlink.LinkUpdate) error {
@@ -537,19 +795,28 @@ func (n *netmon) handleRTMDelLink(ev netlink.LinkUpdate) error {
 		return nil
 	}
 
-	if err := n.delInterfaceCLI(iface); err != nil {
-		return err
-	}
-
 	// Delete the interface from the internal list.
 	delete(n.netIfaces, linkAttrs.Index)
 
+	// A physical interface leaves the network namespace when the runtime
+	// binds it to VFIO, to pass it to the sandbox, and must not be
+	// removed from the sandbox then.
+	if iface.boundToVFIO() {
+		n.logger().Debugf("Not removing physical interface %s, bound to VFIO",
+			linkAttrs.Name)
+		return nil
+	}
+
+	n.addOperation(netapi.RemoveInterface, iface.Interface)
+
 	// Complete by updating the routes.
-	return n.updateRoutes()
+	n.routesChanged = true
+
+	return nil
 }
 
 func (n *netmon) handleRTMNewRoute(ev netlink.RouteUpdate) error {
-	// Add the route through updateRoutes(), only if the route refer to an
+	// Add the route by updating the routes, only if the route refer to an
 	// interface that already exists in the internal list of interfaces.
 	if _, exist := n.netIfaces[ev.Route.LinkIndex]; !exist {
 		n.logger().Debugf("Ignoring route %+v since interface %d not found",
@@ -557,13 +824,16 @@ func (n *netmon) handleRTMNewRoute(ev netlink.RouteUpdate) error {
 		return nil
 	}
 
-	return n.updateRoutes()
+	n.routesChanged = true
+
+	return nil
 }
 
 func (n *netmon) handleRTMDelRoute(ev netlink.RouteUpdate) error {
-	// Remove the route through updateRoutes(), only if the route refer to
-	// an interface that already exists in the internal list of interfaces.
-	return n.updateRoutes()
+	// Remove the route by updating the routes.
+	n.routesChanged = true
+
+	return nil
 }
 
 func (n *netmon) handleLinkEvent(ev netlink.LinkUpdate) error {
@@ -576,12 +846,6 @@ func (n *netmon) handleLinkEvent(ev netlink.LinkUpdate) error {
 	case unix.NLMSG_ERROR:
 		n.logger().Error("NLMSG_ERROR")
 		return fmt.Errorf("Error while listening on netlink socket")
-	case unix.RTM_NEWADDR:
-		n.logger().Debug("RTM_NEWADDR")
-		return n.handleRTMNewAddr(ev)
-	case unix.RTM_DELADDR:
-		n.logger().Debug("RTM_DELADDR")
-		return n.handleRTMDelAddr(ev)
 	case unix.RTM_NEWLINK:
 		n.logger().Debug("RTM_NEWLINK")
 		return n.handleRTMNewLink(ev)
@@ -595,6 +859,18 @@ func (n *netmon) handleLinkEvent(ev netlink.LinkUpdate) error {
 	return nil
 }
 
+func (n *netmon) handleAddrEvent(ev netlink.AddrUpdate) error {
+	n.logger().Debug("handleAddrEvent: netlink event received")
+
+	if ev.NewAddr {
+		n.logger().Debug("RTM_NEWADDR")
+		return n.handleRTMNewAddr(ev)
+	}
+
+	n.logger().Debug("RTM_DELADDR")
+	return n.handleRTMDelAddr(ev)
+}
+
 func (n *netmon) handleRouteEvent(ev netlink.RouteUpdate) error {
 	n.logger().Debug("handleRouteEvent: netlink event received")
 
@@ -612,17 +888,52 @@ func (n *netmon) handleRouteEvent(ev netlink.RouteUpdate) error {
 	return nil
 }
 
-func (n *netmon) handleEvents() (err error) {
+// handleNextEvent handles the next event, and returns false if none was
+// received before timeout.
+func (n *netmon) handleNextEvent(timeout <-chan time.Time) (bool, error) {
+	select {
+	case ev := <-n.linkUpdateCh:
+		return true, n.handleLinkEvent(ev)
+	case ev := <-n.addrUpdateCh:
+		return true, n.handleAddrEvent(ev)
+	case ev := <-n.rtUpdateCh:
+		return true, n.handleRouteEvent(ev)
+	case <-timeout:
+		return false, nil
+	}
+}
+
+// handleBurst handles the events of a burst, starting with the next one.
+func (n *netmon) handleBurst() error {
+	// Wait for the first event of the burst.
+	if _, err := n.handleNextEvent(nil); err != nil {
+		return err
+	}
+
+	deadline := time.After(batchMaxDelay)
+
 	for {
 		select {
-		case ev := <-n.linkUpdateCh:
-			if err = n.handleLinkEvent(ev); err != nil {
-				return err
-			}
-		case ev := <-n.rtUpdateCh:
-			if err = n.handleRouteEvent(ev); err != nil {
-				return err
-			}
+		case <-deadline:
+			return nil
+		default:
+		}
+
+		received, err := n.handleNextEvent(time.After(batchQuietDelay))
+		if err != nil || !received {
+			return err
+		}
+	}
+}
+
+func (n *netmon) handleEvents() (err error) {
+	for {
+		if err = n.handleBurst(); err != nil {
+			return err
+		}
+
+		if err = n.flush(); err != nil {
+			return err
 		}
 	}
 }
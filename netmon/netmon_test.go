@@ -9,6 +9,7 @@ import (
 	"encoding/json"
 	"io/ioutil"
 	"net"
+	"net/http"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -16,10 +17,12 @@ import (
 	"runtime"
 	"testing"
 
+	"github.com/kata-containers/runtime/pkg/netapi"
 	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netlink/nl"
 	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
 )
@@ -116,6 +119,7 @@ func TestCleanup(t *testing.T) {
 	n := &netmon{
 		storagePath: filepath.Join(storageParentPath, testSandboxID),
 		linkDoneCh:  make(chan struct{}),
+		addrDoneCh:  make(chan struct{}),
 		rtDoneCh:    make(chan struct{}),
 		netHandler:  handler,
 	}
@@ -131,6 +135,8 @@ func TestCleanup(t *testing.T) {
 	assert.NotNil(t, err)
 	_, ok := (<-n.linkDoneCh)
 	assert.False(t, ok)
+	_, ok = (<-n.addrDoneCh)
+	assert.False(t, ok)
 	_, ok = (<-n.rtDoneCh)
 	assert.False(t, ok)
 }
@@ -289,14 +295,14 @@ func TestScanNetwork(t *testing.T) {
 	idx, expected := testCreateDummyNetwork(t, handler)
 
 	n := &netmon{
-		netIfaces:  make(map[int]vcTypes.Interface),
+		netIfaces:  make(map[int]netIface),
 		netHandler: handler,
 	}
 
 	err = n.scanNetwork()
 	assert.Nil(t, err)
-	assert.True(t, reflect.DeepEqual(expected, n.netIfaces[idx]),
-		"Got %+v\nExpected %+v", n.netIfaces[idx], expected)
+	assert.True(t, reflect.DeepEqual(expected, n.netIfaces[idx].Interface),
+		"Got %+v\nExpected %+v", n.netIfaces[idx].Interface, expected)
 }
 
 func TestStoreDataToSend(t *testing.T) {
@@ -398,16 +404,12 @@ func TestActionsCLI(t *testing.T) {
 	assert.Nil(t, err)
 	defer os.RemoveAll(testStorageParentPath)
 
-	// Test addInterfaceCLI
-	err = n.addInterfaceCLI(vcTypes.Interface{})
-	assert.Nil(t, err)
-
-	// Test delInterfaceCLI
-	err = n.delInterfaceCLI(vcTypes.Interface{})
+	// Test applyCLI
+	err = n.applyCLI([]netapi.Operation{})
 	assert.Nil(t, err)
 
-	// Test updateRoutesCLI
-	err = n.updateRoutesCLI([]vcTypes.Route{})
+	// Test apply, without API socket
+	err = n.apply([]netapi.Operation{{Op: netapi.AddInterface, Interface: &vcTypes.Interface{}}})
 	assert.Nil(t, err)
 
 	tearDownNetworkCb := testSetupNetwork(t)
@@ -420,27 +422,362 @@ func TestActionsCLI(t *testing.T) {
 
 	n.netHandler = handler
 
-	// Test updateRoutes
-	err = n.updateRoutes()
-	assert.Nil(t, err)
-
 	// Test handleRTMDelRoute
 	err = n.handleRTMDelRoute(netlink.RouteUpdate{})
 	assert.Nil(t, err)
+	assert.True(t, n.routesChanged)
+
+	// Test flush, updating the routes
+	err = n.flush()
+	assert.Nil(t, err)
+	assert.False(t, n.routesChanged)
+}
+
+type testNetworkSandbox struct {
+	batches int
+	ops     []string
+}
+
+func (s *testNetworkSandbox) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	s.ops = append(s.ops, netapi.AddInterface+" "+inf.Name)
+	return inf, nil
+}
+
+func (s *testNetworkSandbox) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	s.ops = append(s.ops, netapi.RemoveInterface+" "+inf.Name)
+	return inf, nil
+}
+
+func (s *testNetworkSandbox) UpdateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	s.ops = append(s.ops, netapi.UpdateInterface+" "+inf.Name)
+	return inf, nil
+}
+
+func (s *testNetworkSandbox) UpdateBandwidth(bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	s.ops = append(s.ops, netapi.UpdateBandwidth)
+	return bw, nil
+}
+
+func (s *testNetworkSandbox) UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+	s.ops = append(s.ops, netapi.UpdateRoutes)
+	return routes, nil
+}
+
+func TestApplyAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "netmon-api-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "network.sock")
+	listener, err := net.Listen("unix", socketPath)
+	assert.Nil(t, err)
+	defer listener.Close()
+
+	sandbox := &testNetworkSandbox{}
+	go http.Serve(listener, netapi.NewHandler(func() netapi.Sandbox {
+		sandbox.batches++
+		return sandbox
+	}))
+
+	n := &netmon{
+		netmonParams: netmonParams{
+			apiSocket: socketPath,
+		},
+		apiClient: netapi.NewClient(socketPath),
+	}
+
+	// Nothing to send
+	err = n.flush()
+	assert.Nil(t, err)
+	assert.Zero(t, sandbox.batches)
+
+	n.addOperation(netapi.AddInterface, vcTypes.Interface{Name: "eth1"})
+	n.addOperation(netapi.RemoveInterface, vcTypes.Interface{Name: "eth2"})
+
+	err = n.flush()
+	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
+	assert.Equal(t, 1, sandbox.batches)
+	assert.Equal(t, []string{"AddInterface eth1", "RemoveInterface eth2"}, sandbox.ops)
+}
+
+func TestHandleBurst(t *testing.T) {
+	n := &netmon{
+		netIfaces:    make(map[int]netIface),
+		linkUpdateCh: make(chan netlink.LinkUpdate),
+		rtUpdateCh:   make(chan netlink.RouteUpdate),
+	}
+
+	sent := make(chan struct{})
+	go func() {
+		ev := netlink.RouteUpdate{Type: unix.RTM_DELROUTE}
+		for i := 0; i < 3; i++ {
+			n.rtUpdateCh <- ev
+		}
+		n.linkUpdateCh <- netlink.LinkUpdate{}
+		close(sent)
+	}()
+
+	err := n.handleBurst()
+	assert.Nil(t, err)
+	assert.True(t, n.routesChanged)
+
+	select {
+	case <-sent:
+	default:
+		t.Fatal("The events of the burst were not all handled")
+	}
+}
+
+func testAddrUpdate(t *testing.T, addr string, newAddr bool) netlink.AddrUpdate {
+	ip, ipNet, err := net.ParseCIDR(addr)
+	assert.Nil(t, err)
+	ipNet.IP = ip
+
+	return netlink.AddrUpdate{
+		LinkAddress: *ipNet,
+		LinkIndex:   testIfaceIndex,
+		NewAddr:     newAddr,
+	}
+}
+
+func testLinkUpdate(mtu int, flags uint32) netlink.LinkUpdate {
+	ev := netlink.LinkUpdate{
+		Link: &netlink.Dummy{
+			LinkAttrs: netlink.LinkAttrs{
+				Index: testIfaceIndex,
+				Name:  testIfaceName,
+				MTU:   mtu,
+			},
+		},
+	}
+	ev.Header.Type = unix.RTM_NEWLINK
+	ev.Index = testIfaceIndex
+	ev.Flags = flags
+
+	return ev
+}
+
+func testNetmonWithIface() *netmon {
+	n := &netmon{
+		netIfaces: make(map[int]netIface),
+	}
+
+	n.netIfaces[testIfaceIndex] = netIface{
+		Interface: vcTypes.Interface{
+			Name:   testIfaceName,
+			HwAddr: testHwAddr,
+			Mtu:    1500,
+			IPAddresses: []*vcTypes.IPAddress{
+				{Family: netlink.FAMILY_V4, Address: testIPAddress, Mask: "24"},
+			},
+		},
+		flags: unix.IFF_UP | unix.IFF_RUNNING,
+	}
+
+	return n
+}
+
+func TestConvertAddress(t *testing.T) {
+	_, ipNet, err := net.ParseCIDR("fd00::2/64")
+	assert.Nil(t, err)
+	ipNet.IP = net.ParseIP("fd00::2")
+
+	addr := convertAddress(*ipNet)
+	assert.Equal(t, &vcTypes.IPAddress{Family: netlink.FAMILY_V6, Address: "fd00::2", Mask: "64"}, addr)
+
+	// IPv6 link-local addresses are not replicated
+	ipNet.IP = net.ParseIP("fe80::1")
+	assert.Nil(t, convertAddress(*ipNet))
 }
 
 func TestHandleRTMNewAddr(t *testing.T) {
-	n := &netmon{}
+	n := testNetmonWithIface()
 
-	err := n.handleRTMNewAddr(netlink.LinkUpdate{})
+	// Unknown interface
+	ev := testAddrUpdate(t, "10.0.0.2/8", true)
+	ev.LinkIndex = testIfaceIndex + 1
+	err := n.handleRTMNewAddr(ev)
 	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
+
+	// Address already replicated
+	err = n.handleRTMNewAddr(testAddrUpdate(t, testIPAddress+"/24", true))
+	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
+
+	// IPv6 link-local address
+	err = n.handleRTMNewAddr(testAddrUpdate(t, "fe80::1/64", true))
+	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
+
+	err = n.handleRTMNewAddr(testAddrUpdate(t, "10.0.0.2/8", true))
+	assert.Nil(t, err)
+	assert.Len(t, n.pendingOps, 1)
+	assert.Equal(t, netapi.UpdateInterface, n.pendingOps[0].Op)
+	assert.Len(t, n.pendingOps[0].Interface.IPAddresses, 2)
+	assert.Equal(t, "10.0.0.2", n.pendingOps[0].Interface.IPAddresses[1].Address)
+	assert.Len(t, n.netIfaces[testIfaceIndex].IPAddresses, 2)
+	assert.True(t, n.routesChanged)
 }
 
 func TestHandleRTMDelAddr(t *testing.T) {
-	n := &netmon{}
+	n := testNetmonWithIface()
+
+	// Address not replicated
+	err := n.handleRTMDelAddr(testAddrUpdate(t, "10.0.0.2/8", false))
+	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
 
-	err := n.handleRTMDelAddr(netlink.LinkUpdate{})
+	err = n.handleRTMDelAddr(testAddrUpdate(t, testIPAddress+"/24", false))
 	assert.Nil(t, err)
+	assert.Len(t, n.pendingOps, 1)
+	assert.Equal(t, netapi.UpdateInterface, n.pendingOps[0].Op)
+	assert.Empty(t, n.pendingOps[0].Interface.IPAddresses)
+	assert.Empty(t, n.netIfaces[testIfaceIndex].IPAddresses)
+}
+
+func TestHandleLinkChange(t *testing.T) {
+	n := testNetmonWithIface()
+
+	// Same MTU
+	err := n.handleRTMNewLink(testLinkUpdate(1500, unix.IFF_UP|unix.IFF_RUNNING))
+	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
+
+	// The MTU changes while the link is down
+	err = n.handleRTMNewLink(testLinkUpdate(9000, 0))
+	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
+	assert.Equal(t, uint32(0), n.netIfaces[testIfaceIndex].flags)
+
+	// The link is back up
+	err = n.handleRTMNewLink(testLinkUpdate(9000, unix.IFF_UP|unix.IFF_RUNNING))
+	assert.Nil(t, err)
+	assert.Len(t, n.pendingOps, 1)
+	assert.Equal(t, netapi.UpdateInterface, n.pendingOps[0].Op)
+	assert.Equal(t, uint64(9000), n.pendingOps[0].Interface.Mtu)
+	assert.Equal(t, uint64(9000), n.netIfaces[testIfaceIndex].Mtu)
+
+	// Loopback changes are not replicated
+	n = testNetmonWithIface()
+	err = n.handleRTMNewLink(testLinkUpdate(9000, unix.IFF_UP|unix.IFF_RUNNING|unix.IFF_LOOPBACK))
+	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
+}
+
+// TestReplayUpdates replays sequences of netlink updates, and checks the
+// operations of the resulting batch.
+func TestReplayUpdates(t *testing.T) {
+	type testData struct {
+		name      string
+		updates   []interface{}
+		ops       []string
+		addresses []string
+		mtu       uint64
+	}
+
+	up := uint32(unix.IFF_UP | unix.IFF_RUNNING)
+
+	data := []testData{
+		{
+			name: "Second address",
+			updates: []interface{}{
+				testAddrUpdate(t, "10.0.0.2/8", true),
+			},
+			ops:       []string{"UpdateInterface"},
+			addresses: []string{testIPAddress + "/24", "10.0.0.2/8"},
+			mtu:       1500,
+		},
+		{
+			name: "Move to IPv6",
+			updates: []interface{}{
+				testAddrUpdate(t, "fd00::2/64", true),
+				testAddrUpdate(t, "fe80::2/64", true),
+				testAddrUpdate(t, testIPAddress+"/24", false),
+			},
+			ops:       []string{"UpdateInterface"},
+			addresses: []string{"fd00::2/64"},
+			mtu:       1500,
+		},
+		{
+			name: "MTU changed while down",
+			updates: []interface{}{
+				testLinkUpdate(1500, 0),
+				testLinkUpdate(1400, 0),
+				testLinkUpdate(1400, up),
+			},
+			ops:       []string{"UpdateInterface"},
+			addresses: []string{testIPAddress + "/24"},
+			mtu:       1400,
+		},
+		{
+			name: "Address added and removed",
+			updates: []interface{}{
+				testAddrUpdate(t, "10.0.0.2/8", true),
+				testAddrUpdate(t, "10.0.0.2/8", false),
+			},
+			ops:       []string{"UpdateInterface"},
+			addresses: []string{testIPAddress + "/24"},
+			mtu:       1500,
+		},
+		{
+			name: "Interface removed",
+			updates: []interface{}{
+				testAddrUpdate(t, "10.0.0.2/8", true),
+				netlink.LinkUpdate{
+					Header: unix.NlMsghdr{Type: unix.RTM_DELLINK},
+					IfInfomsg: nl.IfInfomsg{
+						IfInfomsg: unix.IfInfomsg{Index: testIfaceIndex},
+					},
+					Link: &netlink.Dummy{
+						LinkAttrs: netlink.LinkAttrs{Index: testIfaceIndex, Name: testIfaceName},
+					},
+				},
+			},
+			ops: []string{"UpdateInterface", "RemoveInterface"},
+		},
+	}
+
+	for _, d := range data {
+		n := testNetmonWithIface()
+
+		for _, update := range d.updates {
+			var err error
+
+			switch ev := update.(type) {
+			case netlink.AddrUpdate:
+				err = n.handleAddrEvent(ev)
+			case netlink.LinkUpdate:
+				err = n.handleLinkEvent(ev)
+			}
+
+			assert.Nil(t, err, d.name)
+		}
+
+		var ops []string
+		for _, op := range n.pendingOps {
+			ops = append(ops, op.Op)
+		}
+		assert.Equal(t, d.ops, ops, d.name)
+
+		iface, exist := n.netIfaces[testIfaceIndex]
+		if d.addresses == nil {
+			assert.False(t, exist, d.name)
+			continue
+		}
+
+		// The batch sends the last state of the interface
+		sent := n.pendingOps[len(n.pendingOps)-1].Interface
+		assert.Equal(t, iface.Interface, *sent, d.name)
+
+		var addresses []string
+		for _, addr := range sent.IPAddresses {
+			addresses = append(addresses, addr.Address+"/"+addr.Mask)
+		}
+		assert.Equal(t, d.addresses, addresses, d.name)
+		assert.Equal(t, d.mtu, sent.Mtu, d.name)
+	}
 }
 
 func TestHandleRTMNewLink(t *testing.T) {
@@ -465,8 +802,8 @@ func TestHandleRTMNewLink(t *testing.T) {
 	assert.Nil(t, err)
 
 	// Interface already exist in list
-	n.netIfaces = make(map[int]vcTypes.Interface)
-	n.netIfaces[testIfaceIndex] = vcTypes.Interface{}
+	n.netIfaces = make(map[int]netIface)
+	n.netIfaces[testIfaceIndex] = netIface{}
 	ev = netlink.LinkUpdate{
 		Link: &netlink.Dummy{
 			LinkAttrs: netlink.LinkAttrs{
@@ -479,7 +816,7 @@ func TestHandleRTMNewLink(t *testing.T) {
 	assert.Nil(t, err)
 
 	// Flags are not up and running
-	n.netIfaces = make(map[int]vcTypes.Interface)
+	n.netIfaces = make(map[int]netIface)
 	ev = netlink.LinkUpdate{
 		Link: &netlink.Dummy{
 			LinkAttrs: netlink.LinkAttrs{
@@ -491,8 +828,8 @@ func TestHandleRTMNewLink(t *testing.T) {
 	err = n.handleRTMNewLink(ev)
 	assert.Nil(t, err)
 
-	// Invalid link
-	n.netIfaces = make(map[int]vcTypes.Interface)
+	// Invalid link, added with the next batch
+	n.netIfaces = make(map[int]netIface)
 	ev = netlink.LinkUpdate{
 		Link: &netlink.Dummy{
 			LinkAttrs: netlink.LinkAttrs{
@@ -508,6 +845,13 @@ func TestHandleRTMNewLink(t *testing.T) {
 	defer handler.Delete()
 	n.netHandler = handler
 	err = n.handleRTMNewLink(ev)
+	assert.Nil(t, err)
+	assert.Len(t, n.pendingOps, 1)
+	assert.Equal(t, netapi.AddInterface, n.pendingOps[0].Op)
+	assert.True(t, n.routesChanged)
+
+	// No runtime to send the batch to
+	err = n.flush()
 	assert.NotNil(t, err)
 }
 
@@ -533,7 +877,7 @@ func TestHandleRTMDelLink(t *testing.T) {
 	assert.Nil(t, err)
 
 	// Interface does not exist in list
-	n.netIfaces = make(map[int]vcTypes.Interface)
+	n.netIfaces = make(map[int]netIface)
 	ev = netlink.LinkUpdate{
 		Link: &netlink.Dummy{
 			LinkAttrs: netlink.LinkAttrs{
@@ -544,11 +888,57 @@ func TestHandleRTMDelLink(t *testing.T) {
 	ev.Index = testIfaceIndex
 	err = n.handleRTMDelLink(ev)
 	assert.Nil(t, err)
+
+	// Interface removed with the next batch
+	n.netIfaces[testIfaceIndex] = netIface{
+		Interface: vcTypes.Interface{Name: "foo0"},
+	}
+	ev.Link.Attrs().Index = testIfaceIndex
+	err = n.handleRTMDelLink(ev)
+	assert.Nil(t, err)
+	assert.Len(t, n.pendingOps, 1)
+	assert.Equal(t, netapi.RemoveInterface, n.pendingOps[0].Op)
+	assert.Empty(t, n.netIfaces)
+
+	// Physical interface removed
+	n.pendingOps = nil
+	n.netIfaces[testIfaceIndex] = netIface{
+		Interface: vcTypes.Interface{Name: "foo0", LinkType: physicalLinkType},
+		bdf:       "0000:00:03.0",
+	}
+	err = n.handleRTMDelLink(ev)
+	assert.Nil(t, err)
+	assert.Len(t, n.pendingOps, 1)
+	assert.Empty(t, n.netIfaces)
+
+	// Physical interface bound to VFIO
+	dir, err := ioutil.TempDir("", "netmon-pci")
+	assert.Nil(t, err)
+	defer os.RemoveAll(dir)
+
+	savedSysPCIDevicesPath := sysPCIDevicesPath
+	sysPCIDevicesPath = dir
+	defer func() {
+		sysPCIDevicesPath = savedSysPCIDevicesPath
+	}()
+
+	assert.Nil(t, os.Mkdir(filepath.Join(dir, "0000:00:03.0"), 0755))
+	assert.Nil(t, os.Symlink("../../../bus/pci/drivers/"+vfioDriver, filepath.Join(dir, "0000:00:03.0", "driver")))
+
+	n.pendingOps = nil
+	n.netIfaces[testIfaceIndex] = netIface{
+		Interface: vcTypes.Interface{Name: "foo0", LinkType: physicalLinkType},
+		bdf:       "0000:00:03.0",
+	}
+	err = n.handleRTMDelLink(ev)
+	assert.Nil(t, err)
+	assert.Empty(t, n.pendingOps)
+	assert.Empty(t, n.netIfaces)
 }
 
 func TestHandleRTMNewRouteIfaceNotFound(t *testing.T) {
 	n := &netmon{
-		netIfaces: make(map[int]vcTypes.Interface),
+		netIfaces: make(map[int]netIface),
 	}
 
 	err := n.handleRTMNewRoute(netlink.RouteUpdate{})
@@ -573,16 +963,6 @@ func TestHandleLinkEvent(t *testing.T) {
 	err = n.handleLinkEvent(ev)
 	assert.NotNil(t, err)
 
-	// NEWADDR event
-	ev.Header.Type = unix.RTM_NEWADDR
-	err = n.handleLinkEvent(ev)
-	assert.Nil(t, err)
-
-	// DELADDR event
-	ev.Header.Type = unix.RTM_DELADDR
-	err = n.handleLinkEvent(ev)
-	assert.Nil(t, err)
-
 	// NEWLINK event
 	ev.Header.Type = unix.RTM_NEWLINK
 	ev.Link = &netlink.Dummy{}
@@ -15,6 +15,7 @@ var defaultInitrdPath = "/usr/share/kata-containers/kata-containers-initrd.img"
 var defaultFirmwarePath = ""
 var defaultMachineAccelerators = ""
 var defaultShimPath = "/usr/libexec/kata-containers/kata-shim"
+var defaultVirtioFSDaemon = "/usr/libexec/virtiofsd"
 var systemdUnitName = "kata-containers.target"
 
 const defaultKernelParams = ""
@@ -39,9 +40,12 @@ const defaultEnableSwap bool = false
 const defaultEnableDebug bool = false
 const defaultDisableNestingChecks bool = false
 const defaultMsize9p uint32 = 8192
+const defaultSharedFS = "virtio-9p"
+const defaultVirtioFSCache = "always"
 const defaultHotplugVFIOOnRootBus bool = false
 const defaultEntropySource = "/dev/urandom"
 const defaultGuestHookPath string = ""
+const defaultJailerChrootBase = "/srv/jailer"
 
 const defaultVMCacheEndpoint string = "/var/run/kata-containers/cache.sock"
 
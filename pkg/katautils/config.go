@@ -9,14 +9,14 @@ package katautils
 import (
 	"errors"
 	"fmt"
-	"io/ioutil"
 	goruntime "runtime"
 	"strings"
+	"time"
 
-	"github.com/BurntSushi/toml"
 	vc "github.com/kata-containers/runtime/virtcontainers"
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/sirupsen/logrus"
 )
@@ -71,6 +71,7 @@ type tomlConfig struct {
 	Proxy      map[string]proxy
 	Shim       map[string]shim
 	Agent      map[string]agent
+	Profile    map[string]profile
 	Runtime    runtime
 	Factory    factory
 	Netmon     netmon
@@ -84,6 +85,11 @@ type factory struct {
 
 type hypervisor struct {
 	Path                    string `toml:"path"`
+	JailerPath              string `toml:"jailer_path"`
+	JailerChrootBase        string `toml:"jailer_chroot_base"`
+	JailerUID               uint32 `toml:"jailer_uid"`
+	JailerGID               uint32 `toml:"jailer_gid"`
+	JailerNumaNode          uint32 `toml:"jailer_numa_node"`
 	Kernel                  string `toml:"kernel"`
 	Initrd                  string `toml:"initrd"`
 	Image                   string `toml:"image"`
@@ -103,6 +109,10 @@ type hypervisor struct {
 	MemOffset               uint32 `toml:"memory_offset"`
 	DefaultBridges          uint32 `toml:"default_bridges"`
 	Msize9p                 uint32 `toml:"msize_9p"`
+	SharedFS                string `toml:"shared_fs"`
+	VirtioFSDaemon          string `toml:"virtio_fs_daemon"`
+	VirtioFSCache           string `toml:"virtio_fs_cache"`
+	VirtioFSCacheSize       uint32 `toml:"virtio_fs_cache_size"`
 	DisableBlockDeviceUse   bool   `toml:"disable_block_device_use"`
 	MemPrealloc             bool   `toml:"enable_mem_prealloc"`
 	HugePages               bool   `toml:"enable_hugepages"`
@@ -114,6 +124,8 @@ type hypervisor struct {
 	HotplugVFIOOnRootBus    bool   `toml:"hotplug_vfio_on_root_bus"`
 	DisableVhostNet         bool   `toml:"disable_vhost_net"`
 	GuestHookPath           string `toml:"guest_hook_path"`
+	EnableBalloon           bool   `toml:"enable_balloon"`
+	BalloonReclaimInterval  uint32 `toml:"balloon_reclaim_interval"`
 }
 
 type proxy struct {
@@ -122,11 +134,18 @@ type proxy struct {
 }
 
 type runtime struct {
-	Debug               bool   `toml:"enable_debug"`
-	Tracing             bool   `toml:"enable_tracing"`
-	DisableNewNetNs     bool   `toml:"disable_new_netns"`
-	DisableGuestSeccomp bool   `toml:"disable_guest_seccomp"`
-	InterNetworkModel   string `toml:"internetworking_model"`
+	Debug                   bool     `toml:"enable_debug"`
+	Tracing                 bool     `toml:"enable_tracing"`
+	DisableNewNetNs         bool     `toml:"disable_new_netns"`
+	DisableGuestSeccomp     bool     `toml:"disable_guest_seccomp"`
+	InterNetworkModel       string   `toml:"internetworking_model"`
+	IngressBandwidth        uint64   `toml:"ingress_bandwidth"`
+	EgressBandwidth         uint64   `toml:"egress_bandwidth"`
+	StoreBackend            string   `toml:"store_backend"`
+	MonitorCheckInterval    uint32   `toml:"monitor_check_interval"`
+	MonitorFailureThreshold uint32   `toml:"monitor_failure_threshold"`
+	EnableAnnotations       []string `toml:"enable_annotations"`
+	DefaultProfile          string   `toml:"default_profile"`
 }
 
 type shim struct {
@@ -154,6 +173,27 @@ func (h hypervisor) path() (string, error) {
 	return ResolvePath(p)
 }
 
+func (h hypervisor) jailerPath() (string, error) {
+	if h.JailerPath == "" {
+		return "", nil
+	}
+
+	// Running firecracker as root would defeat the point of the jailer.
+	if h.JailerUID == 0 || h.JailerGID == 0 {
+		return "", errors.New("jailer_uid and jailer_gid must be set to a non-root user and group with jailer_path")
+	}
+
+	return ResolvePath(h.JailerPath)
+}
+
+func (h hypervisor) jailerChrootBase() string {
+	if h.JailerChrootBase == "" {
+		return defaultJailerChrootBase
+	}
+
+	return h.JailerChrootBase
+}
+
 func (h hypervisor) kernel() (string, error) {
 	p := h.Kernel
 
@@ -330,6 +370,48 @@ func (h hypervisor) msize9p() uint32 {
 	return h.Msize9p
 }
 
+func (h hypervisor) sharedFS() (string, error) {
+	supportedSharedFS := []string{config.Virtio9P, config.VirtioFS}
+
+	if h.SharedFS == "" {
+		return defaultSharedFS, nil
+	}
+
+	for _, fs := range supportedSharedFS {
+		if fs == h.SharedFS {
+			return h.SharedFS, nil
+		}
+	}
+
+	return "", fmt.Errorf("Invalid hypervisor shared file system %v specified (supported file systems: %v)", h.SharedFS, supportedSharedFS)
+}
+
+func (h hypervisor) virtioFSDaemon() (string, error) {
+	p := h.VirtioFSDaemon
+
+	if p == "" {
+		p = defaultVirtioFSDaemon
+	}
+
+	return ResolvePath(p)
+}
+
+func (h hypervisor) virtioFSCache() (string, error) {
+	supportedCaches := []string{"none", "auto", "always"}
+
+	if h.VirtioFSCache == "" {
+		return defaultVirtioFSCache, nil
+	}
+
+	for _, c := range supportedCaches {
+		if c == h.VirtioFSCache {
+			return h.VirtioFSCache, nil
+		}
+	}
+
+	return "", fmt.Errorf("Invalid virtio-fs cache mode %v specified (supported modes: %v)", h.VirtioFSCache, supportedCaches)
+}
+
 func (h hypervisor) useVSock() bool {
 	return h.UseVSock
 }
@@ -341,6 +423,14 @@ func (h hypervisor) guestHookPath() string {
 	return h.GuestHookPath
 }
 
+func (h hypervisor) balloonReclaimInterval() (time.Duration, error) {
+	if h.BalloonReclaimInterval > 0 && !h.EnableBalloon {
+		return 0, errors.New("balloon_reclaim_interval requires enable_balloon")
+	}
+
+	return time.Duration(h.BalloonReclaimInterval) * time.Second, nil
+}
+
 func (h hypervisor) getInitrdAndImage() (initrd string, image string, err error) {
 	initrd, errInitrd := h.initrd()
 
@@ -431,12 +521,22 @@ func newFirecrackerHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 		return vc.HypervisorConfig{}, err
 	}
 
+	jailer, err := h.jailerPath()
+	if err != nil {
+		return vc.HypervisorConfig{}, err
+	}
+
 	if !utils.SupportsVsocks() {
 		return vc.HypervisorConfig{}, errors.New("No vsock support, firecracker cannot be used")
 	}
 
 	return vc.HypervisorConfig{
 		HypervisorPath:        hypervisor,
+		JailerPath:            jailer,
+		JailerChrootBase:      h.jailerChrootBase(),
+		JailerUID:             h.JailerUID,
+		JailerGID:             h.JailerGID,
+		JailerNumaNode:        h.JailerNumaNode,
 		KernelPath:            kernel,
 		InitrdPath:            initrd,
 		ImagePath:             image,
@@ -500,6 +600,27 @@ func newQemuHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 		return vc.HypervisorConfig{}, err
 	}
 
+	balloonReclaimInterval, err := h.balloonReclaimInterval()
+	if err != nil {
+		return vc.HypervisorConfig{}, err
+	}
+
+	sharedFS, err := h.sharedFS()
+	if err != nil {
+		return vc.HypervisorConfig{}, err
+	}
+
+	var virtioFSDaemon, virtioFSCache string
+	if sharedFS == config.VirtioFS {
+		if virtioFSDaemon, err = h.virtioFSDaemon(); err != nil {
+			return vc.HypervisorConfig{}, err
+		}
+
+		if virtioFSCache, err = h.virtioFSCache(); err != nil {
+			return vc.HypervisorConfig{}, err
+		}
+	}
+
 	useVSock := false
 	if h.useVSock() {
 		if utils.SupportsVsocks() {
@@ -538,10 +659,16 @@ func newQemuHypervisorConfig(h hypervisor) (vc.HypervisorConfig, error) {
 		BlockDeviceCacheNoflush: h.BlockDeviceCacheNoflush,
 		EnableIOThreads:         h.EnableIOThreads,
 		Msize9p:                 h.msize9p(),
+		SharedFS:                sharedFS,
+		VirtioFSDaemon:          virtioFSDaemon,
+		VirtioFSCache:           virtioFSCache,
+		VirtioFSCacheSize:       h.VirtioFSCacheSize,
 		UseVSock:                useVSock,
 		HotplugVFIOOnRootBus:    h.HotplugVFIOOnRootBus,
 		DisableVhostNet:         h.DisableVhostNet,
 		GuestHookPath:           h.guestHookPath(),
+		EnableBalloon:           h.EnableBalloon,
+		BalloonReclaimInterval:  balloonReclaimInterval,
 	}, nil
 }
 
@@ -817,17 +944,25 @@ func LoadConfiguration(configPath string, ignoreLogging, builtIn bool) (resolved
 		return "", config, fmt.Errorf("Cannot find usable config file (%v)", err)
 	}
 
-	configData, err := ioutil.ReadFile(resolved)
+	layers, err := loadConfigLayers(resolved)
 	if err != nil {
 		return "", config, err
 	}
 
 	var tomlConf tomlConfig
-	_, err = toml.Decode(string(configData), &tomlConf)
+	unknownKeys, err := layers.decode(&tomlConf)
 	if err != nil {
 		return "", config, err
 	}
 
+	for _, key := range unknownKeys {
+		kataUtilsLogger.WithFields(
+			logrus.Fields{
+				"key":  key,
+				"file": layers.settingSource(key),
+			}).Warn("unknown configuration key")
+	}
+
 	config.Debug = tomlConf.Runtime.Debug
 	if !tomlConf.Runtime.Debug {
 		// If debug is not required, switch back to the original
@@ -845,6 +980,10 @@ func LoadConfiguration(configPath string, ignoreLogging, builtIn bool) (resolved
 		}
 	}
 
+	if err := store.SetBackend(tomlConf.Runtime.StoreBackend); err != nil {
+		return "", config, err
+	}
+
 	if !ignoreLogging {
 		err := handleSystemLog("", "")
 		if err != nil {
@@ -853,17 +992,30 @@ func LoadConfiguration(configPath string, ignoreLogging, builtIn bool) (resolved
 
 		kataUtilsLogger.WithFields(
 			logrus.Fields{
-				"format": "TOML",
-				"file":   resolved,
+				"format":   "TOML",
+				"file":     resolved,
+				"drop-ins": layers.files[1:],
 			}).Info("loaded configuration")
 	}
 
-	if err := updateRuntimeConfig(resolved, tomlConf, &config, builtIn); err != nil {
+	defaultConf := tomlConf
+	if tomlConf.Runtime.DefaultProfile != "" {
+		if defaultConf, err = profileTomlConfig(tomlConf, tomlConf.Runtime.DefaultProfile); err != nil {
+			return "", config, fmt.Errorf("%v: %v", resolved, err)
+		}
+	}
+
+	if err := updateRuntimeConfig(resolved, defaultConf, &config, builtIn); err != nil {
 		return "", config, err
 	}
 
 	config.DisableGuestSeccomp = tomlConf.Runtime.DisableGuestSeccomp
 
+	config.MonitorConfig = vc.MonitorConfig{
+		CheckInterval:    time.Duration(tomlConf.Runtime.MonitorCheckInterval) * time.Second,
+		FailureThreshold: uint(tomlConf.Runtime.MonitorFailureThreshold),
+	}
+
 	// use no proxy if HypervisorConfig.UseVSock is true
 	if config.HypervisorConfig.UseVSock {
 		kataUtilsLogger.Info("VSOCK supported, configure to not use proxy")
@@ -872,11 +1024,18 @@ func LoadConfiguration(configPath string, ignoreLogging, builtIn bool) (resolved
 	}
 
 	config.DisableNewNetNs = tomlConf.Runtime.DisableNewNetNs
+	config.IngressBandwidth = tomlConf.Runtime.IngressBandwidth
+	config.EgressBandwidth = tomlConf.Runtime.EgressBandwidth
+	config.EnableAnnotations = tomlConf.Runtime.EnableAnnotations
 
 	if err := checkConfig(config); err != nil {
 		return "", config, err
 	}
 
+	if config.Profiles, err = newProfileConfigs(resolved, tomlConf, config, builtIn); err != nil {
+		return "", config, err
+	}
+
 	return resolved, config, nil
 }
 
@@ -923,7 +1082,13 @@ func checkFactoryConfig(config oci.RuntimeConfig) error {
 		return errors.New("VM factory cannot work together with VM cache")
 	}
 
-	if config.FactoryConfig.Template {
+	// A firecracker template is a snapshot, loaded into a jail for the
+	// unix socket backing its hybrid vsock to be private to each VM.
+	if config.FactoryConfig.Template && config.HypervisorType == vc.FirecrackerHypervisor {
+		if config.HypervisorConfig.JailerPath == "" {
+			return errors.New("VM factory template requires jailer_path with firecracker")
+		}
+	} else if config.FactoryConfig.Template {
 		if config.HypervisorConfig.InitrdPath == "" {
 			return errors.New("Factory option enable_template requires an initrd image")
 		}
@@ -934,13 +1099,15 @@ func checkFactoryConfig(config oci.RuntimeConfig) error {
 	}
 
 	if config.FactoryConfig.VMCacheNumber > 0 {
-		if config.HypervisorType != vc.QemuHypervisor {
-			return errors.New("VM cache just support qemu")
+		if config.HypervisorType != vc.QemuHypervisor && config.HypervisorType != vc.FirecrackerHypervisor {
+			return errors.New("VM cache just support qemu and firecracker")
 		}
 		if config.AgentType != vc.KataContainersAgent {
 			return errors.New("VM cache just support kata agent")
 		}
-		if config.HypervisorConfig.UseVSock {
+		// The vsock context ID of a firecracker VM is owned by the
+		// firecracker process, not by the VM cache server.
+		if config.HypervisorConfig.UseVSock && config.HypervisorType != vc.FirecrackerHypervisor {
 			return errors.New("config vsock conflicts with VM cache, please disable one of them")
 		}
 	}
@@ -0,0 +1,353 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
+)
+
+// The levels of the configuration issues.
+const (
+	// ConfigError is an issue which prevents the configuration from
+	// being used, or which is most likely a mistake.
+	ConfigError = "error"
+
+	// ConfigWarning is an issue which does not prevent the configuration
+	// from being used.
+	ConfigWarning = "warning"
+)
+
+// procMeminfo is the file telling the huge pages of the host.
+var procMeminfo = "/proc/meminfo"
+
+// hostSupportsVsocks tells if the host supports vsocks.
+var hostSupportsVsocks = utils.SupportsVsocks
+
+// hypervisorBlockDrivers are the block device drivers each hypervisor
+// supports.
+var hypervisorBlockDrivers = map[string][]string{
+	qemuHypervisorTableType:        {config.VirtioSCSI, config.VirtioBlock, config.Nvdimm},
+	firecrackerHypervisorTableType: {config.VirtioMmio},
+}
+
+// ConfigIssue is a problem found in the configuration. File, Line and Key
+// are set when the issue can be traced back to them.
+type ConfigIssue struct {
+	Level   string
+	File    string
+	Line    int
+	Key     string
+	Message string
+}
+
+func (i ConfigIssue) String() string {
+	location := i.File
+	if i.Line > 0 {
+		location = fmt.Sprintf("%s:%d", location, i.Line)
+	}
+
+	if i.Key == "" {
+		return fmt.Sprintf("%s: %s: %s", location, i.Level, i.Message)
+	}
+
+	return fmt.Sprintf("%s: %s: %s: %s", location, i.Level, i.Key, i.Message)
+}
+
+// undecodedKeys returns the dotted keys of md not decoded into the
+// configuration, without the keys of the tables already returned.
+func undecodedKeys(md toml.MetaData) []string {
+	var keys []string
+
+	for _, k := range md.Undecoded() {
+		key := strings.Join(k, ".")
+
+		known := true
+		for _, parent := range keys {
+			if strings.HasPrefix(key, parent+".") {
+				known = false
+				break
+			}
+		}
+
+		if known {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// configKeyLine returns the line of file setting the dotted key, or
+// starting its table, and 0 when it is not found.
+func configKeyLine(file, key string) int {
+	f, err := os.Open(file)
+	if err != nil {
+		return 0
+	}
+	defer f.Close()
+
+	table := ""
+	scanner := bufio.NewScanner(f)
+
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+
+		if strings.HasPrefix(text, "[") {
+			end := strings.Index(text, "]")
+			if end < 0 {
+				continue
+			}
+
+			table = strings.TrimSpace(strings.TrimLeft(text[:end], "["))
+			if table == key || strings.HasPrefix(table, key+".") {
+				return line
+			}
+
+			continue
+		}
+
+		eq := strings.Index(text, "=")
+		if eq < 0 || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		name := strings.Trim(strings.TrimSpace(text[:eq]), `"`)
+		if table != "" {
+			name = table + "." + name
+		}
+
+		if name == key {
+			return line
+		}
+	}
+
+	return 0
+}
+
+// parseErrorLine returns the line of a TOML parse error, and 0 when it is
+// not known.
+func parseErrorLine(err error) int {
+	var line int
+
+	if _, err := fmt.Sscanf(err.Error(), "Near line %d", &line); err != nil {
+		return 0
+	}
+
+	return line
+}
+
+// hostHasHugePages tells if huge pages are allocated on the host.
+func hostHasHugePages() bool {
+	data, err := ioutil.ReadFile(procMeminfo)
+	if err != nil {
+		return false
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "HugePages_Total:" {
+			continue
+		}
+
+		total, err := strconv.ParseUint(fields[1], 10, 64)
+		return err == nil && total > 0
+	}
+
+	return false
+}
+
+// checkConfigFile checks a configuration file, or a drop-in fragment, on
+// its own: its syntax and its keys.
+func checkConfigFile(file string) []ConfigIssue {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return []ConfigIssue{{Level: ConfigError, File: file, Message: err.Error()}}
+	}
+
+	var tomlConf tomlConfig
+	md, err := toml.Decode(string(data), &tomlConf)
+	if err != nil {
+		return []ConfigIssue{{
+			Level:   ConfigError,
+			File:    file,
+			Line:    parseErrorLine(err),
+			Message: err.Error(),
+		}}
+	}
+
+	var issues []ConfigIssue
+
+	for _, key := range undecodedKeys(md) {
+		issues = append(issues, ConfigIssue{
+			Level:   ConfigError,
+			File:    file,
+			Line:    configKeyLine(file, key),
+			Key:     key,
+			Message: "unknown configuration key",
+		})
+	}
+
+	return issues
+}
+
+// checkConfigCombinations checks the merged configuration for values which
+// cannot work together, or on this host.
+func checkConfigCombinations(tomlConf tomlConfig) []ConfigIssue {
+	var issues []ConfigIssue
+
+	add := func(level, key, format string, args ...interface{}) {
+		issues = append(issues, ConfigIssue{
+			Level:   level,
+			Key:     key,
+			Message: fmt.Sprintf(format, args...),
+		})
+	}
+
+	var names []string
+	for k := range tomlConf.Hypervisor {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+
+	for _, k := range names {
+		h := tomlConf.Hypervisor[k]
+		key := "hypervisor." + k
+
+		drivers, ok := hypervisorBlockDrivers[k]
+		if !ok {
+			add(ConfigError, key, "unknown hypervisor type %q", k)
+			continue
+		}
+
+		if h.Initrd != "" && h.Image != "" {
+			add(ConfigError, key+".initrd", "having both an image and an initrd is not supported")
+		}
+
+		if h.BlockDeviceDriver != "" {
+			supported := false
+			for _, d := range drivers {
+				supported = supported || d == h.BlockDeviceDriver
+			}
+
+			if !supported {
+				add(ConfigError, key+".block_device_driver", "block device driver %q is not supported by %s (supported drivers: %v)", h.BlockDeviceDriver, k, drivers)
+			}
+		}
+
+		switch k {
+		case firecrackerHypervisorTableType:
+			if !hostSupportsVsocks() {
+				add(ConfigError, key, "firecracker requires vsock, which the host does not support")
+			}
+
+			if h.HugePages {
+				add(ConfigWarning, key+".enable_hugepages", "huge pages are not supported by firecracker, the option is ignored")
+			}
+
+			if tomlConf.Factory.Template {
+				add(ConfigError, "factory.enable_template", "VM templating is not supported by firecracker")
+			}
+
+			if h.SharedFS == config.VirtioFS {
+				add(ConfigError, key+".shared_fs", "virtio-fs is not supported by firecracker")
+			}
+		case qemuHypervisorTableType:
+			if h.UseVSock && !hostSupportsVsocks() {
+				add(ConfigWarning, key+".use_vsock", "the host does not support vsock, the legacy serial port is used")
+			}
+
+			if h.HugePages && !hostHasHugePages() {
+				add(ConfigError, key+".enable_hugepages", "no huge pages are allocated on the host")
+			}
+
+			if h.SharedFS == config.VirtioFS && tomlConf.Factory.Template {
+				add(ConfigError, key+".shared_fs", "virtio-fs cannot be used with VM templating")
+			}
+		}
+	}
+
+	return issues
+}
+
+// CheckConfiguration validates the configuration file, merged with its
+// drop-in fragments, and returns the issues found. The configuration can
+// be used if none of them is a ConfigError. An error is only returned when
+// the configuration file cannot be found.
+func CheckConfiguration(configPath string) ([]ConfigIssue, error) {
+	var resolved string
+	var err error
+
+	if configPath == "" {
+		resolved, err = getDefaultConfigFile()
+	} else {
+		resolved, err = ResolvePath(configPath)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("Cannot find usable config file (%v)", err)
+	}
+
+	dropIns, err := getConfigDropIns(resolved)
+	if err != nil {
+		return nil, err
+	}
+
+	var issues []ConfigIssue
+
+	for _, file := range append([]string{resolved}, dropIns...) {
+		issues = append(issues, checkConfigFile(file)...)
+	}
+
+	for _, issue := range issues {
+		// The files cannot be read or parsed, and merged.
+		if issue.Key == "" {
+			return issues, nil
+		}
+	}
+
+	layers, err := loadConfigLayers(resolved)
+	if err != nil {
+		return append(issues, ConfigIssue{Level: ConfigError, File: resolved, Message: err.Error()}), nil
+	}
+
+	var tomlConf tomlConfig
+	if _, err := layers.decode(&tomlConf); err != nil {
+		return append(issues, ConfigIssue{Level: ConfigError, File: resolved, Message: err.Error()}), nil
+	}
+
+	for _, issue := range checkConfigCombinations(tomlConf) {
+		issue.File = layers.settingSource(issue.Key)
+		if issue.File == "" {
+			issue.File = resolved
+		}
+		issue.Line = configKeyLine(issue.File, issue.Key)
+
+		issues = append(issues, issue)
+	}
+
+	for _, issue := range issues {
+		if issue.Level == ConfigError {
+			return issues, nil
+		}
+	}
+
+	// The checks of the runtime configuration itself
+	if _, _, err := LoadConfiguration(resolved, true, false); err != nil {
+		issues = append(issues, ConfigIssue{Level: ConfigError, File: resolved, Message: err.Error()})
+	}
+
+	return issues, nil
+}
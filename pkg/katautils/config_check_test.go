@@ -0,0 +1,207 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func makeCheckConfigFileData(dir, hypervisorOptions string) string {
+	return `
+[hypervisor.qemu]
+path = "` + filepath.Join(dir, "qemu") + `"
+kernel = "` + filepath.Join(dir, "kernel") + `"
+image = "` + filepath.Join(dir, "image") + `"
+` + hypervisorOptions + `
+
+[proxy.kata]
+path = "` + filepath.Join(dir, "proxy") + `"
+
+[shim.kata]
+path = "` + filepath.Join(dir, "shim") + `"
+
+[agent.kata]
+`
+}
+
+func TestCheckConfiguration(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "check-config-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"qemu", "kernel", "image", "initrd", "proxy", "shim"} {
+		assert.NoError(WriteFile(filepath.Join(dir, file), "foo", testFileMode))
+	}
+
+	configPath := filepath.Join(dir, "runtime.toml")
+
+	// A valid configuration
+	assert.NoError(ioutil.WriteFile(configPath, []byte(makeCheckConfigFileData(dir, "")), testFileMode))
+	issues, err := CheckConfiguration(configPath)
+	assert.NoError(err)
+	assert.Empty(issues)
+
+	// A misspelled key, on the 6th line
+	assert.NoError(ioutil.WriteFile(configPath, []byte(makeCheckConfigFileData(dir, "default_memroy = 4096")), testFileMode))
+	issues, err = CheckConfiguration(configPath)
+	assert.NoError(err)
+	assert.Equal([]ConfigIssue{
+		{
+			Level:   ConfigError,
+			File:    configPath,
+			Line:    6,
+			Key:     "hypervisor.qemu.default_memroy",
+			Message: "unknown configuration key",
+		},
+	}, issues)
+
+	// An unknown table in a drop-in fragment
+	assert.NoError(ioutil.WriteFile(configPath, []byte(makeCheckConfigFileData(dir, "")), testFileMode))
+
+	dropInDir := filepath.Join(dir, configDropInDir)
+	assert.NoError(os.MkdirAll(dropInDir, testDirMode))
+
+	dropIn := filepath.Join(dropInDir, "10-hypervisor.toml")
+	assert.NoError(ioutil.WriteFile(dropIn, []byte("[hypervisor.qemu]\ndefault_memory = 4096\n\n[hypervisr.qemu]\npath = \"/usr/bin/qemu\"\n"), testFileMode))
+	issues, err = CheckConfiguration(configPath)
+	assert.NoError(err)
+	assert.Len(issues, 1)
+	assert.Equal(dropIn, issues[0].File)
+	assert.Equal(4, issues[0].Line)
+	assert.Equal("hypervisr.qemu", issues[0].Key)
+
+	// Combinations, the issues are traced back to the fragment
+	assert.NoError(ioutil.WriteFile(dropIn, []byte(`
+[hypervisor.qemu]
+initrd = "`+filepath.Join(dir, "initrd")+`"
+block_device_driver = "virtio-mmio"
+`), testFileMode))
+	issues, err = CheckConfiguration(configPath)
+	assert.NoError(err)
+	assert.Len(issues, 2)
+	for _, issue := range issues {
+		assert.Equal(ConfigError, issue.Level)
+		assert.Equal(dropIn, issue.File)
+	}
+	assert.Equal("hypervisor.qemu.initrd", issues[0].Key)
+	assert.Equal(3, issues[0].Line)
+	assert.Equal("hypervisor.qemu.block_device_driver", issues[1].Key)
+	assert.Equal(4, issues[1].Line)
+
+	// A syntax error
+	assert.NoError(ioutil.WriteFile(dropIn, []byte("[hypervisor.qemu]\ndefault_memory = \n"), testFileMode))
+	issues, err = CheckConfiguration(configPath)
+	assert.NoError(err)
+	assert.Len(issues, 1)
+	assert.Equal(dropIn, issues[0].File)
+	assert.Equal(ConfigError, issues[0].Level)
+	assert.Empty(issues[0].Key)
+
+	// The runtime configuration checks
+	assert.NoError(ioutil.WriteFile(dropIn, []byte("[hypervisor.qemu]\ndefault_memory = 0\n[factory]\nenable_template = true\n"), testFileMode))
+	issues, err = CheckConfiguration(configPath)
+	assert.NoError(err)
+	assert.Len(issues, 1)
+	assert.Equal(configPath, issues[0].File)
+	assert.Equal(ConfigError, issues[0].Level)
+
+	_, err = CheckConfiguration(filepath.Join(dir, "missing.toml"))
+	assert.Error(err)
+}
+
+func TestCheckConfigCombinations(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "check-combinations-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedProcMeminfo := procMeminfo
+	savedHostSupportsVsocks := hostSupportsVsocks
+	defer func() {
+		procMeminfo = savedProcMeminfo
+		hostSupportsVsocks = savedHostSupportsVsocks
+	}()
+
+	procMeminfo = filepath.Join(dir, "meminfo")
+	assert.NoError(ioutil.WriteFile(procMeminfo, []byte("MemTotal:       16318232 kB\nHugePages_Total:       0\n"), testFileMode))
+	hostSupportsVsocks = func() bool { return false }
+
+	tomlConf := tomlConfig{
+		Hypervisor: map[string]hypervisor{
+			"qemu": {
+				HugePages: true,
+				UseVSock:  true,
+				SharedFS:  "virtio-fs",
+			},
+			"firecracker": {
+				BlockDeviceDriver: "virtio-mmio",
+				SharedFS:          "virtio-fs",
+			},
+			"clh": {},
+		},
+		Factory: factory{
+			Template: true,
+		},
+	}
+
+	var keys []string
+	levels := make(map[string]string)
+	for _, issue := range checkConfigCombinations(tomlConf) {
+		keys = append(keys, issue.Key)
+		levels[issue.Key] = issue.Level
+	}
+
+	assert.Equal([]string{
+		"hypervisor.clh",
+		"hypervisor.firecracker",
+		"factory.enable_template",
+		"hypervisor.firecracker.shared_fs",
+		"hypervisor.qemu.use_vsock",
+		"hypervisor.qemu.enable_hugepages",
+		"hypervisor.qemu.shared_fs",
+	}, keys)
+	assert.Equal(ConfigError, levels["hypervisor.firecracker"])
+	assert.Equal(ConfigWarning, levels["hypervisor.qemu.use_vsock"])
+	assert.Equal(ConfigError, levels["hypervisor.qemu.enable_hugepages"])
+
+	// Huge pages allocated on the host
+	assert.NoError(ioutil.WriteFile(procMeminfo, []byte("HugePages_Total:     512\n"), testFileMode))
+	assert.True(hostHasHugePages())
+}
+
+func TestConfigKeyLine(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "key-line-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	file := filepath.Join(dir, "runtime.toml")
+	assert.NoError(ioutil.WriteFile(file, []byte(`# enable_debug = true
+[hypervisor.qemu] # comment
+path = "/usr/bin/qemu"
+  "default_memory" = 2048
+
+[runtime]
+enable_debug = true
+`), testFileMode))
+
+	assert.Equal(2, configKeyLine(file, "hypervisor.qemu"))
+	assert.Equal(2, configKeyLine(file, "hypervisor"))
+	assert.Equal(3, configKeyLine(file, "hypervisor.qemu.path"))
+	assert.Equal(4, configKeyLine(file, "hypervisor.qemu.default_memory"))
+	assert.Equal(7, configKeyLine(file, "runtime.enable_debug"))
+	assert.Equal(0, configKeyLine(file, "runtime.enable_tracing"))
+	assert.Equal(0, configKeyLine(filepath.Join(dir, "missing.toml"), "runtime"))
+}
@@ -0,0 +1,220 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+// configDropInDir is the name of the drop-in directory of a configuration
+// file, found next to it. The "*.toml" fragments of the directory are
+// merged in lexical order over the configuration file, each one only
+// setting the keys it contains:
+//
+//   # /etc/kata-containers/config.d/50-memory.toml
+//   [hypervisor.qemu]
+//   default_memory = 4096
+const configDropInDir = "config.d"
+
+// ConfigSetting is a value of the merged configuration, with the file which
+// supplied it.
+type ConfigSetting struct {
+	Key    string
+	Value  interface{}
+	Source string
+}
+
+// configLayers is a configuration file merged with its drop-in fragments.
+type configLayers struct {
+	// files are the files merged, in order.
+	files []string
+
+	// values is the merged configuration.
+	values map[string]interface{}
+
+	// settings maps the dotted key of each merged value to the value
+	// and the file which supplied it.
+	settings map[string]ConfigSetting
+}
+
+// configDropInDirs returns the drop-in directories of the resolved
+// configuration file, in the order they are merged. The drop-in directory
+// of the system configuration file also applies over the default one, so
+// that single keys can be overridden without copying the whole file.
+func configDropInDirs(resolved string) []string {
+	dirs := []string{filepath.Join(filepath.Dir(resolved), configDropInDir)}
+
+	defaultConfig, err := ResolvePath(defaultRuntimeConfiguration)
+	if err != nil || defaultConfig != resolved {
+		return dirs
+	}
+
+	sysConfDir := filepath.Join(filepath.Dir(defaultSysConfRuntimeConfiguration), configDropInDir)
+	if sysConfDir != dirs[0] {
+		dirs = append(dirs, sysConfDir)
+	}
+
+	return dirs
+}
+
+// getConfigDropIns returns the drop-in fragments of the resolved
+// configuration file, in the order they are merged.
+func getConfigDropIns(resolved string) ([]string, error) {
+	var files []string
+
+	for _, dir := range configDropInDirs(resolved) {
+		// Sorted lexically
+		matches, err := filepath.Glob(filepath.Join(dir, "*.toml"))
+		if err != nil {
+			return nil, err
+		}
+
+		files = append(files, matches...)
+	}
+
+	return files, nil
+}
+
+// loadConfigLayers reads the resolved configuration file and merges its
+// drop-in fragments over it.
+func loadConfigLayers(resolved string) (configLayers, error) {
+	dropIns, err := getConfigDropIns(resolved)
+	if err != nil {
+		return configLayers{}, err
+	}
+
+	layers := configLayers{
+		values:   make(map[string]interface{}),
+		settings: make(map[string]ConfigSetting),
+	}
+
+	for _, file := range append([]string{resolved}, dropIns...) {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			return configLayers{}, err
+		}
+
+		var values map[string]interface{}
+		if _, err := toml.Decode(string(data), &values); err != nil {
+			return configLayers{}, fmt.Errorf("%v: %v", file, err)
+		}
+
+		layers.merge(layers.values, values, "", file)
+		layers.files = append(layers.files, file)
+	}
+
+	return layers, nil
+}
+
+// merge merges the values of file over dst. Tables are merged key by key,
+// any other value replaces the previous one.
+func (l *configLayers) merge(dst, values map[string]interface{}, prefix, file string) {
+	for k, v := range values {
+		key := prefix + k
+
+		table, isTable := v.(map[string]interface{})
+		dstTable, dstIsTable := dst[k].(map[string]interface{})
+
+		if isTable && dstIsTable {
+			l.merge(dstTable, table, key+".", file)
+			continue
+		}
+
+		l.forget(key)
+
+		if isTable {
+			dstTable = make(map[string]interface{})
+			dst[k] = dstTable
+			l.merge(dstTable, table, key+".", file)
+			continue
+		}
+
+		dst[k] = v
+		l.settings[key] = ConfigSetting{
+			Key:    key,
+			Value:  v,
+			Source: file,
+		}
+	}
+}
+
+// forget drops the settings of the key value, which is being replaced.
+func (l *configLayers) forget(key string) {
+	delete(l.settings, key)
+
+	for k := range l.settings {
+		if strings.HasPrefix(k, key+".") {
+			delete(l.settings, k)
+		}
+	}
+}
+
+// decode decodes the merged configuration, returning the keys which are
+// not part of it.
+func (l configLayers) decode(tomlConf *tomlConfig) ([]string, error) {
+	var buf bytes.Buffer
+
+	if err := toml.NewEncoder(&buf).Encode(l.values); err != nil {
+		return nil, err
+	}
+
+	md, err := toml.Decode(buf.String(), tomlConf)
+	if err != nil {
+		return nil, err
+	}
+
+	return undecodedKeys(md), nil
+}
+
+// settingSource returns the file which supplied the key value, or one of
+// the values of the key table.
+func (l configLayers) settingSource(key string) string {
+	if setting, ok := l.settings[key]; ok {
+		return setting.Source
+	}
+
+	for _, setting := range l.sortedSettings() {
+		if strings.HasPrefix(setting.Key, key+".") {
+			return setting.Source
+		}
+	}
+
+	return ""
+}
+
+// sortedSettings returns the merged values, sorted by key.
+func (l configLayers) sortedSettings() []ConfigSetting {
+	var settings []ConfigSetting
+
+	for _, setting := range l.settings {
+		settings = append(settings, setting)
+	}
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+
+	return settings
+}
+
+// GetConfigSettings returns the values of the resolved configuration file
+// merged with its drop-in fragments, with the file which supplied each one,
+// and the files merged.
+func GetConfigSettings(resolved string) ([]ConfigSetting, []string, error) {
+	layers, err := loadConfigLayers(resolved)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return layers.sortedSettings(), layers.files, nil
+}
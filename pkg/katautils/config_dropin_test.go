@@ -0,0 +1,128 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigurationDropIns(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "drop-ins-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"qemu", "kernel", "image", "proxy", "shim"} {
+		assert.NoError(WriteFile(filepath.Join(dir, file), "foo", testFileMode))
+	}
+
+	configPath := filepath.Join(dir, "runtime.toml")
+	assert.NoError(createConfig(configPath, `
+	[hypervisor.qemu]
+	path = "`+filepath.Join(dir, "qemu")+`"
+	kernel = "`+filepath.Join(dir, "kernel")+`"
+	image = "`+filepath.Join(dir, "image")+`"
+	default_memory = 1024
+	msize_9p = 16384
+	kernel_params = "foo=bar"
+
+	[proxy.kata]
+	path = "`+filepath.Join(dir, "proxy")+`"
+
+	[shim.kata]
+	path = "`+filepath.Join(dir, "shim")+`"
+
+	[agent.kata]
+	`))
+
+	dropInDir := filepath.Join(dir, configDropInDir)
+	assert.NoError(os.MkdirAll(dropInDir, testDirMode))
+
+	memory := filepath.Join(dropInDir, "10-memory.toml")
+	assert.NoError(createConfig(memory, `
+	[hypervisor.qemu]
+	default_memory = 2048
+	`))
+
+	override := filepath.Join(dropInDir, "20-override.toml")
+	assert.NoError(createConfig(override, `
+	[hypervisor.qemu]
+	default_memory = 4096
+	kernel_params = "baz=qux"
+	`))
+
+	// Not a TOML fragment
+	assert.NoError(createConfig(filepath.Join(dropInDir, "30-ignored.conf"), `
+	[hypervisor.qemu]
+	default_memory = 8192
+	`))
+
+	_, config, err := LoadConfiguration(configPath, true, false)
+	assert.NoError(err)
+
+	assert.Equal(uint32(4096), config.HypervisorConfig.MemorySize)
+	assert.Equal(uint32(16384), config.HypervisorConfig.Msize9p)
+	assert.Equal(filepath.Join(dir, "qemu"), config.HypervisorConfig.HypervisorPath)
+
+	settings, files, err := GetConfigSettings(configPath)
+	assert.NoError(err)
+	assert.Equal([]string{configPath, memory, override}, files)
+
+	sources := make(map[string]ConfigSetting)
+	for _, s := range settings {
+		sources[s.Key] = s
+	}
+
+	assert.Equal(override, sources["hypervisor.qemu.default_memory"].Source)
+	assert.Equal(int64(4096), sources["hypervisor.qemu.default_memory"].Value)
+	assert.Equal(override, sources["hypervisor.qemu.kernel_params"].Source)
+	assert.Equal(configPath, sources["hypervisor.qemu.msize_9p"].Source)
+	assert.Equal(configPath, sources["hypervisor.qemu.path"].Source)
+
+	// An invalid fragment
+	assert.NoError(createConfig(filepath.Join(dropInDir, "40-invalid.toml"), "[hypervisor.qemu"))
+	_, _, err = LoadConfiguration(configPath, true, false)
+	assert.Error(err)
+}
+
+func TestConfigLayersMerge(t *testing.T) {
+	assert := assert.New(t)
+
+	layers := configLayers{
+		values:   make(map[string]interface{}),
+		settings: make(map[string]ConfigSetting),
+	}
+
+	layers.merge(layers.values, map[string]interface{}{
+		"runtime": map[string]interface{}{
+			"enable_debug": true,
+		},
+		"factory": map[string]interface{}{
+			"template": true,
+		},
+	}, "", "base.toml")
+
+	// A table replaced by a value, and a value by a table
+	layers.merge(layers.values, map[string]interface{}{
+		"factory": "none",
+		"runtime": map[string]interface{}{
+			"enable_debug": map[string]interface{}{
+				"level": "info",
+			},
+		},
+	}, "", "10-fragment.toml")
+
+	assert.Equal([]ConfigSetting{
+		{Key: "factory", Value: "none", Source: "10-fragment.toml"},
+		{Key: "runtime.enable_debug.level", Value: "info", Source: "10-fragment.toml"},
+	}, layers.sortedSettings())
+}
@@ -19,6 +19,7 @@ import (
 	"strings"
 	"syscall"
 	"testing"
+	"time"
 
 	vc "github.com/kata-containers/runtime/virtcontainers"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
@@ -80,6 +81,7 @@ func makeRuntimeConfigFileData(hypervisor, hypervisorPath, kernelPath, imagePath
 
         [runtime]
 	enable_debug = ` + strconv.FormatBool(runtimeDebug) + `
+	ingress_bandwidth = 1000000
 	disable_new_netns= ` + strconv.FormatBool(disableNewNetNs)
 }
 
@@ -163,6 +165,7 @@ func createAllRuntimeConfigFiles(dir, hypervisor string) (config testRuntimeConf
 		EnableIOThreads:       enableIOThreads,
 		HotplugVFIOOnRootBus:  hotplugVFIOOnRootBus,
 		Msize9p:               defaultMsize9p,
+		SharedFS:              defaultSharedFS,
 		MemSlots:              defaultMemSlots,
 		EntropySource:         defaultEntropySource,
 		GuestHookPath:         defaultGuestHookPath,
@@ -201,8 +204,9 @@ func createAllRuntimeConfigFiles(dir, hypervisor string) (config testRuntimeConf
 		ShimType:   defaultShim,
 		ShimConfig: shimConfig,
 
-		NetmonConfig:    netmonConfig,
-		DisableNewNetNs: disableNewNetNs,
+		NetmonConfig:     netmonConfig,
+		DisableNewNetNs:  disableNewNetNs,
+		IngressBandwidth: 1000000,
 
 		FactoryConfig: factoryConfig,
 	}
@@ -613,6 +617,7 @@ func TestMinimalRuntimeConfig(t *testing.T) {
 		Mlock:                 !defaultEnableSwap,
 		BlockDeviceDriver:     defaultBlockDeviceDriver,
 		Msize9p:               defaultMsize9p,
+		SharedFS:              defaultSharedFS,
 		GuestHookPath:         defaultGuestHookPath,
 	}
 
@@ -1121,6 +1126,73 @@ func TestHypervisorDefaultsGuestHookPath(t *testing.T) {
 	assert.Equal(guestHookPath, testGuestHookPath, "custom guest hook path wrong")
 }
 
+func TestHypervisorBalloonReclaimInterval(t *testing.T) {
+	assert := assert.New(t)
+
+	h := hypervisor{}
+	interval, err := h.balloonReclaimInterval()
+	assert.NoError(err)
+	assert.Zero(interval)
+
+	h.BalloonReclaimInterval = 10
+	_, err = h.balloonReclaimInterval()
+	assert.Error(err)
+
+	h.EnableBalloon = true
+	interval, err = h.balloonReclaimInterval()
+	assert.NoError(err)
+	assert.Equal(10*time.Second, interval)
+}
+
+func TestHypervisorSharedFS(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "shared-fs-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	h := hypervisor{}
+	sharedFS, err := h.sharedFS()
+	assert.NoError(err)
+	assert.Equal(defaultSharedFS, sharedFS)
+
+	h.SharedFS = "virtio-fs"
+	sharedFS, err = h.sharedFS()
+	assert.NoError(err)
+	assert.Equal("virtio-fs", sharedFS)
+
+	h.SharedFS = "nfs"
+	_, err = h.sharedFS()
+	assert.Error(err)
+
+	cache, err := h.virtioFSCache()
+	assert.NoError(err)
+	assert.Equal(defaultVirtioFSCache, cache)
+
+	h.VirtioFSCache = "none"
+	cache, err = h.virtioFSCache()
+	assert.NoError(err)
+	assert.Equal("none", cache)
+
+	h.VirtioFSCache = "sometimes"
+	_, err = h.virtioFSCache()
+	assert.Error(err)
+
+	savedVirtioFSDaemon := defaultVirtioFSDaemon
+	defer func() {
+		defaultVirtioFSDaemon = savedVirtioFSDaemon
+	}()
+
+	defaultVirtioFSDaemon = filepath.Join(dir, "virtiofsd")
+	_, err = h.virtioFSDaemon()
+	assert.Error(err)
+
+	assert.NoError(createEmptyFile(defaultVirtioFSDaemon))
+	daemon, err := h.virtioFSDaemon()
+	assert.NoError(err)
+	assert.Equal(defaultVirtioFSDaemon, daemon)
+}
+
 func TestProxyDefaults(t *testing.T) {
 	p := proxy{}
 
@@ -1590,6 +1662,100 @@ func TestCheckFactoryConfig(t *testing.T) {
 			assert.NoError(err, "test %d (%+v)", i, d)
 		}
 	}
+
+	// firecracker templates are snapshots, which need the jailer but
+	// neither an initrd nor to disable vsock.
+	config := oci.RuntimeConfig{
+		HypervisorType: vc.FirecrackerHypervisor,
+		HypervisorConfig: vc.HypervisorConfig{
+			ImagePath: "image",
+			UseVSock:  true,
+		},
+		FactoryConfig: oci.FactoryConfig{
+			Template: true,
+		},
+	}
+	assert.Error(checkFactoryConfig(config))
+
+	config.HypervisorConfig.JailerPath = "/usr/bin/jailer"
+	assert.NoError(checkFactoryConfig(config))
+}
+
+func TestCheckFactoryConfigVMCache(t *testing.T) {
+	assert := assert.New(t)
+
+	type testData struct {
+		hypervisorType vc.HypervisorType
+		useVSock       bool
+		expectError    bool
+	}
+
+	data := []testData{
+		{vc.QemuHypervisor, false, false},
+		{vc.QemuHypervisor, true, true},
+		{vc.FirecrackerHypervisor, true, false},
+		{vc.MockHypervisor, false, true},
+	}
+
+	for i, d := range data {
+		config := oci.RuntimeConfig{
+			HypervisorType: d.hypervisorType,
+			HypervisorConfig: vc.HypervisorConfig{
+				UseVSock: d.useVSock,
+			},
+			AgentType: vc.KataContainersAgent,
+			FactoryConfig: oci.FactoryConfig{
+				VMCacheNumber: 1,
+			},
+		}
+
+		err := checkFactoryConfig(config)
+
+		if d.expectError {
+			assert.Error(err, "test %d (%+v)", i, d)
+		} else {
+			assert.NoError(err, "test %d (%+v)", i, d)
+		}
+	}
+}
+
+func TestHypervisorJailer(t *testing.T) {
+	assert := assert.New(t)
+
+	h := hypervisor{}
+
+	p, err := h.jailerPath()
+	assert.NoError(err)
+	assert.Equal("", p)
+	assert.Equal(defaultJailerChrootBase, h.jailerChrootBase())
+
+	tmpdir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(tmpdir)
+
+	jailer := filepath.Join(tmpdir, "jailer")
+	h.JailerPath = jailer
+	_, err = h.jailerPath()
+	assert.Error(err)
+
+	err = createEmptyFile(jailer)
+	assert.NoError(err)
+
+	// The jailer cannot run firecracker as root.
+	_, err = h.jailerPath()
+	assert.Error(err)
+
+	h.JailerUID = 1000
+	_, err = h.jailerPath()
+	assert.Error(err)
+
+	h.JailerGID = 1000
+	p, err = h.jailerPath()
+	assert.NoError(err)
+	assert.Equal(jailer, p)
+
+	h.JailerChrootBase = "/var/lib/jailer"
+	assert.Equal("/var/lib/jailer", h.jailerChrootBase())
 }
 
 func TestCheckNetNsConfigShimTrace(t *testing.T) {
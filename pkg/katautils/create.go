@@ -169,26 +169,7 @@ func CreateSandbox(ctx context.Context, vci vc.VC, ociSpec oci.CompatOCISpec, ru
 	span, ctx := Trace(ctx, "createSandbox")
 	defer span.Finish()
 
-	sandboxConfig, err := oci.SandboxConfig(ociSpec, runtimeConfig, bundlePath, containerID, console, disableOutput, systemdCgroup)
-	if err != nil {
-		return nil, vc.Process{}, err
-	}
-
-	if builtIn {
-		sandboxConfig.Stateful = true
-	}
-
-	// Important to create the network namespace before the sandbox is
-	// created, because it is not responsible for the creation of the
-	// netns if it does not exist.
-	if err := SetupNetworkNamespace(&sandboxConfig.NetworkConfig); err != nil {
-		return nil, vc.Process{}, err
-	}
-
-	// Run pre-start OCI hooks.
-	err = EnterNetNS(sandboxConfig.NetworkConfig.NetNSPath, func() error {
-		return PreStartHooks(ctx, ociSpec, containerID, bundlePath)
-	})
+	sandboxConfig, err := newSandboxConfig(ctx, ociSpec, runtimeConfig, containerID, bundlePath, console, disableOutput, systemdCgroup, builtIn)
 	if err != nil {
 		return nil, vc.Process{}, err
 	}
@@ -217,6 +198,70 @@ func CreateSandbox(ctx context.Context, vci vc.VC, ociSpec oci.CompatOCISpec, ru
 	return sandbox, containers[0].Process(), nil
 }
 
+// RestoreSandbox restores a sandbox container, and all the containers
+// it was running, from a checkpoint.
+func RestoreSandbox(ctx context.Context, vci vc.VC, ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
+	containerID, bundlePath, checkpointDir, console string, disableOutput, systemdCgroup, builtIn bool) (vc.VCSandbox, error) {
+	span, ctx := Trace(ctx, "restoreSandbox")
+	defer span.Finish()
+
+	sandboxConfig, err := newSandboxConfig(ctx, ociSpec, runtimeConfig, containerID, bundlePath, console, disableOutput, systemdCgroup, builtIn)
+	if err != nil {
+		return nil, err
+	}
+
+	sandbox, err := vci.RestoreSandbox(ctx, sandboxConfig, checkpointDir)
+	if err != nil {
+		return nil, err
+	}
+
+	sid := sandbox.ID()
+	kataUtilsLogger = kataUtilsLogger.WithField("sandbox", sid)
+	span.SetTag("sandbox", sid)
+
+	if !builtIn {
+		for _, c := range sandbox.GetAllContainers() {
+			if err := AddContainerIDMapping(ctx, c.ID(), sid); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	return sandbox, nil
+}
+
+// newSandboxConfig builds the configuration of a sandbox container and
+// prepares the host for it: its network namespace gets created and the
+// OCI pre-start hooks are run.
+func newSandboxConfig(ctx context.Context, ociSpec oci.CompatOCISpec, runtimeConfig oci.RuntimeConfig,
+	containerID, bundlePath, console string, disableOutput, systemdCgroup, builtIn bool) (vc.SandboxConfig, error) {
+	sandboxConfig, err := oci.SandboxConfig(ociSpec, runtimeConfig, bundlePath, containerID, console, disableOutput, systemdCgroup)
+	if err != nil {
+		return vc.SandboxConfig{}, err
+	}
+
+	if builtIn {
+		sandboxConfig.Stateful = true
+	}
+
+	// Important to create the network namespace before the sandbox is
+	// created, because it is not responsible for the creation of the
+	// netns if it does not exist.
+	if err := SetupNetworkNamespace(&sandboxConfig.NetworkConfig); err != nil {
+		return vc.SandboxConfig{}, err
+	}
+
+	// Run pre-start OCI hooks.
+	err = EnterNetNS(sandboxConfig.NetworkConfig.NetNSPath, func() error {
+		return PreStartHooks(ctx, ociSpec, containerID, bundlePath)
+	})
+	if err != nil {
+		return vc.SandboxConfig{}, err
+	}
+
+	return sandboxConfig, nil
+}
+
 // CreateContainer create a container
 func CreateContainer(ctx context.Context, vci vc.VC, sandbox vc.VCSandbox, ociSpec oci.CompatOCISpec, containerID, bundlePath, console string, disableOutput, builtIn bool) (vc.Process, error) {
 	var c vc.VCContainer
@@ -0,0 +1,175 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	vcAnnotations "github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+)
+
+// configProfileSeparator separates the configuration file path from the
+// name of the profile to use in the ConfigPath containerd runtime option.
+const configProfileSeparator = "#"
+
+// A profile is a named runtime configuration, which combines some of the
+// hypervisor, agent, proxy and shim tables of the configuration file:
+//
+//   [profile.<name>]
+//   hypervisor = "firecracker"
+//
+// All the tables of the components a profile does not select are used, as
+// when there is no profile.
+type profile struct {
+	Hypervisor string   `toml:"hypervisor"`
+	Agent      string   `toml:"agent"`
+	Proxy      string   `toml:"proxy"`
+	Shim       string   `toml:"shim"`
+	Factory    *factory `toml:"factory"`
+}
+
+// tomlConfig returns the configuration file as seen by the profile, with
+// only the tables it selects.
+func (p profile) tomlConfig(tomlConf tomlConfig) (tomlConfig, error) {
+	if p.Hypervisor != "" {
+		h, ok := tomlConf.Hypervisor[p.Hypervisor]
+		if !ok {
+			return tomlConfig{}, fmt.Errorf("no [hypervisor.%s] table", p.Hypervisor)
+		}
+		tomlConf.Hypervisor = map[string]hypervisor{p.Hypervisor: h}
+	}
+
+	if p.Agent != "" {
+		a, ok := tomlConf.Agent[p.Agent]
+		if !ok {
+			return tomlConfig{}, fmt.Errorf("no [agent.%s] table", p.Agent)
+		}
+		tomlConf.Agent = map[string]agent{p.Agent: a}
+	}
+
+	if p.Proxy != "" {
+		pr, ok := tomlConf.Proxy[p.Proxy]
+		if !ok {
+			return tomlConfig{}, fmt.Errorf("no [proxy.%s] table", p.Proxy)
+		}
+		tomlConf.Proxy = map[string]proxy{p.Proxy: pr}
+	}
+
+	if p.Shim != "" {
+		s, ok := tomlConf.Shim[p.Shim]
+		if !ok {
+			return tomlConfig{}, fmt.Errorf("no [shim.%s] table", p.Shim)
+		}
+		tomlConf.Shim = map[string]shim{p.Shim: s}
+	}
+
+	if p.Factory != nil {
+		tomlConf.Factory = *p.Factory
+	}
+
+	return tomlConf, nil
+}
+
+// profileTomlConfig returns the configuration file as seen by the name
+// profile.
+func profileTomlConfig(tomlConf tomlConfig, name string) (tomlConfig, error) {
+	p, ok := tomlConf.Profile[name]
+	if !ok {
+		return tomlConfig{}, fmt.Errorf("Unknown runtime profile %q", name)
+	}
+
+	profileConf, err := p.tomlConfig(tomlConf)
+	if err != nil {
+		return tomlConfig{}, fmt.Errorf("Invalid runtime profile %q: %v", name, err)
+	}
+
+	return profileConf, nil
+}
+
+// newProfileConfigs returns the runtime configurations of the profiles of
+// the configuration file. They share the runtime section of the default
+// configuration, base.
+func newProfileConfigs(configPath string, tomlConf tomlConfig, base oci.RuntimeConfig, builtIn bool) (map[string]oci.RuntimeConfig, error) {
+	if len(tomlConf.Profile) == 0 {
+		return nil, nil
+	}
+
+	configs := make(map[string]oci.RuntimeConfig)
+
+	for name := range tomlConf.Profile {
+		profileConf, err := profileTomlConfig(tomlConf, name)
+		if err != nil {
+			return nil, fmt.Errorf("%v: %v", configPath, err)
+		}
+
+		config := base
+		config.Profiles = nil
+		config.HypervisorConfig.KernelParams = append([]vc.Param{}, base.HypervisorConfig.KernelParams...)
+
+		if err := updateRuntimeConfig(configPath, profileConf, &config, builtIn); err != nil {
+			return nil, fmt.Errorf("runtime profile %q: %v", name, err)
+		}
+
+		// use no proxy if HypervisorConfig.UseVSock is true
+		if config.HypervisorConfig.UseVSock {
+			config.ProxyType = vc.NoProxyType
+			config.ProxyConfig = vc.ProxyConfig{}
+		}
+
+		if err := checkConfig(config); err != nil {
+			return nil, fmt.Errorf("runtime profile %q: %v", name, err)
+		}
+
+		configs[name] = config
+	}
+
+	return configs, nil
+}
+
+// SplitConfigProfile splits a "<config path>#<profile>" containerd
+// ConfigPath runtime option into the configuration file path and the name
+// of the profile.
+func SplitConfigProfile(configPath string) (string, string) {
+	i := strings.LastIndex(configPath, configProfileSeparator)
+	if i < 0 {
+		return configPath, ""
+	}
+
+	return configPath[:i], configPath[i+1:]
+}
+
+// SelectProfile returns the runtime configuration of the profile a sandbox
+// selects, with its RuntimeProfile annotation or else with name. The default
+// runtime configuration is returned when none is selected, and an error when
+// the selected profile is unknown.
+func SelectProfile(ociSpec oci.CompatOCISpec, config oci.RuntimeConfig, name string) (oci.RuntimeConfig, error) {
+	if a, ok := ociSpec.Annotations[vcAnnotations.RuntimeProfile]; ok {
+		name = a
+	}
+
+	if name == "" {
+		return config, nil
+	}
+
+	profileConfig, ok := config.Profiles[name]
+	if !ok {
+		var names []string
+		for n := range config.Profiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+
+		return oci.RuntimeConfig{}, fmt.Errorf("Unknown runtime profile %q (profiles: %v)", name, names)
+	}
+
+	kataUtilsLogger.WithField("profile", name).Info("using runtime profile")
+
+	return profileConfig, nil
+}
@@ -0,0 +1,176 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package katautils
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	vc "github.com/kata-containers/runtime/virtcontainers"
+	vcAnnotations "github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
+	"github.com/kata-containers/runtime/virtcontainers/pkg/oci"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeProfilesConfigFileData(dir, profiles string) string {
+	return `
+	[hypervisor.qemu]
+	path = "` + filepath.Join(dir, "qemu") + `"
+	kernel = "` + filepath.Join(dir, "kernel") + `"
+	image = "` + filepath.Join(dir, "image") + `"
+
+	[hypervisor.firecracker]
+	path = "` + filepath.Join(dir, "firecracker") + `"
+	kernel = "` + filepath.Join(dir, "kernel") + `"
+	image = "` + filepath.Join(dir, "image") + `"
+
+	[proxy.kata]
+	path = "` + filepath.Join(dir, "proxy") + `"
+
+	[shim.kata]
+	path = "` + filepath.Join(dir, "shim") + `"
+
+	[agent.kata]
+	` + profiles
+}
+
+func TestLoadConfigurationProfiles(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "profiles-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	for _, file := range []string{"qemu", "firecracker", "kernel", "image", "proxy", "shim"} {
+		assert.NoError(WriteFile(filepath.Join(dir, file), "foo", testFileMode))
+	}
+
+	configPath := filepath.Join(dir, "runtime.toml")
+
+	// The firecracker table is not used, it would fail without vsock
+	// support.
+	profiles := `
+	[profile.qemu]
+	hypervisor = "qemu"
+
+	[profile.cache]
+	hypervisor = "qemu"
+	agent = "kata"
+
+	[profile.cache.factory]
+	vm_cache_number = 1
+
+	[runtime]
+	default_profile = "qemu"
+	`
+	assert.NoError(createConfig(configPath, makeProfilesConfigFileData(dir, profiles)))
+
+	_, config, err := LoadConfiguration(configPath, true, false)
+	assert.NoError(err)
+
+	assert.Equal(vc.QemuHypervisor, config.HypervisorType)
+	assert.Equal(filepath.Join(dir, "qemu"), config.HypervisorConfig.HypervisorPath)
+	assert.Zero(config.FactoryConfig.VMCacheNumber)
+	assert.Len(config.Profiles, 2)
+
+	qemu := config.Profiles["qemu"]
+	assert.Equal(vc.QemuHypervisor, qemu.HypervisorType)
+	assert.Equal(config.HypervisorConfig, qemu.HypervisorConfig)
+	assert.Zero(qemu.FactoryConfig.VMCacheNumber)
+	assert.Nil(qemu.Profiles)
+
+	cache := config.Profiles["cache"]
+	assert.Equal(vc.QemuHypervisor, cache.HypervisorType)
+	assert.Equal(uint(1), cache.FactoryConfig.VMCacheNumber)
+	assert.Equal(vc.KataContainersAgent, cache.AgentType)
+	assert.Equal(config.ProxyConfig, cache.ProxyConfig)
+
+	// Unknown default profile
+	profiles = `
+	[profile.cache]
+	hypervisor = "qemu"
+
+	[runtime]
+	default_profile = "qemu"
+	`
+	assert.NoError(createConfig(configPath, makeProfilesConfigFileData(dir, profiles)))
+	_, _, err = LoadConfiguration(configPath, true, false)
+	assert.Error(err)
+
+	// Profile of a missing table
+	profiles = `
+	[profile.qemu]
+	hypervisor = "qemu"
+
+	[profile.clh]
+	hypervisor = "clh"
+
+	[runtime]
+	default_profile = "qemu"
+	`
+	assert.NoError(createConfig(configPath, makeProfilesConfigFileData(dir, profiles)))
+	_, _, err = LoadConfiguration(configPath, true, false)
+	assert.Error(err)
+}
+
+func TestSelectProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	config := oci.RuntimeConfig{
+		HypervisorType: vc.QemuHypervisor,
+		Profiles: map[string]oci.RuntimeConfig{
+			"fc": {
+				HypervisorType: vc.FirecrackerHypervisor,
+			},
+			"qemu": {
+				HypervisorType: vc.QemuHypervisor,
+			},
+		},
+	}
+
+	var ociSpec oci.CompatOCISpec
+
+	selected, err := SelectProfile(ociSpec, config, "")
+	assert.NoError(err)
+	assert.Equal(config, selected)
+
+	selected, err = SelectProfile(ociSpec, config, "fc")
+	assert.NoError(err)
+	assert.Equal(vc.FirecrackerHypervisor, selected.HypervisorType)
+
+	_, err = SelectProfile(ociSpec, config, "clh")
+	assert.Error(err)
+
+	// The annotation takes precedence
+	ociSpec.Annotations = map[string]string{
+		vcAnnotations.RuntimeProfile: "qemu",
+	}
+	selected, err = SelectProfile(ociSpec, config, "fc")
+	assert.NoError(err)
+	assert.Equal(vc.QemuHypervisor, selected.HypervisorType)
+
+	ociSpec.Annotations[vcAnnotations.RuntimeProfile] = "clh"
+	_, err = SelectProfile(ociSpec, config, "")
+	assert.Error(err)
+}
+
+func TestSplitConfigProfile(t *testing.T) {
+	assert := assert.New(t)
+
+	path, profile := SplitConfigProfile("/etc/kata-containers/configuration.toml#fc")
+	assert.Equal("/etc/kata-containers/configuration.toml", path)
+	assert.Equal("fc", profile)
+
+	path, profile = SplitConfigProfile("/etc/kata-containers/configuration.toml")
+	assert.Equal("/etc/kata-containers/configuration.toml", path)
+	assert.Equal("", profile)
+
+	path, profile = SplitConfigProfile("")
+	assert.Equal("", path)
+	assert.Equal("", profile)
+}
@@ -0,0 +1,160 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package netapi
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	defaultRetries    = 10
+	defaultRetryDelay = 100 * time.Millisecond
+	maxRetryDelay     = 2 * time.Second
+
+	// The requests wait for the sandbox to be created, which includes
+	// booting its VM.
+	requestTimeout = time.Minute
+)
+
+// errRetry is an error after which the request was not handled, and can
+// be sent again.
+type errRetry struct {
+	err error
+}
+
+func (e errRetry) Error() string {
+	return e.err.Error()
+}
+
+// Client is a client of the network API served on a unix socket.
+type Client struct {
+	// Retries is how many times a request which could not be handled,
+	// because the socket is not served yet or the sandbox is not
+	// created yet, is sent again.
+	Retries int
+
+	// RetryDelay is the delay before sending a request again, doubled
+	// after each attempt.
+	RetryDelay time.Duration
+
+	client *http.Client
+}
+
+// NewClient returns a client of the network API served on socketPath.
+func NewClient(socketPath string) *Client {
+	return &Client{
+		Retries:    defaultRetries,
+		RetryDelay: defaultRetryDelay,
+		client: &http.Client{
+			Timeout: requestTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socketPath)
+				},
+			},
+		},
+	}
+}
+
+// isDialError tells if err is a failure to connect to the socket, which
+// is not served yet.
+func isDialError(err error) bool {
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+
+	opErr, ok := err.(*net.OpError)
+	return ok && opErr.Op == "dial"
+}
+
+// resultError returns the error of the last operation of a failed request.
+func resultError(data []byte) (string, []Result) {
+	var results []Result
+	if json.Unmarshal(data, &results) == nil && len(results) > 0 {
+		return results[len(results)-1].Error, results
+	}
+
+	var result Result
+	json.Unmarshal(data, &result)
+
+	return result.Error, nil
+}
+
+func (c *Client) post(ops []Operation) ([]Result, error) {
+	body, err := json.Marshal(ops)
+	if err != nil {
+		return nil, err
+	}
+
+	// The host is ignored, the requests go to the socket.
+	resp, err := c.client.Post("http://sandbox"+OperationsPath, "application/json", bytes.NewReader(body))
+	if err != nil {
+		if isDialError(err) {
+			return nil, errRetry{err}
+		}
+
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		msg, results := resultError(data)
+		err := fmt.Errorf("Network API request failed (%s): %s", resp.Status, msg)
+
+		if resp.StatusCode == http.StatusServiceUnavailable {
+			return nil, errRetry{err}
+		}
+
+		return results, err
+	}
+
+	var results []Result
+	if err := json.Unmarshal(data, &results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+// Apply sends the operations to apply in order, in a single request, and
+// returns their results. The request is sent again, after a delay, if it
+// could not be handled.
+func (c *Client) Apply(ops []Operation) ([]Result, error) {
+	delay := c.RetryDelay
+
+	for attempt := 0; ; attempt++ {
+		results, err := c.post(ops)
+
+		retry, ok := err.(errRetry)
+		if !ok {
+			return results, err
+		}
+
+		if attempt >= c.Retries {
+			return nil, retry.err
+		}
+
+		time.Sleep(delay)
+
+		if delay *= 2; delay > maxRetryDelay {
+			delay = maxRetryDelay
+		}
+	}
+}
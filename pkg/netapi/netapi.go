@@ -0,0 +1,251 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+// Package netapi implements the network management API of a sandbox,
+// served over a local socket by the runtime owning the sandbox, and used
+// by the network monitor to replicate the changes of the network
+// namespace into the sandbox.
+package netapi
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
+)
+
+// The network operations.
+const (
+	// AddInterface adds the operation interface to the sandbox.
+	AddInterface = "AddInterface"
+
+	// RemoveInterface removes the operation interface from the sandbox.
+	RemoveInterface = "RemoveInterface"
+
+	// UpdateInterface updates the addresses and the MTU of the operation
+	// interface, already added to the sandbox.
+	UpdateInterface = "UpdateInterface"
+
+	// UpdateBandwidth updates the bandwidth limits of the sandbox
+	// network interfaces with the operation bandwidth.
+	UpdateBandwidth = "UpdateBandwidth"
+
+	// UpdateRoutes replaces the sandbox routes with the operation routes.
+	UpdateRoutes = "UpdateRoutes"
+)
+
+// The API endpoints.
+const (
+	// OperationsPath applies a batch of operations, in order.
+	OperationsPath = "/v1/network/operations"
+
+	// InterfacesPath adds an interface on POST, updates it on PUT, and
+	// removes it on DELETE.
+	InterfacesPath = "/v1/network/interfaces"
+
+	// RoutesPath updates the routes on PUT.
+	RoutesPath = "/v1/network/routes"
+
+	// BandwidthPath updates the bandwidth limits on PUT.
+	BandwidthPath = "/v1/network/bandwidth"
+)
+
+var errSandboxNotReady = errors.New("The sandbox is not ready")
+
+// Operation is a network operation on a sandbox.
+type Operation struct {
+	Op        string             `json:"op"`
+	Interface *vcTypes.Interface `json:"interface,omitempty"`
+	Routes    []*vcTypes.Route   `json:"routes,omitempty"`
+	Bandwidth *vcTypes.Bandwidth `json:"bandwidth,omitempty"`
+}
+
+// Result is the result of a network operation. Error is set when the
+// operation failed.
+type Result struct {
+	Interface *vcTypes.Interface `json:"interface,omitempty"`
+	Routes    []*vcTypes.Route   `json:"routes,omitempty"`
+	Bandwidth *vcTypes.Bandwidth `json:"bandwidth,omitempty"`
+	Error     string             `json:"error,omitempty"`
+}
+
+// Sandbox is the network of a sandbox, as managed through the API.
+type Sandbox interface {
+	AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	UpdateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	UpdateBandwidth(bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error)
+	UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error)
+}
+
+func apply(s Sandbox, op Operation) (Result, error) {
+	var result Result
+	var err error
+
+	switch op.Op {
+	case AddInterface, RemoveInterface, UpdateInterface:
+		if op.Interface == nil {
+			return result, fmt.Errorf("Missing interface for network operation %s", op.Op)
+		}
+
+		switch op.Op {
+		case AddInterface:
+			result.Interface, err = s.AddInterface(op.Interface)
+		case RemoveInterface:
+			result.Interface, err = s.RemoveInterface(op.Interface)
+		default:
+			result.Interface, err = s.UpdateInterface(op.Interface)
+		}
+	case UpdateBandwidth:
+		if op.Bandwidth == nil {
+			return result, fmt.Errorf("Missing bandwidth for network operation %s", op.Op)
+		}
+
+		result.Bandwidth, err = s.UpdateBandwidth(op.Bandwidth)
+	case UpdateRoutes:
+		result.Routes, err = s.UpdateRoutes(op.Routes)
+	default:
+		err = fmt.Errorf("Unknown network operation %q", op.Op)
+	}
+
+	return result, err
+}
+
+// Apply applies the operations to the sandbox in order, and stops at the
+// first one which fails. The results of the operations applied, including
+// the failed one, are returned.
+func Apply(s Sandbox, ops []Operation) ([]Result, error) {
+	results := []Result{}
+
+	for _, op := range ops {
+		result, err := apply(s, op)
+		if err != nil {
+			result.Error = err.Error()
+			return append(results, result), err
+		}
+
+		results = append(results, result)
+	}
+
+	return results, nil
+}
+
+type handler struct {
+	sandbox func() Sandbox
+}
+
+// NewHandler returns the HTTP handler serving the network API. sandbox
+// returns the sandbox to manage, or nil when it is not created yet, in
+// which case the requests fail as unavailable and can be retried.
+func NewHandler(sandbox func() Sandbox) http.Handler {
+	h := &handler{sandbox: sandbox}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc(OperationsPath, h.operations)
+	mux.HandleFunc(InterfacesPath, h.interfaces)
+	mux.HandleFunc(RoutesPath, h.routes)
+	mux.HandleFunc(BandwidthPath, h.bandwidth)
+
+	return mux
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+// serve applies ops and replies with their results, or with the result of
+// the only operation when single is set.
+func (h *handler) serve(w http.ResponseWriter, ops []Operation, single bool) {
+	s := h.sandbox()
+	if s == nil {
+		writeJSON(w, http.StatusServiceUnavailable, Result{Error: errSandboxNotReady.Error()})
+		return
+	}
+
+	status := http.StatusOK
+	results, err := Apply(s, ops)
+	if err != nil {
+		status = http.StatusInternalServerError
+	}
+
+	if single {
+		writeJSON(w, status, results[0])
+		return
+	}
+
+	writeJSON(w, status, results)
+}
+
+func (h *handler) operations(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeJSON(w, http.StatusMethodNotAllowed, Result{Error: "Method not allowed"})
+		return
+	}
+
+	var ops []Operation
+	if err := json.NewDecoder(r.Body).Decode(&ops); err != nil {
+		writeJSON(w, http.StatusBadRequest, Result{Error: err.Error()})
+		return
+	}
+
+	h.serve(w, ops, false)
+}
+
+func (h *handler) interfaces(w http.ResponseWriter, r *http.Request) {
+	op := Operation{}
+
+	switch r.Method {
+	case http.MethodPost:
+		op.Op = AddInterface
+	case http.MethodPut:
+		op.Op = UpdateInterface
+	case http.MethodDelete:
+		op.Op = RemoveInterface
+	default:
+		writeJSON(w, http.StatusMethodNotAllowed, Result{Error: "Method not allowed"})
+		return
+	}
+
+	if err := json.NewDecoder(r.Body).Decode(&op.Interface); err != nil {
+		writeJSON(w, http.StatusBadRequest, Result{Error: err.Error()})
+		return
+	}
+
+	h.serve(w, []Operation{op}, true)
+}
+
+func (h *handler) routes(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, Result{Error: "Method not allowed"})
+		return
+	}
+
+	op := Operation{Op: UpdateRoutes}
+	if err := json.NewDecoder(r.Body).Decode(&op.Routes); err != nil {
+		writeJSON(w, http.StatusBadRequest, Result{Error: err.Error()})
+		return
+	}
+
+	h.serve(w, []Operation{op}, true)
+}
+
+func (h *handler) bandwidth(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		writeJSON(w, http.StatusMethodNotAllowed, Result{Error: "Method not allowed"})
+		return
+	}
+
+	op := Operation{Op: UpdateBandwidth}
+	if err := json.NewDecoder(r.Body).Decode(&op.Bandwidth); err != nil {
+		writeJSON(w, http.StatusBadRequest, Result{Error: err.Error()})
+		return
+	}
+
+	h.serve(w, []Operation{op}, true)
+}
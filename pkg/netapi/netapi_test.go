@@ -0,0 +1,228 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package netapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
+	"github.com/stretchr/testify/assert"
+)
+
+type testSandbox struct {
+	ops []string
+}
+
+func (s *testSandbox) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	s.ops = append(s.ops, AddInterface+" "+inf.Name)
+	return inf, nil
+}
+
+func (s *testSandbox) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	if inf.Name == "missing" {
+		return nil, errors.New("interface not found")
+	}
+
+	s.ops = append(s.ops, RemoveInterface+" "+inf.Name)
+	return inf, nil
+}
+
+func (s *testSandbox) UpdateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	s.ops = append(s.ops, UpdateInterface+" "+inf.Name)
+	return inf, nil
+}
+
+func (s *testSandbox) UpdateBandwidth(bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	s.ops = append(s.ops, UpdateBandwidth)
+	return bw, nil
+}
+
+func (s *testSandbox) UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error) {
+	s.ops = append(s.ops, UpdateRoutes)
+	return routes, nil
+}
+
+func TestApply(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &testSandbox{}
+	routes := []*vcTypes.Route{{Dest: "default", Gateway: "172.17.0.1", Device: "eth0"}}
+
+	results, err := Apply(s, []Operation{
+		{Op: AddInterface, Interface: &vcTypes.Interface{Name: "eth0"}},
+		{Op: UpdateInterface, Interface: &vcTypes.Interface{Name: "eth0", Mtu: 9000}},
+		{Op: UpdateBandwidth, Bandwidth: &vcTypes.Bandwidth{Ingress: 1000000}},
+		{Op: UpdateRoutes, Routes: routes},
+	})
+	assert.NoError(err)
+	assert.Len(results, 4)
+	assert.Equal("eth0", results[0].Interface.Name)
+	assert.Equal(uint64(9000), results[1].Interface.Mtu)
+	assert.Equal(uint64(1000000), results[2].Bandwidth.Ingress)
+	assert.Equal(routes, results[3].Routes)
+	assert.Equal([]string{"AddInterface eth0", "UpdateInterface eth0", "UpdateBandwidth", "UpdateRoutes"}, s.ops)
+
+	// Stops at the first failure
+	s.ops = nil
+	results, err = Apply(s, []Operation{
+		{Op: RemoveInterface, Interface: &vcTypes.Interface{Name: "missing"}},
+		{Op: UpdateRoutes},
+	})
+	assert.Error(err)
+	assert.Len(results, 1)
+	assert.Equal("interface not found", results[0].Error)
+	assert.Empty(s.ops)
+
+	_, err = Apply(s, []Operation{{Op: AddInterface}})
+	assert.Error(err)
+
+	_, err = Apply(s, []Operation{{Op: UpdateInterface}})
+	assert.Error(err)
+
+	_, err = Apply(s, []Operation{{Op: UpdateBandwidth}})
+	assert.Error(err)
+
+	_, err = Apply(s, []Operation{{Op: "Foo"}})
+	assert.Error(err)
+}
+
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &testSandbox{}
+	server := httptest.NewServer(NewHandler(func() Sandbox { return s }))
+	defer server.Close()
+
+	resp, err := http.Post(server.URL+InterfacesPath, "application/json", bytes.NewBufferString(`{"name":"eth1"}`))
+	assert.NoError(err)
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	var result Result
+	assert.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	assert.Equal("eth1", result.Interface.Name)
+
+	req, err := http.NewRequest(http.MethodPut, server.URL+InterfacesPath, bytes.NewBufferString(`{"name":"eth1","mtu":9000}`))
+	assert.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodDelete, server.URL+InterfacesPath, bytes.NewBufferString(`{"name":"missing"}`))
+	assert.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusInternalServerError, resp.StatusCode)
+
+	req, err = http.NewRequest(http.MethodPut, server.URL+BandwidthPath, bytes.NewBufferString(`{"ingress":1000000,"egress":2000000}`))
+	assert.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(err)
+	assert.NoError(json.NewDecoder(resp.Body).Decode(&result))
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+	assert.Equal(&vcTypes.Bandwidth{Ingress: 1000000, Egress: 2000000}, result.Bandwidth)
+
+	req, err = http.NewRequest(http.MethodPut, server.URL+RoutesPath, bytes.NewBufferString(`[]`))
+	assert.NoError(err)
+	resp, err = http.DefaultClient.Do(req)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusOK, resp.StatusCode)
+
+	resp, err = http.Get(server.URL + RoutesPath)
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusMethodNotAllowed, resp.StatusCode)
+
+	resp, err = http.Post(server.URL+OperationsPath, "application/json", bytes.NewBufferString(`{`))
+	assert.NoError(err)
+	resp.Body.Close()
+	assert.Equal(http.StatusBadRequest, resp.StatusCode)
+
+	assert.Equal([]string{"AddInterface eth1", "UpdateInterface eth1", "UpdateBandwidth", "UpdateRoutes"}, s.ops)
+}
+
+func TestClient(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "netapi-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, "network.sock")
+
+	var mu sync.Mutex
+	var sandbox Sandbox
+	s := &testSandbox{}
+
+	handler := NewHandler(func() Sandbox {
+		mu.Lock()
+		defer mu.Unlock()
+		return sandbox
+	})
+
+	c := NewClient(socketPath)
+	c.RetryDelay = time.Millisecond
+
+	ops := []Operation{
+		{Op: AddInterface, Interface: &vcTypes.Interface{Name: "eth0"}},
+		{Op: UpdateRoutes},
+	}
+
+	// The socket is not served
+	c.Retries = 2
+	_, err = c.Apply(ops)
+	assert.Error(err)
+
+	listener, err := net.Listen("unix", socketPath)
+	assert.NoError(err)
+	defer listener.Close()
+	go http.Serve(listener, handler)
+
+	// The sandbox is not created
+	_, err = c.Apply(ops)
+	assert.Error(err)
+	assert.Empty(s.ops)
+
+	// The sandbox is created while the client retries
+	c.Retries = 100
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		mu.Lock()
+		sandbox = s
+		mu.Unlock()
+	}()
+
+	results, err := c.Apply(ops)
+	assert.NoError(err)
+	assert.Len(results, 2)
+	assert.Equal([]string{"AddInterface eth0", "UpdateRoutes"}, s.ops)
+
+	// A failed operation is not sent again
+	s.ops = nil
+	results, err = c.Apply([]Operation{
+		{Op: UpdateRoutes},
+		{Op: RemoveInterface, Interface: &vcTypes.Interface{Name: "missing"}},
+	})
+	assert.Error(err)
+	assert.Len(results, 2)
+	assert.Equal("interface not found", results[1].Error)
+	assert.Equal([]string{"UpdateRoutes"}, s.ops)
+}
@@ -10,6 +10,7 @@ import (
 	"os"
 	"runtime"
 	"syscall"
+	"time"
 
 	deviceApi "github.com/kata-containers/runtime/virtcontainers/device/api"
 	deviceConfig "github.com/kata-containers/runtime/virtcontainers/device/config"
@@ -65,6 +66,21 @@ func CreateSandbox(ctx context.Context, sandboxConfig SandboxConfig, factory Fac
 	return s, err
 }
 
+// RestoreSandbox is the virtcontainers sandbox restore entry point.
+// RestoreSandbox boots a sandbox and its containers from a checkpoint
+// created through VCSandbox.Checkpoint().
+func RestoreSandbox(ctx context.Context, sandboxConfig SandboxConfig, checkpointDir string) (VCSandbox, error) {
+	span, ctx := trace(ctx, "RestoreSandbox")
+	defer span.Finish()
+
+	s, err := restoreSandbox(ctx, sandboxConfig, checkpointDir)
+	if err == nil {
+		s.releaseStatelessSandbox()
+	}
+
+	return s, err
+}
+
 func createSandboxFromConfig(ctx context.Context, sandboxConfig SandboxConfig, factory Factory) (*Sandbox, error) {
 	span, ctx := trace(ctx, "createSandboxFromConfig")
 	defer span.Finish()
@@ -85,9 +101,11 @@ func createSandboxFromConfig(ctx context.Context, sandboxConfig SandboxConfig, f
 	}()
 
 	// Create the sandbox network
+	start := time.Now()
 	if err = s.createNetwork(); err != nil {
 		return nil, err
 	}
+	observeBootPhase(bootPhaseNetwork, start)
 
 	// network rollback
 	defer func() {
@@ -113,9 +131,11 @@ func createSandboxFromConfig(ctx context.Context, sandboxConfig SandboxConfig, f
 	}
 
 	// Create Containers
+	start = time.Now()
 	if err = s.createContainers(); err != nil {
 		return nil, err
 	}
+	observeBootPhase(bootPhaseContainers, start)
 
 	// The sandbox is completely created now, we can store it.
 	if err = s.storeSandbox(); err != nil {
@@ -842,6 +862,54 @@ func RemoveInterface(ctx context.Context, sandboxID string, inf *vcTypes.Interfa
 	return toggleInterface(ctx, sandboxID, inf, false)
 }
 
+// UpdateInterface is the virtcontainers update interface entry point.
+func UpdateInterface(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	span, ctx := trace(ctx, "UpdateInterface")
+	defer span.Finish()
+
+	if sandboxID == "" {
+		return nil, errNeedSandboxID
+	}
+
+	lockFile, err := rwLockSandbox(ctx, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockSandbox(ctx, sandboxID, lockFile)
+
+	s, err := fetchSandbox(ctx, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseStatelessSandbox()
+
+	return s.UpdateInterface(inf)
+}
+
+// UpdateBandwidth is the virtcontainers update bandwidth entry point.
+func UpdateBandwidth(ctx context.Context, sandboxID string, bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	span, ctx := trace(ctx, "UpdateBandwidth")
+	defer span.Finish()
+
+	if sandboxID == "" {
+		return nil, errNeedSandboxID
+	}
+
+	lockFile, err := rwLockSandbox(ctx, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer unlockSandbox(ctx, sandboxID, lockFile)
+
+	s, err := fetchSandbox(ctx, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+	defer s.releaseStatelessSandbox()
+
+	return s.UpdateBandwidth(bw)
+}
+
 // ListInterfaces is the virtcontainers list interfaces entry point.
 func ListInterfaces(ctx context.Context, sandboxID string) ([]*vcTypes.Interface, error) {
 	span, ctx := trace(ctx, "ListInterfaces")
@@ -2428,6 +2428,9 @@ func TestNetworkOperation(t *testing.T) {
 	_, err = AddInterface(ctx, "abc", inf)
 	assert.Error(err)
 
+	_, err = UpdateInterface(ctx, "", inf)
+	assert.Error(err)
+
 	netNSPath, err := createNetNS()
 	assert.NoError(err)
 	defer deleteNetNS(netNSPath)
@@ -2447,6 +2450,10 @@ func TestNetworkOperation(t *testing.T) {
 	_, err = RemoveInterface(ctx, s.ID(), inf)
 	assert.NoError(err)
 
+	// The interface was not added
+	_, err = UpdateInterface(ctx, s.ID(), inf)
+	assert.Error(err)
+
 	_, err = ListInterfaces(ctx, s.ID())
 	assert.NoError(err)
 
@@ -106,12 +106,37 @@ func (endpoint *BridgedMacvlanEndpoint) Detach(netNsCreated bool, netNsPath stri
 	})
 }
 
-// HotAttach for physical endpoint not supported yet
+// HotAttach for the virtual endpoint bridges the network pair and hot
+// plugs the tap interface of the network pair into the hypervisor.
 func (endpoint *BridgedMacvlanEndpoint) HotAttach(h hypervisor) error {
-	return fmt.Errorf("BridgedMacvlanEndpoint does not support Hot attach")
+	if err := xConnectVMNetwork(endpoint, h); err != nil {
+		networkLogger().WithError(err).Error("Error bridging virtual ep")
+		return err
+	}
+
+	if _, err := h.hotplugAddDevice(endpoint, netDev); err != nil {
+		networkLogger().WithError(err).Error("Error attach virtual ep")
+		return err
+	}
+	return nil
 }
 
-// HotDetach for physical endpoint not supported yet
+// HotDetach for the virtual endpoint tears down the tap and bridge
+// created for the interface, and hot unplugs the tap interface.
 func (endpoint *BridgedMacvlanEndpoint) HotDetach(h hypervisor, netNsCreated bool, netNsPath string) error {
-	return fmt.Errorf("BridgedMacvlanEndpoint does not support Hot detach")
+	if !netNsCreated {
+		return nil
+	}
+
+	if err := doNetNS(netNsPath, func(_ ns.NetNS) error {
+		return xDisconnectVMNetwork(endpoint)
+	}); err != nil {
+		networkLogger().WithError(err).Warn("Error un-bridging virtual ep")
+	}
+
+	if _, err := h.hotplugRemoveDevice(endpoint, netDev); err != nil {
+		networkLogger().WithError(err).Error("Error detach virtual ep")
+		return err
+	}
+	return nil
 }
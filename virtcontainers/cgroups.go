@@ -87,15 +87,41 @@ func cgroupPathers(subystems []cgroups.Subsystem) []cgroupPather {
 // v1MountPoint returns the mount point where the cgroup
 // mountpoints are mounted in a single hiearchy
 func cgroupV1MountPoint() (string, error) {
-	f, err := os.Open("/proc/self/mountinfo")
+	v1, _, err := cgroupMountPoints()
+	if err != nil {
+		return "", err
+	}
+	if v1 == "" {
+		return "", cgroups.ErrMountPointNotExist
+	}
+	return filepath.Dir(v1), nil
+}
+
+// cgroupV2MountPoint returns the mount point of the cgroup v2 unified
+// hierarchy, as long as no cgroup v1 hierarchy is mounted.
+func cgroupV2MountPoint() (string, error) {
+	v1, v2, err := cgroupMountPoints()
 	if err != nil {
 		return "", err
 	}
+	if v1 != "" || v2 == "" {
+		return "", cgroups.ErrMountPointNotExist
+	}
+	return v2, nil
+}
+
+// cgroupMountPoints returns the mount points of the first cgroup v1
+// and cgroup v2 hierarchies found, if any.
+func cgroupMountPoints() (v1 string, v2 string, err error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return "", "", err
+	}
 	defer f.Close()
 	scanner := bufio.NewScanner(f)
 	for scanner.Scan() {
 		if err := scanner.Err(); err != nil {
-			return "", err
+			return "", "", err
 		}
 		var (
 			text   = scanner.Text()
@@ -107,17 +133,24 @@ func cgroupV1MountPoint() (string, error) {
 		)
 		// this is an error as we can't detect if the mount is for "cgroup"
 		if numPostFields == 0 {
-			return "", fmt.Errorf("Found no fields post '-' in %q", text)
+			return "", "", fmt.Errorf("Found no fields post '-' in %q", text)
 		}
-		if postSeparatorFields[0] == "cgroup" {
+		switch postSeparatorFields[0] {
+		case "cgroup":
 			// check that the mount is properly formated.
 			if numPostFields < 3 {
-				return "", fmt.Errorf("Error found less than 3 fields post '-' in %q", text)
+				return "", "", fmt.Errorf("Error found less than 3 fields post '-' in %q", text)
+			}
+			if v1 == "" {
+				v1 = fields[4]
+			}
+		case "cgroup2":
+			if v2 == "" {
+				v2 = fields[4]
 			}
-			return filepath.Dir(fields[4]), nil
 		}
 	}
-	return "", cgroups.ErrMountPointNotExist
+	return v1, v2, nil
 }
 
 func cgroupNoConstraintsPath(path string) string {
@@ -144,6 +177,10 @@ func (s *Sandbox) updateCgroups() error {
 		return nil
 	}
 
+	if isCgroupV2() {
+		return s.updateCgroupsV2()
+	}
+
 	cgroup, err := cgroupsLoadFunc(V1Constraints, cgroups.StaticPath(s.state.CgroupPath))
 	if err != nil {
 		return fmt.Errorf("Could not load cgroup %v: %v", s.state.CgroupPath, err)
@@ -173,6 +210,10 @@ func (s *Sandbox) updateCgroups() error {
 func (s *Sandbox) deleteCgroups() error {
 	s.Logger().Debug("Deleting sandbox cgroup")
 
+	if isCgroupV2() {
+		return s.deleteCgroupsV2()
+	}
+
 	path := cgroupNoConstraintsPath(s.state.CgroupPath)
 	s.Logger().WithField("path", path).Debug("Deleting no constraints cgroup")
 	noConstraintsCgroup, err := cgroupsLoadFunc(V1NoConstraints, cgroups.StaticPath(path))
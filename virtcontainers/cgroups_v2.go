@@ -0,0 +1,671 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/containerd/cgroups"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+)
+
+const (
+	// cgroupV2VCPUsDir is the threaded cgroup, child of the hypervisor
+	// cgroup, the vCPU threads are placed into.
+	cgroupV2VCPUsDir = "vcpus"
+
+	// cgroupV2HypervisorDir is the cgroup, child of the sandbox cgroup,
+	// the hypervisor is placed into.
+	cgroupV2HypervisorDir = "hypervisor"
+
+	// cgroupV2ShimDir is the leaf cgroup, child of a container cgroup,
+	// the shim is placed into. A cgroup cannot have processes of its own
+	// once controllers are enabled for its children, as the hypervisor
+	// cgroup under the sandbox cgroup requires.
+	cgroupV2ShimDir = "shim"
+
+	// cgroupV2DefaultPeriod is the cpu.max period used when the
+	// resources define a quota but no period.
+	cgroupV2DefaultPeriod = 100000
+)
+
+// cgroupV2Controllers are the controllers kata may use to constrain
+// the sandbox and containers on a unified hierarchy.
+var cgroupV2Controllers = []string{"cpu", "cpuset", "io", "memory"}
+
+// cgroupV2ThreadedControllers are the controllers that can be enabled
+// in a threaded subtree.
+var cgroupV2ThreadedControllers = []string{"cpu", "cpuset"}
+
+var cgroupV2MountPointFunc = cgroupV2MountPoint
+
+// the unified hierarchy mount point is looked up once, the cgroup
+// mounts of the host are not expected to change.
+var (
+	cgroupV2RootOnce sync.Once
+	cgroupV2RootPath string
+	cgroupV2RootErr  error
+)
+
+// cgroupV2Root returns the mount point of the unified hierarchy.
+func cgroupV2Root() (string, error) {
+	cgroupV2RootOnce.Do(func() {
+		cgroupV2RootPath, cgroupV2RootErr = cgroupV2MountPointFunc()
+	})
+
+	return cgroupV2RootPath, cgroupV2RootErr
+}
+
+// isCgroupV2 returns true when the host only mounts the cgroup v2
+// unified hierarchy. Hybrid hosts keep using the v1 controllers.
+func isCgroupV2() bool {
+	_, err := cgroupV2Root()
+	return err == nil
+}
+
+// cgroupV2HypervisorPath returns the path of the hypervisor cgroup of
+// the sandbox cgroup at path.
+func cgroupV2HypervisorPath(path string) string {
+	return filepath.Join(path, cgroupV2HypervisorDir)
+}
+
+// newContainerCgroup creates the cgroup of a container, on the unified
+// hierarchy when the host only uses cgroup v2.
+func newContainerCgroup(path string, resources *specs.LinuxResources) (cgroups.Cgroup, error) {
+	if !isCgroupV2() {
+		return cgroupsNewFunc(cgroups.V1, cgroups.StaticPath(path), resources)
+	}
+
+	cg, err := newCgroupV2(path, resources)
+	if err != nil {
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+// addContainerProcess adds the process pid, the shim, to the cgroup of a
+// container. On the unified hierarchy it is added to a leaf child cgroup.
+func addContainerProcess(cgroup cgroups.Cgroup, pid int) error {
+	if cg, ok := cgroup.(*cgroupV2); ok {
+		leaf, err := newCgroupV2(filepath.Join(cg.path, cgroupV2ShimDir), &specs.LinuxResources{})
+		if err != nil {
+			return err
+		}
+		cgroup = leaf
+	}
+
+	return cgroup.Add(cgroups.Process{Pid: pid})
+}
+
+// loadContainerCgroup loads the cgroup of a container, from the unified
+// hierarchy when the host only uses cgroup v2.
+func loadContainerCgroup(path string) (cgroups.Cgroup, error) {
+	if !isCgroupV2() {
+		return cgroupsLoadFunc(cgroups.V1, cgroups.StaticPath(path))
+	}
+
+	cg, err := loadCgroupV2(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+// parentContainerCgroup returns the cgroup the processes of a container
+// cgroup are moved to before deleting it. On the unified hierarchy the
+// parent cgroup cannot have processes of its own when controllers are
+// enabled for its children, the root cgroup is used instead.
+func parentContainerCgroup(path string) (cgroups.Cgroup, error) {
+	if !isCgroupV2() {
+		return parentCgroup(cgroups.V1, path)
+	}
+
+	root, err := loadCgroupV2("/")
+	if err != nil {
+		return nil, err
+	}
+
+	return root, nil
+}
+
+func (s *Sandbox) updateCgroupsV2() error {
+	resources, err := s.resources()
+	if err != nil {
+		return err
+	}
+
+	return s.constrainHypervisorV2(&resources)
+}
+
+func (s *Sandbox) deleteCgroupsV2() error {
+	path := cgroupV2HypervisorPath(s.state.CgroupPath)
+	s.Logger().WithField("path", path).Debug("Deleting hypervisor cgroup")
+
+	cgroup, err := loadCgroupV2(path)
+	if err == cgroups.ErrCgroupDeleted {
+		// cgroup already deleted
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("Could not load hypervisor cgroup %v: %v", path, err)
+	}
+
+	// move running process to the root cgroup, that way cgroup can be removed
+	root, err := loadCgroupV2("/")
+	if err != nil {
+		return err
+	}
+
+	if err := cgroup.MoveTo(root); err != nil {
+		// Don't fail, cgroup can be deleted
+		s.Logger().WithError(err).Warn("Could not move process from hypervisor to root cgroup")
+	}
+
+	return cgroup.Delete()
+}
+
+// constrainHypervisorV2 is the unified hierarchy counterpart of
+// constrainHypervisor. Processes of a cgroup v2 cannot be split across
+// cgroups, only their threads can, within a threaded subtree. The
+// hypervisor is placed into its own cgroup under the sandbox cgroup,
+// unconstrained, and its vCPU threads into a threaded child cgroup
+// constrained with resources.
+func (s *Sandbox) constrainHypervisorV2(resources *specs.LinuxResources) error {
+	pid := s.hypervisor.pid()
+	if pid <= 0 {
+		return fmt.Errorf("Invalid hypervisor PID: %d", pid)
+	}
+
+	path := cgroupV2HypervisorPath(s.state.CgroupPath)
+	hypervisorCgroup, err := newCgroupV2(path, &specs.LinuxResources{})
+	if err != nil {
+		return fmt.Errorf("Could not create cgroup %v: %v", path, err)
+	}
+
+	if err := hypervisorCgroup.Add(cgroups.Process{Pid: pid}); err != nil {
+		return fmt.Errorf("Could not add hypervisor PID %d to cgroup %v: %v", pid, path, err)
+	}
+
+	// when new container joins, new CPU could be hotplugged, so we
+	// have to query fresh vcpu info from hypervisor for every time.
+	tids, err := s.hypervisor.getThreadIDs()
+	if err != nil {
+		return fmt.Errorf("failed to get thread ids from hypervisor: %v", err)
+	}
+	if tids == nil || len(tids.vcpus) == 0 {
+		// nothing to constrain
+		return nil
+	}
+
+	vcpusCgroup, err := hypervisorCgroup.newThreaded(cgroupV2VCPUsDir, resources)
+	if err != nil {
+		return fmt.Errorf("Could not create vCPUs cgroup under %v: %v", path, err)
+	}
+
+	for _, i := range tids.vcpus {
+		if err := vcpusCgroup.AddTask(cgroups.Process{Pid: i}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// cgroupV2 is a cgroup of the unified hierarchy.
+// It implements the cgroups.Cgroup interface so that it can be handled
+// the same way as the v1 cgroups.
+type cgroupV2 struct {
+	root string
+	path string
+}
+
+// newCgroupV2 creates, or reuses, the cgroup at path in the unified
+// hierarchy and applies resources to it.
+func newCgroupV2(path string, resources *specs.LinuxResources) (*cgroupV2, error) {
+	root, err := cgroupV2Root()
+	if err != nil {
+		return nil, err
+	}
+
+	cg := &cgroupV2{
+		root: root,
+		path: filepath.Join("/", path),
+	}
+
+	if err := os.MkdirAll(cg.dir(), 0755); err != nil {
+		return nil, err
+	}
+
+	// The controllers used by a cgroup have to be enabled all the way
+	// down from the root.
+	parent := root
+	for _, elem := range strings.Split(strings.Trim(cg.path, "/"), "/") {
+		if err := cg.enableControllers(parent, cgroupV2Controllers); err != nil {
+			return nil, err
+		}
+		parent = filepath.Join(parent, elem)
+	}
+
+	if err := cg.Update(resources); err != nil {
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+// loadCgroupV2 loads the existing cgroup at path in the unified hierarchy.
+func loadCgroupV2(path string) (*cgroupV2, error) {
+	root, err := cgroupV2Root()
+	if err != nil {
+		return nil, err
+	}
+
+	cg := &cgroupV2{
+		root: root,
+		path: filepath.Join("/", path),
+	}
+
+	if _, err := os.Lstat(cg.dir()); err != nil {
+		if os.IsNotExist(err) {
+			return nil, cgroups.ErrCgroupDeleted
+		}
+		return nil, err
+	}
+
+	return cg, nil
+}
+
+func (cg *cgroupV2) dir() string {
+	return filepath.Join(cg.root, cg.path)
+}
+
+func (cg *cgroupV2) read(file string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(cg.dir(), file))
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(data)), nil
+}
+
+func (cg *cgroupV2) write(file, value string) error {
+	if err := ioutil.WriteFile(filepath.Join(cg.dir(), file), []byte(value), 0644); err != nil {
+		return fmt.Errorf("Could not write %q to %v: %v", value, filepath.Join(cg.path, file), err)
+	}
+
+	return nil
+}
+
+// enableControllers enables, among controllers, the ones available in
+// the cgroup at dir for its children. Controllers already enabled are
+// left alone.
+func (cg *cgroupV2) enableControllers(dir string, controllers []string) error {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.controllers"))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	available := make(map[string]bool)
+	for _, c := range strings.Fields(string(data)) {
+		available[c] = true
+	}
+
+	// the subtree_control file may not exist yet in a cgroup just
+	// created, nothing is enabled then.
+	enabled := make(map[string]bool)
+	if data, err := ioutil.ReadFile(filepath.Join(dir, "cgroup.subtree_control")); err == nil {
+		for _, c := range strings.Fields(string(data)) {
+			enabled[strings.TrimPrefix(c, "+")] = true
+		}
+	}
+
+	for _, c := range controllers {
+		if !available[c] || enabled[c] {
+			continue
+		}
+
+		file := filepath.Join(dir, "cgroup.subtree_control")
+		if err := ioutil.WriteFile(file, []byte("+"+c), 0644); err != nil {
+			return fmt.Errorf("Could not enable controller %s in %v: %v", c, dir, err)
+		}
+	}
+
+	return nil
+}
+
+// newThreaded creates a threaded child cgroup. The threads of the
+// processes in cg can be moved into it with AddTask, and constrained
+// with the threaded controllers only.
+func (cg *cgroupV2) newThreaded(name string, resources *specs.LinuxResources) (*cgroupV2, error) {
+	child := &cgroupV2{
+		root: cg.root,
+		path: filepath.Join(cg.path, name),
+	}
+
+	if err := os.MkdirAll(child.dir(), 0755); err != nil {
+		return nil, err
+	}
+
+	if t, err := child.read("cgroup.type"); err != nil || t != "threaded" {
+		if err := child.write("cgroup.type", "threaded"); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := cg.enableControllers(cg.dir(), cgroupV2ThreadedControllers); err != nil {
+		return nil, err
+	}
+
+	r := &specs.LinuxResources{}
+	if resources != nil {
+		r.CPU = resources.CPU
+	}
+
+	if err := child.Update(r); err != nil {
+		return nil, err
+	}
+
+	return child, nil
+}
+
+// New creates a new cgroup under cg.
+func (cg *cgroupV2) New(name string, resources *specs.LinuxResources) (cgroups.Cgroup, error) {
+	return newCgroupV2(filepath.Join(cg.path, name), resources)
+}
+
+// Add moves a process into the cgroup.
+func (cg *cgroupV2) Add(process cgroups.Process) error {
+	if process.Pid <= 0 {
+		return cgroups.ErrInvalidPid
+	}
+
+	return cg.write("cgroup.procs", strconv.Itoa(process.Pid))
+}
+
+// AddTask moves a thread into the cgroup.
+func (cg *cgroupV2) AddTask(process cgroups.Process) error {
+	if process.Pid <= 0 {
+		return cgroups.ErrInvalidPid
+	}
+
+	return cg.write("cgroup.threads", strconv.Itoa(process.Pid))
+}
+
+// Delete removes the cgroup and its children.
+func (cg *cgroupV2) Delete() error {
+	var dirs []string
+
+	err := filepath.Walk(cg.dir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			dirs = append(dirs, path)
+		}
+		return nil
+	})
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	// children first
+	for i := len(dirs) - 1; i >= 0; i-- {
+		if err := os.Remove(dirs[i]); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// MoveTo moves all the processes of the cgroup and of its children, which
+// Delete removes as well, to destination.
+func (cg *cgroupV2) MoveTo(destination cgroups.Cgroup) error {
+	processes, err := cg.Processes("", true)
+	if err != nil {
+		return err
+	}
+
+	for _, p := range processes {
+		if err := destination.Add(p); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Stat is not supported on the unified hierarchy.
+func (cg *cgroupV2) Stat(...cgroups.ErrorHandler) (*cgroups.Metrics, error) {
+	return nil, fmt.Errorf("Stat is not supported on cgroup v2")
+}
+
+// Update applies resources to the cgroup.
+func (cg *cgroupV2) Update(resources *specs.LinuxResources) error {
+	for _, s := range cgroupV2Resources(resources) {
+		if err := cg.write(s.file, s.value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Processes returns the processes of the cgroup. The subsystem name is
+// ignored, the unified hierarchy has a single tree.
+func (cg *cgroupV2) Processes(_ cgroups.Name, recursive bool) ([]cgroups.Process, error) {
+	var processes []cgroups.Process
+
+	err := filepath.Walk(cg.dir(), func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		if !recursive && path != cg.dir() {
+			return filepath.SkipDir
+		}
+
+		data, err := ioutil.ReadFile(filepath.Join(path, "cgroup.procs"))
+		if os.IsNotExist(err) {
+			// removed since walked
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, field := range strings.Fields(string(data)) {
+			pid, err := strconv.Atoi(field)
+			if err != nil {
+				return err
+			}
+			processes = append(processes, cgroups.Process{
+				Pid:  pid,
+				Path: path,
+			})
+		}
+
+		return nil
+	})
+
+	return processes, err
+}
+
+// Freeze freezes all the processes of the cgroup.
+func (cg *cgroupV2) Freeze() error {
+	return cg.write("cgroup.freeze", "1")
+}
+
+// Thaw resumes all the processes of the cgroup.
+func (cg *cgroupV2) Thaw() error {
+	return cg.write("cgroup.freeze", "0")
+}
+
+// OOMEventFD is not supported on the unified hierarchy.
+func (cg *cgroupV2) OOMEventFD() (uintptr, error) {
+	return 0, fmt.Errorf("OOM event fd is not supported on cgroup v2")
+}
+
+// State returns the state of the cgroup.
+func (cg *cgroupV2) State() cgroups.State {
+	if _, err := os.Lstat(cg.dir()); err != nil {
+		return cgroups.Deleted
+	}
+
+	if frozen, err := cg.read("cgroup.freeze"); err == nil && frozen == "1" {
+		return cgroups.Frozen
+	}
+
+	return cgroups.Thawed
+}
+
+// Subsystems returns nil, the unified hierarchy has no subsystems.
+func (cg *cgroupV2) Subsystems() []cgroups.Subsystem {
+	return nil
+}
+
+// cgroupV2Setting is a value to be written into a cgroup v2 interface file.
+type cgroupV2Setting struct {
+	file  string
+	value string
+}
+
+// cgroupV2Resources translates the OCI resources into cgroup v2 settings.
+func cgroupV2Resources(resources *specs.LinuxResources) []cgroupV2Setting {
+	var settings []cgroupV2Setting
+
+	if resources == nil {
+		return nil
+	}
+
+	if cpu := resources.CPU; cpu != nil {
+		if cpu.Quota != nil || cpu.Period != nil {
+			quota := "max"
+			if cpu.Quota != nil && *cpu.Quota > 0 {
+				quota = strconv.FormatInt(*cpu.Quota, 10)
+			}
+
+			period := uint64(cgroupV2DefaultPeriod)
+			if cpu.Period != nil && *cpu.Period > 0 {
+				period = *cpu.Period
+			}
+
+			settings = append(settings, cgroupV2Setting{"cpu.max", fmt.Sprintf("%s %d", quota, period)})
+		}
+
+		if cpu.Shares != nil && *cpu.Shares > 0 {
+			settings = append(settings, cgroupV2Setting{"cpu.weight", strconv.FormatUint(cgroupV2CPUWeight(*cpu.Shares), 10)})
+		}
+
+		if cpu.Cpus != "" {
+			settings = append(settings, cgroupV2Setting{"cpuset.cpus", cpu.Cpus})
+		}
+
+		if cpu.Mems != "" {
+			settings = append(settings, cgroupV2Setting{"cpuset.mems", cpu.Mems})
+		}
+	}
+
+	if mem := resources.Memory; mem != nil {
+		if mem.Reservation != nil {
+			settings = append(settings, cgroupV2Setting{"memory.low", cgroupV2Limit(*mem.Reservation)})
+		}
+
+		if mem.Limit != nil {
+			settings = append(settings, cgroupV2Setting{"memory.max", cgroupV2Limit(*mem.Limit)})
+
+			// On v1 the swap limit accounts for memory plus swap,
+			// on v2 it accounts for swap only.
+			if mem.Swap != nil {
+				swap := *mem.Swap
+				if swap > 0 && *mem.Limit > 0 {
+					swap -= *mem.Limit
+				}
+				settings = append(settings, cgroupV2Setting{"memory.swap.max", cgroupV2Limit(swap)})
+			}
+		}
+	}
+
+	if blkio := resources.BlockIO; blkio != nil {
+		if blkio.Weight != nil && *blkio.Weight > 0 {
+			settings = append(settings, cgroupV2Setting{"io.weight", strconv.FormatUint(cgroupV2IOWeight(*blkio.Weight), 10)})
+		}
+
+		throttles := []struct {
+			key     string
+			devices []specs.LinuxThrottleDevice
+		}{
+			{"rbps", blkio.ThrottleReadBpsDevice},
+			{"wbps", blkio.ThrottleWriteBpsDevice},
+			{"riops", blkio.ThrottleReadIOPSDevice},
+			{"wiops", blkio.ThrottleWriteIOPSDevice},
+		}
+
+		for _, t := range throttles {
+			for _, d := range t.devices {
+				rate := "max"
+				if d.Rate > 0 {
+					rate = strconv.FormatUint(d.Rate, 10)
+				}
+				settings = append(settings, cgroupV2Setting{"io.max", fmt.Sprintf("%d:%d %s=%s", d.Major, d.Minor, t.key, rate)})
+			}
+		}
+	}
+
+	return settings
+}
+
+// cgroupV2Limit converts a v1 limit, where -1 means unlimited, into a
+// v2 one.
+func cgroupV2Limit(limit int64) string {
+	if limit < 0 {
+		return "max"
+	}
+
+	return strconv.FormatInt(limit, 10)
+}
+
+// cgroupV2CPUWeight converts the v1 cpu shares [2-262144] into the v2
+// cpu weight [1-10000].
+func cgroupV2CPUWeight(shares uint64) uint64 {
+	if shares < 2 {
+		shares = 2
+	} else if shares > 262144 {
+		shares = 262144
+	}
+
+	return 1 + ((shares-2)*9999)/262142
+}
+
+// cgroupV2IOWeight converts the v1 blkio weight [10-1000] into the v2
+// io weight [1-10000].
+func cgroupV2IOWeight(weight uint16) uint64 {
+	w := uint64(weight)
+	if w < 10 {
+		w = 10
+	} else if w > 1000 {
+		w = 1000
+	}
+
+	return 1 + ((w-10)*9999)/990
+}
@@ -0,0 +1,228 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/containerd/cgroups"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+// mockCgroupV2Root fakes a unified hierarchy mounted on a temporary
+// directory, and returns a function restoring the host one.
+func mockCgroupV2Root(t *testing.T) (string, func()) {
+	root, err := ioutil.TempDir(testDir, "cgroup2-")
+	assert.NoError(t, err)
+
+	err = ioutil.WriteFile(filepath.Join(root, "cgroup.controllers"), []byte("cpuset cpu io memory pids"), 0644)
+	assert.NoError(t, err)
+
+	old := cgroupV2MountPointFunc
+	cgroupV2MountPointFunc = func() (string, error) {
+		return root, nil
+	}
+	cgroupV2RootOnce = sync.Once{}
+
+	return root, func() {
+		cgroupV2MountPointFunc = old
+		cgroupV2RootOnce = sync.Once{}
+		os.RemoveAll(root)
+	}
+}
+
+func readCgroupV2File(t *testing.T, path ...string) string {
+	data, err := ioutil.ReadFile(filepath.Join(path...))
+	assert.NoError(t, err)
+	return strings.TrimSpace(string(data))
+}
+
+func TestCgroupV2Resources(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(cgroupV2Resources(nil))
+
+	quota := int64(50000)
+	period := uint64(200000)
+	shares := uint64(1024)
+	limit := int64(256 << 20)
+	swap := int64(512 << 20)
+	reservation := int64(-1)
+	weight := uint16(500)
+
+	// the device numbers are embedded into an unexported struct
+	readBps := specs.LinuxThrottleDevice{Rate: 1048576}
+	readBps.Major, readBps.Minor = 8, 0
+	writeIOPS := specs.LinuxThrottleDevice{Rate: 0}
+	writeIOPS.Major, writeIOPS.Minor = 8, 16
+
+	resources := &specs.LinuxResources{
+		CPU: &specs.LinuxCPU{
+			Quota:  &quota,
+			Period: &period,
+			Shares: &shares,
+			Cpus:   "0-1",
+		},
+		Memory: &specs.LinuxMemory{
+			Limit:       &limit,
+			Swap:        &swap,
+			Reservation: &reservation,
+		},
+		BlockIO: &specs.LinuxBlockIO{
+			Weight:                  &weight,
+			ThrottleReadBpsDevice:   []specs.LinuxThrottleDevice{readBps},
+			ThrottleWriteIOPSDevice: []specs.LinuxThrottleDevice{writeIOPS},
+		},
+	}
+
+	expected := []cgroupV2Setting{
+		{"cpu.max", "50000 200000"},
+		{"cpu.weight", "39"},
+		{"cpuset.cpus", "0-1"},
+		{"memory.low", "max"},
+		{"memory.max", "268435456"},
+		{"memory.swap.max", "268435456"},
+		{"io.weight", "4950"},
+		{"io.max", "8:0 rbps=1048576"},
+		{"io.max", "8:16 wiops=max"},
+	}
+
+	assert.Equal(expected, cgroupV2Resources(resources))
+
+	// quota without period
+	resources = &specs.LinuxResources{
+		CPU: &specs.LinuxCPU{
+			Quota: &quota,
+		},
+	}
+	assert.Equal([]cgroupV2Setting{{"cpu.max", "50000 100000"}}, cgroupV2Resources(resources))
+}
+
+func TestCgroupV2(t *testing.T) {
+	assert := assert.New(t)
+
+	root, restore := mockCgroupV2Root(t)
+	defer restore()
+
+	assert.True(isCgroupV2())
+
+	_, err := loadCgroupV2("/kata/foo")
+	assert.Equal(cgroups.ErrCgroupDeleted, err)
+
+	quota := int64(100000)
+	cg, err := newCgroupV2("/kata/foo", &specs.LinuxResources{
+		CPU: &specs.LinuxCPU{Quota: &quota},
+	})
+	assert.NoError(err)
+	assert.Equal("100000 100000", readCgroupV2File(t, root, "kata", "foo", "cpu.max"))
+	assert.Equal("+memory", readCgroupV2File(t, root, "cgroup.subtree_control"))
+
+	err = cg.Add(cgroups.Process{Pid: 0})
+	assert.Error(err)
+
+	err = cg.Add(cgroups.Process{Pid: 42})
+	assert.NoError(err)
+
+	processes, err := cg.Processes("", false)
+	assert.NoError(err)
+	assert.Len(processes, 1)
+	assert.Equal(42, processes[0].Pid)
+
+	vcpus, err := cg.newThreaded(cgroupV2VCPUsDir, nil)
+	assert.NoError(err)
+	assert.Equal("threaded", readCgroupV2File(t, root, "kata", "foo", cgroupV2VCPUsDir, "cgroup.type"))
+
+	err = vcpus.AddTask(cgroups.Process{Pid: 43})
+	assert.NoError(err)
+	assert.Equal("43", readCgroupV2File(t, root, "kata", "foo", cgroupV2VCPUsDir, "cgroup.threads"))
+
+	dest, err := newCgroupV2("/bar", nil)
+	assert.NoError(err)
+	assert.NoError(cg.MoveTo(dest))
+	assert.Equal("42", readCgroupV2File(t, root, "bar", "cgroup.procs"))
+
+	// a controller that cannot be enabled is reported
+	err = os.Mkdir(filepath.Join(root, "baz"), 0755)
+	assert.NoError(err)
+	err = ioutil.WriteFile(filepath.Join(root, "baz", "cgroup.controllers"), []byte("cpu"), 0644)
+	assert.NoError(err)
+	err = os.Mkdir(filepath.Join(root, "baz", "cgroup.subtree_control"), 0755)
+	assert.NoError(err)
+	_, err = newCgroupV2("/baz/qux", nil)
+	assert.Error(err)
+
+	assert.Equal(cgroups.Thawed, cg.State())
+	assert.NoError(cg.Freeze())
+	assert.Equal(cgroups.Frozen, cg.State())
+	assert.NoError(cg.Thaw())
+	assert.Equal(cgroups.Thawed, cg.State())
+}
+
+func TestAddContainerProcessV2(t *testing.T) {
+	assert := assert.New(t)
+
+	root, restore := mockCgroupV2Root(t)
+	defer restore()
+
+	cg, err := newContainerCgroup("/sandbox", &specs.LinuxResources{})
+	assert.NoError(err)
+
+	// The shim is kept out of the sandbox cgroup, whose controllers are
+	// enabled for the hypervisor cgroup.
+	assert.NoError(addContainerProcess(cg, 42))
+	assert.Equal("42", readCgroupV2File(t, root, "sandbox", cgroupV2ShimDir, "cgroup.procs"))
+	_, err = os.Stat(filepath.Join(root, "sandbox", "cgroup.procs"))
+	assert.True(os.IsNotExist(err))
+
+	// The processes of the children are moved before deleting them.
+	parent, err := parentContainerCgroup("/sandbox")
+	assert.NoError(err)
+	assert.NoError(cg.MoveTo(parent))
+	assert.Equal("42", readCgroupV2File(t, root, "cgroup.procs"))
+}
+
+func TestConstrainHypervisorV2(t *testing.T) {
+	assert := assert.New(t)
+
+	root, restore := mockCgroupV2Root(t)
+	defer restore()
+
+	s := &Sandbox{
+		state: types.State{
+			CgroupPath: "/sandbox",
+		},
+		hypervisor: &mockHypervisor{mockPid: 0},
+		config: &SandboxConfig{
+			HypervisorConfig: HypervisorConfig{
+				NumVCPUs: 2,
+			},
+		},
+	}
+
+	// bad pid
+	assert.Error(s.updateCgroups())
+
+	s.hypervisor = &mockHypervisor{mockPid: 42}
+	assert.NoError(s.updateCgroups())
+
+	dir := filepath.Join(root, s.state.CgroupPath, cgroupV2HypervisorDir)
+	assert.Equal("42", readCgroupV2File(t, dir, "cgroup.procs"))
+	assert.Equal("threaded", readCgroupV2File(t, dir, cgroupV2VCPUsDir, "cgroup.type"))
+	assert.Equal(strconv.Itoa(os.Getpid()), readCgroupV2File(t, dir, cgroupV2VCPUsDir, "cgroup.threads"))
+	assert.Equal("200000 100000", readCgroupV2File(t, dir, cgroupV2VCPUsDir, "cpu.max"))
+
+	// cgroup already deleted
+	s.state.CgroupPath = "/another-sandbox"
+	assert.NoError(s.deleteCgroups())
+}
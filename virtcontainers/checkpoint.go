@@ -0,0 +1,516 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/kata-containers/runtime/virtcontainers/device/api"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/vishvananda/netlink"
+)
+
+const (
+	// checkpointInfoFile describes the sandbox a checkpoint was taken from.
+	checkpointInfoFile = "checkpoint.json"
+
+	// checkpointStateFile holds the VM memory and device state.
+	checkpointStateFile = "vm.state"
+)
+
+// checkpointSandboxItems are the sandbox store items saved into a
+// checkpoint. The agent item is left out on purpose: it describes the
+// proxy of the checkpointed sandbox, and a new one is started on restore.
+var checkpointSandboxItems = []store.Item{
+	store.Configuration,
+	store.State,
+	store.Network,
+	store.Hypervisor,
+	store.Devices,
+}
+
+// checkpointContainerItems are the container store items saved into a
+// checkpoint.
+var checkpointContainerItems = []store.Item{
+	store.Configuration,
+	store.State,
+	store.Process,
+	store.Mounts,
+	store.DeviceIDs,
+}
+
+// checkpointInfo describes a sandbox checkpoint.
+type checkpointInfo struct {
+	SandboxID      string
+	HypervisorType HypervisorType
+	Containers     []string
+	Created        time.Time
+}
+
+func readCheckpointInfo(dir string) (checkpointInfo, error) {
+	var info checkpointInfo
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, checkpointInfoFile))
+	if err != nil {
+		return info, err
+	}
+
+	if err := json.Unmarshal(data, &info); err != nil {
+		return info, err
+	}
+
+	return info, nil
+}
+
+func writeCheckpointInfo(dir string, info checkpointInfo) error {
+	data, err := json.Marshal(info)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(dir, checkpointInfoFile), data, 0640)
+}
+
+// Checkpoint saves the sandbox VM memory and device state, together with
+// the sandbox and containers store items, into dir.
+// A running sandbox is paused for the duration of the checkpoint and
+// resumed right after. Sandboxes with hot added vCPUs, memory or devices
+// other than block drives cannot be checkpointed.
+func (s *Sandbox) Checkpoint(dir string) error {
+	span, _ := s.trace("checkpoint")
+	defer span.Finish()
+
+	if dir == "" {
+		return fmt.Errorf("Missing checkpoint directory")
+	}
+
+	if s.config.AgentType != KataContainersAgent {
+		return fmt.Errorf("Checkpoint is not supported with agent %s", s.config.AgentType)
+	}
+
+	if s.state.State != types.StateRunning && s.state.State != types.StatePaused {
+		return fmt.Errorf("Sandbox not running or paused, impossible to checkpoint")
+	}
+
+	if err := s.checkCheckpointable(); err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(dir, store.DirMode); err != nil {
+		return err
+	}
+
+	s.Logger().WithField("checkpoint", dir).Info("Checkpointing sandbox")
+
+	if s.state.State == types.StateRunning {
+		if err := s.hypervisor.pauseSandbox(); err != nil {
+			return err
+		}
+
+		defer func() {
+			if err := s.hypervisor.resumeSandbox(); err != nil {
+				s.Logger().WithError(err).Error("failed to resume sandbox after checkpoint")
+			}
+		}()
+	}
+
+	if err := s.hypervisor.checkpointSandbox(filepath.Join(dir, checkpointStateFile)); err != nil {
+		return err
+	}
+
+	info := checkpointInfo{
+		SandboxID:      s.id,
+		HypervisorType: s.config.HypervisorType,
+		Created:        time.Now().UTC(),
+	}
+
+	sandboxStore, err := store.NewVCCheckpointStore(s.ctx, dir, s.id)
+	if err != nil {
+		return err
+	}
+
+	if err := s.store.Copy(sandboxStore, checkpointSandboxItems); err != nil {
+		return err
+	}
+
+	for _, c := range s.containers {
+		ctrStore, err := store.NewVCCheckpointStore(s.ctx, dir, filepath.Join(s.id, c.id))
+		if err != nil {
+			return err
+		}
+
+		if err := c.store.Copy(ctrStore, checkpointContainerItems); err != nil {
+			return err
+		}
+
+		info.Containers = append(info.Containers, c.id)
+	}
+
+	return writeCheckpointInfo(dir, info)
+}
+
+// checkCheckpointable returns an error if the sandbox VM holds hot added
+// resources other than block drives. The restored VM is started from the
+// sandbox configuration, which does not describe those resources, and the
+// incoming migration would fail to load their state. The block drives are
+// plugged back into the restored VM at their checkpointed addresses.
+func (s *Sandbox) checkCheckpointable() error {
+	vcpus, memDevs, err := s.hypervisor.hotpluggedResources()
+	if err != nil {
+		return err
+	}
+
+	if vcpus > 0 || len(memDevs) > 0 {
+		return fmt.Errorf("Sandbox has hot added vCPUs or memory, impossible to checkpoint")
+	}
+
+	if s.devManager == nil {
+		return nil
+	}
+
+	// Block drives are plugged back at the same address on restore,
+	// unless they are NVDIMMs which cannot be.
+	restorable := func(dev api.Device) bool {
+		return dev.DeviceType() == config.DeviceBlock &&
+			s.config.HypervisorConfig.BlockDeviceDriver != config.Nvdimm
+	}
+
+	for _, dev := range s.devManager.GetAllDevices() {
+		if dev.DeviceType() == config.DeviceGeneric || dev.GetAttachCount() == 0 || restorable(dev) {
+			continue
+		}
+
+		return fmt.Errorf("Sandbox has hot added device %s, impossible to checkpoint", dev.DeviceID())
+	}
+
+	return nil
+}
+
+// checkpointBlockDrives returns the drives of the attached block devices
+// of a checkpointed sandbox.
+func checkpointBlockDrives(devices []api.Device) []config.BlockDrive {
+	var drives []config.BlockDrive
+
+	for _, dev := range devices {
+		if dev.DeviceType() != config.DeviceBlock || dev.GetAttachCount() == 0 {
+			continue
+		}
+
+		if drive, ok := dev.GetDeviceInfo().(*config.BlockDrive); ok && drive != nil {
+			drives = append(drives, *drive)
+		}
+	}
+
+	return drives
+}
+
+// restoreCheckpointStore copies the store items saved into a checkpoint
+// back into the sandbox and containers stores.
+func restoreCheckpointStore(ctx context.Context, dir string, info checkpointInfo) error {
+	sandboxStore, err := store.NewVCCheckpointStore(ctx, dir, info.SandboxID)
+	if err != nil {
+		return err
+	}
+
+	vcStore, err := store.NewVCSandboxStore(ctx, info.SandboxID)
+	if err != nil {
+		return err
+	}
+
+	if err := sandboxStore.Copy(vcStore, checkpointSandboxItems); err != nil {
+		return err
+	}
+
+	for _, id := range info.Containers {
+		ctrStore, err := store.NewVCCheckpointStore(ctx, dir, filepath.Join(info.SandboxID, id))
+		if err != nil {
+			return err
+		}
+
+		vcCtrStore, err := store.NewVCContainerStore(ctx, info.SandboxID, id)
+		if err != nil {
+			return err
+		}
+
+		if err := ctrStore.Copy(vcCtrStore, checkpointContainerItems); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// restoreSandbox boots a sandbox from a checkpoint written by
+// Sandbox.Checkpoint. The sandbox configuration must match the
+// checkpointed one, except for its network namespace.
+func restoreSandbox(ctx context.Context, sandboxConfig SandboxConfig, dir string) (_ *Sandbox, err error) {
+	span, ctx := trace(ctx, "restoreSandbox")
+	defer span.Finish()
+
+	info, err := readCheckpointInfo(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.SandboxID != sandboxConfig.ID {
+		return nil, fmt.Errorf("Checkpoint was taken from sandbox %s, cannot restore it as %s", info.SandboxID, sandboxConfig.ID)
+	}
+
+	if info.HypervisorType != sandboxConfig.HypervisorType {
+		return nil, fmt.Errorf("Checkpoint was taken with hypervisor %s, cannot restore it with %s", info.HypervisorType, sandboxConfig.HypervisorType)
+	}
+
+	if sandboxConfig.AgentType != KataContainersAgent {
+		return nil, fmt.Errorf("Restore is not supported with agent %s", sandboxConfig.AgentType)
+	}
+
+	if _, err := os.Stat(store.SandboxConfigurationRootPath(sandboxConfig.ID)); err == nil {
+		return nil, fmt.Errorf("Sandbox %s already exists", sandboxConfig.ID)
+	}
+
+	vcStore, err := store.NewVCSandboxStore(ctx, sandboxConfig.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			vcStore.Delete()
+		}
+	}()
+
+	// Restore the store items first, so that the sandbox gets re-created
+	// from them instead of being created from scratch in the guest.
+	if err = restoreCheckpointStore(ctx, dir, info); err != nil {
+		return nil, err
+	}
+
+	var checkpointConfig SandboxConfig
+	if err = vcStore.Load(store.Configuration, &checkpointConfig); err != nil {
+		return nil, err
+	}
+
+	sandboxConfig.Containers = checkpointConfig.Containers
+	sandboxConfig.HypervisorConfig.BootFromCheckpoint = true
+	sandboxConfig.HypervisorConfig.DevicesStatePath = filepath.Join(dir, checkpointStateFile)
+
+	// The block drives hotplugged into the checkpointed VM have to be
+	// plugged back before its device state is loaded.
+	devices, err := vcStore.LoadDevices()
+	if err != nil {
+		return nil, err
+	}
+	sandboxConfig.HypervisorConfig.CheckpointBlockDrives = checkpointBlockDrives(devices)
+
+	s, err := createSandbox(ctx, sandboxConfig, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			globalSandboxList.removeSandbox(s.id)
+		}
+	}()
+
+	// The checkpointed network namespace belongs to the host the
+	// checkpoint was taken on. Scan the one we have been given instead,
+	// once its interfaces have the MAC addresses of the checkpointed ones.
+	if err = restoreHardwareAddrs(s.config.NetworkConfig.NetNSPath, s.networkNS.Endpoints); err != nil {
+		return nil, err
+	}
+
+	s.networkNS = NetworkNamespace{}
+	if err = s.createNetwork(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil && s.networkNS.NetNsCreated {
+			s.removeNetwork()
+		}
+	}()
+
+	if err = s.fetchContainers(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			bindUnmountAllRootfs(ctx, kataHostSharedDir, s)
+		}
+	}()
+
+	for _, c := range s.containers {
+		if err = c.restoreHostMounts(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = s.restoreVM(); err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		if err != nil {
+			s.hypervisor.stopSandbox()
+		}
+	}()
+
+	if err = s.updateCgroups(); err != nil {
+		return nil, err
+	}
+
+	// The VM is not tied to the checkpoint anymore.
+	s.config.HypervisorConfig.BootFromCheckpoint = false
+	s.config.HypervisorConfig.DevicesStatePath = ""
+	s.config.HypervisorConfig.CheckpointBlockDrives = nil
+
+	if err = s.storeSandbox(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// restoreHardwareAddrs gives the interfaces of the network namespace a
+// sandbox is restored into the MAC addresses of the checkpointed endpoints of
+// the same name. The restored guest interfaces keep their checkpointed MAC
+// addresses, which the agent finds them by and which they send frames from.
+// Only the veth, macvlan and VLAN interfaces can be given a MAC address.
+func restoreHardwareAddrs(netNSPath string, endpoints []Endpoint) error {
+	if netNSPath == "" || len(endpoints) == 0 {
+		return nil
+	}
+
+	return doNetNS(netNSPath, func(_ ns.NetNS) error {
+		netHandle, err := netlink.NewHandle()
+		if err != nil {
+			return err
+		}
+		defer netHandle.Delete()
+
+		for _, ep := range endpoints {
+			if ep.Type() != VethEndpointType && ep.Type() != BridgedMacvlanEndpointType &&
+				ep.Type() != VlanEndpointType {
+				continue
+			}
+
+			name := ep.Properties().Iface.Name
+			link, err := netHandle.LinkByName(name)
+			if err != nil {
+				return fmt.Errorf("Could not find interface %s to restore: %v", name, err)
+			}
+
+			hwAddr, err := net.ParseMAC(ep.HardwareAddr())
+			if err != nil {
+				return err
+			}
+
+			if link.Attrs().HardwareAddr.String() == hwAddr.String() {
+				continue
+			}
+
+			if err := netHandle.LinkSetHardwareAddr(link, hwAddr); err != nil {
+				return fmt.Errorf("Could not restore the MAC address of interface %s: %v", name, err)
+			}
+		}
+
+		return nil
+	})
+}
+
+// restoreVM boots the sandbox VM from its checkpoint and reconnects to
+// the agent already running inside it.
+func (s *Sandbox) restoreVM() error {
+	span, _ := s.trace("restoreVM")
+	defer span.Finish()
+
+	s.Logger().Info("Restoring VM")
+
+	if err := s.network.Run(s.networkNS.NetNsPath, func() error {
+		return s.hypervisor.startSandbox(vmStartTimeout)
+	}); err != nil {
+		return err
+	}
+
+	if err := s.agent.startProxy(s); err != nil {
+		return err
+	}
+
+	// VMs restored from a checkpoint are paused, and we only resume
+	// the ones that were not paused when checkpointed.
+	if s.state.State == types.StatePaused {
+		s.Logger().Info("VM restored paused")
+		return nil
+	}
+
+	if err := s.hypervisor.resumeSandbox(); err != nil {
+		return err
+	}
+
+	if err := s.agent.check(); err != nil {
+		return err
+	}
+
+	// Sync the guest with the interfaces and routes of the network
+	// namespace the sandbox has been restored into.
+	interfaces, routes, err := generateInterfacesAndRoutes(s.networkNS)
+	if err != nil {
+		return err
+	}
+
+	for _, inf := range interfaces {
+		if _, err := s.agent.updateInterface(inf); err != nil {
+			return err
+		}
+	}
+
+	if _, err := s.agent.updateRoutes(routes); err != nil {
+		return err
+	}
+
+	s.Logger().Info("VM restored")
+
+	return nil
+}
+
+// restoreHostMounts re-creates the host side mounts that a restored
+// container expects to find in the directory shared with the guest.
+func (c *Container) restoreHostMounts() error {
+	caps := c.sandbox.hypervisor.capabilities()
+	if !caps.IsFsSharingSupported() {
+		return nil
+	}
+
+	if c.state.Fstype == "" {
+		if err := bindMountContainerRootfs(c.ctx, kataHostSharedDir, c.sandboxID, c.id, c.rootFs, false); err != nil {
+			return err
+		}
+	}
+
+	for _, m := range c.mounts {
+		if m.HostPath == "" {
+			continue
+		}
+
+		if err := bindMount(c.ctx, m.Source, m.HostPath, false); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
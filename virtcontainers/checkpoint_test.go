@@ -0,0 +1,214 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/device/api"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/device/drivers"
+	"github.com/kata-containers/runtime/virtcontainers/device/manager"
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckpointInfo(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir(testDir, "checkpoint-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	_, err = readCheckpointInfo(dir)
+	assert.Error(err)
+
+	info := checkpointInfo{
+		SandboxID:      testSandboxID,
+		HypervisorType: QemuHypervisor,
+		Containers:     []string{"foo", "bar"},
+		Created:        time.Now().UTC(),
+	}
+
+	err = writeCheckpointInfo(dir, info)
+	assert.NoError(err)
+
+	read, err := readCheckpointInfo(dir)
+	assert.NoError(err)
+	assert.Equal(info.SandboxID, read.SandboxID)
+	assert.Equal(info.HypervisorType, read.HypervisorType)
+	assert.Equal(info.Containers, read.Containers)
+	assert.True(info.Created.Equal(read.Created))
+}
+
+func TestSandboxCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanUp()
+
+	contID := "100"
+	hConfig := newHypervisorConfig(nil, nil)
+	containers := []ContainerConfig{newTestContainerConfigNoop(contID)}
+
+	s, err := testCreateSandbox(t, testSandboxID, MockHypervisor, hConfig, NoopAgentType, NetworkConfig{}, containers, nil)
+	assert.NoError(err)
+
+	err = s.storeSandbox()
+	assert.NoError(err)
+
+	dir, err := ioutil.TempDir(testDir, "checkpoint-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	err = s.Checkpoint("")
+	assert.Error(err)
+
+	// Only the kata agent can be checkpointed.
+	err = s.Checkpoint(dir)
+	assert.Error(err)
+
+	s.config.AgentType = KataContainersAgent
+
+	// The sandbox must be running or paused.
+	err = s.Checkpoint(dir)
+	assert.Error(err)
+
+	err = s.setSandboxState(types.StateRunning)
+	assert.NoError(err)
+
+	err = s.Checkpoint(dir)
+	assert.NoError(err)
+
+	info, err := readCheckpointInfo(dir)
+	assert.NoError(err)
+	assert.Equal(testSandboxID, info.SandboxID)
+	assert.Equal(MockHypervisor, info.HypervisorType)
+	assert.Equal([]string{contID}, info.Containers)
+
+	_, err = os.Stat(filepath.Join(dir, "config", testSandboxID, store.ConfigurationFile))
+	assert.NoError(err)
+
+	_, err = os.Stat(filepath.Join(dir, "run", testSandboxID, store.StateFile))
+	assert.NoError(err)
+
+	_, err = os.Stat(filepath.Join(dir, "run", testSandboxID, store.AgentFile))
+	assert.True(os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(dir, "run", testSandboxID, contID, store.StateFile))
+	assert.NoError(err)
+
+	// Hot added resources cannot be restored.
+	s.hypervisor = &mockHypervisor{hotpluggedVCPUs: 1}
+	err = s.Checkpoint(dir)
+	assert.Error(err)
+
+	s.hypervisor = &mockHypervisor{hotpluggedMemory: []*memoryDevice{{slot: 0, sizeMB: 128}}}
+	err = s.Checkpoint(dir)
+	assert.Error(err)
+}
+
+func TestRestoreSandboxInvalidCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+	defer cleanUp()
+
+	dir, err := ioutil.TempDir(testDir, "checkpoint-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	config := newTestSandboxConfigNoop()
+	ctx := context.Background()
+
+	// No checkpoint information
+	_, err = restoreSandbox(ctx, config, dir)
+	assert.Error(err)
+
+	info := checkpointInfo{
+		SandboxID:      "another-sandbox",
+		HypervisorType: config.HypervisorType,
+	}
+	err = writeCheckpointInfo(dir, info)
+	assert.NoError(err)
+
+	_, err = restoreSandbox(ctx, config, dir)
+	assert.Error(err)
+
+	info.SandboxID = config.ID
+	info.HypervisorType = QemuHypervisor
+	err = writeCheckpointInfo(dir, info)
+	assert.NoError(err)
+
+	_, err = restoreSandbox(ctx, config, dir)
+	assert.Error(err)
+
+	// The noop agent cannot be restored.
+	info.HypervisorType = config.HypervisorType
+	err = writeCheckpointInfo(dir, info)
+	assert.NoError(err)
+
+	_, err = restoreSandbox(ctx, config, dir)
+	assert.Error(err)
+
+	// An existing sandbox cannot be overwritten.
+	config.AgentType = KataContainersAgent
+	err = os.MkdirAll(store.SandboxConfigurationRootPath(config.ID), store.DirMode)
+	assert.NoError(err)
+
+	_, err = restoreSandbox(ctx, config, dir)
+	assert.Error(err)
+}
+
+func TestCheckTemplateConfigCheckpoint(t *testing.T) {
+	assert := assert.New(t)
+
+	conf := HypervisorConfig{
+		BootFromCheckpoint: true,
+	}
+	assert.Error(conf.checkTemplateConfig())
+
+	conf.DevicesStatePath = "/checkpoint/vm.state"
+	assert.NoError(conf.checkTemplateConfig())
+
+	conf.BootFromTemplate = true
+	conf.MemoryPath = "/template/memory"
+	assert.Error(conf.checkTemplateConfig())
+}
+
+func TestCheckCheckpointableDevices(t *testing.T) {
+	assert := assert.New(t)
+
+	blockDev := drivers.NewBlockDevice(&config.DeviceInfo{ID: "block"})
+	blockDev.BlockDrive = &config.BlockDrive{ID: "drive", File: "/dev/foo", Index: 1}
+	vfioDev := drivers.NewVFIODevice(&config.DeviceInfo{ID: "vfio"})
+
+	s := &Sandbox{
+		hypervisor: &mockHypervisor{},
+		config:     &SandboxConfig{},
+		devManager: manager.NewDeviceManager(manager.VirtioSCSI, []api.Device{blockDev, vfioDev}),
+	}
+
+	// Devices which are not attached are not in the VM.
+	assert.NoError(s.checkCheckpointable())
+	assert.Empty(checkpointBlockDrives([]api.Device{blockDev, vfioDev}))
+
+	// Block drives are plugged back on restore.
+	blockDev.AttachCount = 1
+	assert.NoError(s.checkCheckpointable())
+	assert.Equal([]config.BlockDrive{*blockDev.BlockDrive}, checkpointBlockDrives([]api.Device{blockDev, vfioDev}))
+
+	// But not as NVDIMMs.
+	s.config.HypervisorConfig.BlockDeviceDriver = config.Nvdimm
+	assert.Error(s.checkCheckpointable())
+	s.config.HypervisorConfig.BlockDeviceDriver = config.VirtioSCSI
+
+	// Other devices cannot be.
+	vfioDev.AttachCount = 1
+	assert.Error(s.checkCheckpointable())
+}
@@ -0,0 +1,265 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	consoleLogFile = "console.log"
+
+	// consoleLogMaxSize is the size above which the console log is
+	// rotated. Only the previous log is kept, as consoleLogFile.1.
+	consoleLogMaxSize = 512 * 1024
+
+	// consoleLogsKept is the number of sandboxes whose console logs are
+	// kept, the oldest ones are removed when a new collector starts.
+	consoleLogsKept = 64
+)
+
+func consoleLogDir(sandboxID string) string {
+	return filepath.Join(store.RunConsoleStoragePath, sandboxID)
+}
+
+func consoleLogPaths(sandboxID string) (current, rotated string) {
+	current = filepath.Join(consoleLogDir(sandboxID), consoleLogFile)
+	return current, current + ".1"
+}
+
+// consoleCollector writes the lines read from a guest console into the
+// rotated console log of a sandbox.
+type consoleCollector struct {
+	sync.Mutex
+
+	sandboxID string
+	file      *os.File
+	size      int64
+}
+
+func newConsoleCollector(sandboxID string) (*consoleCollector, error) {
+	if err := os.MkdirAll(consoleLogDir(sandboxID), store.DirMode); err != nil {
+		return nil, err
+	}
+
+	pruneConsoleLogs(sandboxID)
+
+	c := &consoleCollector{
+		sandboxID: sandboxID,
+	}
+
+	if err := c.open(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *consoleCollector) open() error {
+	current, _ := consoleLogPaths(c.sandboxID)
+
+	f, err := os.OpenFile(current, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0640)
+	if err != nil {
+		return err
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+
+	c.file = f
+	c.size = info.Size()
+
+	return nil
+}
+
+func (c *consoleCollector) rotate() error {
+	if err := c.file.Close(); err != nil {
+		return err
+	}
+
+	current, rotated := consoleLogPaths(c.sandboxID)
+	if err := os.Rename(current, rotated); err != nil {
+		return err
+	}
+
+	return c.open()
+}
+
+// write appends a timestamped console line to the log.
+func (c *consoleCollector) write(line string) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.file == nil {
+		return fmt.Errorf("Console log of sandbox %s is closed", c.sandboxID)
+	}
+
+	entry := fmt.Sprintf("%s %s\n", time.Now().UTC().Format(time.RFC3339Nano), line)
+
+	if c.size > 0 && c.size+int64(len(entry)) > consoleLogMaxSize {
+		if err := c.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := c.file.WriteString(entry)
+	c.size += int64(n)
+
+	return err
+}
+
+func (c *consoleCollector) close() error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.file == nil {
+		return nil
+	}
+
+	err := c.file.Close()
+	c.file = nil
+
+	return err
+}
+
+// collect reads the console until it gets closed, writing its lines into
+// the log and, in debug mode, logging them too.
+func (c *consoleCollector) collect(console io.Reader, logger *logrus.Entry, debug bool) {
+	defer c.close()
+
+	scanner := bufio.NewScanner(console)
+	for scanner.Scan() {
+		if debug {
+			logger.WithFields(logrus.Fields{
+				"sandbox":   c.sandboxID,
+				"vmconsole": scanner.Text(),
+			}).Debug("reading guest console")
+		}
+
+		if err := c.write(scanner.Text()); err != nil {
+			logger.WithError(err).Warn("Failed to write the guest console log")
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		logger.WithError(err).Error("Failed to read the guest console")
+		return
+	}
+
+	logger.Info("console watcher quits")
+}
+
+// watchConsole connects to the guest console and collects it into the
+// sandbox console log until the returned connection is closed.
+func watchConsole(sandboxID, proto, console string, logger *logrus.Entry, debug bool) (net.Conn, error) {
+	var conn net.Conn
+	var err error
+
+	switch proto {
+	case consoleProtoUnix:
+		conn, err = net.Dial("unix", console)
+		if err != nil {
+			return nil, err
+		}
+	// TODO: add pty console support for kvmtools
+	case consoleProtoPty:
+		fallthrough
+	default:
+		return nil, fmt.Errorf("unknown console proto %s", proto)
+	}
+
+	collector, err := newConsoleCollector(sandboxID)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	go collector.collect(conn, logger.WithFields(logrus.Fields{
+		"console-protocol": proto,
+		"console-socket":   console,
+	}), debug)
+
+	return conn, nil
+}
+
+// pruneConsoleLogs removes the oldest sandboxes console logs, so that only
+// consoleLogsKept remain, the one of sandboxID excepted.
+func pruneConsoleLogs(sandboxID string) {
+	entries, err := ioutil.ReadDir(store.RunConsoleStoragePath)
+	if err != nil {
+		return
+	}
+
+	var logs []os.FileInfo
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != sandboxID {
+			logs = append(logs, e)
+		}
+	}
+
+	if len(logs) < consoleLogsKept {
+		return
+	}
+
+	sort.Slice(logs, func(i, j int) bool {
+		return logs[i].ModTime().Before(logs[j].ModTime())
+	})
+
+	for _, e := range logs[:len(logs)-consoleLogsKept+1] {
+		if err := os.RemoveAll(filepath.Join(store.RunConsoleStoragePath, e.Name())); err != nil {
+			virtLog.WithError(err).WithField("sandbox", e.Name()).Warn("Could not remove console log")
+		}
+	}
+}
+
+// ConsoleLog returns the guest console log collected for a sandbox,
+// including the rotated part. If maxSize is not zero, only the last
+// maxSize bytes of the log are returned.
+func ConsoleLog(sandboxID string, maxSize int64) ([]byte, error) {
+	if sandboxID == "" {
+		return nil, errNeedSandboxID
+	}
+
+	current, rotated := consoleLogPaths(sandboxID)
+
+	if _, err := os.Stat(consoleLogDir(sandboxID)); err != nil {
+		return nil, err
+	}
+
+	var log []byte
+	for _, path := range []string{rotated, current} {
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		log = append(log, data...)
+	}
+
+	if maxSize > 0 && int64(len(log)) > maxSize {
+		log = log[int64(len(log))-maxSize:]
+	}
+
+	return log, nil
+}
@@ -0,0 +1,125 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConsoleCollectorRotate(t *testing.T) {
+	assert := assert.New(t)
+
+	sandboxID := "console-rotate"
+	defer os.RemoveAll(consoleLogDir(sandboxID))
+
+	c, err := newConsoleCollector(sandboxID)
+	assert.NoError(err)
+
+	line := strings.Repeat("x", 1023)
+	for i := 0; i < consoleLogMaxSize/1024+1; i++ {
+		assert.NoError(c.write(line))
+	}
+
+	assert.NoError(c.close())
+	assert.Error(c.write(line))
+
+	current, rotated := consoleLogPaths(sandboxID)
+
+	info, err := os.Stat(rotated)
+	assert.NoError(err)
+	assert.True(info.Size() <= consoleLogMaxSize)
+
+	info, err = os.Stat(current)
+	assert.NoError(err)
+	assert.True(info.Size() > 0)
+
+	log, err := ConsoleLog(sandboxID, 0)
+	assert.NoError(err)
+	assert.Equal(consoleLogMaxSize/1024+1, strings.Count(string(log), "\n"))
+
+	log, err = ConsoleLog(sandboxID, 10)
+	assert.NoError(err)
+	assert.Equal("xxxxxxxxx\n", string(log))
+}
+
+func TestConsoleLogErrors(t *testing.T) {
+	_, err := ConsoleLog("", 0)
+	assert.Error(t, err)
+
+	_, err = ConsoleLog("console-unknown", 0)
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestConsolePruneLogs(t *testing.T) {
+	assert := assert.New(t)
+
+	for i := 0; i < consoleLogsKept+2; i++ {
+		err := os.MkdirAll(consoleLogDir(fmt.Sprintf("console-prune-%d", i)), store.DirMode)
+		assert.NoError(err)
+	}
+	defer os.RemoveAll(store.RunConsoleStoragePath)
+
+	c, err := newConsoleCollector("console-prune-new")
+	assert.NoError(err)
+	assert.NoError(c.close())
+
+	entries, err := ioutil.ReadDir(store.RunConsoleStoragePath)
+	assert.NoError(err)
+	assert.Len(entries, consoleLogsKept)
+}
+
+func TestConsoleWatch(t *testing.T) {
+	assert := assert.New(t)
+
+	sandboxID := "console-watch"
+	defer os.RemoveAll(consoleLogDir(sandboxID))
+
+	dir, err := ioutil.TempDir(testDir, "")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socket := filepath.Join(dir, "console.sock")
+	l, err := net.Listen("unix", socket)
+	assert.NoError(err)
+	defer l.Close()
+
+	_, err = watchConsole(sandboxID, "foobarproto", socket, testDefaultLogger, false)
+	assert.Error(err)
+
+	conn, err := watchConsole(sandboxID, consoleProtoUnix, socket, testDefaultLogger, false)
+	assert.NoError(err)
+
+	guest, err := l.Accept()
+	assert.NoError(err)
+
+	_, err = guest.Write([]byte("Kernel panic - not syncing\n"))
+	assert.NoError(err)
+
+	// The collector closes its log once the console is closed.
+	guest.Close()
+	defer conn.Close()
+
+	current, _ := consoleLogPaths(sandboxID)
+	for i := 0; i < 100; i++ {
+		data, _ := ioutil.ReadFile(current)
+		if strings.Contains(string(data), "Kernel panic") {
+			return
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatal("console line not collected")
+}
@@ -161,7 +161,7 @@ type BlkioStats struct {
 	// number of bytes tranferred to and from the block device
 	IoServiceBytesRecursive []BlkioStatEntry `json:"io_service_bytes_recursive,omitempty"`
 	IoServicedRecursive     []BlkioStatEntry `json:"io_serviced_recursive,omitempty"`
-	IoQueuedRecursive       []BlkioStatEntry `json:"io_queue_recursive,omitempty"`
+	IoQueuedRecursive       []BlkioStatEntry `json:"io_queued_recursive,omitempty"`
 	IoServiceTimeRecursive  []BlkioStatEntry `json:"io_service_time_recursive,omitempty"`
 	IoWaitTimeRecursive     []BlkioStatEntry `json:"io_wait_time_recursive,omitempty"`
 	IoMergedRecursive       []BlkioStatEntry `json:"io_merged_recursive,omitempty"`
@@ -189,9 +189,26 @@ type CgroupStats struct {
 	HugetlbStats map[string]HugetlbStats `json:"hugetlb_stats,omitempty"`
 }
 
+// NetworkStats describes the statistics of a guest network interface.
+type NetworkStats struct {
+	Name      string `json:"name,omitempty"`
+	RxBytes   uint64 `json:"rx_bytes,omitempty"`
+	RxPackets uint64 `json:"rx_packets,omitempty"`
+	RxErrors  uint64 `json:"rx_errors,omitempty"`
+	RxDropped uint64 `json:"rx_dropped,omitempty"`
+	TxBytes   uint64 `json:"tx_bytes,omitempty"`
+	TxPackets uint64 `json:"tx_packets,omitempty"`
+	TxErrors  uint64 `json:"tx_errors,omitempty"`
+	TxDropped uint64 `json:"tx_dropped,omitempty"`
+}
+
 // ContainerStats describes a container stats.
 type ContainerStats struct {
 	CgroupStats *CgroupStats
+	// NetworkStats are the statistics of the guest network interfaces,
+	// which are shared by all the containers of the sandbox, as reported
+	// by the agent.
+	NetworkStats []*NetworkStats
 }
 
 // ContainerResources describes container resources
@@ -763,6 +780,11 @@ func (c *Container) create() (err error) {
 	}
 	c.process = *process
 
+	// The block devices of the mounts are attached by the agent.
+	if err = c.updateBlockRateLimiters(nil); err != nil {
+		return
+	}
+
 	if err = c.newCgroups(); err != nil {
 		return
 	}
@@ -1068,6 +1090,14 @@ func (c *Container) update(resources specs.LinuxResources) error {
 		return err
 	}
 
+	if blkio := resources.BlockIO; blkio != nil {
+		previous := c.config.Resources.BlockIO
+		c.config.Resources.BlockIO = blkio
+		if err := c.updateBlockRateLimiters(previous); err != nil {
+			return err
+		}
+	}
+
 	if err := c.updateCgroups(resources); err != nil {
 		return err
 	}
@@ -1075,6 +1105,91 @@ func (c *Container) update(resources specs.LinuxResources) error {
 	return c.sandbox.agent.updateContainer(c.sandbox, *c, resources)
 }
 
+// updateBlockRateLimiters applies the block IO throttling of the container
+// to the drives of its block devices. The rate limiter of a drive previously
+// throttled, and which is not throttled anymore, is removed.
+func (c *Container) updateBlockRateLimiters(previous *specs.LinuxBlockIO) error {
+	blkio := c.config.Resources.BlockIO
+	if blkio == nil {
+		return nil
+	}
+
+	caps := c.sandbox.hypervisor.capabilities()
+	if !caps.IsBlockRateLimiterSupported() {
+		if len(blkio.ThrottleReadBpsDevice) > 0 || len(blkio.ThrottleWriteBpsDevice) > 0 ||
+			len(blkio.ThrottleReadIOPSDevice) > 0 || len(blkio.ThrottleWriteIOPSDevice) > 0 {
+			c.Logger().Warn("Block IO throttling not supported by the hypervisor")
+		}
+
+		return nil
+	}
+
+	devIDs := []string{c.state.BlockDeviceID}
+	for _, m := range c.mounts {
+		devIDs = append(devIDs, m.BlockDeviceID)
+	}
+	for _, d := range c.devices {
+		devIDs = append(devIDs, d.ID)
+	}
+
+	for _, id := range devIDs {
+		if id == "" {
+			continue
+		}
+
+		dev := c.sandbox.devManager.GetDeviceByID(id)
+		if dev == nil || dev.DeviceType() != config.DeviceBlock {
+			continue
+		}
+
+		drive, ok := dev.GetDeviceInfo().(*config.BlockDrive)
+		if !ok || drive == nil {
+			continue
+		}
+
+		major, minor := dev.GetMajorMinor()
+		bandwidth, iops := blockIOLimits(blkio, major, minor)
+		if bandwidth == 0 && iops == 0 {
+			if previous == nil {
+				continue
+			}
+
+			if bandwidth, iops := blockIOLimits(previous, major, minor); bandwidth == 0 && iops == 0 {
+				continue
+			}
+		}
+
+		if err := c.sandbox.hypervisor.setBlockRateLimiter(drive, bandwidth, iops); err != nil {
+			return fmt.Errorf("Could not limit the rate of drive %s: %v", drive.ID, err)
+		}
+	}
+
+	return nil
+}
+
+// blockIOLimits returns the bandwidth, in bytes per second, and the
+// operations per second blkio throttles the major:minor device to. Reads and
+// writes are limited together by the hypervisor, so the lowest of their
+// limits is kept.
+func blockIOLimits(blkio *specs.LinuxBlockIO, major, minor int64) (bandwidth, iops uint64) {
+	lowest := func(limit uint64, devices []specs.LinuxThrottleDevice) uint64 {
+		for _, d := range devices {
+			if d.Major != major || d.Minor != minor || d.Rate == 0 {
+				continue
+			}
+			if limit == 0 || d.Rate < limit {
+				limit = d.Rate
+			}
+		}
+		return limit
+	}
+
+	bandwidth = lowest(lowest(0, blkio.ThrottleReadBpsDevice), blkio.ThrottleWriteBpsDevice)
+	iops = lowest(lowest(0, blkio.ThrottleReadIOPSDevice), blkio.ThrottleWriteIOPSDevice)
+
+	return bandwidth, iops
+}
+
 func (c *Container) pause() error {
 	if err := c.checkSandboxRunning("pause"); err != nil {
 		return err
@@ -1284,12 +1399,14 @@ func (c *Container) newCgroups() error {
 		CPU: nil,
 	}
 
+	// Memory and IO are not constrained on the host either, on the
+	// unified hierarchy the hypervisor lives under the sandbox cgroup
+	// and would be held to the limits of the sandbox container.
 	if spec.Linux != nil && spec.Linux.Resources != nil {
 		resources.CPU = validCPUResources(spec.Linux.Resources.CPU)
 	}
 
-	cgroup, err := cgroupsNewFunc(cgroups.V1,
-		cgroups.StaticPath(spec.Linux.CgroupsPath), &resources)
+	cgroup, err := newContainerCgroup(spec.Linux.CgroupsPath, &resources)
 	if err != nil {
 		return fmt.Errorf("Could not create cgroup for %v: %v", spec.Linux.CgroupsPath, err)
 	}
@@ -1299,7 +1416,7 @@ func (c *Container) newCgroups() error {
 
 	// Add shim into cgroup
 	if c.process.Pid > 0 {
-		if err := cgroup.Add(cgroups.Process{Pid: c.process.Pid}); err != nil {
+		if err := addContainerProcess(cgroup, c.process.Pid); err != nil {
 			return fmt.Errorf("Could not add PID %d to cgroup %v: %v", c.process.Pid, spec.Linux.CgroupsPath, err)
 		}
 	}
@@ -1308,8 +1425,7 @@ func (c *Container) newCgroups() error {
 }
 
 func (c *Container) deleteCgroups() error {
-	cgroup, err := cgroupsLoadFunc(cgroups.V1,
-		cgroups.StaticPath(c.state.CgroupPath))
+	cgroup, err := loadContainerCgroup(c.state.CgroupPath)
 
 	if err == cgroups.ErrCgroupDeleted {
 		// cgroup already deleted
@@ -1321,7 +1437,7 @@ func (c *Container) deleteCgroups() error {
 	}
 
 	// move running process here, that way cgroup can be removed
-	parent, err := parentCgroup(cgroups.V1, c.state.CgroupPath)
+	parent, err := parentContainerCgroup(c.state.CgroupPath)
 	if err != nil {
 		// parent cgroup doesn't exist, that means there are no process running
 		// and the container cgroup was removed.
@@ -1342,8 +1458,7 @@ func (c *Container) deleteCgroups() error {
 }
 
 func (c *Container) updateCgroups(resources specs.LinuxResources) error {
-	cgroup, err := cgroupsLoadFunc(cgroups.V1,
-		cgroups.StaticPath(c.state.CgroupPath))
+	cgroup, err := loadContainerCgroup(c.state.CgroupPath)
 	if err != nil {
 		return fmt.Errorf("Could not load cgroup %v: %v", c.state.CgroupPath, err)
 	}
@@ -22,6 +22,7 @@ import (
 	"github.com/kata-containers/runtime/virtcontainers/device/manager"
 	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/kata-containers/runtime/virtcontainers/types"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -474,3 +475,107 @@ func TestProcessIOStream(t *testing.T) {
 	_, _, _, err = c.ioStream(processID)
 	assert.Error(err)
 }
+
+func TestBlockIOLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	throttle := func(major, minor int64, rate uint64) specs.LinuxThrottleDevice {
+		d := specs.LinuxThrottleDevice{Rate: rate}
+		d.Major = major
+		d.Minor = minor
+		return d
+	}
+
+	blkio := &specs.LinuxBlockIO{
+		ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{
+			throttle(8, 0, 2000000),
+			throttle(8, 16, 3000000),
+		},
+		ThrottleWriteBpsDevice: []specs.LinuxThrottleDevice{
+			throttle(8, 0, 1000000),
+		},
+		ThrottleWriteIOPSDevice: []specs.LinuxThrottleDevice{
+			throttle(8, 0, 0),
+			throttle(8, 16, 100),
+		},
+	}
+
+	bandwidth, iops := blockIOLimits(blkio, 8, 0)
+	assert.Equal(uint64(1000000), bandwidth)
+	assert.Zero(iops)
+
+	bandwidth, iops = blockIOLimits(blkio, 8, 16)
+	assert.Equal(uint64(3000000), bandwidth)
+	assert.Equal(uint64(100), iops)
+
+	bandwidth, iops = blockIOLimits(blkio, 8, 32)
+	assert.Zero(bandwidth)
+	assert.Zero(iops)
+}
+
+// rateLimiterHypervisor records the rate limiters set on the drives.
+type rateLimiterHypervisor struct {
+	mockHypervisor
+	limits map[string][2]uint64
+}
+
+func (h *rateLimiterHypervisor) capabilities() types.Capabilities {
+	var caps types.Capabilities
+	caps.SetBlockRateLimiterSupport()
+	return caps
+}
+
+func (h *rateLimiterHypervisor) setBlockRateLimiter(drive *config.BlockDrive, bandwidth, iops uint64) error {
+	h.limits[drive.ID] = [2]uint64{bandwidth, iops}
+	return nil
+}
+
+func TestUpdateBlockRateLimiters(t *testing.T) {
+	assert := assert.New(t)
+
+	dm := manager.NewDeviceManager(config.VirtioBlock, nil)
+	dev, err := dm.NewDevice(config.DeviceInfo{
+		HostPath:      "/dev/sdb",
+		ContainerPath: "/dev/sdb",
+		DevType:       "b",
+		Major:         8,
+		Minor:         16,
+	})
+	assert.NoError(err)
+
+	blockDev, ok := dev.(*drivers.BlockDevice)
+	assert.True(ok)
+	blockDev.BlockDrive = &config.BlockDrive{ID: "drive-sdb"}
+
+	h := &rateLimiterHypervisor{limits: map[string][2]uint64{}}
+	throttle := specs.LinuxThrottleDevice{Rate: 1000000}
+	throttle.Major = 8
+	throttle.Minor = 16
+	throttled := &specs.LinuxBlockIO{
+		ThrottleReadBpsDevice: []specs.LinuxThrottleDevice{throttle},
+	}
+
+	c := &Container{
+		sandbox: &Sandbox{
+			hypervisor: h,
+			devManager: dm,
+		},
+		config: &ContainerConfig{
+			Resources: specs.LinuxResources{BlockIO: throttled},
+		},
+		devices: []ContainerDevice{{ID: dev.DeviceID()}},
+	}
+
+	assert.NoError(c.updateBlockRateLimiters(nil))
+	assert.Equal([2]uint64{1000000, 0}, h.limits["drive-sdb"])
+
+	// An unthrottled drive is left alone...
+	h.limits = map[string][2]uint64{}
+	c.config.Resources.BlockIO = &specs.LinuxBlockIO{}
+	assert.NoError(c.updateBlockRateLimiters(nil))
+	assert.Empty(h.limits)
+
+	// ...unless it was throttled, its rate limiter is then removed.
+	assert.NoError(c.updateBlockRateLimiters(throttled))
+	assert.Equal([2]uint64{0, 0}, h.limits["drive-sdb"])
+}
@@ -50,6 +50,9 @@ const (
 
 	// IPVlanEndpointType is ipvlan network interface.
 	IPVlanEndpointType EndpointType = "ipvlan"
+
+	// VlanEndpointType is vlan network interface.
+	VlanEndpointType EndpointType = "vlan"
 )
 
 // Set sets an endpoint type based on the input string.
@@ -76,6 +79,9 @@ func (endpointType *EndpointType) Set(value string) error {
 	case "ipvlan":
 		*endpointType = IPVlanEndpointType
 		return nil
+	case "vlan":
+		*endpointType = VlanEndpointType
+		return nil
 	default:
 		return fmt.Errorf("Unknown endpoint type %s", value)
 	}
@@ -98,6 +104,8 @@ func (endpointType *EndpointType) String() string {
 		return string(TapEndpointType)
 	case IPVlanEndpointType:
 		return string(IPVlanEndpointType)
+	case VlanEndpointType:
+		return string(VlanEndpointType)
 	default:
 		return ""
 	}
@@ -40,6 +40,10 @@ func TestMacvtapEndpointTypeSet(t *testing.T) {
 	testEndpointTypeSet(t, "macvtap", MacvtapEndpointType)
 }
 
+func TestVlanEndpointTypeSet(t *testing.T) {
+	testEndpointTypeSet(t, "vlan", VlanEndpointType)
+}
+
 func TestEndpointTypeSetFailure(t *testing.T) {
 	var endpointType EndpointType
 
@@ -82,6 +86,11 @@ func TestMacvtapEndpointTypeString(t *testing.T) {
 	testEndpointTypeString(t, &endpointType, string(MacvtapEndpointType))
 }
 
+func TestVlanEndpointTypeString(t *testing.T) {
+	endpointType := VlanEndpointType
+	testEndpointTypeString(t, &endpointType, string(VlanEndpointType))
+}
+
 func TestIncorrectEndpointTypeString(t *testing.T) {
 	var endpointType EndpointType
 	testEndpointTypeString(t, &endpointType, "")
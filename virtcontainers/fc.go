@@ -6,12 +6,17 @@
 package virtcontainers
 
 import (
+	"bytes"
 	"context"
-	"errors"
+	"encoding/json"
 	"fmt"
+	"io/ioutil"
 	"net/url"
+	"os"
 	"os/exec"
 	"path/filepath"
+	"regexp"
+	"sort"
 
 	"strconv"
 	"strings"
@@ -21,10 +26,12 @@ import (
 
 	opentracing "github.com/opentracing/opentracing-go"
 	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netns"
 
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
 
 	"net"
 	"net/http"
@@ -57,8 +64,40 @@ const (
 	fcDiskPoolSize = 8
 	// The boot source is the first partition of the first block device added
 	rootDevice = "root=/dev/vda1"
+	// The serial console is the only one firecracker provides
+	consoleDevice = "console=ttyS0"
+	// The name firecracker gives to its vCPU threads, followed by their number
+	fcVCPUThreadName = "fc_vcpu "
+	// The token buckets of the rate limiters are refilled every second,
+	// in milliseconds
+	fcRateLimiterRefillTime = 1000
+	// The VM states and snapshot type of the firecracker API
+	fcVMStatePaused    = "Paused"
+	fcVMStateResumed   = "Resumed"
+	fcSnapshotTypeFull = "Full"
 )
 
+// fcHybridVsockVersion is the first firecracker version the agent vsock
+// is added to as a hybrid vsock, backed by a unix socket on the host. The
+// vhost-vsock device used by the previous versions is gone from
+// fcNoVhostVsockVersion on, and the versions in between are not supported.
+// The firecracker SDK does not provide this request either.
+var fcHybridVsockVersion = fcVersion{0, 21, 0}
+
+var fcNoVhostVsockVersion = fcVersion{0, 18, 0}
+
+// fcSnapshotVersion is the first firecracker version able to pause, resume,
+// snapshot the VM and load it from a snapshot. The firecracker SDK does not
+// provide these requests, see fcAPIRequest.
+var fcSnapshotVersion = fcVersion{0, 23, 0}
+
+// fcDriveRateLimiterVersion is the first firecracker version able to update
+// the rate limiter of a drive. The firecracker SDK does not provide this
+// request either.
+var fcDriveRateLimiterVersion = fcVersion{0, 21, 0}
+
+var fcVersionRegex = regexp.MustCompile(`v?(\d+)\.(\d+)\.(\d+)`)
+
 func (s vmmState) String() string {
 	switch s {
 	case notReady:
@@ -78,6 +117,39 @@ type FirecrackerInfo struct {
 	PID int
 }
 
+// fcVersion is a firecracker version, as major, minor and patch numbers.
+type fcVersion [3]int
+
+func (v fcVersion) atLeast(min fcVersion) bool {
+	for i := range v {
+		if v[i] != min[i] {
+			return v[i] > min[i]
+		}
+	}
+
+	return true
+}
+
+func (v fcVersion) String() string {
+	return fmt.Sprintf("v%d.%d.%d", v[0], v[1], v[2])
+}
+
+// parseFcVersion parses the version printed by firecracker --version.
+func parseFcVersion(out string) (fcVersion, error) {
+	var v fcVersion
+
+	m := fcVersionRegex.FindStringSubmatch(out)
+	if m == nil {
+		return v, fmt.Errorf("Unexpected firecracker version %q", strings.TrimSpace(out))
+	}
+
+	for i := range v {
+		v[i], _ = strconv.Atoi(m[i+1])
+	}
+
+	return v, nil
+}
+
 type firecrackerState struct {
 	sync.RWMutex
 	state vmmState
@@ -98,12 +170,28 @@ type firecracker struct {
 
 	firecrackerd *exec.Cmd           //Tracks the firecracker process itself
 	fcClient     *client.Firecracker //Tracks the current active connection
+	console      *fcConsole          //Serves the serial console
 	socketPath   string
 
 	store          *store.VCStore
 	config         HypervisorConfig
 	pendingDevices []firecrackerDevice // Devices to be added when the FC API is ready
+	vsock          kataVSOCK           // The vsock the agent is reached through
 	ctx            context.Context
+
+	versionOnce sync.Once
+	version     fcVersion // The version of the firecracker binary
+
+	netPool    []fcPoolInterface // The network interfaces of a VM from a factory
+	driveFiles []string          // The files backing the drives the VM is booted with
+}
+
+// fcSnapshotInfo is what a VM loaded from a snapshot needs to be given, on
+// top of the snapshot: the files and the TAP interfaces the snapshot refers
+// to.
+type fcSnapshotInfo struct {
+	Files   []string
+	NetPool []fcPoolInterface
 }
 
 type firecrackerDevice struct {
@@ -141,9 +229,12 @@ func (fc *firecracker) createSandbox(ctx context.Context, id string, hypervisorC
 	//TODO: check validity of the hypervisor config provided
 	//https://github.com/kata-containers/runtime/issues/1065
 	fc.id = id
-	fc.socketPath = filepath.Join(store.SandboxRuntimeRootPath(fc.id), fireSocket)
 	fc.store = vcStore
 	fc.config = *hypervisorConfig
+	fc.socketPath = filepath.Join(fc.vmPath(), fireSocket)
+	if fc.jailed() {
+		fc.socketPath = filepath.Join(fc.jailerRoot(), jailerSocket)
+	}
 	fc.state.set(notReady)
 
 	// No need to return an error from there since there might be nothing
@@ -152,15 +243,35 @@ func (fc *firecracker) createSandbox(ctx context.Context, id string, hypervisorC
 		fc.Logger().WithField("function", "init").WithError(err).Info("No info could be fetched")
 	}
 
+	// A VM from the factory is only known to the sandbox through the
+	// vm path, linked to the one of the factory VM.
+	if fc.info.PID == 0 {
+		if data, err := ioutil.ReadFile(fc.pidFile()); err == nil {
+			fc.info.PID, _ = strconv.Atoi(strings.TrimSpace(string(data)))
+		}
+	}
+
+	// Only a VM from a factory has a network interface pool.
+	if err := fc.loadNetPool(); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
 	return nil
 }
 
-func (fc *firecracker) newFireClient() *client.Firecracker {
-	span, _ := fc.trace("newFireClient")
-	defer span.Finish()
-	httpClient := client.NewHTTPClient(strfmt.NewFormats())
+// vmPath is where the firecracker API socket and pid file live. It is
+// linked from the sandbox vm path when the VM comes from a factory.
+func (fc *firecracker) vmPath() string {
+	return filepath.Join(store.RunVMStoragePath, fc.id)
+}
+
+func (fc *firecracker) pidFile() string {
+	return filepath.Join(fc.vmPath(), "pid")
+}
 
-	socketTransport := &http.Transport{
+// socketTransport returns an HTTP transport to the firecracker API socket.
+func (fc *firecracker) socketTransport() *http.Transport {
+	return &http.Transport{
 		DialContext: func(ctx context.Context, network, path string) (net.Conn, error) {
 			addr, err := net.ResolveUnixAddr("unix", fc.socketPath)
 			if err != nil {
@@ -170,14 +281,84 @@ func (fc *firecracker) newFireClient() *client.Firecracker {
 			return net.DialUnix("unix", nil, addr)
 		},
 	}
+}
+
+func (fc *firecracker) newFireClient() *client.Firecracker {
+	span, _ := fc.trace("newFireClient")
+	defer span.Finish()
+	httpClient := client.NewHTTPClient(strfmt.NewFormats())
 
 	transport := httptransport.New(client.DefaultHost, client.DefaultBasePath, client.DefaultSchemes)
-	transport.Transport = socketTransport
+	transport.Transport = fc.socketTransport()
 	httpClient.SetTransport(transport)
 
 	return httpClient
 }
 
+// fcAPIRequest sends the request to the firecracker API, for the requests
+// the firecracker SDK does not provide.
+func (fc *firecracker) fcAPIRequest(method, path string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(method, "http://"+client.DefaultHost+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	httpClient := &http.Client{
+		Transport: fc.socketTransport(),
+		Timeout:   fcTimeout * time.Second,
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 == 2 {
+		return nil
+	}
+
+	var fault models.Error
+	if err := json.NewDecoder(resp.Body).Decode(&fault); err != nil || fault.FaultMessage == "" {
+		return fmt.Errorf("Firecracker API request %s %s failed: %s", method, path, resp.Status)
+	}
+
+	return fmt.Errorf("Firecracker API request %s %s failed: %s", method, path, fault.FaultMessage)
+}
+
+// fcVersion returns the version of the firecracker binary, or the zero
+// version if it cannot be found out.
+func (fc *firecracker) fcVersion() fcVersion {
+	fc.versionOnce.Do(func() {
+		out, err := exec.Command(fc.config.HypervisorPath, "--version").Output()
+		if err == nil {
+			fc.version, err = parseFcVersion(string(out))
+		}
+		if err != nil {
+			fc.Logger().WithError(err).Warn("Could not find out the firecracker version")
+		}
+	})
+
+	return fc.version
+}
+
+// checkVersion fails if the firecracker binary is a version the agent
+// vsock cannot be added to.
+func (fc *firecracker) checkVersion() error {
+	v := fc.fcVersion()
+	if v.atLeast(fcNoVhostVsockVersion) && !v.atLeast(fcHybridVsockVersion) {
+		return fmt.Errorf("Firecracker %s is not supported, use a version older than %s or from %s", v, fcNoVhostVsockVersion, fcHybridVsockVersion)
+	}
+
+	return nil
+}
+
 func (fc *firecracker) vmRunning() bool {
 	resp, err := fc.client().Operations.DescribeInstance(nil)
 	if err != nil {
@@ -229,15 +410,64 @@ func (fc *firecracker) fcInit(timeout int) error {
 	span, _ := fc.trace("fcInit")
 	defer span.Finish()
 
-	args := []string{"--api-sock", fc.socketPath}
+	if err := os.MkdirAll(fc.vmPath(), store.DirMode); err != nil {
+		return err
+	}
+
+	// A VM booted for a factory runs in a network namespace of its own,
+	// which only holds the TAP interfaces of its pool: the VMs loaded from
+	// the same snapshot have pools of the same names. The namespace goes
+	// away with firecracker.
+	if fc.config.BootForFactory {
+		return doNewNetNS(func() error {
+			return fc.fcLaunch(timeout)
+		})
+	}
+
+	return fc.fcLaunch(timeout)
+}
+
+// fcLaunch starts firecracker, or its jailer, in the network namespace of
+// the calling thread and waits for its API socket.
+func (fc *firecracker) fcLaunch(timeout int) error {
+
+	var cmd *exec.Cmd
+	if fc.jailed() {
+		cmd = exec.Command(fc.config.JailerPath, fc.jailerArgs()...)
+	} else {
+		cmd = exec.Command(fc.config.HypervisorPath, "--api-sock", fc.socketPath)
+	}
+
+	// The serial console is the standard input and output of firecracker.
+	consolePath, err := fc.getSandboxConsole(fc.id)
+	if err != nil {
+		return err
+	}
+
+	if fc.console, err = newFcConsole(consolePath, fc.Logger()); err != nil {
+		fc.Logger().WithError(err).Warn("Could not serve the firecracker console")
+	} else {
+		cmd.Stdin = fc.console.slave
+		cmd.Stdout = fc.console.slave
+	}
 
-	cmd := exec.Command(fc.config.HypervisorPath, args...)
 	if err := cmd.Start(); err != nil {
 		fc.Logger().WithField("Error starting firecracker", err).Debug()
+		if fc.console != nil {
+			fc.console.close()
+			fc.console = nil
+		}
 		return err
 	}
 
+	if fc.console != nil {
+		fc.console.started()
+	}
+
 	fc.info.PID = cmd.Process.Pid
+	if err := ioutil.WriteFile(fc.pidFile(), []byte(strconv.Itoa(fc.info.PID)), 0600); err != nil {
+		return err
+	}
 	fc.firecrackerd = cmd
 	fc.fcClient = fc.newFireClient()
 
@@ -269,7 +499,7 @@ func (fc *firecracker) fcSetBootSource(path, params string) error {
 	fc.Logger().WithFields(logrus.Fields{"kernel-path": path,
 		"kernel-params": params}).Debug("fcSetBootSource")
 
-	bootParams := params + " " + rootDevice
+	bootParams := params + " " + rootDevice + " " + consoleDevice
 	bootSrcParams := ops.NewPutGuestBootSourceParams()
 	src := &models.BootSource{
 		KernelImagePath: &path,
@@ -285,6 +515,23 @@ func (fc *firecracker) fcSetBootSource(path, params string) error {
 	return nil
 }
 
+// fcSetVMBaseConfig sets the vCPUs and memory of the VM. The request is
+// sent as is, as firecracker requires ht_enabled, which the firecracker SDK
+// omits when false.
+func (fc *firecracker) fcSetVMBaseConfig(mem int64, vcpus int64, htEnabled bool) error {
+	span, _ := fc.trace("fcSetVMBaseConfig")
+	defer span.Finish()
+	fc.Logger().WithFields(logrus.Fields{"mem": mem,
+		"vcpus":     vcpus,
+		"htEnabled": htEnabled}).Debug("fcSetVMBaseConfig")
+
+	return fc.fcAPIRequest(http.MethodPut, "/machine-config", map[string]interface{}{
+		"mem_size_mib": mem,
+		"vcpu_count":   vcpus,
+		"ht_enabled":   htEnabled,
+	})
+}
+
 func (fc *firecracker) fcSetVMRootfs(path string) error {
 	span, _ := fc.trace("fcSetVMRootfs")
 	defer span.Finish()
@@ -293,7 +540,9 @@ func (fc *firecracker) fcSetVMRootfs(path string) error {
 	driveID := "rootfs"
 	driveParams := ops.NewPutGuestDriveByIDParams()
 	driveParams.SetDriveID(driveID)
-	isReadOnly := false
+	// The image is shared by all the VMs, a jailed firecracker is not
+	// given write access to it.
+	isReadOnly := fc.jailed()
 	//Add it as a regular block device
 	//This allows us to use a paritioned root block device
 	isRootDevice := false
@@ -343,21 +592,21 @@ func (fc *firecracker) startSandbox(timeout int) error {
 	span, _ := fc.trace("startSandbox")
 	defer span.Finish()
 
-	err := fc.fcInit(fcTimeout)
-	if err != nil {
+	if err := fc.checkVersion(); err != nil {
 		return err
 	}
 
+	// A VM created from a template is loaded from its snapshot, which
+	// already holds the VM configuration and devices.
+	if fc.config.BootFromTemplate {
+		return fc.startFromSnapshot(timeout)
+	}
+
 	kernelPath, err := fc.config.KernelAssetPath()
 	if err != nil {
 		return err
 	}
 
-	strParams := SerializeParams(fc.config.KernelParams, "=")
-	formattedParams := strings.Join(strParams, " ")
-
-	fc.fcSetBootSource(kernelPath, formattedParams)
-
 	image, err := fc.config.InitrdAssetPath()
 	if err != nil {
 		return err
@@ -370,8 +619,52 @@ func (fc *firecracker) startSandbox(timeout int) error {
 		}
 	}
 
-	fc.fcSetVMRootfs(image)
-	fc.createDiskPool()
+	diskPool, err := fc.diskPoolFiles()
+	if err != nil {
+		return err
+	}
+
+	if fc.jailed() {
+		files := append([]string{kernelPath, image}, diskPool...)
+
+		// The snapshot of a template VM is saved through the jail.
+		if fc.config.BootToBeTemplate {
+			snapshotFiles, err := fc.snapshotFiles()
+			if err != nil {
+				return err
+			}
+			files = append(files, snapshotFiles...)
+		}
+
+		if err := fc.jailerPrepare(files); err != nil {
+			return err
+		}
+	}
+
+	if err := fc.fcInit(fcTimeout); err != nil {
+		return err
+	}
+
+	if err := fc.fcSetVMBaseConfig(int64(fc.config.MemorySize), int64(fc.config.NumVCPUs), false); err != nil {
+		return err
+	}
+
+	strParams := SerializeParams(fc.config.KernelParams, "=")
+	formattedParams := strings.Join(strParams, " ")
+
+	fc.fcSetBootSource(fc.jailerPath(kernelPath), formattedParams)
+
+	fc.fcSetVMRootfs(fc.jailerPath(image))
+	fc.createDiskPool(diskPool)
+	fc.driveFiles = append([]string{image}, diskPool...)
+
+	// The network of the sandbox a VM from a factory is assigned to is
+	// not known yet, and firecracker cannot hot add network interfaces.
+	if fc.config.BootForFactory {
+		if err := fc.createNetPool(); err != nil {
+			return err
+		}
+	}
 
 	for _, d := range fc.pendingDevices {
 		if err = fc.addDevice(d.dev, d.devType); err != nil {
@@ -386,37 +679,102 @@ func (fc *firecracker) startSandbox(timeout int) error {
 	return fc.waitVMM(timeout)
 }
 
-func (fc *firecracker) createDiskPool() error {
-	span, _ := fc.trace("createDiskPool")
-	defer span.Finish()
+// startFromSnapshot starts firecracker and loads the VM from the snapshot
+// saved by saveSandbox. The VM is left paused, to be resumed once assigned
+// to a sandbox.
+func (fc *firecracker) startFromSnapshot(timeout int) error {
+	// The snapshot refers to the unix socket backing the vsock by its
+	// path, which is only private to the VM at the root of a jail.
+	if !fc.jailed() {
+		return fmt.Errorf("Firecracker can only load a VM from a snapshot in a jail")
+	}
 
-	for i := 0; i < fcDiskPoolSize; i++ {
-		driveID := "drive-" + strconv.Itoa(i)
-		driveParams := ops.NewPutGuestDriveByIDParams()
-		driveParams.SetDriveID(driveID)
-		isReadOnly := false
-		isRootDevice := false
+	info, err := fc.loadSnapshotInfo()
+	if err != nil {
+		return err
+	}
+
+	files := append([]string{fc.config.DevicesStatePath, fc.config.MemoryPath}, info.Files...)
+	if err := fc.jailerPrepare(files); err != nil {
+		return err
+	}
+
+	if err := fc.fcInit(fcTimeout); err != nil {
+		return err
+	}
+
+	// Firecracker opens the TAP interfaces of the snapshot by name.
+	if len(info.NetPool) > 0 {
+		if err := fc.createNetPoolTaps(info.NetPool); err != nil {
+			return err
+		}
+	}
+
+	// The snapshot vsock is backed by the unix socket of the VM the
+	// snapshot was taken from, which can only be linked from the vm
+	// path of this one when at the root of a jail.
+	for _, d := range fc.pendingDevices {
+		if hvs, ok := d.dev.(kataHybridVSOCK); ok {
+			if err := fc.linkHybridVsock(hvs); err != nil {
+				return err
+			}
+		}
+	}
+
+	if err := fc.fcLoadSnapshot(fc.jailerPath(fc.config.DevicesStatePath), fc.jailerPath(fc.config.MemoryPath)); err != nil {
+		return err
+	}
+
+	return fc.waitVMM(timeout)
+}
+
+// diskPoolFiles creates the temporary files used as placeholder backends
+// for the drives of the disk pool.
+func (fc *firecracker) diskPoolFiles() ([]string, error) {
+	var files []string
 
-		// Create a temporary file as a placeholder backend for the drive
+	for i := 0; i < fcDiskPoolSize; i++ {
 		hostURL, err := fc.store.Raw("")
 		if err != nil {
-			return err
+			return nil, err
 		}
 
 		// We get a full URL from Raw(), we need to parse it.
 		u, err := url.Parse(hostURL)
 		if err != nil {
-			return err
+			return nil, err
 		}
 
+		if err := fc.jailerChown(u.Path); err != nil {
+			return nil, err
+		}
+
+		files = append(files, u.Path)
+	}
+
+	return files, nil
+}
+
+func (fc *firecracker) createDiskPool(files []string) error {
+	span, _ := fc.trace("createDiskPool")
+	defer span.Finish()
+
+	for i, f := range files {
+		driveID := "drive-" + strconv.Itoa(i)
+		driveParams := ops.NewPutGuestDriveByIDParams()
+		driveParams.SetDriveID(driveID)
+		isReadOnly := false
+		isRootDevice := false
+		path := fc.jailerPath(f)
+
 		drive := &models.Drive{
 			DriveID:      &driveID,
 			IsReadOnly:   &isReadOnly,
 			IsRootDevice: &isRootDevice,
-			PathOnHost:   &u.Path,
+			PathOnHost:   &path,
 		}
 		driveParams.SetBody(drive)
-		_, err = fc.client().Operations.PutGuestDriveByID(driveParams)
+		_, err := fc.client().Operations.PutGuestDriveByID(driveParams)
 		if err != nil {
 			return err
 		}
@@ -437,6 +795,11 @@ func (fc *firecracker) stopSandbox() (err error) {
 			fc.Logger().Info("stopSandbox failed")
 		} else {
 			fc.Logger().Info("Firecracker VM stopped")
+			if fc.console != nil {
+				fc.console.close()
+				fc.console = nil
+			}
+			fc.cleanupVM()
 		}
 	}()
 
@@ -448,6 +811,17 @@ func (fc *firecracker) stopSandbox() (err error) {
 		return nil
 	}
 
+	// The TAP interfaces of the pool outlive firecracker, and are only
+	// reachable through its network namespace while it runs.
+	if len(fc.netPool) > 0 {
+		if fcNS, nsErr := netns.GetFromPath(fc.fcNetNSPath()); nsErr == nil {
+			defer func() {
+				fc.removeNetPool(fcNS)
+				fcNS.Close()
+			}()
+		}
+	}
+
 	// Send a SIGTERM to the VM process to try to stop it properly
 	if err = syscall.Kill(pid, syscall.SIGTERM); err != nil {
 		return err
@@ -474,16 +848,152 @@ func (fc *firecracker) stopSandbox() (err error) {
 	return syscall.Kill(pid, syscall.SIGKILL)
 }
 
-func (fc *firecracker) pauseSandbox() error {
+func (fc *firecracker) fcSetVMState(state string) error {
+	span, _ := fc.trace("fcSetVMState")
+	defer span.Finish()
+
+	fc.Logger().WithField("vm-state", state).Info("Setting VM state")
+
+	return fc.fcAPIRequest(http.MethodPatch, "/vm", map[string]string{
+		"state": state,
+	})
+}
+
+// fcCreateSnapshot saves the VM state to statePath and its memory to
+// memPath. The VM must be paused.
+func (fc *firecracker) fcCreateSnapshot(statePath, memPath string) error {
+	span, _ := fc.trace("fcCreateSnapshot")
+	defer span.Finish()
+
+	fc.Logger().WithFields(logrus.Fields{
+		"state-path":  statePath,
+		"memory-path": memPath,
+	}).Info("Creating VM snapshot")
+
+	if statePath == "" || memPath == "" {
+		return fmt.Errorf("Missing state or memory path to snapshot the VM")
+	}
+
+	return fc.fcAPIRequest(http.MethodPut, "/snapshot/create", map[string]string{
+		"snapshot_path": statePath,
+		"mem_file_path": memPath,
+		"snapshot_type": fcSnapshotTypeFull,
+	})
+}
+
+// fcLoadSnapshot loads the VM from the state and memory saved by
+// fcCreateSnapshot, into a firecracker whose VM is not configured yet. The
+// VM is left paused.
+func (fc *firecracker) fcLoadSnapshot(statePath, memPath string) error {
+	span, _ := fc.trace("fcLoadSnapshot")
+	defer span.Finish()
+
+	fc.Logger().WithFields(logrus.Fields{
+		"state-path":  statePath,
+		"memory-path": memPath,
+	}).Info("Loading VM snapshot")
+
+	if statePath == "" || memPath == "" {
+		return fmt.Errorf("Missing state or memory path to load the VM from")
+	}
+
+	if !fc.fcVersion().atLeast(fcSnapshotVersion) {
+		return fmt.Errorf("Firecracker %s cannot load a VM snapshot", fc.fcVersion())
+	}
+
+	if err := fc.fcAPIRequest(http.MethodPut, "/snapshot/load", map[string]string{
+		"snapshot_path": statePath,
+		"mem_file_path": memPath,
+	}); err != nil {
+		return err
+	}
+
+	fc.state.set(vmReady)
+
 	return nil
 }
 
+func (fc *firecracker) pauseSandbox() error {
+	span, _ := fc.trace("pauseSandbox")
+	defer span.Finish()
+
+	return fc.fcSetVMState(fcVMStatePaused)
+}
+
+// saveSandbox snapshots the paused VM, its state to DevicesStatePath and
+// its memory to MemoryPath. What a VM loaded from the snapshot needs on top
+// of it is saved next to the state.
 func (fc *firecracker) saveSandbox() error {
-	return nil
+	span, _ := fc.trace("saveSandbox")
+	defer span.Finish()
+
+	if err := fc.fcCreateSnapshot(fc.jailerPath(fc.config.DevicesStatePath), fc.jailerPath(fc.config.MemoryPath)); err != nil {
+		return err
+	}
+
+	info := fcSnapshotInfo{
+		Files: fc.driveFiles,
+	}
+
+	for _, iface := range fc.netPool {
+		iface.Used = false
+		info.NetPool = append(info.NetPool, iface)
+	}
+
+	data, err := json.Marshal(&info)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fc.snapshotInfoFile(), data, 0600)
+}
+
+// snapshotFiles creates the files the VM is saved to, for them to be linked
+// into the jail.
+func (fc *firecracker) snapshotFiles() ([]string, error) {
+	files := []string{fc.config.DevicesStatePath, fc.config.MemoryPath}
+
+	for _, f := range files {
+		file, err := os.OpenFile(f, os.O_CREATE|os.O_WRONLY, 0600)
+		if err != nil {
+			return nil, err
+		}
+		file.Close()
+
+		if err := fc.jailerChown(f); err != nil {
+			return nil, err
+		}
+	}
+
+	return files, nil
+}
+
+func (fc *firecracker) snapshotInfoFile() string {
+	return fc.config.DevicesStatePath + ".json"
+}
+
+func (fc *firecracker) loadSnapshotInfo() (fcSnapshotInfo, error) {
+	var info fcSnapshotInfo
+
+	data, err := ioutil.ReadFile(fc.snapshotInfoFile())
+	if err != nil {
+		return info, err
+	}
+
+	err = json.Unmarshal(data, &info)
+
+	return info, err
+}
+
+func (fc *firecracker) checkpointSandbox(statePath string) error {
+	return fmt.Errorf("firecracker does not support sandbox checkpoint")
 }
 
 func (fc *firecracker) resumeSandbox() error {
-	return nil
+	span, _ := fc.trace("resumeSandbox")
+	defer span.Finish()
+
+	return fc.fcSetVMState(fcVMStateResumed)
 }
 
 func (fc *firecracker) fcAddVsock(vs kataVSOCK) error {
@@ -502,6 +1012,12 @@ func (fc *firecracker) fcAddVsock(vs kataVSOCK) error {
 	if err != nil {
 		return err
 	}
+
+	fc.vsock = kataVSOCK{
+		contextID: vs.contextID,
+		port:      vs.port,
+	}
+
 	//Still racy. There is no way to send an fd to the firecracker
 	//REST API. We could release this just before we start the instance
 	//but even that will not eliminate the race
@@ -509,18 +1025,55 @@ func (fc *firecracker) fcAddVsock(vs kataVSOCK) error {
 	return nil
 }
 
+// fcAddHybridVsock adds the agent vsock, backed by the unix socket
+// firecracker creates at hvs.udsPath. A jailed firecracker creates it at
+// the root of its jail, linked from hvs.udsPath.
+func (fc *firecracker) fcAddHybridVsock(hvs kataHybridVSOCK) error {
+	span, _ := fc.trace("fcAddHybridVsock")
+	defer span.Finish()
+
+	if err := fc.linkHybridVsock(hvs); err != nil {
+		return err
+	}
+
+	return fc.fcAPIRequest(http.MethodPut, "/vsock", map[string]interface{}{
+		"vsock_id":  "root",
+		"guest_cid": hybridVSockContextID,
+		"uds_path":  fc.jailerPath(hvs.udsPath),
+	})
+}
+
+// linkHybridVsock links the unix socket a jailed firecracker backs the
+// vsock with, at the root of its jail, from hvs.udsPath.
+func (fc *firecracker) linkHybridVsock(hvs kataHybridVSOCK) error {
+	os.Remove(hvs.udsPath)
+
+	if !fc.jailed() {
+		return nil
+	}
+
+	jailPath := filepath.Join(fc.jailerRoot(), fc.jailerPath(hvs.udsPath))
+	os.Remove(jailPath)
+
+	return os.Symlink(jailPath, hvs.udsPath)
+}
+
 func (fc *firecracker) fcAddNetDevice(endpoint Endpoint) error {
 	span, _ := fc.trace("fcAddNetDevice")
 	defer span.Finish()
 
+	return fc.fcPutNetInterface(endpoint.Name(), endpoint.HardwareAddr(), endpoint.NetworkPair().TapInterface.TAPIface.Name)
+}
+
+func (fc *firecracker) fcPutNetInterface(ifaceID, guestMAC, hostDevName string) error {
 	cfg := ops.NewPutGuestNetworkInterfaceByIDParams()
-	ifaceID := endpoint.Name()
 	ifaceCfg := &models.NetworkInterface{
 		AllowMmdsRequests: false,
-		GuestMac:          endpoint.HardwareAddr(),
+		GuestMac:          guestMAC,
 		IfaceID:           &ifaceID,
-		HostDevName:       endpoint.NetworkPair().TapInterface.TAPIface.Name,
+		HostDevName:       hostDevName,
 	}
+
 	cfg.SetBody(ifaceCfg)
 	cfg.SetIfaceID(ifaceID)
 	_, err := fc.client().Operations.PutGuestNetworkInterfaceByID(cfg)
@@ -566,9 +1119,18 @@ func (fc *firecracker) fcUpdateBlockDrive(drive config.BlockDrive) error {
 	driveParams := ops.NewPatchGuestDriveByIDParams()
 	driveParams.SetDriveID(driveID)
 
+	if fc.jailed() {
+		// The jail of the running VM only sees the files linked
+		// into it, not the ones bind mounted.
+		if err := fc.jailerLink(drive.File, false); err != nil {
+			return err
+		}
+	}
+	path := fc.jailerPath(drive.File)
+
 	driveFc := &models.PartialDrive{
 		DriveID:    &driveID,
-		PathOnHost: &drive.File, //This is the only property that can be modified
+		PathOnHost: &path, //This is the only property that can be modified
 	}
 	driveParams.SetBody(driveFc)
 	_, err := fc.client().Operations.PatchGuestDriveByID(driveParams)
@@ -622,6 +1184,9 @@ func (fc *firecracker) addDevice(devInfo interface{}, devType deviceType) error
 	case kataVSOCK:
 		fc.Logger().WithField("device-type-vsock", devInfo).Info("Adding device")
 		return fc.fcAddVsock(v)
+	case kataHybridVSOCK:
+		fc.Logger().WithField("device-type-hybrid-vsock", devInfo).Info("Adding device")
+		return fc.fcAddHybridVsock(v)
 	default:
 		fc.Logger().WithField("unknown-device-type", devInfo).Error("Adding device")
 		break
@@ -631,14 +1196,22 @@ func (fc *firecracker) addDevice(devInfo interface{}, devType deviceType) error
 }
 
 // hotplugAddDevice supported in Firecracker VMM
-func (fc *firecracker) hotplugAddDevice(devInfo interface{}, devType deviceType) (interface{}, error) {
+func (fc *firecracker) hotplugAddDevice(devInfo interface{}, devType deviceType) (_ interface{}, err error) {
 	span, _ := fc.trace("hotplugAddDevice")
 	defer span.Finish()
 
+	defer func(start time.Time) {
+		observeHotplug(devType, addDevice, start, err)
+	}(time.Now())
+
 	switch devType {
 	case blockDev:
 		//The drive placeholder has to exist prior to Update
 		return nil, fc.fcUpdateBlockDrive(*devInfo.(*config.BlockDrive))
+	case netDev:
+		// Endpoints are attached to the network interfaces the VM
+		// from a factory is booted with.
+		return nil, fc.fcAttachPoolInterface(devInfo.(Endpoint))
 	default:
 		fc.Logger().WithFields(logrus.Fields{"devInfo": devInfo,
 			"deviceType": devType}).Warn("hotplugAddDevice: unsupported device")
@@ -654,11 +1227,8 @@ func (fc *firecracker) hotplugRemoveDevice(devInfo interface{}, devType deviceTy
 
 // getSandboxConsole builds the path of the console where we can read
 // logs coming from the sandbox.
-//
-// we can get logs from firecracker itself; WIP on enabling.  Who needs
-// logs when you're just hacking?
 func (fc *firecracker) getSandboxConsole(id string) (string, error) {
-	return "", nil
+	return utils.BuildSocketPath(store.RunVMStoragePath, id, consoleSocket)
 }
 
 func (fc *firecracker) disconnect() {
@@ -673,6 +1243,19 @@ func (fc *firecracker) capabilities() types.Capabilities {
 	caps.SetFsSharingUnsupported()
 	caps.SetBlockDeviceHotplugSupport()
 
+	if fc.fcVersion().atLeast(fcHybridVsockVersion) {
+		caps.SetHybridVsockSupport()
+	}
+
+	if fc.fcVersion().atLeast(fcSnapshotVersion) {
+		caps.SetPauseSupport()
+		caps.SetSnapshotSupport()
+	}
+
+	if fc.fcVersion().atLeast(fcDriveRateLimiterVersion) {
+		caps.SetBlockRateLimiterSupport()
+	}
+
 	return caps
 }
 
@@ -684,34 +1267,216 @@ func (fc *firecracker) resizeMemory(reqMemMB uint32, memoryBlockSizeMB uint32) (
 	return 0, nil
 }
 
+func (fc *firecracker) hotpluggedResources() (uint32, []*memoryDevice, error) {
+	return 0, nil, nil
+}
+
 func (fc *firecracker) resizeVCPUs(reqVCPUs uint32) (currentVCPUs uint32, newVCPUs uint32, err error) {
 	return 0, 0, nil
 }
 
-// this is used to apply cgroup information on the host. not sure how necessary this
-// is in the first pass.
-//
-// Need to see if there's an easy way to ask firecracker for thread ids associated with
-// the vCPUs.  Issue opened to ask for per vCPU thread IDs:
-// https://github.com/firecracker-microvm/firecracker/issues/718
+// setBlockRateLimiter limits the bandwidth, in bytes per second, and the
+// operations per second of a drive, a zero limit removing it.
+func (fc *firecracker) setBlockRateLimiter(drive *config.BlockDrive, bandwidth, iops uint64) error {
+	span, _ := fc.trace("setBlockRateLimiter")
+	defer span.Finish()
+
+	driveID := "drive-" + strconv.Itoa(drive.Index)
+	path := fc.jailerPath(drive.File)
+
+	fc.Logger().WithFields(logrus.Fields{
+		"drive":     driveID,
+		"bandwidth": bandwidth,
+		"iops":      iops,
+	}).Info("Setting drive rate limiter")
+
+	// The host path has to be given again, it is kept unchanged.
+	return fc.fcAPIRequest(http.MethodPatch, "/drives/"+driveID, map[string]interface{}{
+		"drive_id":     driveID,
+		"path_on_host": path,
+		"rate_limiter": fcRateLimiter(bandwidth, iops),
+	})
+}
+
+// fcRateLimiter returns a rate limiter of bandwidth bytes and iops
+// operations per second.
+func fcRateLimiter(bandwidth, iops uint64) *models.RateLimiter {
+	return &models.RateLimiter{
+		Bandwidth: fcTokenBucket(bandwidth),
+		Ops:       fcTokenBucket(iops),
+	}
+}
+
+// fcTokenBucket returns a token bucket refilled with rate tokens every
+// second. Firecracker disables the buckets of no size, so a zero rate is no
+// limit.
+func fcTokenBucket(rate uint64) *models.TokenBucket {
+	size := int64(rate)
+	refillTime := int64(0)
+	if rate > 0 {
+		refillTime = fcRateLimiterRefillTime
+	}
+
+	return &models.TokenBucket{
+		Size:       &size,
+		RefillTime: &refillTime,
+	}
+}
+
+// getThreadIDs returns the IDs of the vCPU threads, named "fc_vcpu N" by
+// firecracker, so that they can be constrained by the sandbox cgroup.
 func (fc *firecracker) getThreadIDs() (*threadIDs, error) {
-	//TODO: this may not be exactly supported in Firecracker. Closest is cpu-template as part
-	// of get /machine-config
-	return nil, nil
+	span, _ := fc.trace("getThreadIDs")
+	defer span.Finish()
+
+	if fc.info.PID <= 0 {
+		return nil, nil
+	}
+
+	vcpus, err := fcVCPUThreadIDs(fmt.Sprintf("/proc/%d/task", fc.info.PID))
+	if err != nil {
+		return nil, err
+	}
+
+	return &threadIDs{vcpus: vcpus}, nil
+}
+
+// fcVCPUThreadIDs returns the IDs of the vCPU threads of the tasks found in
+// taskDir, ordered by vCPU number.
+func fcVCPUThreadIDs(taskDir string) ([]int, error) {
+	tasks, err := ioutil.ReadDir(taskDir)
+	if err != nil {
+		return nil, err
+	}
+
+	type vcpuThread struct {
+		vcpu int
+		tid  int
+	}
+
+	var threads []vcpuThread
+	for _, t := range tasks {
+		tid, err := strconv.Atoi(t.Name())
+		if err != nil {
+			continue
+		}
+
+		// The thread may have exited since the directory was read.
+		comm, err := ioutil.ReadFile(filepath.Join(taskDir, t.Name(), "comm"))
+		if err != nil {
+			continue
+		}
+
+		var vcpu int
+		if _, err := fmt.Sscanf(string(comm), fcVCPUThreadName+"%d", &vcpu); err != nil {
+			continue
+		}
+
+		threads = append(threads, vcpuThread{vcpu, tid})
+	}
+
+	sort.Slice(threads, func(i, j int) bool {
+		return threads[i].vcpu < threads[j].vcpu
+	})
+
+	var vcpus []int
+	for _, t := range threads {
+		vcpus = append(vcpus, t.tid)
+	}
+
+	return vcpus, nil
 }
 
 func (fc *firecracker) cleanup() error {
 	return nil
 }
 
+// cleanupVM removes the vm path, and the factory VM path it links to.
+func (fc *firecracker) cleanupVM() {
+	if fc.id == "" {
+		return
+	}
+
+	fc.jailerCleanup()
+
+	dir := fc.vmPath()
+
+	link, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		fc.Logger().WithError(err).WithField("dir", dir).Warn("failed to resolve vm path")
+	}
+
+	if err := os.RemoveAll(dir); err != nil {
+		fc.Logger().WithError(err).Warnf("failed to remove vm path %s", dir)
+	}
+
+	if link != dir && link != "" {
+		if err := os.RemoveAll(link); err != nil {
+			fc.Logger().WithError(err).WithField("link", link).Warn("failed to remove resolved vm path")
+		}
+	}
+}
+
 func (fc *firecracker) pid() int {
 	return fc.info.PID
 }
 
-func (fc *firecracker) fromGrpc(ctx context.Context, hypervisorConfig *HypervisorConfig, store *store.VCStore, j []byte) error {
-	return errors.New("firecracker is not supported by VM cache")
+// subscribeEvents is a no-op, firecracker exposes no VM lifecycle events,
+// its exit is detected through its process.
+func (fc *firecracker) subscribeEvents(events chan<- hypervisorEvent) error {
+	return nil
+}
+
+type firecrackerGrpc struct {
+	ID         string
+	SocketPath string
+	Info       FirecrackerInfo
+
+	// The vsock the VM was booted with, its context ID being owned by
+	// the firecracker process.
+	VsockContextID uint64
+	VsockPort      uint32
+
+	NetPool []fcPoolInterface
+}
+
+func (fc *firecracker) fromGrpc(ctx context.Context, hypervisorConfig *HypervisorConfig, vcStore *store.VCStore, j []byte) error {
+	var fp firecrackerGrpc
+	if err := json.Unmarshal(j, &fp); err != nil {
+		return err
+	}
+
+	fc.ctx = ctx
+	fc.id = fp.ID
+	fc.socketPath = fp.SocketPath
+	fc.info = fp.Info
+	fc.store = vcStore
+	fc.config = *hypervisorConfig
+	fc.vsock = kataVSOCK{
+		contextID: fp.VsockContextID,
+		port:      fp.VsockPort,
+	}
+	fc.netPool = fp.NetPool
+
+	// The VM was started by the VM cache server, the API socket is
+	// connected to on first use.
+	fc.state.set(vmReady)
+
+	return nil
 }
 
 func (fc *firecracker) toGrpc() ([]byte, error) {
-	return nil, errors.New("firecracker is not supported by VM cache")
+	// Drop the API connection, it is not used anymore by this process.
+	fc.fcClient = nil
+
+	fp := firecrackerGrpc{
+		ID:             fc.id,
+		SocketPath:     fc.socketPath,
+		Info:           fc.info,
+		VsockContextID: fc.vsock.contextID,
+		VsockPort:      fc.vsock.port,
+		NetPool:        fc.netPool,
+	}
+
+	return json.Marshal(&fp)
 }
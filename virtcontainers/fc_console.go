@@ -0,0 +1,140 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"io"
+	"net"
+	"os"
+	"sync"
+
+	"github.com/containerd/console"
+	"github.com/sirupsen/logrus"
+)
+
+// fcConsole serves the serial console of firecracker, which is its standard
+// input and output, on a unix socket the proxies can watch as they watch the
+// QEMU console socket.
+//
+// The socket is served by the process which started firecracker. When that
+// process exits, the guest output is dropped: writes to a pty without its
+// master fail, without killing firecracker as a closed pipe would.
+type fcConsole struct {
+	sync.Mutex
+
+	master   console.Console
+	slave    *os.File
+	listener net.Listener
+	conn     net.Conn
+	logger   *logrus.Entry
+}
+
+// newFcConsole creates the pty given to firecracker as its serial console,
+// and starts serving its master side on the socketPath unix socket.
+func newFcConsole(socketPath string, logger *logrus.Entry) (*fcConsole, error) {
+	master, slavePath, err := console.NewPty()
+	if err != nil {
+		return nil, err
+	}
+
+	slave, err := os.OpenFile(slavePath, os.O_RDWR, 0)
+	if err != nil {
+		master.Close()
+		return nil, err
+	}
+
+	// The guest output is relayed as is.
+	if err := master.SetRaw(); err != nil {
+		logger.WithError(err).Debug("Could not set the console in raw mode")
+	}
+	if err := console.ClearONLCR(slave.Fd()); err != nil {
+		logger.WithError(err).Debug("Could not disable the console newline translation")
+	}
+
+	os.Remove(socketPath)
+	listener, err := net.Listen("unix", socketPath)
+	if err != nil {
+		slave.Close()
+		master.Close()
+		return nil, err
+	}
+
+	c := &fcConsole{
+		master:   master,
+		slave:    slave,
+		listener: listener,
+		logger:   logger,
+	}
+
+	go c.serve()
+
+	return c, nil
+}
+
+// serve relays the console to one client at a time, the guest output being
+// dropped while there is none.
+func (c *fcConsole) serve() {
+	go c.relayOutput()
+
+	for {
+		conn, err := c.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		c.Lock()
+		if c.conn != nil {
+			c.conn.Close()
+		}
+		c.conn = conn
+		c.Unlock()
+
+		go func() {
+			io.Copy(c.master, conn)
+		}()
+	}
+}
+
+func (c *fcConsole) relayOutput() {
+	buf := make([]byte, 4096)
+
+	for {
+		n, err := c.master.Read(buf)
+		if err != nil {
+			return
+		}
+
+		c.Lock()
+		if c.conn != nil {
+			if _, err := c.conn.Write(buf[:n]); err != nil {
+				c.logger.WithError(err).Debug("Console client gone")
+				c.conn.Close()
+				c.conn = nil
+			}
+		}
+		c.Unlock()
+	}
+}
+
+// started closes the slave side of the console once it has been given to
+// firecracker, so that the console output ends when firecracker exits.
+func (c *fcConsole) started() {
+	c.slave.Close()
+}
+
+// close stops serving the console.
+func (c *fcConsole) close() {
+	c.listener.Close()
+
+	c.Lock()
+	if c.conn != nil {
+		c.conn.Close()
+		c.conn = nil
+	}
+	c.Unlock()
+
+	c.master.Close()
+}
@@ -0,0 +1,222 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"syscall"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// defaultJailerChrootBase is the default base directory of the jails,
+	// the same as the jailer one.
+	defaultJailerChrootBase = "/srv/jailer"
+
+	// jailerRootLink is the link, from the vm path, to the root of the
+	// jail so that the jail of a VM from the factory is found from the
+	// sandbox.
+	jailerRootLink = "root"
+
+	// jailerSocket is the API socket of a firecracker exec'ed by the
+	// jailer, at the root of the jail.
+	jailerSocket = "api.socket"
+
+	vhostVsockDevice = "/dev/vhost-vsock"
+)
+
+// jailed tells if firecracker is run by its jailer.
+func (fc *firecracker) jailed() bool {
+	return fc.config.JailerPath != ""
+}
+
+// jailerDir is the directory the jailer creates the jail of the VM in.
+func (fc *firecracker) jailerDir() string {
+	base := fc.config.JailerChrootBase
+	if base == "" {
+		base = defaultJailerChrootBase
+	}
+
+	return filepath.Join(base, filepath.Base(fc.config.HypervisorPath), fc.id)
+}
+
+// jailerRoot is the root of the jail, as seen from the host.
+func (fc *firecracker) jailerRoot() string {
+	return filepath.Join(fc.vmPath(), jailerRootLink)
+}
+
+// jailerPath returns the path of a host file linked into the jail, as seen
+// by firecracker.
+func (fc *firecracker) jailerPath(hostPath string) string {
+	if !fc.jailed() {
+		return hostPath
+	}
+
+	return "/" + filepath.Base(hostPath)
+}
+
+// jailerArgs returns the jailer command line. Firecracker is exec'ed by the
+// jailer, in the jail and with the seccomp filtering level the jailer passes
+// to it. The jailer does not forward any other argument to firecracker, whose
+// API socket is then jailerSocket.
+// The jailer makes firecracker join the network namespace of the calling
+// thread, which is the one of the sandbox, where its TAP interfaces are,
+// when started by the sandbox.
+func (fc *firecracker) jailerArgs() []string {
+	base := fc.config.JailerChrootBase
+	if base == "" {
+		base = defaultJailerChrootBase
+	}
+
+	return []string{
+		"--id", fc.id,
+		"--node", strconv.FormatUint(uint64(fc.config.JailerNumaNode), 10),
+		"--exec-file", fc.config.HypervisorPath,
+		"--uid", strconv.FormatUint(uint64(fc.config.JailerUID), 10),
+		"--gid", strconv.FormatUint(uint64(fc.config.JailerGID), 10),
+		"--chroot-base-dir", base,
+		"--seccomp-level", "2",
+		"--netns", fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), syscall.Gettid()),
+	}
+}
+
+// jailerPrepare creates the jail and links the files firecracker needs into
+// it. This must be done before the jailer is started, as the bind mounts
+// done later are not seen from the mount namespace of the jail.
+func (fc *firecracker) jailerPrepare(files []string) error {
+	root := filepath.Join(fc.jailerDir(), jailerRootLink)
+
+	if err := os.MkdirAll(root, store.DirMode); err != nil {
+		return err
+	}
+
+	os.Remove(fc.jailerRoot())
+	if err := os.Symlink(root, fc.jailerRoot()); err != nil {
+		return err
+	}
+
+	for _, f := range files {
+		if err := fc.jailerLink(f, true); err != nil {
+			return err
+		}
+	}
+
+	// The agent vsock of the firecracker versions without hybrid vsock is
+	// backed by the vhost-vsock device, the jailer only creates the KVM
+	// and TUN ones.
+	if fc.config.UseVSock && !fc.fcVersion().atLeast(fcHybridVsockVersion) {
+		return fc.jailerMknod(vhostVsockDevice, vhostVsockDevice)
+	}
+
+	return nil
+}
+
+// jailerLink makes a host file available in the jail, under its base name.
+// Device nodes are re-created in the jail, regular files are hard linked
+// or, across filesystems and if bindMount is set, bind mounted. A bind mount
+// is only seen from the jail if done before the jailer is started.
+func (fc *firecracker) jailerLink(hostPath string, bindMount bool) error {
+	src, err := filepath.EvalSymlinks(hostPath)
+	if err != nil {
+		return err
+	}
+
+	dst := filepath.Join(fc.jailerRoot(), filepath.Base(hostPath))
+
+	fc.Logger().WithFields(logrus.Fields{
+		"host-path":  src,
+		"jail-path":  dst,
+		"jailer-dir": fc.jailerDir(),
+	}).Debug("Linking file into the jail")
+
+	fi, err := os.Stat(src)
+	if err != nil {
+		return err
+	}
+
+	if fi.Mode()&os.ModeDevice != 0 {
+		return fc.jailerMknod(src, "/"+filepath.Base(hostPath))
+	}
+
+	err = os.Link(src, dst)
+	if err == nil || os.IsExist(err) {
+		return nil
+	}
+
+	if !bindMount {
+		return fmt.Errorf("Could not link %s into the jail %s: %v", src, fc.jailerDir(), err)
+	}
+
+	if err := ioutil.WriteFile(dst, nil, 0600); err != nil {
+		return err
+	}
+
+	if err := syscall.Mount(src, dst, "", syscall.MS_BIND, ""); err != nil {
+		os.Remove(dst)
+		return fmt.Errorf("Could not link %s into the jail: %v", src, err)
+	}
+
+	return nil
+}
+
+// jailerMknod creates in the jail, at jailPath, the device node hostPath
+// is, owned by the user firecracker is run as.
+func (fc *firecracker) jailerMknod(hostPath, jailPath string) error {
+	var st syscall.Stat_t
+	if err := syscall.Stat(hostPath, &st); err != nil {
+		return err
+	}
+
+	dst := filepath.Join(fc.jailerRoot(), jailPath)
+	if err := os.MkdirAll(filepath.Dir(dst), store.DirMode); err != nil {
+		return err
+	}
+
+	if err := syscall.Mknod(dst, st.Mode, int(st.Rdev)); err != nil && !os.IsExist(err) {
+		return err
+	}
+
+	return os.Chown(dst, int(fc.config.JailerUID), int(fc.config.JailerGID))
+}
+
+// jailerChown gives a file linked into the jail to the user firecracker is
+// run as.
+func (fc *firecracker) jailerChown(hostPath string) error {
+	if !fc.jailed() {
+		return nil
+	}
+
+	return os.Chown(hostPath, int(fc.config.JailerUID), int(fc.config.JailerGID))
+}
+
+// jailerCleanup unmounts the files bind mounted into the jail and removes
+// it.
+func (fc *firecracker) jailerCleanup() {
+	root, err := filepath.EvalSymlinks(fc.jailerRoot())
+	if err != nil {
+		return
+	}
+
+	files, err := ioutil.ReadDir(root)
+	if err != nil {
+		fc.Logger().WithError(err).WithField("jail", root).Warn("failed to read the jail")
+		return
+	}
+
+	for _, f := range files {
+		syscall.Unmount(filepath.Join(root, f.Name()), syscall.MNT_DETACH)
+	}
+
+	if err := os.RemoveAll(filepath.Dir(root)); err != nil {
+		fc.Logger().WithError(err).WithField("jail", root).Warn("failed to remove the jail")
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"syscall"
+	"testing"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirecrackerJailerArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	fc := &firecracker{
+		id: "fc-jailer",
+		config: HypervisorConfig{
+			HypervisorPath: "/usr/bin/firecracker",
+			JailerPath:     "/usr/bin/jailer",
+			JailerUID:      1000,
+			JailerGID:      1001,
+			JailerNumaNode: 1,
+		},
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	assert.True(fc.jailed())
+	assert.Equal("/srv/jailer/firecracker/fc-jailer", fc.jailerDir())
+	assert.Equal("/vmlinux", fc.jailerPath("/usr/share/kata-containers/vmlinux"))
+	assert.Equal([]string{
+		"--id", "fc-jailer",
+		"--node", "1",
+		"--exec-file", "/usr/bin/firecracker",
+		"--uid", "1000",
+		"--gid", "1001",
+		"--chroot-base-dir", "/srv/jailer",
+		"--seccomp-level", "2",
+		"--netns", fmt.Sprintf("/proc/%d/task/%d/ns/net", os.Getpid(), syscall.Gettid()),
+	}, fc.jailerArgs())
+
+	fc.config.JailerChrootBase = "/var/lib/jailer"
+	args := fc.jailerArgs()
+	assert.Contains(args, "/var/lib/jailer")
+	assert.Equal("/var/lib/jailer/firecracker/fc-jailer", fc.jailerDir())
+
+	fc.config.JailerPath = ""
+	assert.False(fc.jailed())
+	assert.Equal("/usr/share/kata-containers/vmlinux", fc.jailerPath("/usr/share/kata-containers/vmlinux"))
+}
+
+func TestFirecrackerJailerPrepare(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "fc-jailer")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRunVMStoragePath := store.RunVMStoragePath
+	store.RunVMStoragePath = filepath.Join(dir, "vm")
+	defer func() {
+		store.RunVMStoragePath = savedRunVMStoragePath
+	}()
+
+	kernel := filepath.Join(dir, "vmlinux")
+	assert.NoError(ioutil.WriteFile(kernel, []byte("kernel"), 0644))
+
+	fc := &firecracker{
+		ctx: context.Background(),
+		id:  "fc-jailer",
+		config: HypervisorConfig{
+			HypervisorPath:   "/usr/bin/firecracker",
+			JailerPath:       "/usr/bin/jailer",
+			JailerChrootBase: filepath.Join(dir, "jailer"),
+			JailerUID:        uint32(os.Getuid()),
+			JailerGID:        uint32(os.Getgid()),
+		},
+	}
+	assert.NoError(os.MkdirAll(fc.vmPath(), store.DirMode))
+
+	assert.NoError(fc.jailerPrepare([]string{kernel}))
+
+	data, err := ioutil.ReadFile(filepath.Join(fc.jailerDir(), "root", "vmlinux"))
+	assert.NoError(err)
+	assert.Equal("kernel", string(data))
+
+	// The jail is reached from the vm path
+	_, err = os.Stat(filepath.Join(fc.jailerRoot(), "vmlinux"))
+	assert.NoError(err)
+
+	assert.Error(fc.jailerLink(filepath.Join(dir, "missing"), true))
+
+	fc.jailerCleanup()
+	_, err = os.Stat(fc.jailerDir())
+	assert.True(os.IsNotExist(err))
+
+	// The linked file is left untouched
+	_, err = os.Stat(kernel)
+	assert.NoError(err)
+}
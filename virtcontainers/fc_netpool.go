@@ -0,0 +1,292 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+const (
+	// fcNetPoolSize is the number of network interfaces a VM created by a
+	// VM factory is booted with, firecracker being unable to hot add them.
+	fcNetPoolSize = 2
+
+	fcNetPoolFile = "netpool.json"
+)
+
+// fcPoolInterface is a network interface a VM created by a VM factory is
+// booted with, before the network of its sandbox is known. Its TAP interface
+// lives in the network namespace of firecracker until an endpoint is attached
+// to it.
+type fcPoolInterface struct {
+	IfaceID string
+	TapName string
+	MAC     string
+	Used    bool
+}
+
+// netPoolFile is where the network interface pool is stored, for the sandbox
+// the VM is assigned to.
+func (fc *firecracker) netPoolFile() string {
+	return filepath.Join(fc.vmPath(), fcNetPoolFile)
+}
+
+func (fc *firecracker) storeNetPool() error {
+	data, err := json.Marshal(fc.netPool)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(fc.netPoolFile(), data, 0600)
+}
+
+func (fc *firecracker) loadNetPool() error {
+	data, err := ioutil.ReadFile(fc.netPoolFile())
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(data, &fc.netPool)
+}
+
+// fcNetNSPath is the network namespace of the firecracker process, where the
+// TAP interfaces of the pool are created.
+func (fc *firecracker) fcNetNSPath() string {
+	return fmt.Sprintf("/proc/%d/ns/net", fc.info.PID)
+}
+
+// createNetPool creates the TAP interfaces of the network interface pool, and
+// adds the pool interfaces to the VM. It must be called before the VM starts.
+func (fc *firecracker) createNetPool() error {
+	span, _ := fc.trace("createNetPool")
+	defer span.Finish()
+
+	prefix := fc.id
+	if len(prefix) > 8 {
+		prefix = prefix[:8]
+	}
+
+	var pool []fcPoolInterface
+	for i := 0; i < fcNetPoolSize; i++ {
+		mac, err := generateRandomPrivateMacAddr()
+		if err != nil {
+			return err
+		}
+
+		pool = append(pool, fcPoolInterface{
+			IfaceID: fmt.Sprintf("pool%d", i),
+			TapName: fmt.Sprintf("fcp%s%d", prefix, i),
+			MAC:     mac,
+		})
+	}
+
+	if err := fc.createNetPoolTaps(pool); err != nil {
+		return err
+	}
+
+	for _, iface := range fc.netPool {
+		if err := fc.fcPutNetInterface(iface.IfaceID, iface.MAC, iface.TapName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// createNetPoolTaps creates the TAP interfaces of the network interface
+// pool, in the network namespace of firecracker, and stores the pool.
+func (fc *firecracker) createNetPoolTaps(pool []fcPoolInterface) error {
+	fc.netPool = nil
+
+	err := doNetNS(fc.fcNetNSPath(), func(_ ns.NetNS) error {
+		netHandle, err := netlink.NewHandle()
+		if err != nil {
+			return err
+		}
+		defer netHandle.Delete()
+
+		for _, iface := range pool {
+			// The TAP interface is persistent, it outlives its
+			// file descriptors until firecracker opens it.
+			if _, _, err := createLink(netHandle, iface.TapName, &netlink.Tuntap{}, 0); err != nil {
+				return fmt.Errorf("Could not create pool TAP interface: %s", err)
+			}
+
+			fc.netPool = append(fc.netPool, iface)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return fc.storeNetPool()
+}
+
+// fcAttachPoolInterface attaches the endpoint to a free interface of the pool.
+// It must be called from the network namespace of the endpoint, once
+// xConnectVMNetwork connected it to a TAP interface of its own, which is
+// replaced with the TAP interface of the pool interface. The guest interface
+// keeps the MAC address of the pool interface, which firecracker cannot
+// change once booted, so the interface of the endpoint is given the same MAC
+// address for the pod to be seen from its network with a single one.
+func (fc *firecracker) fcAttachPoolInterface(endpoint Endpoint) error {
+	span, _ := fc.trace("fcAttachPoolInterface")
+	defer span.Finish()
+
+	netPair := endpoint.NetworkPair()
+	if netPair == nil || netPair.NetInterworkingModel != NetXConnectTCFilterModel {
+		return fmt.Errorf("Only the %s networking model is supported by a firecracker VM from a factory",
+			tcFilterNetModelStr)
+	}
+
+	var iface *fcPoolInterface
+	for i := range fc.netPool {
+		if !fc.netPool[i].Used {
+			iface = &fc.netPool[i]
+			break
+		}
+	}
+	if iface == nil {
+		return fmt.Errorf("No network interface left in the pool of VM %s", fc.id)
+	}
+
+	netHandle, err := netlink.NewHandle()
+	if err != nil {
+		return err
+	}
+	defer netHandle.Delete()
+
+	// Drop the TAP interface created by xConnectVMNetwork, and its
+	// redirection.
+	tapLink, err := getLinkByName(netHandle, netPair.TAPIface.Name, &netlink.Tuntap{})
+	if err != nil {
+		return err
+	}
+
+	if err := netHandle.LinkDel(tapLink); err != nil {
+		return fmt.Errorf("Could not remove TAP %s: %s", netPair.TAPIface.Name, err)
+	}
+
+	for _, f := range netPair.VMFds {
+		f.Close()
+	}
+	netPair.VMFds = nil
+
+	for _, f := range netPair.VhostFds {
+		f.Close()
+	}
+	netPair.VhostFds = nil
+
+	link, err := getLinkForEndpoint(endpoint, netHandle)
+	if err != nil {
+		return err
+	}
+
+	if err := removeRedirectTCFilter(link); err != nil {
+		return err
+	}
+
+	if err := removeQdiscIngress(link); err != nil {
+		return err
+	}
+
+	// Move the TAP interface of the pool interface to the network
+	// namespace of the endpoint, under the name of the dropped one.
+	fcNS, err := netns.GetFromPath(fc.fcNetNSPath())
+	if err != nil {
+		return err
+	}
+	defer fcNS.Close()
+
+	fcHandle, err := netlink.NewHandleAt(fcNS)
+	if err != nil {
+		return err
+	}
+	defer fcHandle.Delete()
+
+	poolLink, err := fcHandle.LinkByName(iface.TapName)
+	if err != nil {
+		return fmt.Errorf("Could not find pool TAP %s: %s", iface.TapName, err)
+	}
+
+	curNS, err := netns.Get()
+	if err != nil {
+		return err
+	}
+	defer curNS.Close()
+
+	if err := fcHandle.LinkSetNsFd(poolLink, int(curNS)); err != nil {
+		return fmt.Errorf("Could not move pool TAP %s: %s", iface.TapName, err)
+	}
+
+	poolLink, err = netHandle.LinkByName(iface.TapName)
+	if err != nil {
+		return err
+	}
+
+	if err := netHandle.LinkSetName(poolLink, netPair.TAPIface.Name); err != nil {
+		return fmt.Errorf("Could not rename pool TAP %s: %s", iface.TapName, err)
+	}
+
+	tapLink, err = getLinkByName(netHandle, netPair.TAPIface.Name, &netlink.Tuntap{})
+	if err != nil {
+		return err
+	}
+
+	if err := tcFilterTAP(netHandle, endpoint, tapLink); err != nil {
+		return err
+	}
+
+	hwAddr, err := net.ParseMAC(iface.MAC)
+	if err != nil {
+		return err
+	}
+
+	if err := netHandle.LinkSetHardwareAddr(link, hwAddr); err != nil {
+		return fmt.Errorf("Could not set the MAC address of %s: %s", link.Attrs().Name, err)
+	}
+
+	// The agent finds the guest interface from its MAC address.
+	netPair.TAPIface.HardAddr = iface.MAC
+	iface.Used = true
+
+	return fc.storeNetPool()
+}
+
+// removeNetPool removes the TAP interfaces of the free pool interfaces, which
+// outlive firecracker. fcNS is the network namespace of firecracker.
+func (fc *firecracker) removeNetPool(fcNS netns.NsHandle) {
+	fcHandle, err := netlink.NewHandleAt(fcNS)
+	if err != nil {
+		fc.Logger().WithError(err).Warn("Could not remove the network interface pool")
+		return
+	}
+	defer fcHandle.Delete()
+
+	for _, iface := range fc.netPool {
+		if iface.Used {
+			continue
+		}
+
+		link, err := fcHandle.LinkByName(iface.TapName)
+		if err == nil {
+			err = fcHandle.LinkDel(link)
+		}
+		if err != nil {
+			fc.Logger().WithError(err).WithField("tap", iface.TapName).Warn("Could not remove pool TAP")
+		}
+	}
+}
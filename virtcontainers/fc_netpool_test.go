@@ -0,0 +1,80 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFirecrackerNetPool(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "fc-netpool")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRunVMStoragePath := store.RunVMStoragePath
+	store.RunVMStoragePath = dir
+	defer func() {
+		store.RunVMStoragePath = savedRunVMStoragePath
+	}()
+
+	fc := &firecracker{
+		ctx: context.Background(),
+		id:  "fc-netpool",
+		netPool: []fcPoolInterface{
+			{IfaceID: "pool0", TapName: "fcpfc-netp0", MAC: "02:00:00:00:00:01", Used: true},
+			{IfaceID: "pool1", TapName: "fcpfc-netp1", MAC: "02:00:00:00:00:02"},
+		},
+	}
+
+	assert.NoError(os.MkdirAll(fc.vmPath(), store.DirMode))
+	assert.NoError(fc.storeNetPool())
+
+	fc2 := &firecracker{
+		ctx: context.Background(),
+		id:  fc.id,
+	}
+	assert.NoError(fc2.loadNetPool())
+	assert.Equal(fc.netPool, fc2.netPool)
+
+	assert.NoError(os.Remove(filepath.Join(fc.vmPath(), fcNetPoolFile)))
+	assert.True(os.IsNotExist(fc2.loadNetPool()))
+}
+
+func TestFirecrackerAttachPoolInterface(t *testing.T) {
+	assert := assert.New(t)
+
+	fc := &firecracker{
+		ctx: context.Background(),
+		id:  "fc-netpool",
+	}
+
+	endpoint := &VethEndpoint{
+		NetPair: NetworkInterfacePair{
+			NetInterworkingModel: NetXConnectBridgedModel,
+		},
+	}
+
+	// Only the tcfilter model is supported.
+	_, err := fc.hotplugAddDevice(endpoint, netDev)
+	assert.Error(err)
+
+	// The pool is exhausted.
+	endpoint.NetPair.NetInterworkingModel = NetXConnectTCFilterModel
+	fc.netPool = []fcPoolInterface{
+		{IfaceID: "pool0", TapName: "fcpfc-netp0", MAC: "02:00:00:00:00:01", Used: true},
+	}
+	_, err = fc.hotplugAddDevice(endpoint, netDev)
+	assert.Error(err)
+}
@@ -0,0 +1,497 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/stretchr/testify/assert"
+)
+
+type fcAPIRequest struct {
+	method string
+	path   string
+	body   map[string]interface{}
+}
+
+// fcAPIServer serves a fake firecracker API on a unix socket, recording
+// the requests it receives.
+type fcAPIServer struct {
+	sync.Mutex
+	server   *http.Server
+	requests []fcAPIRequest
+	status   int
+}
+
+func newFcAPIServer(t *testing.T, socketPath string) *fcAPIServer {
+	l, err := net.Listen("unix", socketPath)
+	assert.NoError(t, err)
+
+	s := &fcAPIServer{
+		status: http.StatusNoContent,
+	}
+
+	s.server = &http.Server{
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			req := fcAPIRequest{
+				method: r.Method,
+				path:   r.URL.Path,
+			}
+			json.NewDecoder(r.Body).Decode(&req.body)
+
+			s.Lock()
+			s.requests = append(s.requests, req)
+			status := s.status
+			s.Unlock()
+
+			if status != http.StatusNoContent {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(status)
+				w.Write([]byte(`{"fault_message": "bad request"}`))
+				return
+			}
+
+			w.WriteHeader(status)
+		}),
+	}
+
+	go s.server.Serve(l)
+
+	return s
+}
+
+func (s *fcAPIServer) lastRequest() fcAPIRequest {
+	s.Lock()
+	defer s.Unlock()
+
+	if len(s.requests) == 0 {
+		return fcAPIRequest{}
+	}
+
+	return s.requests[len(s.requests)-1]
+}
+
+func newTestFirecracker(t *testing.T) (*firecracker, *fcAPIServer, func()) {
+	dir, err := ioutil.TempDir("", "fc-test")
+	assert.NoError(t, err)
+
+	fc := &firecracker{
+		ctx:        context.Background(),
+		socketPath: filepath.Join(dir, fireSocket),
+	}
+
+	server := newFcAPIServer(t, fc.socketPath)
+
+	return fc, server, func() {
+		server.server.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestFirecrackerPauseResumeSandbox(t *testing.T) {
+	assert := assert.New(t)
+
+	fc, server, cleanup := newTestFirecracker(t)
+	defer cleanup()
+
+	assert.NoError(fc.pauseSandbox())
+	req := server.lastRequest()
+	assert.Equal(http.MethodPatch, req.method)
+	assert.Equal("/vm", req.path)
+	assert.Equal("Paused", req.body["state"])
+
+	assert.NoError(fc.resumeSandbox())
+	req = server.lastRequest()
+	assert.Equal(http.MethodPatch, req.method)
+	assert.Equal("/vm", req.path)
+	assert.Equal("Resumed", req.body["state"])
+
+	server.Lock()
+	server.status = http.StatusBadRequest
+	server.Unlock()
+
+	assert.Error(fc.pauseSandbox())
+}
+
+func TestFirecrackerSaveSandbox(t *testing.T) {
+	assert := assert.New(t)
+
+	fc, server, cleanup := newTestFirecracker(t)
+	defer cleanup()
+
+	// No snapshot location
+	assert.Error(fc.saveSandbox())
+
+	dir, err := ioutil.TempDir("", "fc-template")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	fc.config.DevicesStatePath = filepath.Join(dir, "state")
+	fc.config.MemoryPath = filepath.Join(dir, "memory")
+	fc.driveFiles = []string{"/usr/share/kata-containers/kata.img", "/run/vc/sbs/fc/drive-0"}
+	fc.netPool = []fcPoolInterface{
+		{IfaceID: "pool0", TapName: "fcpfc0", MAC: "02:00:00:00:00:01", Used: true},
+	}
+
+	assert.NoError(fc.saveSandbox())
+	req := server.lastRequest()
+	assert.Equal(http.MethodPut, req.method)
+	assert.Equal("/snapshot/create", req.path)
+	assert.Equal(fc.config.DevicesStatePath, req.body["snapshot_path"])
+	assert.Equal(fc.config.MemoryPath, req.body["mem_file_path"])
+	assert.Equal("Full", req.body["snapshot_type"])
+
+	// A VM loaded from the snapshot gets the same files and free TAP
+	// interfaces.
+	info, err := fc.loadSnapshotInfo()
+	assert.NoError(err)
+	assert.Equal(fc.driveFiles, info.Files)
+	assert.Equal([]fcPoolInterface{
+		{IfaceID: "pool0", TapName: "fcpfc0", MAC: "02:00:00:00:00:01"},
+	}, info.NetPool)
+}
+
+func TestFirecrackerLoadSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	fc, server, cleanup := newTestFirecracker(t)
+	defer cleanup()
+
+	dir := filepath.Dir(fc.socketPath)
+	newVersion := func(version string) {
+		fc.config.HypervisorPath = filepath.Join(dir, "firecracker-"+version)
+		err := ioutil.WriteFile(fc.config.HypervisorPath, []byte("#!/bin/sh\necho Firecracker "+version+"\n"), 0755)
+		assert.NoError(err)
+		fc.versionOnce = sync.Once{}
+	}
+
+	// No snapshot location
+	newVersion("v0.23.0")
+	assert.Error(fc.fcLoadSnapshot("", ""))
+
+	assert.NoError(fc.fcLoadSnapshot("/state", "/memory"))
+	req := server.lastRequest()
+	assert.Equal(http.MethodPut, req.method)
+	assert.Equal("/snapshot/load", req.path)
+	assert.Equal("/state", req.body["snapshot_path"])
+	assert.Equal("/memory", req.body["mem_file_path"])
+	assert.Equal(vmReady, fc.state.state)
+
+	newVersion("v0.21.0")
+	assert.Error(fc.fcLoadSnapshot("/state", "/memory"))
+
+	// The snapshot vsock is only private to the VM in a jail.
+	fc.config.BootFromTemplate = true
+	assert.Error(fc.startSandbox(1))
+}
+
+func TestFirecrackerCheckVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "fc-version")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	for version, supported := range map[string]bool{
+		"v0.12.0": true,
+		"v0.18.0": false,
+		"v0.20.0": false,
+		"v0.21.0": true,
+		"v0.23.0": true,
+	} {
+		path := filepath.Join(dir, "firecracker-"+version)
+		err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho Firecracker "+version+"\n"), 0755)
+		assert.NoError(err)
+
+		fc := &firecracker{
+			ctx:    context.Background(),
+			config: HypervisorConfig{HypervisorPath: path},
+		}
+
+		if supported {
+			assert.NoError(fc.checkVersion(), version)
+		} else {
+			assert.Error(fc.checkVersion(), version)
+		}
+	}
+}
+
+func TestFirecrackerSetVMBaseConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	fc, server, cleanup := newTestFirecracker(t)
+	defer cleanup()
+
+	assert.NoError(fc.fcSetVMBaseConfig(2048, 2, false))
+	req := server.lastRequest()
+	assert.Equal(http.MethodPut, req.method)
+	assert.Equal("/machine-config", req.path)
+	assert.Equal(float64(2048), req.body["mem_size_mib"])
+	assert.Equal(float64(2), req.body["vcpu_count"])
+
+	// Firecracker requires ht_enabled.
+	htEnabled, ok := req.body["ht_enabled"]
+	assert.True(ok)
+	assert.Equal(false, htEnabled)
+}
+
+func TestFirecrackerAddHybridVsock(t *testing.T) {
+	assert := assert.New(t)
+
+	fc, server, cleanup := newTestFirecracker(t)
+	defer cleanup()
+
+	dir := filepath.Dir(fc.socketPath)
+	hvs := kataHybridVSOCK{
+		udsPath: filepath.Join(dir, hybridVSockName),
+		port:    1024,
+	}
+
+	assert.NoError(fc.fcAddHybridVsock(hvs))
+	req := server.lastRequest()
+	assert.Equal(http.MethodPut, req.method)
+	assert.Equal("/vsock", req.path)
+	assert.Equal("root", req.body["vsock_id"])
+	assert.Equal(float64(hybridVSockContextID), req.body["guest_cid"])
+	assert.Equal(hvs.udsPath, req.body["uds_path"])
+
+	// A jailed firecracker creates the socket at the root of its jail.
+	savedRunVMStoragePath := store.RunVMStoragePath
+	store.RunVMStoragePath = dir
+	defer func() {
+		store.RunVMStoragePath = savedRunVMStoragePath
+	}()
+
+	fc.id = "fc-hvsock"
+	fc.config.JailerPath = "/usr/bin/jailer"
+	assert.NoError(os.MkdirAll(fc.vmPath(), store.DirMode))
+	hvs.udsPath = filepath.Join(fc.vmPath(), hybridVSockName)
+
+	assert.NoError(fc.fcAddHybridVsock(hvs))
+	req = server.lastRequest()
+	assert.Equal("/"+hybridVSockName, req.body["uds_path"])
+
+	target, err := os.Readlink(hvs.udsPath)
+	assert.NoError(err)
+	assert.Equal(filepath.Join(fc.jailerRoot(), hybridVSockName), target)
+}
+
+func TestFirecrackerSetBlockRateLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	fc, server, cleanup := newTestFirecracker(t)
+	defer cleanup()
+
+	drive := &config.BlockDrive{
+		File:  "/dev/sdb",
+		Index: 1,
+	}
+
+	assert.NoError(fc.setBlockRateLimiter(drive, 1000000, 0))
+	req := server.lastRequest()
+	assert.Equal(http.MethodPatch, req.method)
+	assert.Equal("/drives/drive-1", req.path)
+	assert.Equal("/dev/sdb", req.body["path_on_host"])
+
+	limiter := req.body["rate_limiter"].(map[string]interface{})
+	assert.Equal(map[string]interface{}{
+		"size":        float64(1000000),
+		"refill_time": float64(fcRateLimiterRefillTime),
+	}, limiter["bandwidth"])
+	assert.Equal(map[string]interface{}{
+		"size":        float64(0),
+		"refill_time": float64(0),
+	}, limiter["ops"])
+}
+
+func TestParseFcVersion(t *testing.T) {
+	assert := assert.New(t)
+
+	v, err := parseFcVersion("Firecracker v0.23.1\n\nSupported snapshot data format versions: 0.23.0\n")
+	assert.NoError(err)
+	assert.Equal(fcVersion{0, 23, 1}, v)
+	assert.True(v.atLeast(fcSnapshotVersion))
+
+	v, err = parseFcVersion("firecracker 0.12.0\n")
+	assert.NoError(err)
+	assert.Equal(fcVersion{0, 12, 0}, v)
+	assert.False(v.atLeast(fcSnapshotVersion))
+
+	assert.True(fcVersion{1, 0, 0}.atLeast(fcSnapshotVersion))
+
+	_, err = parseFcVersion("firecracker\n")
+	assert.Error(err)
+}
+
+func TestFirecrackerCapabilities(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "fc-version")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	newFc := func(version string) *firecracker {
+		path := filepath.Join(dir, "firecracker-"+version)
+		err := ioutil.WriteFile(path, []byte("#!/bin/sh\necho Firecracker "+version+"\n"), 0755)
+		assert.NoError(err)
+
+		return &firecracker{
+			ctx:    context.Background(),
+			config: HypervisorConfig{HypervisorPath: path},
+		}
+	}
+
+	// Firecracker v0.12.0 can neither pause nor snapshot, nor limit the
+	// rate of a plugged drive, and has no hybrid vsock.
+	caps := newFc("v0.12.0").capabilities()
+	assert.False(caps.IsPauseSupported())
+	assert.False(caps.IsSnapshotSupported())
+	assert.False(caps.IsBlockRateLimiterSupported())
+	assert.False(caps.IsFsSharingSupported())
+	assert.True(caps.IsBlockDeviceHotplugSupported())
+	assert.False(caps.IsHybridVsockSupported())
+
+	caps = newFc("v0.21.0").capabilities()
+	assert.False(caps.IsPauseSupported())
+	assert.True(caps.IsBlockRateLimiterSupported())
+	assert.True(caps.IsHybridVsockSupported())
+
+	caps = newFc("v0.23.0").capabilities()
+	assert.True(caps.IsPauseSupported())
+	assert.True(caps.IsSnapshotSupported())
+
+	// Nor can an unknown version.
+	fc := &firecracker{
+		ctx:    context.Background(),
+		config: HypervisorConfig{HypervisorPath: filepath.Join(dir, "missing")},
+	}
+	caps = fc.capabilities()
+	assert.False(caps.IsPauseSupported())
+}
+
+func TestFirecrackerGrpc(t *testing.T) {
+	assert := assert.New(t)
+
+	fc := &firecracker{
+		ctx:        context.Background(),
+		id:         "fc-grpc",
+		socketPath: "/run/vc/vm/fc-grpc/" + fireSocket,
+		info: FirecrackerInfo{
+			PID: 1234,
+		},
+		vsock: kataVSOCK{
+			contextID: 5,
+			port:      1024,
+		},
+		netPool: []fcPoolInterface{
+			{IfaceID: "pool0", TapName: "fcpfc-grpc0", MAC: "02:00:00:00:00:01", Used: true},
+		},
+	}
+	fc.fcClient = fc.newFireClient()
+
+	j, err := fc.toGrpc()
+	assert.NoError(err)
+	assert.Nil(fc.fcClient)
+
+	var config HypervisorConfig
+	fc2 := &firecracker{}
+	assert.NoError(fc2.fromGrpc(context.Background(), &config, nil, j))
+
+	assert.Equal(fc.id, fc2.id)
+	assert.Equal(fc.socketPath, fc2.socketPath)
+	assert.Equal(fc.info, fc2.info)
+	assert.Equal(fc.vsock, fc2.vsock)
+	assert.Equal(fc.netPool, fc2.netPool)
+	assert.Equal(vmReady, fc2.state.state)
+
+	assert.Error(fc2.fromGrpc(context.Background(), &config, nil, []byte("not json")))
+}
+
+func TestFcVCPUThreadIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	taskDir, err := ioutil.TempDir("", "fc-tasks")
+	assert.NoError(err)
+	defer os.RemoveAll(taskDir)
+
+	tasks := map[string]string{
+		"100": "firecracker\n",
+		"101": "fc_api\n",
+		"103": "fc_vcpu 1\n",
+		"102": "fc_vcpu 0\n",
+		"104": "fc_vcpu 2\n",
+	}
+
+	for tid, comm := range tasks {
+		assert.NoError(os.MkdirAll(filepath.Join(taskDir, tid), 0755))
+		assert.NoError(ioutil.WriteFile(filepath.Join(taskDir, tid, "comm"), []byte(comm), 0644))
+	}
+
+	// A thread which exited while listed
+	assert.NoError(os.MkdirAll(filepath.Join(taskDir, "105"), 0755))
+
+	vcpus, err := fcVCPUThreadIDs(taskDir)
+	assert.NoError(err)
+	assert.Equal([]int{102, 103, 104}, vcpus)
+
+	_, err = fcVCPUThreadIDs(filepath.Join(taskDir, "missing"))
+	assert.Error(err)
+
+	fc := &firecracker{
+		ctx: context.Background(),
+	}
+	tids, err := fc.getThreadIDs()
+	assert.NoError(err)
+	assert.Nil(tids)
+}
+
+func TestFirecrackerConsole(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "fc-console")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, consoleSocket)
+	c, err := newFcConsole(socketPath, virtLog)
+	assert.NoError(err)
+	defer c.close()
+
+	conn, err := net.Dial("unix", socketPath)
+	assert.NoError(err)
+	defer conn.Close()
+
+	// Wait for the client to be served, the output being dropped before.
+	for i := 0; i < 100; i++ {
+		c.Lock()
+		served := c.conn != nil
+		c.Unlock()
+		if served {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	_, err = c.slave.Write([]byte("guest output\n"))
+	assert.NoError(err)
+
+	conn.SetReadDeadline(time.Now().Add(5 * time.Second))
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("guest output\n", line)
+}
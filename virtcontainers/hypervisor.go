@@ -13,6 +13,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	"github.com/kata-containers/runtime/virtcontainers/store"
@@ -97,6 +98,8 @@ const (
 type memoryDevice struct {
 	slot   int
 	sizeMB int
+	// addr is the guest physical address of the memory, when plugged.
+	addr uint64
 }
 
 // Set sets an hypervisor type based on the input string.
@@ -168,6 +171,20 @@ type HypervisorConfig struct {
 	// Msize9p is used as the msize for 9p shares
 	Msize9p uint32
 
+	// SharedFS is the type of the file system shared with the guest,
+	// config.Virtio9P when empty, or config.VirtioFS.
+	SharedFS string
+
+	// VirtioFSDaemon is the virtio-fs vhost-user daemon host path.
+	VirtioFSDaemon string
+
+	// VirtioFSCache is the cache mode of the virtio-fs daemon.
+	VirtioFSCache string
+
+	// VirtioFSCacheSize is the DAX cache size in MiB of the virtio-fs
+	// device, DAX is disabled when it is zero.
+	VirtioFSCacheSize uint32
+
 	// MemSlots specifies default memory slots the VM.
 	MemSlots uint32
 
@@ -199,6 +216,24 @@ type HypervisorConfig struct {
 	// HypervisorPath is the hypervisor executable host path.
 	HypervisorPath string
 
+	// JailerPath is the firecracker jailer executable host path. When set,
+	// firecracker is run by its jailer, in a chroot and as JailerUID and
+	// JailerGID.
+	JailerPath string
+
+	// JailerChrootBase is the directory under which the jailer creates
+	// the chroot of each VM.
+	JailerChrootBase string
+
+	// JailerUID is the user firecracker is run as by its jailer.
+	JailerUID uint32
+
+	// JailerGID is the group firecracker is run as by its jailer.
+	JailerGID uint32
+
+	// JailerNumaNode is the NUMA node the jailer binds firecracker to.
+	JailerNumaNode uint32
+
 	// BlockDeviceDriver specifies the driver to be used for block device
 	// either VirtioSCSI or VirtioBlock with the default driver being defaultBlockDriver
 	BlockDeviceDriver string
@@ -278,11 +313,33 @@ type HypervisorConfig struct {
 	// BootFromTemplate used to indicate if the VM should be created from a template VM
 	BootFromTemplate bool
 
+	// BootForFactory used to indicate if the VM is created by a VM factory,
+	// before the network of the sandbox it is assigned to is known
+	BootForFactory bool
+
+	// BootFromCheckpoint used to indicate if the VM should be restored from a
+	// checkpoint. The VM memory and device state are read from DevicesStatePath.
+	BootFromCheckpoint bool
+
+	// CheckpointBlockDrives are the block drives hotplugged into the
+	// checkpointed VM, plugged back at the same addresses before its
+	// device state is loaded.
+	CheckpointBlockDrives []config.BlockDrive
+
 	// DisableVhostNet is used to indicate if host supports vhost_net
 	DisableVhostNet bool
 
 	// GuestHookPath is the path within the VM that will be used for 'drop-in' hooks
 	GuestHookPath string
+
+	// EnableBalloon adds a memory balloon device to the VM, used to give
+	// memory back to the host when the VM memory is resized down.
+	EnableBalloon bool
+
+	// BalloonReclaimInterval is the period at which the guest memory
+	// statistics are polled to reclaim the memory the guest does not use.
+	// Zero disables the reclaim, which requires EnableBalloon.
+	BalloonReclaimInterval time.Duration
 }
 
 type threadIDs struct {
@@ -304,6 +361,21 @@ func (conf *HypervisorConfig) checkTemplateConfig() error {
 		}
 	}
 
+	// The state of a vhost-user-fs device cannot be migrated.
+	if (conf.BootToBeTemplate || conf.BootFromTemplate) && conf.SharedFS == config.VirtioFS {
+		return fmt.Errorf("Cannot use virtio-fs with a vm template")
+	}
+
+	if conf.BootFromCheckpoint {
+		if conf.BootToBeTemplate || conf.BootFromTemplate {
+			return fmt.Errorf("Cannot restore a vm template from a checkpoint")
+		}
+
+		if conf.DevicesStatePath == "" {
+			return fmt.Errorf("Missing DevicesStatePath to restore from checkpoint")
+		}
+	}
+
 	return nil
 }
 
@@ -320,6 +392,14 @@ func (conf *HypervisorConfig) valid() error {
 		return err
 	}
 
+	if conf.SharedFS == config.VirtioFS && conf.VirtioFSDaemon == "" {
+		return fmt.Errorf("Missing virtio-fs daemon path")
+	}
+
+	if conf.BalloonReclaimInterval > 0 && !conf.EnableBalloon {
+		return fmt.Errorf("Memory reclaim requires the balloon device")
+	}
+
 	if conf.NumVCPUs == 0 {
 		conf.NumVCPUs = defaultVCPUs
 	}
@@ -589,6 +669,23 @@ func RunningOnVMM(cpuInfoPath string) (bool, error) {
 	return false, fmt.Errorf("Couldn't find %q from %q output", flagsField, cpuInfoPath)
 }
 
+type hypervisorEventKind int
+
+const (
+	// vmShutdownEvent is sent when the VM shuts down.
+	vmShutdownEvent hypervisorEventKind = iota
+
+	// guestPanicEvent is sent when the guest kernel panics.
+	guestPanicEvent
+)
+
+// hypervisorEvent is a VM lifecycle event reported by the hypervisor to
+// its events subscriber.
+type hypervisorEvent struct {
+	kind    hypervisorEventKind
+	details string
+}
+
 // hypervisor is the virtcontainers hypervisor interface.
 // The default hypervisor implementation is Qemu.
 type hypervisor interface {
@@ -597,12 +694,15 @@ type hypervisor interface {
 	stopSandbox() error
 	pauseSandbox() error
 	saveSandbox() error
+	checkpointSandbox(statePath string) error
 	resumeSandbox() error
 	addDevice(devInfo interface{}, devType deviceType) error
 	hotplugAddDevice(devInfo interface{}, devType deviceType) (interface{}, error)
 	hotplugRemoveDevice(devInfo interface{}, devType deviceType) (interface{}, error)
 	resizeMemory(memMB uint32, memoryBlockSizeMB uint32) (uint32, error)
 	resizeVCPUs(vcpus uint32) (uint32, uint32, error)
+	setBlockRateLimiter(drive *config.BlockDrive, bandwidth, iops uint64) error
+	hotpluggedResources() (uint32, []*memoryDevice, error)
 	getSandboxConsole(sandboxID string) (string, error)
 	disconnect()
 	capabilities() types.Capabilities
@@ -610,6 +710,7 @@ type hypervisor interface {
 	getThreadIDs() (*threadIDs, error)
 	cleanup() error
 	pid() int
+	subscribeEvents(events chan<- hypervisorEvent) error
 	fromGrpc(ctx context.Context, hypervisorConfig *HypervisorConfig, store *store.VCStore, j []byte) error
 	toGrpc() ([]byte, error)
 }
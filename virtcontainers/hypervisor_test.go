@@ -12,6 +12,9 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
 )
 
 func testSetHypervisorType(t *testing.T, value string, expected HypervisorType) {
@@ -157,6 +160,38 @@ func TestHypervisorConfigIsValid(t *testing.T) {
 	testHypervisorConfigValid(t, hypervisorConfig, true)
 }
 
+func TestHypervisorConfigBalloonReclaimWithoutBalloon(t *testing.T) {
+	hypervisorConfig := &HypervisorConfig{
+		KernelPath:             fmt.Sprintf("%s/%s", testDir, testKernel),
+		ImagePath:              fmt.Sprintf("%s/%s", testDir, testImage),
+		HypervisorPath:         fmt.Sprintf("%s/%s", testDir, testHypervisor),
+		BalloonReclaimInterval: time.Second,
+	}
+
+	testHypervisorConfigValid(t, hypervisorConfig, false)
+
+	hypervisorConfig.EnableBalloon = true
+	testHypervisorConfigValid(t, hypervisorConfig, true)
+}
+
+func TestHypervisorConfigVirtioFS(t *testing.T) {
+	hypervisorConfig := &HypervisorConfig{
+		KernelPath:     fmt.Sprintf("%s/%s", testDir, testKernel),
+		ImagePath:      fmt.Sprintf("%s/%s", testDir, testImage),
+		HypervisorPath: fmt.Sprintf("%s/%s", testDir, testHypervisor),
+		SharedFS:       config.VirtioFS,
+	}
+
+	testHypervisorConfigValid(t, hypervisorConfig, false)
+
+	hypervisorConfig.VirtioFSDaemon = "/usr/libexec/virtiofsd"
+	testHypervisorConfigValid(t, hypervisorConfig, true)
+
+	hypervisorConfig.BootToBeTemplate = true
+	hypervisorConfig.MemoryPath = "foobar"
+	testHypervisorConfigValid(t, hypervisorConfig, false)
+}
+
 func TestHypervisorConfigValidTemplateConfig(t *testing.T) {
 	hypervisorConfig := &HypervisorConfig{
 		KernelPath:       fmt.Sprintf("%s/%s", testDir, testKernel),
@@ -41,6 +41,11 @@ func (impl *VCImpl) CreateSandbox(ctx context.Context, sandboxConfig SandboxConf
 	return CreateSandbox(ctx, sandboxConfig, impl.factory)
 }
 
+// RestoreSandbox implements the VC function of the same name.
+func (impl *VCImpl) RestoreSandbox(ctx context.Context, sandboxConfig SandboxConfig, checkpointDir string) (VCSandbox, error) {
+	return RestoreSandbox(ctx, sandboxConfig, checkpointDir)
+}
+
 // DeleteSandbox implements the VC function of the same name.
 func (impl *VCImpl) DeleteSandbox(ctx context.Context, sandboxID string) (VCSandbox, error) {
 	return DeleteSandbox(ctx, sandboxID)
@@ -162,6 +167,16 @@ func (impl *VCImpl) RemoveInterface(ctx context.Context, sandboxID string, inf *
 	return RemoveInterface(ctx, sandboxID, inf)
 }
 
+// UpdateInterface implements the VC function of the same name.
+func (impl *VCImpl) UpdateInterface(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	return UpdateInterface(ctx, sandboxID, inf)
+}
+
+// UpdateBandwidth implements the VC function of the same name.
+func (impl *VCImpl) UpdateBandwidth(ctx context.Context, sandboxID string, bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	return UpdateBandwidth(ctx, sandboxID, bw)
+}
+
 // ListInterfaces implements the VC function of the same name.
 func (impl *VCImpl) ListInterfaces(ctx context.Context, sandboxID string) ([]*vcTypes.Interface, error) {
 	return ListInterfaces(ctx, sandboxID)
@@ -24,6 +24,7 @@ type VC interface {
 	SetFactory(ctx context.Context, factory Factory)
 
 	CreateSandbox(ctx context.Context, sandboxConfig SandboxConfig) (VCSandbox, error)
+	RestoreSandbox(ctx context.Context, sandboxConfig SandboxConfig, checkpointDir string) (VCSandbox, error)
 	DeleteSandbox(ctx context.Context, sandboxID string) (VCSandbox, error)
 	FetchSandbox(ctx context.Context, sandboxID string) (VCSandbox, error)
 	ListSandbox(ctx context.Context) ([]SandboxStatus, error)
@@ -51,6 +52,8 @@ type VC interface {
 
 	AddInterface(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error)
 	RemoveInterface(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	UpdateInterface(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	UpdateBandwidth(ctx context.Context, sandboxID string, bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error)
 	ListInterfaces(ctx context.Context, sandboxID string) ([]*vcTypes.Interface, error)
 	UpdateRoutes(ctx context.Context, sandboxID string, routes []*vcTypes.Route) ([]*vcTypes.Route, error)
 	ListRoutes(ctx context.Context, sandboxID string) ([]*vcTypes.Route, error)
@@ -61,6 +64,8 @@ type VC interface {
 type VCSandbox interface {
 	Annotations(key string) (string, error)
 	GetNetNs() string
+	GetHypervisorPid() (int, error)
+	GetVCPUThreadIDs() ([]int, error)
 	GetAllContainers() []VCContainer
 	GetAnnotations() map[string]string
 	GetContainer(containerID string) VCContainer
@@ -71,6 +76,7 @@ type VCSandbox interface {
 	Stop() error
 	Pause() error
 	Resume() error
+	Checkpoint(dir string) error
 	Release() error
 	Monitor() (chan error, error)
 	Delete() error
@@ -96,6 +102,8 @@ type VCSandbox interface {
 
 	AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error)
 	RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	UpdateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	UpdateBandwidth(bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error)
 	ListInterfaces() ([]*vcTypes.Interface, error)
 	UpdateRoutes(routes []*vcTypes.Route) ([]*vcTypes.Route, error)
 	ListRoutes() ([]*vcTypes.Route, error)
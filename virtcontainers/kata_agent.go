@@ -56,20 +56,23 @@ var (
 	mountGuest9pTag       = "kataShared"
 	kataGuestSandboxDir   = "/run/kata-containers/sandbox/"
 	type9pFs              = "9p"
+	typeVirtioFS          = "virtiofs"
 	vsockSocketScheme     = "vsock"
 	// port numbers below 1024 are called privileged ports. Only a process with
 	// CAP_NET_BIND_SERVICE capability may bind to these port numbers.
-	vSockPort            = 1024
-	kata9pDevType        = "9p"
-	kataMmioBlkDevType   = "mmioblk"
-	kataBlkDevType       = "blk"
-	kataSCSIDevType      = "scsi"
-	kataNvdimmDevType    = "nvdimm"
-	sharedDir9pOptions   = []string{"trans=virtio,version=9p2000.L,cache=mmap", "nodev"}
-	shmDir               = "shm"
-	kataEphemeralDevType = "ephemeral"
-	ephemeralPath        = filepath.Join(kataGuestSandboxDir, kataEphemeralDevType)
-	grpcMaxDataSize      = int64(1024 * 1024)
+	vSockPort                = 1024
+	kata9pDevType            = "9p"
+	kataVirtioFSDevType      = "virtio-fs"
+	kataMmioBlkDevType       = "mmioblk"
+	kataBlkDevType           = "blk"
+	kataSCSIDevType          = "scsi"
+	kataNvdimmDevType        = "nvdimm"
+	sharedDir9pOptions       = []string{"trans=virtio,version=9p2000.L,cache=mmap", "nodev"}
+	sharedDirVirtioFSOptions = []string{"nodev"}
+	shmDir                   = "shm"
+	kataEphemeralDevType     = "ephemeral"
+	ephemeralPath            = filepath.Join(kataGuestSandboxDir, kataEphemeralDevType)
+	grpcMaxDataSize          = int64(1024 * 1024)
 )
 
 // KataAgentConfig is a structure storing information needed
@@ -109,6 +112,10 @@ type kataAgent struct {
 	keepConn     bool
 	proxyBuiltIn bool
 
+	// hvsockRelay serves the agent to the client when it is reached
+	// through a hybrid vsock.
+	hvsockRelay *hybridVSockRelay
+
 	vmSocket interface{}
 	ctx      context.Context
 }
@@ -207,6 +214,8 @@ func (k *kataAgent) agentURL() (string, error) {
 		return s.HostPath, nil
 	case kataVSOCK:
 		return s.String(), nil
+	case kataHybridVSOCK:
+		return s.String(), nil
 	default:
 		return "", fmt.Errorf("Invalid socket type")
 	}
@@ -254,6 +263,24 @@ func (k *kataAgent) configure(h hypervisor, id, sharePath string, builtin bool,
 			return err
 		}
 	case kataVSOCK:
+		// The hypervisor backs the vsock with a unix socket in the vm
+		// path, which only its runtime can reach the agent through.
+		if caps := h.capabilities(); caps.IsHybridVsockSupported() {
+			if _, ok := k.shim.(*kataShim); ok {
+				return fmt.Errorf("The kata shim cannot reach the agent through a hybrid vsock, use the shim v2")
+			}
+
+			hs := kataHybridVSOCK{
+				udsPath: filepath.Join(k.getVMPath(id), hybridVSockName),
+				port:    uint32(vSockPort),
+			}
+			if err = h.addDevice(hs, vSockPCIDev); err != nil {
+				return err
+			}
+			k.vmSocket = hs
+			break
+		}
+
 		s.vhostFd, s.contextID, err = utils.FindContextID()
 		if err != nil {
 			return err
@@ -664,6 +691,17 @@ func (k *kataAgent) startSandbox(sandbox *Sandbox) error {
 			Options:    sharedDir9pOptions,
 		}
 
+		// The same directory, shared with virtio-fs instead.
+		if sandbox.config.HypervisorConfig.SharedFS == config.VirtioFS {
+			sharedVolume.Driver = kataVirtioFSDevType
+			sharedVolume.Fstype = typeVirtioFS
+			sharedVolume.Options = sharedDirVirtioFSOptions
+
+			if sandbox.config.HypervisorConfig.VirtioFSCacheSize > 0 {
+				sharedVolume.Options = append([]string{"dax"}, sharedDirVirtioFSOptions...)
+			}
+		}
+
 		storages = append(storages, sharedVolume)
 	}
 
@@ -1368,7 +1406,7 @@ func (k *kataAgent) statsContainer(sandbox *Sandbox, c Container) (*ContainerSta
 		return nil, err
 	}
 
-	stats, ok := returnStats.(*grpc.StatsContainerResponse)
+	stats, ok := returnStats.(*statsContainerResponse)
 	if !ok {
 		return nil, fmt.Errorf("irregular response container stats")
 	}
@@ -1383,8 +1421,10 @@ func (k *kataAgent) statsContainer(sandbox *Sandbox, c Container) (*ContainerSta
 	if err != nil {
 		return nil, err
 	}
+
 	containerStats := &ContainerStats{
-		CgroupStats: &cgroupStats,
+		CgroupStats:  &cgroupStats,
+		NetworkStats: stats.networkStats,
 	}
 	return containerStats, nil
 }
@@ -1405,9 +1445,24 @@ func (k *kataAgent) connect() error {
 		return nil
 	}
 
+	url := k.state.URL
+	hvsock, ok, err := parseHybridVSockURL(url)
+	if err != nil {
+		return err
+	}
+	if ok {
+		relay, err := newHybridVSockRelay(hvsock)
+		if err != nil {
+			return err
+		}
+		k.hvsockRelay = relay
+		url = relay.url()
+	}
+
 	k.Logger().WithField("url", k.state.URL).Info("New client")
-	client, err := kataclient.NewAgentClient(k.ctx, k.state.URL, k.proxyBuiltIn)
+	client, err := kataclient.NewAgentClient(k.ctx, url, k.proxyBuiltIn)
 	if err != nil {
+		k.closeHybridVSockRelay()
 		return err
 	}
 
@@ -1434,10 +1489,22 @@ func (k *kataAgent) disconnect() error {
 
 	k.client = nil
 	k.reqHandlers = nil
+	k.closeHybridVSockRelay()
 
 	return nil
 }
 
+func (k *kataAgent) closeHybridVSockRelay() {
+	if k.hvsockRelay == nil {
+		return
+	}
+
+	if err := k.hvsockRelay.close(); err != nil {
+		k.Logger().WithError(err).Warn("Could not close the hybrid vsock relay")
+	}
+	k.hvsockRelay = nil
+}
+
 // check grpc server is serving
 func (k *kataAgent) check() error {
 	span, _ := k.trace("check")
@@ -1560,7 +1627,16 @@ func (k *kataAgent) installReqFunc(c *kataclient.AgentClient) {
 		return k.client.CloseStdin(ctx, req.(*grpc.CloseStdinRequest), opts...)
 	}
 	k.reqHandlers["grpc.StatsContainerRequest"] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
-		return k.client.StatsContainer(ctx, req.(*grpc.StatsContainerRequest), opts...)
+		codec := &statsContainerCodec{}
+		resp, err := k.client.StatsContainer(ctx, req.(*grpc.StatsContainerRequest), append(opts, golangGrpc.CallCustomCodec(codec))...)
+		if err != nil {
+			return nil, err
+		}
+
+		return &statsContainerResponse{
+			StatsContainerResponse: resp,
+			networkStats:           codec.networkStats,
+		}, nil
 	}
 	k.reqHandlers["grpc.PauseContainerRequest"] = func(ctx context.Context, req interface{}, opts ...golangGrpc.CallOption) (interface{}, error) {
 		return k.client.PauseContainer(ctx, req.(*grpc.PauseContainerRequest), opts...)
@@ -1609,6 +1685,8 @@ func (k *kataAgent) sendReq(request interface{}) (interface{}, error) {
 	message := request.(proto.Message)
 	k.Logger().WithField("name", msgName).WithField("req", message.String()).Debug("sending request")
 
+	defer observeAgentRPC(msgName, time.Now())
+
 	return handler(k.ctx, request)
 }
 
@@ -1732,6 +1810,7 @@ func (k *kataAgent) convertToKataAgentInterface(iface *vcTypes.Interface) *aType
 		return nil
 	}
 
+	// The VLAN ID is not passed, the VLAN tagging is done on the host.
 	return &aTypes.Interface{
 		Device:      iface.Device,
 		Name:        iface.Name,
@@ -0,0 +1,192 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	hybridVSockScheme = "hvsock"
+
+	// hybridVSockName is the unix socket, in the vm path, the hypervisor
+	// backs the hybrid vsock with.
+	hybridVSockName = "kata.hvsock"
+
+	// The guest context ID of a hybrid vsock only needs to be unique in
+	// its VM.
+	hybridVSockContextID = 3
+
+	hybridVSockDialTimeout = 5 * time.Second
+)
+
+var hybridVSockRelayCount uint32
+
+// kataHybridVSOCK is a vsock the host reaches through the unix socket
+// udsPath: a connection to a guest port is opened by writing "CONNECT <port>"
+// to the socket, the hypervisor answering "OK <host port>".
+type kataHybridVSOCK struct {
+	udsPath string
+	port    uint32
+}
+
+func (s *kataHybridVSOCK) String() string {
+	return fmt.Sprintf("%s://%s:%d", hybridVSockScheme, s.udsPath, s.port)
+}
+
+// parseHybridVSockURL parses an agent URL built by kataHybridVSOCK.String().
+func parseHybridVSockURL(url string) (kataHybridVSOCK, bool, error) {
+	prefix := hybridVSockScheme + "://"
+	if !strings.HasPrefix(url, prefix) {
+		return kataHybridVSOCK{}, false, nil
+	}
+
+	addr := strings.TrimPrefix(url, prefix)
+	i := strings.LastIndex(addr, ":")
+	if i <= 0 {
+		return kataHybridVSOCK{}, true, fmt.Errorf("Invalid hybrid vsock URL %q", url)
+	}
+
+	port, err := strconv.ParseUint(addr[i+1:], 10, 32)
+	if err != nil {
+		return kataHybridVSOCK{}, true, fmt.Errorf("Invalid hybrid vsock URL %q: %v", url, err)
+	}
+
+	return kataHybridVSOCK{
+		udsPath: addr[:i],
+		port:    uint32(port),
+	}, true, nil
+}
+
+// dial opens a connection to the guest port of the vsock.
+func (s *kataHybridVSOCK) dial() (net.Conn, error) {
+	conn, err := net.DialTimeout("unix", s.udsPath, hybridVSockDialTimeout)
+	if err != nil {
+		return nil, err
+	}
+
+	conn.SetDeadline(time.Now().Add(hybridVSockDialTimeout))
+
+	if _, err := fmt.Fprintf(conn, "CONNECT %d\n", s.port); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	// Read the answer a byte at a time, not to swallow the first bytes
+	// the guest sends.
+	var answer []byte
+	b := make([]byte, 1)
+	for {
+		if _, err := conn.Read(b); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("Could not connect to vsock port %d through %s: %v", s.port, s.udsPath, err)
+		}
+
+		if b[0] == '\n' {
+			break
+		}
+		answer = append(answer, b[0])
+	}
+
+	if !strings.HasPrefix(string(answer), "OK ") {
+		conn.Close()
+		return nil, fmt.Errorf("Could not connect to vsock port %d through %s: %q", s.port, s.udsPath, answer)
+	}
+
+	conn.SetDeadline(time.Time{})
+
+	return conn, nil
+}
+
+// hybridVSockRelay serves the guest port of a hybrid vsock on a plain unix
+// socket, for the agent client which cannot do the CONNECT handshake. It
+// lives as long as the agent client of the process using it.
+type hybridVSockRelay struct {
+	hvsock   kataHybridVSOCK
+	path     string
+	listener net.Listener
+	wg       sync.WaitGroup
+}
+
+func newHybridVSockRelay(hvsock kataHybridVSOCK) (*hybridVSockRelay, error) {
+	n := atomic.AddUint32(&hybridVSockRelayCount, 1)
+	path := filepath.Join(filepath.Dir(hvsock.udsPath), fmt.Sprintf("relay-%d-%d.sock", os.Getpid(), n))
+
+	os.Remove(path)
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &hybridVSockRelay{
+		hvsock:   hvsock,
+		path:     path,
+		listener: l,
+	}
+
+	r.wg.Add(1)
+	go r.serve()
+
+	return r, nil
+}
+
+// url is the agent URL the relay is reached through.
+func (r *hybridVSockRelay) url() string {
+	return r.path
+}
+
+func (r *hybridVSockRelay) serve() {
+	defer r.wg.Done()
+
+	for {
+		conn, err := r.listener.Accept()
+		if err != nil {
+			return
+		}
+
+		go r.relay(conn)
+	}
+}
+
+func (r *hybridVSockRelay) relay(conn net.Conn) {
+	defer conn.Close()
+
+	guest, err := r.hvsock.dial()
+	if err != nil {
+		virtLog.WithField("subsystem", "kata_agent").WithError(err).Debug("Could not relay to the agent")
+		return
+	}
+	defer guest.Close()
+
+	done := make(chan struct{}, 2)
+	pipe := func(dst, src net.Conn) {
+		io.Copy(dst, src)
+		done <- struct{}{}
+	}
+
+	go pipe(guest, conn)
+	go pipe(conn, guest)
+
+	// Either side closing ends the relayed connection.
+	<-done
+}
+
+func (r *hybridVSockRelay) close() error {
+	err := r.listener.Close()
+	r.wg.Wait()
+	os.Remove(r.path)
+
+	return err
+}
@@ -0,0 +1,114 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// serveHybridVSock serves a fake hybrid vsock on udsPath, whose guest port
+// echoes what it reads.
+func serveHybridVSock(t *testing.T, udsPath string, port uint32) net.Listener {
+	l, err := net.Listen("unix", udsPath)
+	assert.NoError(t, err)
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+
+				r := bufio.NewReader(conn)
+				line, err := r.ReadString('\n')
+				if err != nil || line != fmt.Sprintf("CONNECT %d\n", port) {
+					return
+				}
+				fmt.Fprintf(conn, "OK 1073741824\n")
+
+				for {
+					line, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					conn.Write([]byte(line))
+				}
+			}()
+		}
+	}()
+
+	return l
+}
+
+func TestParseHybridVSockURL(t *testing.T) {
+	assert := assert.New(t)
+
+	hvs := kataHybridVSOCK{
+		udsPath: "/run/vc/vm/sandbox/kata.hvsock",
+		port:    1024,
+	}
+
+	parsed, ok, err := parseHybridVSockURL(hvs.String())
+	assert.NoError(err)
+	assert.True(ok)
+	assert.Equal(hvs, parsed)
+
+	_, ok, err = parseHybridVSockURL("vsock://3:1024")
+	assert.NoError(err)
+	assert.False(ok)
+
+	_, ok, err = parseHybridVSockURL("hvsock:///run/vc/vm/sandbox/kata.hvsock")
+	assert.Error(err)
+	assert.True(ok)
+}
+
+func TestHybridVSockRelay(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "hvsock")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	hvs := kataHybridVSOCK{
+		udsPath: filepath.Join(dir, hybridVSockName),
+		port:    1024,
+	}
+
+	l := serveHybridVSock(t, hvs.udsPath, hvs.port)
+	defer l.Close()
+
+	relay, err := newHybridVSockRelay(hvs)
+	assert.NoError(err)
+
+	conn, err := net.Dial("unix", relay.url())
+	assert.NoError(err)
+
+	fmt.Fprintf(conn, "ping\n")
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	assert.NoError(err)
+	assert.Equal("ping\n", line)
+	conn.Close()
+
+	assert.NoError(relay.close())
+	_, err = os.Stat(relay.url())
+	assert.True(os.IsNotExist(err))
+
+	// The guest port is not served
+	hvs.port = 1025
+	_, err = hvs.dial()
+	assert.Error(err)
+}
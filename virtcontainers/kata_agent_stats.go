@@ -0,0 +1,110 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+
+	"github.com/gogo/protobuf/proto"
+	"github.com/kata-containers/agent/protocols/grpc"
+)
+
+// agentNetworkStats are the statistics of a guest network interface, as
+// returned by the agent in the network_stats field of StatsContainerResponse,
+// which the vendored agent protocol predates.
+type agentNetworkStats struct {
+	Name      string `protobuf:"bytes,1,opt,name=name,proto3"`
+	RxBytes   uint64 `protobuf:"varint,2,opt,name=rx_bytes,json=rxBytes,proto3"`
+	RxPackets uint64 `protobuf:"varint,3,opt,name=rx_packets,json=rxPackets,proto3"`
+	RxErrors  uint64 `protobuf:"varint,4,opt,name=rx_errors,json=rxErrors,proto3"`
+	RxDropped uint64 `protobuf:"varint,5,opt,name=rx_dropped,json=rxDropped,proto3"`
+	TxBytes   uint64 `protobuf:"varint,6,opt,name=tx_bytes,json=txBytes,proto3"`
+	TxPackets uint64 `protobuf:"varint,7,opt,name=tx_packets,json=txPackets,proto3"`
+	TxErrors  uint64 `protobuf:"varint,8,opt,name=tx_errors,json=txErrors,proto3"`
+	TxDropped uint64 `protobuf:"varint,9,opt,name=tx_dropped,json=txDropped,proto3"`
+}
+
+func (m *agentNetworkStats) Reset()         { *m = agentNetworkStats{} }
+func (m *agentNetworkStats) String() string { return proto.CompactTextString(m) }
+func (*agentNetworkStats) ProtoMessage()    {}
+
+// agentNetworkStatsResponse only decodes the network_stats field of
+// StatsContainerResponse.
+type agentNetworkStatsResponse struct {
+	NetworkStats []*agentNetworkStats `protobuf:"bytes,2,rep,name=network_stats,json=networkStats"`
+}
+
+func (m *agentNetworkStatsResponse) Reset()         { *m = agentNetworkStatsResponse{} }
+func (m *agentNetworkStatsResponse) String() string { return proto.CompactTextString(m) }
+func (*agentNetworkStatsResponse) ProtoMessage()    {}
+
+// statsContainerCodec is the gRPC codec of the StatsContainer calls. It
+// decodes the response as the default codec does, and keeps the guest network
+// statistics the vendored response type drops. Agents predating the network
+// statistics do not return any.
+type statsContainerCodec struct {
+	networkStats []*NetworkStats
+}
+
+func (c *statsContainerCodec) Marshal(v interface{}) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("Cannot marshal %T, not a protobuf message", v)
+	}
+
+	return proto.Marshal(m)
+}
+
+func (c *statsContainerCodec) Unmarshal(data []byte, v interface{}) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("Cannot unmarshal %T, not a protobuf message", v)
+	}
+
+	if err := proto.Unmarshal(data, m); err != nil {
+		return err
+	}
+
+	if _, ok := v.(*grpc.StatsContainerResponse); !ok {
+		return nil
+	}
+
+	var resp agentNetworkStatsResponse
+	if err := proto.Unmarshal(data, &resp); err != nil {
+		return err
+	}
+
+	c.networkStats = nil
+	for _, s := range resp.NetworkStats {
+		c.networkStats = append(c.networkStats, &NetworkStats{
+			Name:      s.Name,
+			RxBytes:   s.RxBytes,
+			RxPackets: s.RxPackets,
+			RxErrors:  s.RxErrors,
+			RxDropped: s.RxDropped,
+			TxBytes:   s.TxBytes,
+			TxPackets: s.TxPackets,
+			TxErrors:  s.TxErrors,
+			TxDropped: s.TxDropped,
+		})
+	}
+
+	return nil
+}
+
+// String returns the name of the default codec, used as the content subtype
+// of the calls.
+func (c *statsContainerCodec) String() string {
+	return "proto"
+}
+
+// statsContainerResponse is the response of the agent to a
+// StatsContainerRequest, along with the guest network statistics.
+type statsContainerResponse struct {
+	*grpc.StatsContainerResponse
+
+	networkStats []*NetworkStats
+}
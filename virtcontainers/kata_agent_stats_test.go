@@ -0,0 +1,57 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"testing"
+
+	"github.com/gogo/protobuf/proto"
+	pb "github.com/kata-containers/agent/protocols/grpc"
+	"github.com/stretchr/testify/assert"
+)
+
+// testStatsContainerResponse is a StatsContainerResponse of an agent
+// returning the network statistics.
+type testStatsContainerResponse struct {
+	CgroupStats  *pb.CgroupStats      `protobuf:"bytes,1,opt,name=cgroup_stats,json=cgroupStats"`
+	NetworkStats []*agentNetworkStats `protobuf:"bytes,2,rep,name=network_stats,json=networkStats"`
+}
+
+func (m *testStatsContainerResponse) Reset()         { *m = testStatsContainerResponse{} }
+func (m *testStatsContainerResponse) String() string { return proto.CompactTextString(m) }
+func (*testStatsContainerResponse) ProtoMessage()    {}
+
+func TestStatsContainerCodec(t *testing.T) {
+	assert := assert.New(t)
+
+	data, err := proto.Marshal(&testStatsContainerResponse{
+		CgroupStats: &pb.CgroupStats{
+			PidsStats: &pb.PidsStats{Current: 3},
+		},
+		NetworkStats: []*agentNetworkStats{
+			{Name: "eth0", RxBytes: 42, TxBytes: 24, TxDropped: 1},
+		},
+	})
+	assert.NoError(err)
+
+	codec := &statsContainerCodec{}
+	var resp pb.StatsContainerResponse
+	assert.NoError(codec.Unmarshal(data, &resp))
+	assert.Equal(uint64(3), resp.CgroupStats.PidsStats.Current)
+	assert.Equal([]*NetworkStats{
+		{Name: "eth0", RxBytes: 42, TxBytes: 24, TxDropped: 1},
+	}, codec.networkStats)
+
+	// Agents predating the network statistics
+	data, err = codec.Marshal(&pb.StatsContainerResponse{CgroupStats: &pb.CgroupStats{}})
+	assert.NoError(err)
+	assert.NoError(codec.Unmarshal(data, &resp))
+	assert.Empty(codec.networkStats)
+
+	_, err = codec.Marshal("foo")
+	assert.Error(err)
+	assert.Error(codec.Unmarshal(data, "foo"))
+}
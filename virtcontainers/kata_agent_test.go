@@ -220,7 +220,15 @@ func (p *gRPCProxy) OnlineCPUMem(ctx context.Context, req *pb.OnlineCPUMemReques
 }
 
 func (p *gRPCProxy) StatsContainer(ctx context.Context, req *pb.StatsContainerRequest) (*pb.StatsContainerResponse, error) {
-	return &pb.StatsContainerResponse{}, nil
+	return &pb.StatsContainerResponse{
+		CgroupStats: &pb.CgroupStats{
+			BlkioStats: &pb.BlkioStats{
+				IoQueuedRecursive: []*pb.BlkioStatsEntry{
+					{Major: 8, Op: "Read", Value: 2},
+				},
+			},
+		},
+	}, nil
 }
 
 func (p *gRPCProxy) Check(ctx context.Context, req *pb.CheckRequest) (*pb.HealthCheckResponse, error) {
@@ -337,8 +345,9 @@ func TestKataAgentSendReq(t *testing.T) {
 	err = k.onlineCPUMem(1, true)
 	assert.Nil(err)
 
-	_, err = k.statsContainer(sandbox, Container{})
+	stats, err := k.statsContainer(sandbox, Container{})
 	assert.Nil(err)
+	assert.Equal([]BlkioStatEntry{{Major: 8, Op: "Read", Value: 2}}, stats.CgroupStats.BlkioStats.IoQueuedRecursive)
 
 	err = k.check()
 	assert.Nil(err)
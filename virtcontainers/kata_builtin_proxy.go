@@ -6,9 +6,7 @@
 package virtcontainers
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"net"
 
 	"github.com/sirupsen/logrus"
@@ -56,12 +54,14 @@ func (p *kataBuiltInProxy) start(params proxyParams) (int, string, error) {
 
 	p.sandboxID = params.id
 
-	if params.debug {
-		err := p.watchConsole(buildinProxyConsoleProto, params.consoleURL, params.logger)
-		if err != nil {
-			p.sandboxID = ""
+	// The console is always collected into the sandbox console log,
+	// failing to do so is only fatal when debugging.
+	if err := p.watchConsole(buildinProxyConsoleProto, params.consoleURL, params.logger, params.debug); err != nil {
+		p.sandboxID = ""
+		if params.debug {
 			return -1, "", err
 		}
+		params.logger.WithError(err).Warn("Could not watch the guest console")
 	}
 
 	return -1, params.agentURL, nil
@@ -77,47 +77,13 @@ func (p *kataBuiltInProxy) stop(pid int) error {
 	return nil
 }
 
-func (p *kataBuiltInProxy) watchConsole(proto, console string, logger *logrus.Entry) (err error) {
-	var (
-		scanner *bufio.Scanner
-		conn    net.Conn
-	)
-
-	switch proto {
-	case consoleProtoUnix:
-		conn, err = net.Dial("unix", console)
-		if err != nil {
-			return err
-		}
-	// TODO: add pty console support for kvmtools
-	case consoleProtoPty:
-		fallthrough
-	default:
-		return fmt.Errorf("unknown console proto %s", proto)
+func (p *kataBuiltInProxy) watchConsole(proto, console string, logger *logrus.Entry, debug bool) error {
+	conn, err := watchConsole(p.sandboxID, proto, console, logger, debug)
+	if err != nil {
+		return err
 	}
 
 	p.conn = conn
 
-	go func() {
-		scanner = bufio.NewScanner(conn)
-		for scanner.Scan() {
-			logger.WithFields(logrus.Fields{
-				"sandbox":   p.sandboxID,
-				"vmconsole": scanner.Text(),
-			}).Debug("reading guest console")
-		}
-
-		if err := scanner.Err(); err != nil {
-			if err == io.EOF {
-				logger.Info("console watcher quits")
-			} else {
-				logger.WithError(err).WithFields(logrus.Fields{
-					"console-protocol": proto,
-					"console-socket":   console,
-				}).Error("Failed to read agent logs")
-			}
-		}
-	}()
-
 	return nil
 }
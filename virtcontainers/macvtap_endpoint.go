@@ -8,6 +8,8 @@ package virtcontainers
 import (
 	"fmt"
 	"os"
+
+	"github.com/vishvananda/netlink"
 )
 
 // MacvtapEndpoint represents a macvtap endpoint
@@ -53,8 +55,9 @@ func (endpoint *MacvtapEndpoint) SetProperties(properties NetworkInfo) {
 	endpoint.EndpointProperties = properties
 }
 
-// Attach for macvtap endpoint passes macvtap device to the hypervisor.
-func (endpoint *MacvtapEndpoint) Attach(h hypervisor) error {
+// createFds opens the macvtap device queues, and the vhost ones, to be
+// passed to the hypervisor.
+func (endpoint *MacvtapEndpoint) createFds(h hypervisor) error {
 	var err error
 
 	endpoint.VMFds, err = createMacvtapFds(endpoint.EndpointProperties.Iface.Index, int(h.hypervisorConfig().NumVCPUs))
@@ -70,6 +73,15 @@ func (endpoint *MacvtapEndpoint) Attach(h hypervisor) error {
 		endpoint.VhostFds = vhostFds
 	}
 
+	return nil
+}
+
+// Attach for macvtap endpoint passes macvtap device to the hypervisor.
+func (endpoint *MacvtapEndpoint) Attach(h hypervisor) error {
+	if err := endpoint.createFds(h); err != nil {
+		return err
+	}
+
 	return h.addDevice(endpoint, netDev)
 }
 
@@ -78,14 +90,36 @@ func (endpoint *MacvtapEndpoint) Detach(netNsCreated bool, netNsPath string) err
 	return nil
 }
 
-// HotAttach for macvtap endpoint not supported yet
+// HotAttach for macvtap endpoint hot plugs the macvtap device into the
+// hypervisor. It is called from the network namespace of the macvtap link.
 func (endpoint *MacvtapEndpoint) HotAttach(h hypervisor) error {
-	return fmt.Errorf("MacvtapEndpoint does not support Hot attach")
+	// The index of the link, which names its device, is not part of the
+	// interface to hot attach.
+	link, err := netlink.LinkByName(endpoint.Name())
+	if err != nil {
+		return fmt.Errorf("Could not find macvtap link %s: %s", endpoint.Name(), err)
+	}
+	endpoint.EndpointProperties.Iface.Index = link.Attrs().Index
+
+	if err := endpoint.createFds(h); err != nil {
+		return err
+	}
+
+	if _, err := h.hotplugAddDevice(endpoint, netDev); err != nil {
+		networkLogger().WithError(err).Error("Error attach macvtap ep")
+		return err
+	}
+	return nil
 }
 
-// HotDetach for macvtap endpoint not supported yet
+// HotDetach for macvtap endpoint hot unplugs the macvtap device. The
+// macvtap link itself belongs to the network namespace.
 func (endpoint *MacvtapEndpoint) HotDetach(h hypervisor, netNsCreated bool, netNsPath string) error {
-	return fmt.Errorf("MacvtapEndpoint does not support Hot detach")
+	if _, err := h.hotplugRemoveDevice(endpoint, netDev); err != nil {
+		networkLogger().WithError(err).Error("Error detach macvtap ep")
+		return err
+	}
+	return nil
 }
 
 // PciAddr returns the PCI address of the endpoint.
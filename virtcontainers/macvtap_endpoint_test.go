@@ -6,8 +6,12 @@
 package virtcontainers
 
 import (
+	"errors"
 	"reflect"
 	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
 )
 
 func TestCreateMacvtapEndpoint(t *testing.T) {
@@ -30,3 +34,39 @@ func TestCreateMacvtapEndpoint(t *testing.T) {
 		t.Fatalf("\nGot: %+v, \n\nExpected: %+v", result, expected)
 	}
 }
+
+func TestMacvtapEndpointHotAttach(t *testing.T) {
+	assert := assert.New(t)
+
+	endpoint := &MacvtapEndpoint{
+		EndpointType: MacvtapEndpointType,
+		EndpointProperties: NetworkInfo{
+			Iface: NetlinkIface{
+				LinkAttrs: netlink.LinkAttrs{
+					Name: "macvtap-notfound",
+				},
+				Type: "macvtap",
+			},
+		},
+	}
+
+	// The link is not in the network namespace
+	err := endpoint.HotAttach(&mockHypervisor{})
+	assert.Error(err)
+}
+
+func TestMacvtapEndpointHotDetach(t *testing.T) {
+	assert := assert.New(t)
+
+	endpoint := &MacvtapEndpoint{
+		EndpointType: MacvtapEndpointType,
+	}
+
+	h := &mockHypervisor{}
+	err := endpoint.HotDetach(h, true, "")
+	assert.NoError(err)
+
+	h.hotunplugErr = errors.New("hot unplug failed")
+	err = endpoint.HotDetach(h, true, "")
+	assert.Error(err)
+}
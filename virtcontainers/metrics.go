@@ -0,0 +1,146 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"path/filepath"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "kata"
+
+	metricsSocketExt = ".sock"
+)
+
+// Boot phases of a sandbox, as reported by the boot phase duration metric.
+const (
+	bootPhaseNetwork    = "network"
+	bootPhaseVM         = "vm"
+	bootPhaseAgent      = "agent"
+	bootPhaseContainers = "containers"
+)
+
+var (
+	agentRPCDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "agent",
+		Name:      "rpc_duration_seconds",
+		Help:      "Duration of the agent RPCs, by request type.",
+		Buckets:   prometheus.ExponentialBuckets(0.0005, 2, 16),
+	}, []string{"request"})
+
+	hotplugOperations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "hypervisor",
+		Name:      "hotplug_operations_total",
+		Help:      "Number of device hotplug operations, by device type, operation and result.",
+	}, []string{"device", "operation", "result"})
+
+	hotplugDurations = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "hypervisor",
+		Name:      "hotplug_duration_seconds",
+		Help:      "Duration of the device hotplug operations, by device type and operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 14),
+	}, []string{"device", "operation"})
+
+	bootPhaseDurations = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: "sandbox",
+		Name:      "boot_phase_duration_seconds",
+		Help:      "Duration of the last sandbox boot, by phase.",
+	}, []string{"phase"})
+)
+
+func init() {
+	prometheus.MustRegister(agentRPCDurations)
+	prometheus.MustRegister(hotplugOperations)
+	prometheus.MustRegister(hotplugDurations)
+	prometheus.MustRegister(bootPhaseDurations)
+}
+
+// MetricsSocketPath returns the path of the unix socket on which the shim
+// of a sandbox serves its metrics.
+func MetricsSocketPath(sandboxID string) string {
+	return filepath.Join(store.RunMetricsStoragePath, sandboxID+metricsSocketExt)
+}
+
+// MetricsSockets returns the metrics sockets of all the sandboxes running
+// on the host, indexed by sandbox ID.
+func MetricsSockets() (map[string]string, error) {
+	paths, err := filepath.Glob(filepath.Join(store.RunMetricsStoragePath, "*"+metricsSocketExt))
+	if err != nil {
+		return nil, err
+	}
+
+	sockets := make(map[string]string)
+	for _, path := range paths {
+		sandboxID := filepath.Base(path)
+		sockets[sandboxID[:len(sandboxID)-len(metricsSocketExt)]] = path
+	}
+
+	return sockets, nil
+}
+
+func observeAgentRPC(request string, start time.Time) {
+	agentRPCDurations.WithLabelValues(request).Observe(time.Since(start).Seconds())
+}
+
+func observeBootPhase(phase string, start time.Time) {
+	bootPhaseDurations.WithLabelValues(phase).Set(time.Since(start).Seconds())
+}
+
+func observeHotplug(devType deviceType, op operation, start time.Time, err error) {
+	device := devType.metricsName()
+	opName := "add"
+	if op == removeDevice {
+		opName = "remove"
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+
+	hotplugOperations.WithLabelValues(device, opName, result).Inc()
+	hotplugDurations.WithLabelValues(device, opName).Observe(time.Since(start).Seconds())
+}
+
+// metricsName is the name of the device type used as a metrics label.
+func (devType deviceType) metricsName() string {
+	switch devType {
+	case imgDev:
+		return "img"
+	case fsDev:
+		return "fs"
+	case netDev:
+		return "net"
+	case serialDev:
+		return "serial"
+	case blockDev:
+		return "block"
+	case consoleDev:
+		return "console"
+	case serialPortDev:
+		return "serial_port"
+	case vSockPCIDev:
+		return "vsock"
+	case vfioDev:
+		return "vfio"
+	case vhostuserDev:
+		return "vhost_user"
+	case cpuDev:
+		return "cpu"
+	case memoryDev:
+		return "memory"
+	default:
+		return "unknown"
+	}
+}
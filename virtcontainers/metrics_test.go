@@ -0,0 +1,72 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsSockets(t *testing.T) {
+	assert := assert.New(t)
+
+	err := os.MkdirAll(store.RunMetricsStoragePath, store.DirMode)
+	assert.NoError(err)
+	defer os.RemoveAll(store.RunMetricsStoragePath)
+
+	sockets, err := MetricsSockets()
+	assert.NoError(err)
+	assert.Empty(sockets)
+
+	path := MetricsSocketPath(testSandboxID)
+	assert.Equal(store.RunMetricsStoragePath, filepath.Dir(path))
+
+	err = ioutil.WriteFile(path, nil, 0640)
+	assert.NoError(err)
+	err = ioutil.WriteFile(filepath.Join(store.RunMetricsStoragePath, "unrelated"), nil, 0640)
+	assert.NoError(err)
+
+	sockets, err = MetricsSockets()
+	assert.NoError(err)
+	assert.Equal(map[string]string{testSandboxID: path}, sockets)
+}
+
+func TestMetricsObserveHotplug(t *testing.T) {
+	assert := assert.New(t)
+
+	count := func(result string) float64 {
+		var m dto.Metric
+		err := hotplugOperations.WithLabelValues("block", "remove", result).Write(&m)
+		assert.NoError(err)
+		return m.GetCounter().GetValue()
+	}
+
+	successes := count("success")
+	failures := count("failure")
+
+	observeHotplug(blockDev, removeDevice, time.Now(), nil)
+	observeHotplug(blockDev, removeDevice, time.Now(), errors.New("hotplug failed"))
+	observeHotplug(blockDev, removeDevice, time.Now(), nil)
+
+	assert.Equal(successes+2, count("success"))
+	assert.Equal(failures+1, count("failure"))
+}
+
+func TestMetricsDeviceTypeName(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("vfio", vfioDev.metricsName())
+	assert.Equal("memory", memoryDev.metricsName())
+	assert.Equal("unknown", deviceType(-1).metricsName())
+}
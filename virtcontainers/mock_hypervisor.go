@@ -10,16 +10,25 @@ import (
 	"errors"
 	"os"
 
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/kata-containers/runtime/virtcontainers/types"
 )
 
 type mockHypervisor struct {
 	mockPid int
+
+	// hot added resources, and the error to fail their removal with
+	hotpluggedVCPUs  uint32
+	hotpluggedMemory []*memoryDevice
+	hotunplugErr     error
 }
 
 func (m *mockHypervisor) capabilities() types.Capabilities {
-	return types.Capabilities{}
+	var caps types.Capabilities
+	caps.SetPauseSupport()
+	caps.SetSnapshotSupport()
+	return caps
 }
 
 func (m *mockHypervisor) hypervisorConfig() HypervisorConfig {
@@ -55,6 +64,10 @@ func (m *mockHypervisor) saveSandbox() error {
 	return nil
 }
 
+func (m *mockHypervisor) checkpointSandbox(statePath string) error {
+	return nil
+}
+
 func (m *mockHypervisor) addDevice(devInfo interface{}, devType deviceType) error {
 	return nil
 }
@@ -71,11 +84,24 @@ func (m *mockHypervisor) hotplugAddDevice(devInfo interface{}, devType deviceTyp
 }
 
 func (m *mockHypervisor) hotplugRemoveDevice(devInfo interface{}, devType deviceType) (interface{}, error) {
+	if m.hotunplugErr != nil {
+		return nil, m.hotunplugErr
+	}
+
 	switch devType {
 	case cpuDev:
-		return devInfo.(uint32), nil
+		vcpus := devInfo.(uint32)
+		m.hotpluggedVCPUs -= vcpus
+		return vcpus, nil
 	case memoryDev:
-		return 0, nil
+		memdev := devInfo.(*memoryDevice)
+		for i, d := range m.hotpluggedMemory {
+			if d.slot == memdev.slot {
+				m.hotpluggedMemory = append(m.hotpluggedMemory[:i], m.hotpluggedMemory[i+1:]...)
+				break
+			}
+		}
+		return memdev.sizeMB, nil
 	}
 	return nil, nil
 }
@@ -87,10 +113,18 @@ func (m *mockHypervisor) getSandboxConsole(sandboxID string) (string, error) {
 func (m *mockHypervisor) resizeMemory(memMB uint32, memorySectionSizeMB uint32) (uint32, error) {
 	return 0, nil
 }
+func (m *mockHypervisor) hotpluggedResources() (uint32, []*memoryDevice, error) {
+	return m.hotpluggedVCPUs, append([]*memoryDevice{}, m.hotpluggedMemory...), nil
+}
+
 func (m *mockHypervisor) resizeVCPUs(cpus uint32) (uint32, uint32, error) {
 	return 0, 0, nil
 }
 
+func (m *mockHypervisor) setBlockRateLimiter(drive *config.BlockDrive, bandwidth, iops uint64) error {
+	return nil
+}
+
 func (m *mockHypervisor) disconnect() {
 }
 
@@ -107,6 +141,10 @@ func (m *mockHypervisor) pid() int {
 	return m.mockPid
 }
 
+func (m *mockHypervisor) subscribeEvents(events chan<- hypervisorEvent) error {
+	return nil
+}
+
 func (m *mockHypervisor) fromGrpc(ctx context.Context, hypervisorConfig *HypervisorConfig, store *store.VCStore, j []byte) error {
 	return errors.New("mockHypervisor is not supported by VM cache")
 }
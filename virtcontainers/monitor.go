@@ -6,29 +6,94 @@
 package virtcontainers
 
 import (
+	"fmt"
+	"os"
 	"sync"
 	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+const (
+	defaultCheckInterval    = 10 * time.Second
+	defaultFailureThreshold = 1
+
+	// vmmPollInterval is the interval at which the hypervisor process
+	// is polled when pidfd is not supported by the host kernel.
+	vmmPollInterval = time.Second
+
+	// sysPidfdOpen is the pidfd_open syscall number, common to all
+	// architectures.
+	sysPidfdOpen = 434
 )
 
-const defaultCheckInterval = 10 * time.Second
+// MonitorConfig is the configuration of the sandbox monitor.
+type MonitorConfig struct {
+	// CheckInterval is the interval between two agent checks.
+	CheckInterval time.Duration
+
+	// FailureThreshold is the number of consecutive agent check
+	// failures after which the agent is reported as unreachable.
+	FailureThreshold uint
+}
+
+// MonitorReason describes why the sandbox monitor notified its watchers.
+type MonitorReason string
+
+const (
+	// MonitorAgentUnreachable is the reason of a notification sent when
+	// the agent did not answer its health checks.
+	MonitorAgentUnreachable MonitorReason = "agent unreachable"
+
+	// MonitorVMMExited is the reason of a notification sent when the
+	// hypervisor process exited, or the VM shut down.
+	MonitorVMMExited MonitorReason = "vmm exited"
+
+	// MonitorGuestPanic is the reason of a notification sent when the
+	// guest kernel panicked.
+	MonitorGuestPanic MonitorReason = "guest panic"
+)
+
+// MonitorError is the error sent by the sandbox monitor to its watchers.
+type MonitorError struct {
+	Reason MonitorReason
+	Err    error
+}
+
+func (e *MonitorError) Error() string {
+	return fmt.Sprintf("%s: %v", e.Reason, e.Err)
+}
 
 type monitor struct {
 	sync.Mutex
 
-	sandbox       *Sandbox
-	checkInterval time.Duration
-	watchers      []chan error
-	wg            sync.WaitGroup
-	running       bool
-	stopCh        chan bool
+	sandbox          *Sandbox
+	checkInterval    time.Duration
+	failureThreshold uint
+	failures         uint
+	watchers         []chan error
+	wg               sync.WaitGroup
+	running          bool
+	stopCh           chan struct{}
 }
 
 func newMonitor(s *Sandbox) *monitor {
-	return &monitor{
-		sandbox:       s,
-		checkInterval: defaultCheckInterval,
-		stopCh:        make(chan bool, 1),
+	m := &monitor{
+		sandbox:          s,
+		checkInterval:    defaultCheckInterval,
+		failureThreshold: defaultFailureThreshold,
 	}
+
+	if s.config != nil {
+		if s.config.MonitorConfig.CheckInterval > 0 {
+			m.checkInterval = s.config.MonitorConfig.CheckInterval
+		}
+		if s.config.MonitorConfig.FailureThreshold > 0 {
+			m.failureThreshold = s.config.MonitorConfig.FailureThreshold
+		}
+	}
+
+	return m
 }
 
 func (m *monitor) newWatcher() (chan error, error) {
@@ -40,22 +105,18 @@ func (m *monitor) newWatcher() (chan error, error) {
 
 	if !m.running {
 		m.running = true
-		m.wg.Add(1)
-
-		// create and start agent watcher
-		go func() {
-			tick := time.NewTicker(m.checkInterval)
-			for {
-				select {
-				case <-m.stopCh:
-					tick.Stop()
-					m.wg.Done()
-					return
-				case <-tick.C:
-					m.watchAgent()
-				}
-			}
-		}()
+		m.failures = 0
+		m.stopCh = make(chan struct{})
+
+		events := make(chan hypervisorEvent, 1)
+		if err := m.sandbox.hypervisor.subscribeEvents(events); err != nil {
+			virtLog.WithError(err).Warn("Could not subscribe to hypervisor events")
+		}
+
+		m.wg.Add(3)
+		go m.watchAgent(m.stopCh)
+		go m.watchHypervisorEvents(events, m.stopCh)
+		go m.watchVMM(m.sandbox.hypervisor.pid(), m.stopCh)
 	}
 
 	return watcher, nil
@@ -78,12 +139,17 @@ func (m *monitor) notify(err error) {
 	}()
 
 	for _, c := range m.watchers {
-		c <- err
+		// Do not block on a watcher which did not consume its
+		// previous notification.
+		select {
+		case c <- err:
+		default:
+		}
 	}
 }
 
 func (m *monitor) stop() {
-	// wait outside of monitor lock for the watcher channel to exit.
+	// wait outside of monitor lock for the watchers goroutines to exit.
 	defer m.wg.Wait()
 
 	m.Lock()
@@ -94,11 +160,15 @@ func (m *monitor) stop() {
 	}
 
 	defer func() {
-		m.stopCh <- true
+		close(m.stopCh)
 		m.watchers = nil
 		m.running = false
 	}()
 
+	if err := m.sandbox.hypervisor.subscribeEvents(nil); err != nil {
+		virtLog.WithError(err).Warn("Could not unsubscribe from hypervisor events")
+	}
+
 	// a watcher is not supposed to close the channel
 	// but just in case...
 	defer func() {
@@ -112,9 +182,164 @@ func (m *monitor) stop() {
 	}
 }
 
-func (m *monitor) watchAgent() {
+func (m *monitor) watchAgent(stopCh chan struct{}) {
+	defer m.wg.Done()
+
+	tick := time.NewTicker(m.checkInterval)
+	defer tick.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-tick.C:
+			m.checkAgent()
+		}
+	}
+}
+
+func (m *monitor) checkAgent() {
 	err := m.sandbox.agent.check()
+	if err == nil {
+		m.failures = 0
+		return
+	}
+
+	m.failures++
+	if m.failures < m.failureThreshold {
+		virtLog.WithError(err).WithField("failures", m.failures).Warn("Agent check failed")
+		return
+	}
+
+	m.notify(&MonitorError{
+		Reason: MonitorAgentUnreachable,
+		Err:    err,
+	})
+}
+
+func (m *monitor) watchHypervisorEvents(events chan hypervisorEvent, stopCh chan struct{}) {
+	defer m.wg.Done()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case e := <-events:
+			reason := MonitorVMMExited
+			if e.kind == guestPanicEvent {
+				reason = MonitorGuestPanic
+			}
+
+			m.notify(&MonitorError{
+				Reason: reason,
+				Err:    fmt.Errorf("Hypervisor event: %s", e.details),
+			})
+		}
+	}
+}
+
+func (m *monitor) watchVMM(pid int, stopCh chan struct{}) {
+	defer m.wg.Done()
+
+	if pid <= 0 {
+		return
+	}
+
+	exited, err := waitProcess(pid, stopCh)
+	if err != nil {
+		virtLog.WithError(err).WithField("pid", pid).Warn("Could not watch the hypervisor process")
+		return
+	}
+
+	if exited {
+		m.notify(&MonitorError{
+			Reason: MonitorVMMExited,
+			Err:    fmt.Errorf("Hypervisor process %d exited", pid),
+		})
+	}
+}
+
+func pidfdOpen(pid int) (int, error) {
+	fd, _, errno := unix.Syscall(sysPidfdOpen, uintptr(pid), 0, 0)
+	if errno != 0 {
+		return -1, errno
+	}
+
+	return int(fd), nil
+}
+
+// waitProcess waits for the process pid to exit, or for stopCh to be
+// closed. It returns true if the process exited.
+func waitProcess(pid int, stopCh chan struct{}) (bool, error) {
+	pidfd, err := pidfdOpen(pid)
+	if err == unix.ESRCH {
+		return true, nil
+	}
+	if err != nil {
+		return pollProcess(pid, stopCh)
+	}
+	defer unix.Close(pidfd)
+
+	// The read end of the pipe gets readable once the write end is
+	// closed, which happens when the wait is stopped.
+	stopR, stopW, err := os.Pipe()
 	if err != nil {
-		m.notify(err)
+		return false, err
+	}
+	defer stopR.Close()
+
+	done := make(chan struct{})
+	defer close(done)
+
+	go func() {
+		select {
+		case <-stopCh:
+		case <-done:
+		}
+		stopW.Close()
+	}()
+
+	fds := []unix.PollFd{
+		{Fd: int32(pidfd), Events: unix.POLLIN},
+		{Fd: int32(stopR.Fd()), Events: unix.POLLIN},
+	}
+
+	for {
+		if _, err := unix.Poll(fds, -1); err != nil {
+			if err == unix.EINTR {
+				continue
+			}
+			return false, err
+		}
+
+		return fds[0].Revents != 0, nil
+	}
+}
+
+// pollProcess is the waitProcess fallback for the kernels without pidfd
+// support. It reaps the process if it is a child of the runtime.
+func pollProcess(pid int, stopCh chan struct{}) (bool, error) {
+	tick := time.NewTicker(vmmPollInterval)
+	defer tick.Stop()
+
+	for {
+		var status unix.WaitStatus
+
+		wpid, err := unix.Wait4(pid, &status, unix.WNOHANG, nil)
+		if wpid == pid {
+			return true, nil
+		}
+
+		if err == unix.ECHILD {
+			if err := unix.Kill(pid, 0); err == unix.ESRCH {
+				return true, nil
+			}
+		}
+
+		select {
+		case <-stopCh:
+			return false, nil
+		case <-tick.C:
+		}
 	}
 }
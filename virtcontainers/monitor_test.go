@@ -7,7 +7,9 @@ package virtcontainers
 
 import (
 	"errors"
+	"os/exec"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -60,3 +62,121 @@ func TestMonitorClosedChannel(t *testing.T) {
 
 	m.stop()
 }
+
+func TestMonitorConfig(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Sandbox{config: &SandboxConfig{}}
+
+	m := newMonitor(s)
+	assert.Equal(defaultCheckInterval, m.checkInterval)
+	assert.Equal(uint(defaultFailureThreshold), m.failureThreshold)
+
+	s.config.MonitorConfig = MonitorConfig{
+		CheckInterval:    time.Second,
+		FailureThreshold: 3,
+	}
+
+	m = newMonitor(s)
+	assert.Equal(time.Second, m.checkInterval)
+	assert.Equal(uint(3), m.failureThreshold)
+}
+
+func TestMonitorHypervisorEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Sandbox{
+		hypervisor: &mockHypervisor{},
+		agent:      &noopAgent{},
+	}
+
+	m := newMonitor(s)
+
+	ch, err := m.newWatcher()
+	assert.NoError(err)
+
+	events := make(chan hypervisorEvent)
+	stopCh := make(chan struct{})
+
+	m.wg.Add(1)
+	go m.watchHypervisorEvents(events, stopCh)
+
+	events <- hypervisorEvent{kind: guestPanicEvent, details: "panic"}
+
+	err = <-ch
+	merr, ok := err.(*MonitorError)
+	assert.True(ok)
+	assert.Equal(MonitorGuestPanic, merr.Reason)
+
+	events <- hypervisorEvent{kind: vmShutdownEvent, details: "shutdown"}
+
+	err = <-ch
+	merr, ok = err.(*MonitorError)
+	assert.True(ok)
+	assert.Equal(MonitorVMMExited, merr.Reason)
+
+	close(stopCh)
+	m.stop()
+}
+
+func TestMonitorVMMExit(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("sleep", "60")
+	assert.NoError(cmd.Start())
+
+	s := &Sandbox{
+		hypervisor: &mockHypervisor{mockPid: cmd.Process.Pid},
+		agent:      &noopAgent{},
+	}
+
+	m := newMonitor(s)
+
+	ch, err := m.newWatcher()
+	assert.NoError(err)
+
+	assert.NoError(cmd.Process.Kill())
+
+	err = <-ch
+	merr, ok := err.(*MonitorError)
+	assert.True(ok)
+	assert.Equal(MonitorVMMExited, merr.Reason)
+
+	m.stop()
+	cmd.Wait()
+}
+
+func TestMonitorWaitProcess(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("sleep", "60")
+	assert.NoError(cmd.Start())
+	defer cmd.Wait()
+
+	for _, wait := range []func(int, chan struct{}) (bool, error){waitProcess, pollProcess} {
+		stopCh := make(chan struct{})
+		close(stopCh)
+
+		exited, err := wait(cmd.Process.Pid, stopCh)
+		assert.NoError(err)
+		assert.False(exited)
+	}
+
+	assert.NoError(cmd.Process.Kill())
+
+	exited, err := waitProcess(cmd.Process.Pid, make(chan struct{}))
+	assert.NoError(err)
+	assert.True(exited)
+}
+
+func TestMonitorPollProcessChild(t *testing.T) {
+	assert := assert.New(t)
+
+	cmd := exec.Command("true")
+	assert.NoError(cmd.Start())
+
+	// The exited child is reaped.
+	exited, err := pollProcess(cmd.Process.Pid, make(chan struct{}))
+	assert.NoError(err)
+	assert.True(exited)
+}
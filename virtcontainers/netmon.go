@@ -8,17 +8,26 @@ package virtcontainers
 import (
 	"fmt"
 	"os/exec"
+	"path/filepath"
 	"syscall"
 
+	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/sirupsen/logrus"
 )
 
+const networkSocketExt = ".sock"
+
 // NetmonConfig is the structure providing specific configuration
 // for the network monitor.
 type NetmonConfig struct {
 	Path   string
 	Debug  bool
 	Enable bool
+
+	// APISocket is the socket on which the runtime serves the network
+	// API of the sandbox. When empty, the network monitor calls the
+	// runtime kata-network command instead.
+	APISocket string
 }
 
 // netmonParams is the structure providing specific parameters needed
@@ -28,9 +37,16 @@ type netmonParams struct {
 	debug      bool
 	logLevel   string
 	runtime    string
+	apiSocket  string
 	sandboxID  string
 }
 
+// NetworkSocketPath returns the path of the unix socket on which the
+// runtime of a sandbox serves its network API.
+func NetworkSocketPath(sandboxID string) string {
+	return filepath.Join(store.RunNetworkStoragePath, sandboxID+networkSocketExt)
+}
+
 func netmonLogger() *logrus.Entry {
 	return virtLog.WithField("subsystem", "netmon")
 }
@@ -39,18 +55,23 @@ func prepareNetMonParams(params netmonParams) ([]string, error) {
 	if params.netmonPath == "" {
 		return []string{}, fmt.Errorf("Netmon path is empty")
 	}
-	if params.runtime == "" {
-		return []string{}, fmt.Errorf("Netmon runtime path is empty")
+	if params.runtime == "" && params.apiSocket == "" {
+		return []string{}, fmt.Errorf("Netmon runtime path and API socket are empty")
 	}
 	if params.sandboxID == "" {
 		return []string{}, fmt.Errorf("Netmon sandbox ID is empty")
 	}
 
-	args := []string{params.netmonPath,
-		"-r", params.runtime,
-		"-s", params.sandboxID,
+	args := []string{params.netmonPath}
+
+	if params.apiSocket != "" {
+		args = append(args, "-a", params.apiSocket)
+	} else {
+		args = append(args, "-r", params.runtime)
 	}
 
+	args = append(args, "-s", params.sandboxID)
+
 	if params.debug {
 		args = append(args, "-d")
 	}
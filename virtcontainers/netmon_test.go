@@ -6,9 +6,11 @@
 package virtcontainers
 
 import (
+	"path/filepath"
 	"reflect"
 	"testing"
 
+	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -52,6 +54,16 @@ func TestPrepareNetMonParams(t *testing.T) {
 		"-s", testSandboxID}
 	assert.True(t, reflect.DeepEqual(expected, got),
 		"Got %+v\nExpected %+v", got, expected)
+
+	// The API socket is used instead of the runtime
+	params.runtime = ""
+	params.apiSocket = NetworkSocketPath(testSandboxID)
+	got, err = prepareNetMonParams(params)
+	assert.Nil(t, err)
+	expected = []string{testNetmonPath,
+		"-a", filepath.Join(store.RunNetworkStoragePath, testSandboxID+".sock"),
+		"-s", testSandboxID}
+	assert.Equal(t, expected, got)
 }
 
 func TestStopNetmon(t *testing.T) {
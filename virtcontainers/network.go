@@ -175,6 +175,31 @@ type NetworkConfig struct {
 	DisableNewNetNs   bool
 	NetmonConfig      NetmonConfig
 	InterworkingModel NetInterworkingModel
+
+	// L2Interfaces are the names of the network namespace interfaces
+	// passed into the sandbox even though they have no IP address, the
+	// workload configuring them from the guest. Their MAC address and MTU
+	// are kept, a VLAN interface is tagged on the host and is untagged in
+	// the guest.
+	L2Interfaces []string
+
+	// IngressBandwidth and EgressBandwidth are the maximum bandwidths,
+	// in bits per second, the sandbox receives and transmits at through
+	// each of its network interfaces. Zero is unlimited.
+	IngressBandwidth uint64
+	EgressBandwidth  uint64
+}
+
+// isL2Interface tells if the interface name is passed into the sandbox
+// without any IP address.
+func (config *NetworkConfig) isL2Interface(name string) bool {
+	for _, n := range config.L2Interfaces {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
 }
 
 func networkLogger() *logrus.Entry {
@@ -264,6 +289,10 @@ func generateEndpoints(typedEndpoints []TypedJSONEndpoint) ([]Endpoint, error) {
 			var endpoint IPVlanEndpoint
 			endpointInf = &endpoint
 
+		case VlanEndpointType:
+			var endpoint VlanEndpoint
+			endpointInf = &endpoint
+
 		default:
 			networkLogger().WithField("endpoint-type", e.Type).Error("Ignoring unknown endpoint type")
 		}
@@ -375,6 +404,8 @@ func getLinkForEndpoint(endpoint Endpoint, netHandle *netlink.Handle) (netlink.L
 		link = &netlink.Macvlan{}
 	case *IPVlanEndpoint:
 		link = &netlink.IPVlan{}
+	case *VlanEndpoint:
+		link = &netlink.Vlan{}
 	default:
 		return nil, fmt.Errorf("Unexpected endpointType %s", ep.Type())
 	}
@@ -413,6 +444,10 @@ func getLinkByName(netHandle *netlink.Handle, name string, expectedLink netlink.
 		if l, ok := link.(*netlink.IPVlan); ok {
 			return l, nil
 		}
+	case (&netlink.Vlan{}).Type():
+		if l, ok := link.(*netlink.Vlan); ok {
+			return l, nil
+		}
 	default:
 		return nil, fmt.Errorf("Unsupported link type %s", expectedLink.Type())
 	}
@@ -752,15 +787,20 @@ func setupTCFiltering(endpoint Endpoint, queues int, disableVhostNet bool) error
 		netPair.VhostFds = vhostFds
 	}
 
-	var attrs *netlink.LinkAttrs
-	var link netlink.Link
+	return tcFilterTAP(netHandle, endpoint, tapLink)
+}
 
-	link, err = getLinkForEndpoint(endpoint, netHandle)
+// tcFilterTAP redirects the traffic between the TAP interface tapLink and the
+// network interface of the endpoint, in both directions.
+func tcFilterTAP(netHandle *netlink.Handle, endpoint Endpoint, tapLink netlink.Link) error {
+	netPair := endpoint.NetworkPair()
+
+	link, err := getLinkForEndpoint(endpoint, netHandle)
 	if err != nil {
 		return err
 	}
 
-	attrs = link.Attrs()
+	attrs := link.Attrs()
 
 	// Save the veth MAC address to the TAP so that it can later be used
 	// to build the hypervisor command line. This MAC address has to be
@@ -901,6 +941,169 @@ func removeQdiscIngress(link netlink.Link) error {
 	return nil
 }
 
+const (
+	// tbfLatency is how long, in microseconds, the packets exceeding the
+	// bandwidth limit are queued before being dropped.
+	tbfLatency = 25000
+
+	// tbfBurstTime is how long, in microseconds, the traffic can be sent
+	// at full speed after the link was idle.
+	tbfBurstTime = 10000
+
+	// ethHeaderLen is the size of the ethernet header, on top of the
+	// link MTU.
+	ethHeaderLen = 14
+)
+
+// setLinkBandwidth limits the bandwidth, in bits per second, the traffic
+// is sent on link at, with a token bucket filter root qdisc. A zero
+// bandwidth removes the limit.
+//
+// This is equivalent to calling:
+// `tc qdisc replace dev link root handle 1: tbf rate <bandwidth>bit burst <10ms> latency 25ms`
+func setLinkBandwidth(netHandle *netlink.Handle, link netlink.Link, bandwidth uint64) error {
+	attrs := link.Attrs()
+
+	if bandwidth == 0 {
+		return removeLinkBandwidth(netHandle, link)
+	}
+
+	rate := (bandwidth + 7) / 8
+
+	// The bucket holds at least a full size frame.
+	burst := rate * tbfBurstTime / 1000000
+	if minBurst := uint64(attrs.MTU + ethHeaderLen); burst < minBurst {
+		burst = minBurst
+	}
+
+	qdisc := &netlink.Tbf{
+		QdiscAttrs: netlink.QdiscAttrs{
+			LinkIndex: attrs.Index,
+			Handle:    netlink.MakeHandle(1, 0),
+			Parent:    netlink.HANDLE_ROOT,
+		},
+		Rate:   rate,
+		Limit:  uint32(rate*tbfLatency/1000000 + burst),
+		Buffer: uint32(netlink.Xmittime(rate, uint32(burst))),
+	}
+
+	if err := netHandle.QdiscReplace(qdisc); err != nil {
+		return fmt.Errorf("Could not limit the bandwidth of %s: %s", attrs.Name, err)
+	}
+
+	return nil
+}
+
+// removeLinkBandwidth removes the bandwidth limit set on link.
+func removeLinkBandwidth(netHandle *netlink.Handle, link netlink.Link) error {
+	qdiscs, err := netHandle.QdiscList(link)
+	if err != nil {
+		return err
+	}
+
+	for _, qdisc := range qdiscs {
+		tbf, ok := qdisc.(*netlink.Tbf)
+		if !ok || tbf.Parent != netlink.HANDLE_ROOT {
+			continue
+		}
+
+		if err := netHandle.QdiscDel(tbf); err != nil {
+			return fmt.Errorf("Could not remove the bandwidth limit of %s: %s", link.Attrs().Name, err)
+		}
+	}
+
+	return nil
+}
+
+// setEndpointBandwidth limits the bandwidth, in bits per second, the VM
+// receives and transmits at through endpoint. Both limits are set on the
+// host side, where the traffic to the VM is sent on the tap interface,
+// and the traffic from the VM is sent on the veth interface once
+// redirected or bridged from the tap interface. A zero bandwidth is
+// unlimited.
+//
+// This must be called from the network namespace of the endpoint.
+func setEndpointBandwidth(endpoint Endpoint, ingress, egress uint64) error {
+	netPair := endpoint.NetworkPair()
+	if netPair == nil {
+		if ingress > 0 || egress > 0 {
+			networkLogger().WithField("endpoint-type", endpoint.Type()).Warn("Bandwidth limits not supported by the endpoint")
+		}
+
+		return nil
+	}
+
+	// The traffic received by a macvtap interface skips its qdisc.
+	if netPair.NetInterworkingModel == NetXConnectMacVtapModel && ingress > 0 {
+		return fmt.Errorf("Ingress bandwidth limit not supported by the macvtap interworking model")
+	}
+
+	netHandle, err := netlink.NewHandle()
+	if err != nil {
+		return err
+	}
+	defer netHandle.Delete()
+
+	tapLink, err := netHandle.LinkByName(netPair.TAPIface.Name)
+	if err != nil {
+		return fmt.Errorf("Could not get TAP interface %s: %s", netPair.TAPIface.Name, err)
+	}
+
+	link, err := getLinkForEndpoint(endpoint, netHandle)
+	if err != nil {
+		return err
+	}
+
+	if err := setLinkBandwidth(netHandle, tapLink, ingress); err != nil {
+		return err
+	}
+
+	return setLinkBandwidth(netHandle, link, egress)
+}
+
+// setEndpointMTU sets the MTU of the host side of the endpoint, the tap
+// interface and, when bridged, the bridge connecting it to the veth
+// interface, so that the frames the VM sends with its new MTU still go
+// through.
+//
+// This must be called from the network namespace of the endpoint.
+func setEndpointMTU(endpoint Endpoint, mtu int) error {
+	netPair := endpoint.NetworkPair()
+	if netPair == nil {
+		return nil
+	}
+
+	netHandle, err := netlink.NewHandle()
+	if err != nil {
+		return err
+	}
+	defer netHandle.Delete()
+
+	tapLink, err := netHandle.LinkByName(netPair.TAPIface.Name)
+	if err != nil {
+		return fmt.Errorf("Could not get TAP interface %s: %s", netPair.TAPIface.Name, err)
+	}
+
+	if err := netHandle.LinkSetMTU(tapLink, mtu); err != nil {
+		return fmt.Errorf("Could not set TAP MTU %d: %s", mtu, err)
+	}
+
+	if netPair.NetInterworkingModel != NetXConnectBridgedModel {
+		return nil
+	}
+
+	bridgeLink, err := getLinkByName(netHandle, netPair.Name, &netlink.Bridge{})
+	if err != nil {
+		return fmt.Errorf("Could not get bridge %s: %s", netPair.Name, err)
+	}
+
+	if err := netHandle.LinkSetMTU(bridgeLink, mtu); err != nil {
+		return fmt.Errorf("Could not set bridge MTU %d: %s", mtu, err)
+	}
+
+	return nil
+}
+
 func untapNetworkPair(endpoint Endpoint) error {
 	netHandle, err := netlink.NewHandle()
 	if err != nil {
@@ -1090,6 +1293,28 @@ func doNetNS(netNSPath string, cb func(ns.NetNS) error) error {
 	return cb(targetNS)
 }
 
+// doNewNetNS runs cb in a new network namespace. The namespace is not bound
+// to any path, and only outlives cb through the processes cb starts in it.
+func doNewNetNS(cb func() error) error {
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	currentNS, err := netns.Get()
+	if err != nil {
+		return err
+	}
+	defer currentNS.Close()
+	defer netns.Set(currentNS)
+
+	newNS, err := netns.New()
+	if err != nil {
+		return err
+	}
+	defer newNS.Close()
+
+	return cb()
+}
+
 func deleteNetNS(netNSPath string) error {
 	n, err := ns.GetNS(netNSPath)
 	if err != nil {
@@ -1154,6 +1379,10 @@ func generateInterfacesAndRoutes(networkNS NetworkNamespace) ([]*vcTypes.Interfa
 			PciAddr:     endpoint.PciAddr(),
 		}
 
+		if ep, ok := endpoint.(*VlanEndpoint); ok {
+			ifc.VlanID = ep.VlanID
+		}
+
 		ifaces = append(ifaces, &ifc)
 
 		for _, route := range endpoint.Properties().Routes {
@@ -1297,8 +1526,8 @@ func createEndpointsFromScan(networkNSPath string, config *NetworkConfig) ([]End
 		// Ignore unconfigured network interfaces. These are
 		// either base tunnel devices that are not namespaced
 		// like gre0, gretap0, sit0, ipip0, tunl0 or incorrectly
-		// setup interfaces.
-		if len(netInfo.Addrs) == 0 {
+		// setup interfaces, unless configured as layer 2 only.
+		if len(netInfo.Addrs) == 0 && !config.isL2Interface(netInfo.Iface.Name) {
 			continue
 		}
 
@@ -1369,6 +1598,16 @@ func createEndpoint(netInfo NetworkInfo, idx int, model NetInterworkingModel) (E
 			endpoint, err = createTapNetworkEndpoint(idx, netInfo.Iface.Name)
 		} else if netInfo.Iface.Type == "veth" {
 			endpoint, err = createVethNetworkEndpoint(idx, netInfo.Iface.Name, model)
+		} else if netInfo.Iface.Type == "vlan" {
+			networkLogger().WithField("interface", netInfo.Iface.Name).Info("VLAN network interface found")
+			var vlanEndpoint *VlanEndpoint
+			vlanEndpoint, err = createVlanNetworkEndpoint(idx, netInfo.Iface.Name, model)
+			if err != nil {
+				return nil, err
+			}
+
+			vlanEndpoint.VlanID, vlanEndpoint.ParentLink, err = vlanLinkInfo(netInfo.Iface.Name)
+			endpoint = vlanEndpoint
 		} else if netInfo.Iface.Type == "ipvlan" {
 			endpoint, err = createIPVlanNetworkEndpoint(idx, netInfo.Iface.Name)
 		} else {
@@ -1424,6 +1663,10 @@ func (n *Network) Add(ctx context.Context, config *NetworkConfig, hypervisor hyp
 					return err
 				}
 			}
+
+			if err := setEndpointBandwidth(endpoint, config.IngressBandwidth, config.EgressBandwidth); err != nil {
+				return err
+			}
 		}
 
 		return nil
@@ -9,11 +9,14 @@ import (
 	"net"
 	"os"
 	"reflect"
+	"runtime"
 	"testing"
 
+	"github.com/containernetworking/plugins/pkg/ns"
 	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
 	"github.com/stretchr/testify/assert"
 	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
 )
 
 func TestCreateDeleteNetNS(t *testing.T) {
@@ -304,3 +307,126 @@ func TestTcRedirectNetwork(t *testing.T) {
 	err = netHandle.LinkDel(link)
 	assert.NoError(err)
 }
+
+func TestDoNewNetNS(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip(testDisabledAsNonRoot)
+	}
+
+	assert := assert.New(t)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	origNS, err := netns.Get()
+	assert.NoError(err)
+	defer origNS.Close()
+
+	err = doNewNetNS(func() error {
+		newNS, err := netns.Get()
+		if err != nil {
+			return err
+		}
+		defer newNS.Close()
+
+		assert.False(origNS.Equal(newNS))
+		return nil
+	})
+	assert.NoError(err)
+
+	// The calling thread is back in its network namespace.
+	curNS, err := netns.Get()
+	assert.NoError(err)
+	defer curNS.Close()
+	assert.True(origNS.Equal(curNS))
+}
+
+func TestCreateEndpointsFromScanL2Interfaces(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip(testDisabledAsNonRoot)
+	}
+
+	assert := assert.New(t)
+
+	netNSPath, err := createNetNS()
+	assert.NoError(err)
+	defer deleteNetNS(netNSPath)
+
+	// A veth interface without any IP address.
+	err = doNetNS(netNSPath, func(_ ns.NetNS) error {
+		veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "foo", MTU: 1400}, PeerName: "bar"}
+		if err := netlink.LinkAdd(veth); err != nil {
+			return err
+		}
+
+		return netlink.LinkSetUp(veth)
+	})
+	assert.NoError(err)
+
+	endpoints, err := createEndpointsFromScan(netNSPath, &NetworkConfig{})
+	assert.NoError(err)
+	assert.Empty(endpoints)
+
+	endpoints, err = createEndpointsFromScan(netNSPath, &NetworkConfig{L2Interfaces: []string{"foo"}})
+	assert.NoError(err)
+	if !assert.Len(endpoints, 1) {
+		return
+	}
+	assert.Equal(VethEndpointType, endpoints[0].Type())
+	assert.Equal("foo", endpoints[0].Name())
+	assert.Equal(1400, endpoints[0].Properties().Iface.MTU)
+	assert.Empty(endpoints[0].Properties().Addrs)
+}
+
+func TestSetEndpointBandwidth(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip(testDisabledAsNonRoot)
+	}
+
+	assert := assert.New(t)
+
+	netNSPath, err := createNetNS()
+	assert.NoError(err)
+	defer deleteNetNS(netNSPath)
+
+	tbfRate := func(name string) uint64 {
+		link, err := netlink.LinkByName(name)
+		assert.NoError(err)
+
+		qdiscs, err := netlink.QdiscList(link)
+		assert.NoError(err)
+
+		for _, qdisc := range qdiscs {
+			if tbf, ok := qdisc.(*netlink.Tbf); ok && tbf.Parent == netlink.HANDLE_ROOT {
+				return tbf.Rate
+			}
+		}
+
+		return 0
+	}
+
+	err = doNetNS(netNSPath, func(_ ns.NetNS) error {
+		veth := &netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: "foo", MTU: 1500}, PeerName: "bar"}
+		assert.NoError(netlink.LinkAdd(veth))
+
+		endpoint, err := createVethNetworkEndpoint(1, "foo", NetXConnectTCFilterModel)
+		assert.NoError(err)
+		assert.NoError(setupTCFiltering(endpoint, 1, true))
+
+		assert.NoError(setEndpointBandwidth(endpoint, 1000000, 8000000))
+		assert.Equal(uint64(125000), tbfRate(endpoint.NetPair.TAPIface.Name))
+		assert.Equal(uint64(1000000), tbfRate("foo"))
+
+		// Updated
+		assert.NoError(setEndpointBandwidth(endpoint, 2000000, 0))
+		assert.Equal(uint64(250000), tbfRate(endpoint.NetPair.TAPIface.Name))
+		assert.Zero(tbfRate("foo"))
+
+		// Removed
+		assert.NoError(setEndpointBandwidth(endpoint, 0, 0))
+		assert.Zero(tbfRate(endpoint.NetPair.TAPIface.Name))
+
+		return removeTCFiltering(endpoint)
+	})
+	assert.NoError(err)
+}
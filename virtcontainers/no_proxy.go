@@ -7,6 +7,7 @@ package virtcontainers
 
 import (
 	"fmt"
+	"net"
 )
 
 // This is the no proxy implementation of the proxy interface. This
@@ -20,6 +21,7 @@ import (
 // is to provide both shim and runtime the correct URL to connect
 // directly to the VM.
 type noProxy struct {
+	conn net.Conn
 }
 
 // start is noProxy start implementation for proxy interface.
@@ -34,15 +36,30 @@ func (p *noProxy) start(params proxyParams) (int, string, error) {
 		return -1, "", fmt.Errorf("AgentURL cannot be empty")
 	}
 
+	// Nothing else reads the console, collect it into the sandbox
+	// console log.
+	if params.consoleURL != "" && p.conn == nil {
+		conn, err := watchConsole(params.id, consoleProtoUnix, params.consoleURL, params.logger, params.debug)
+		if err != nil {
+			params.logger.WithError(err).Warn("Could not watch the guest console")
+		} else {
+			p.conn = conn
+		}
+	}
+
 	return 0, params.agentURL, nil
 }
 
 // stop is noProxy stop implementation for proxy interface.
 func (p *noProxy) stop(pid int) error {
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
 	return nil
 }
 
-// The noproxy doesn't need to watch the vm console, thus return false always.
+// check if the proxy has watched the vm console.
 func (p *noProxy) consoleWatched() bool {
-	return false
+	return p.conn != nil
 }
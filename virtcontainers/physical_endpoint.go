@@ -14,6 +14,7 @@ import (
 
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	"github.com/kata-containers/runtime/virtcontainers/device/drivers"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/safchain/ethtool"
 )
 
@@ -86,6 +87,15 @@ func (endpoint *PhysicalEndpoint) Attach(h hypervisor) error {
 	return h.addDevice(d, vfioDev)
 }
 
+// vfioDevice returns the VFIO device hot plugged for the endpoint.
+func (endpoint *PhysicalEndpoint) vfioDevice() *config.VFIODev {
+	return &config.VFIODev{
+		ID:   utils.MakeNameID("vfio", endpoint.IfaceName, maxDevIDSize),
+		Type: config.VFIODeviceNormalType,
+		BDF:  endpoint.BDF,
+	}
+}
+
 // Detach for physical endpoint unbinds the physical network interface from vfio-pci
 // and binds it back to the saved host driver.
 func (endpoint *PhysicalEndpoint) Detach(netNsCreated bool, netNsPath string) error {
@@ -98,14 +108,33 @@ func (endpoint *PhysicalEndpoint) Detach(netNsCreated bool, netNsPath string) er
 	return bindNICToHost(endpoint)
 }
 
-// HotAttach for physical endpoint not supported yet
+// HotAttach for physical endpoint binds the physical network interface to
+// vfio-pci and hot plugs the device into the hypervisor.
 func (endpoint *PhysicalEndpoint) HotAttach(h hypervisor) error {
-	return fmt.Errorf("PhysicalEndpoint does not support Hot attach")
+	if err := bindNICToVFIO(endpoint); err != nil {
+		return err
+	}
+
+	if _, err := h.hotplugAddDevice(endpoint.vfioDevice(), vfioDev); err != nil {
+		networkLogger().WithError(err).Error("Error attach physical ep")
+
+		if err := bindNICToHost(endpoint); err != nil {
+			networkLogger().WithError(err).Warn("Error binding back physical ep to host")
+		}
+		return err
+	}
+	return nil
 }
 
-// HotDetach for physical endpoint not supported yet
+// HotDetach for physical endpoint hot unplugs the device, and binds the
+// physical network interface back to its host driver.
 func (endpoint *PhysicalEndpoint) HotDetach(h hypervisor, netNsCreated bool, netNsPath string) error {
-	return fmt.Errorf("PhysicalEndpoint does not support Hot detach")
+	if _, err := h.hotplugRemoveDevice(endpoint.vfioDevice(), vfioDev); err != nil {
+		networkLogger().WithError(err).Error("Error detach physical ep")
+		return err
+	}
+
+	return bindNICToHost(endpoint)
 }
 
 // isPhysicalIface checks if an interface is a physical device.
@@ -6,6 +6,7 @@
 package virtcontainers
 
 import (
+	"errors"
 	"net"
 	"os"
 	"testing"
@@ -40,6 +41,10 @@ func TestPhysicalEndpoint_HotDetach(t *testing.T) {
 
 	err := v.HotDetach(h, true, "")
 	assert.Error(err)
+
+	h.hotunplugErr = errors.New("hot unplug failed")
+	err = v.HotDetach(h, true, "")
+	assert.Equal(h.hotunplugErr, err)
 }
 
 func TestIsPhysicalIface(t *testing.T) {
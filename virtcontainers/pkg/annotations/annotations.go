@@ -41,16 +41,96 @@ const (
 	// AssetHashType is the hash type used for assets verification
 	AssetHashType = vcAnnotationsPrefix + "AssetHashType"
 
+	// NetL2Interfaces is a sandbox annotation for the comma separated names of the network interfaces passed into the sandbox without any IP address.
+	NetL2Interfaces = vcAnnotationsPrefix + "NetL2Interfaces"
+
 	// ConfigJSONKey is the annotation key to fetch the OCI configuration.
 	ConfigJSONKey = vcAnnotationsPrefix + "pkg.oci.config"
 
 	// BundlePathKey is the annotation key to fetch the OCI configuration file path.
 	BundlePathKey = vcAnnotationsPrefix + "pkg.oci.bundle_path"
 
+	// RuntimeProfile is a sandbox annotation for the runtime configuration profile the sandbox is created with.
+	RuntimeProfile = vcAnnotationsPrefix + "RuntimeProfile"
+
 	// ContainerTypeKey is the annotation key to fetch container type.
 	ContainerTypeKey = vcAnnotationsPrefix + "pkg.oci.container_type"
 )
 
+// Annotations overriding the runtime configuration of a sandbox. They are
+// only applied when listed, without the ConfigAnnotationsPrefix, by the
+// enable_annotations runtime option.
+const (
+	// ConfigAnnotationsPrefix is the prefix of the annotations overriding the runtime configuration.
+	ConfigAnnotationsPrefix = vcAnnotationsPrefix + "config."
+
+	hypervisorConfigPrefix = ConfigAnnotationsPrefix + "hypervisor."
+	agentConfigPrefix      = ConfigAnnotationsPrefix + "agent."
+
+	// DefaultVCPUs is a sandbox annotation for the number of vCPUs the VM is started with.
+	DefaultVCPUs = hypervisorConfigPrefix + "default_vcpus"
+
+	// DefaultMaxVCPUs is a sandbox annotation for the maximum number of vCPUs of the VM.
+	DefaultMaxVCPUs = hypervisorConfigPrefix + "default_maxvcpus"
+
+	// DefaultMemory is a sandbox annotation for the memory, in MiB, the VM is started with.
+	DefaultMemory = hypervisorConfigPrefix + "default_memory"
+
+	// MemSlots is a sandbox annotation for the number of memory slots of the VM.
+	MemSlots = hypervisorConfigPrefix + "memory_slots"
+
+	// MemOffset is a sandbox annotation for the memory space, in MiB, reserved for the nvdimm devices.
+	MemOffset = hypervisorConfigPrefix + "memory_offset"
+
+	// DefaultBridges is a sandbox annotation for the number of PCI bridges of the VM.
+	DefaultBridges = hypervisorConfigPrefix + "default_bridges"
+
+	// Msize9p is a sandbox annotation for the msize of the 9p shares.
+	Msize9p = hypervisorConfigPrefix + "msize_9p"
+
+	// BlockDeviceDriver is a sandbox annotation for the driver of the block devices.
+	BlockDeviceDriver = hypervisorConfigPrefix + "block_device_driver"
+
+	// BlockDeviceCacheSet is a sandbox annotation for setting the cache options of the block devices.
+	BlockDeviceCacheSet = hypervisorConfigPrefix + "block_device_cache_set"
+
+	// BlockDeviceCacheDirect is a sandbox annotation for using O_DIRECT on the block devices.
+	BlockDeviceCacheDirect = hypervisorConfigPrefix + "block_device_cache_direct"
+
+	// BlockDeviceCacheNoflush is a sandbox annotation for ignoring the flush requests of the block devices.
+	BlockDeviceCacheNoflush = hypervisorConfigPrefix + "block_device_cache_noflush"
+
+	// DisableBlockDeviceUse is a sandbox annotation for disallowing block devices.
+	DisableBlockDeviceUse = hypervisorConfigPrefix + "disable_block_device_use"
+
+	// EnableIOThreads is a sandbox annotation for processing the IO of the block devices in a separate thread.
+	EnableIOThreads = hypervisorConfigPrefix + "enable_iothreads"
+
+	// HugePages is a sandbox annotation for allocating the VM memory from huge pages.
+	HugePages = hypervisorConfigPrefix + "enable_hugepages"
+
+	// MemPrealloc is a sandbox annotation for pre-allocating the VM memory.
+	MemPrealloc = hypervisorConfigPrefix + "enable_mem_prealloc"
+
+	// KernelParams is a sandbox annotation for guest kernel parameters, appended to the configured ones.
+	KernelParams = hypervisorConfigPrefix + "kernel_params"
+
+	// MachineType is a sandbox annotation for the machine type the hypervisor emulates.
+	MachineType = hypervisorConfigPrefix + "machine_type"
+
+	// LongLiveConn is a sandbox annotation for keeping the connection to the agent open.
+	LongLiveConn = agentConfigPrefix + "long_live_conn"
+)
+
+// Kubernetes pod annotations.
+const (
+	// IngressBandwidth is a sandbox annotation for the maximum bandwidth, as a Kubernetes quantity of bits per second, the pod receives at.
+	IngressBandwidth = "kubernetes.io/ingress-bandwidth"
+
+	// EgressBandwidth is a sandbox annotation for the maximum bandwidth, as a Kubernetes quantity of bits per second, the pod transmits at.
+	EgressBandwidth = "kubernetes.io/egress-bandwidth"
+)
+
 const (
 	// SHA512 is the SHA-512 (64) hash algorithm
 	SHA512 string = "sha512"
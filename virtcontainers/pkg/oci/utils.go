@@ -11,10 +11,13 @@ import (
 	"errors"
 	"fmt"
 	"io/ioutil"
+	"math"
 	"path/filepath"
+	goruntime "runtime"
 	"strconv"
 	"strings"
 	"syscall"
+	"unicode"
 
 	criContainerdAnnotations "github.com/containerd/cri-containerd/pkg/annotations"
 	crioAnnotations "github.com/kubernetes-incubator/cri-o/pkg/annotations"
@@ -134,6 +137,22 @@ type RuntimeConfig struct {
 
 	//Determines if create a netns for hypervisor process
 	DisableNewNetNs bool
+
+	// IngressBandwidth and EgressBandwidth are the default maximum
+	// bandwidths, in bits per second, of the sandbox network interfaces.
+	IngressBandwidth uint64
+	EgressBandwidth  uint64
+
+	MonitorConfig vc.MonitorConfig
+
+	// EnableAnnotations lists the configuration annotations, without
+	// their prefix, pods are allowed to override the configuration with.
+	// Shell patterns are accepted.
+	EnableAnnotations []string
+
+	// Profiles are the named runtime configurations a sandbox can select
+	// instead of this one.
+	Profiles map[string]RuntimeConfig
 }
 
 // AddKernelParam allows the addition of new kernel parameters to an existing
@@ -340,16 +359,90 @@ func networkConfig(ocispec CompatOCISpec, config RuntimeConfig) (vc.NetworkConfi
 	}
 	netConf.InterworkingModel = config.InterNetworkModel
 	netConf.DisableNewNetNs = config.DisableNewNetNs
+	netConf.IngressBandwidth = config.IngressBandwidth
+	netConf.EgressBandwidth = config.EgressBandwidth
 
 	netConf.NetmonConfig = vc.NetmonConfig{
-		Path:   config.NetmonConfig.Path,
-		Debug:  config.NetmonConfig.Debug,
-		Enable: config.NetmonConfig.Enable,
+		Path:      config.NetmonConfig.Path,
+		Debug:     config.NetmonConfig.Debug,
+		Enable:    config.NetmonConfig.Enable,
+		APISocket: config.NetmonConfig.APISocket,
+	}
+
+	if value, ok := ocispec.Annotations[vcAnnotations.NetL2Interfaces]; ok {
+		for _, name := range strings.Split(value, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				netConf.L2Interfaces = append(netConf.L2Interfaces, name)
+			}
+		}
+	}
+
+	bandwidthAnnotations := map[string]*uint64{
+		vcAnnotations.IngressBandwidth: &netConf.IngressBandwidth,
+		vcAnnotations.EgressBandwidth:  &netConf.EgressBandwidth,
+	}
+
+	for a, bandwidth := range bandwidthAnnotations {
+		value, ok := ocispec.Annotations[a]
+		if !ok {
+			continue
+		}
+
+		b, err := parseBandwidth(value)
+		if err != nil {
+			return vc.NetworkConfig{}, fmt.Errorf("Invalid %s annotation %q: %v", a, value, err)
+		}
+
+		*bandwidth = b
 	}
 
 	return netConf, nil
 }
 
+// bandwidthMultipliers are the multipliers of the Kubernetes quantity
+// suffixes.
+var bandwidthMultipliers = map[string]float64{
+	"":   1,
+	"k":  1e3,
+	"M":  1e6,
+	"G":  1e9,
+	"T":  1e12,
+	"P":  1e15,
+	"E":  1e18,
+	"Ki": 1 << 10,
+	"Mi": 1 << 20,
+	"Gi": 1 << 30,
+	"Ti": 1 << 40,
+	"Pi": 1 << 50,
+	"Ei": 1 << 60,
+}
+
+// parseBandwidth parses a bandwidth in bits per second, expressed as a
+// Kubernetes quantity such as "10M" or "1.5Gi".
+func parseBandwidth(value string) (uint64, error) {
+	i := strings.IndexFunc(value, unicode.IsLetter)
+	if i < 0 {
+		i = len(value)
+	}
+
+	multiplier, ok := bandwidthMultipliers[value[i:]]
+	if !ok {
+		return 0, fmt.Errorf("unknown suffix %q", value[i:])
+	}
+
+	n, err := strconv.ParseFloat(value[:i], 64)
+	if err != nil {
+		return 0, err
+	}
+
+	bandwidth := n * multiplier
+	if bandwidth < 0 || bandwidth >= math.MaxUint64 {
+		return 0, fmt.Errorf("out of range")
+	}
+
+	return uint64(bandwidth), nil
+}
+
 // getConfigPath returns the full config path from the bundle
 // path provided.
 func getConfigPath(bundlePath string) string {
@@ -446,6 +539,205 @@ func addAssetAnnotations(ocispec CompatOCISpec, config *vc.SandboxConfig) {
 	}
 }
 
+// minMemorySize is the smallest memory, in MiB, a sandbox can be configured
+// with, as for the runtime configuration.
+const minMemorySize uint32 = 8
+
+// configAnnotations are the annotations overriding the sandbox configuration,
+// and how they are applied.
+var configAnnotations = map[string]func(c *vc.SandboxConfig, value string) error{
+	vcAnnotations.DefaultVCPUs: func(c *vc.SandboxConfig, value string) error {
+		var vcpus uint32
+		if err := parseNonZeroUint32(value, &vcpus); err != nil {
+			return err
+		}
+
+		// As for the runtime configuration, do not exceed the number
+		// of physical CPUs.
+		if numCPUs := uint32(goruntime.NumCPU()); vcpus > numCPUs {
+			vcpus = numCPUs
+		}
+
+		c.HypervisorConfig.NumVCPUs = vcpus
+		return nil
+	},
+	vcAnnotations.DefaultMaxVCPUs: func(c *vc.SandboxConfig, value string) error {
+		var maxVCPUs uint32
+		if err := parseNonZeroUint32(value, &maxVCPUs); err != nil {
+			return err
+		}
+
+		// As for the runtime configuration, do not exceed the number
+		// of physical CPUs, nor the number of vCPUs supported by the
+		// hypervisor.
+		if numCPUs := uint32(goruntime.NumCPU()); maxVCPUs > numCPUs {
+			maxVCPUs = numCPUs
+		}
+		if maxVCPUs > vc.MaxQemuVCPUs() {
+			maxVCPUs = vc.MaxQemuVCPUs()
+		}
+
+		c.HypervisorConfig.DefaultMaxVCPUs = maxVCPUs
+		return nil
+	},
+	vcAnnotations.DefaultMemory: func(c *vc.SandboxConfig, value string) error {
+		var memory uint32
+		if err := parseUint32(value, &memory); err != nil {
+			return err
+		}
+
+		if memory < minMemorySize {
+			return fmt.Errorf("must be at least %d MiB", minMemorySize)
+		}
+
+		c.HypervisorConfig.MemorySize = memory
+		return nil
+	},
+	vcAnnotations.MemSlots: func(c *vc.SandboxConfig, value string) error {
+		return parseNonZeroUint32(value, &c.HypervisorConfig.MemSlots)
+	},
+	vcAnnotations.MemOffset: func(c *vc.SandboxConfig, value string) error {
+		return parseUint32(value, &c.HypervisorConfig.MemOffset)
+	},
+	vcAnnotations.DefaultBridges: func(c *vc.SandboxConfig, value string) error {
+		return parseUint32(value, &c.HypervisorConfig.DefaultBridges)
+	},
+	vcAnnotations.Msize9p: func(c *vc.SandboxConfig, value string) error {
+		return parseUint32(value, &c.HypervisorConfig.Msize9p)
+	},
+	vcAnnotations.BlockDeviceDriver: func(c *vc.SandboxConfig, value string) error {
+		supportedBlockDrivers := []string{config.VirtioSCSI, config.VirtioBlock, config.VirtioMmio, config.Nvdimm}
+		if !contains(supportedBlockDrivers, value) {
+			return fmt.Errorf("supported drivers: %v", supportedBlockDrivers)
+		}
+
+		c.HypervisorConfig.BlockDeviceDriver = value
+		return nil
+	},
+	vcAnnotations.BlockDeviceCacheSet: func(c *vc.SandboxConfig, value string) error {
+		return parseBool(value, &c.HypervisorConfig.BlockDeviceCacheSet)
+	},
+	vcAnnotations.BlockDeviceCacheDirect: func(c *vc.SandboxConfig, value string) error {
+		return parseBool(value, &c.HypervisorConfig.BlockDeviceCacheDirect)
+	},
+	vcAnnotations.BlockDeviceCacheNoflush: func(c *vc.SandboxConfig, value string) error {
+		return parseBool(value, &c.HypervisorConfig.BlockDeviceCacheNoflush)
+	},
+	vcAnnotations.DisableBlockDeviceUse: func(c *vc.SandboxConfig, value string) error {
+		return parseBool(value, &c.HypervisorConfig.DisableBlockDeviceUse)
+	},
+	vcAnnotations.EnableIOThreads: func(c *vc.SandboxConfig, value string) error {
+		return parseBool(value, &c.HypervisorConfig.EnableIOThreads)
+	},
+	vcAnnotations.HugePages: func(c *vc.SandboxConfig, value string) error {
+		return parseBool(value, &c.HypervisorConfig.HugePages)
+	},
+	vcAnnotations.MemPrealloc: func(c *vc.SandboxConfig, value string) error {
+		return parseBool(value, &c.HypervisorConfig.MemPrealloc)
+	},
+	vcAnnotations.KernelParams: func(c *vc.SandboxConfig, value string) error {
+		// Do not append to the kernel parameters of the runtime configuration.
+		params := append([]vc.Param{}, c.HypervisorConfig.KernelParams...)
+		c.HypervisorConfig.KernelParams = append(params, vc.DeserializeParams(strings.Fields(value))...)
+		return nil
+	},
+	vcAnnotations.MachineType: func(c *vc.SandboxConfig, value string) error {
+		c.HypervisorConfig.HypervisorMachineType = value
+		return nil
+	},
+	vcAnnotations.LongLiveConn: func(c *vc.SandboxConfig, value string) error {
+		agentConfig, ok := c.AgentConfig.(vc.KataAgentConfig)
+		if !ok {
+			return fmt.Errorf("only supported by the %s agent", vc.KataContainersAgent)
+		}
+
+		if err := parseBool(value, &agentConfig.LongLiveConn); err != nil {
+			return err
+		}
+
+		c.AgentConfig = agentConfig
+		return nil
+	},
+}
+
+func parseUint32(value string, v *uint32) error {
+	u, err := strconv.ParseUint(value, 10, 32)
+	if err != nil {
+		return err
+	}
+
+	*v = uint32(u)
+	return nil
+}
+
+func parseNonZeroUint32(value string, v *uint32) error {
+	if err := parseUint32(value, v); err != nil {
+		return err
+	}
+
+	if *v == 0 {
+		return fmt.Errorf("must be greater than zero")
+	}
+
+	return nil
+}
+
+func parseBool(value string, v *bool) error {
+	b, err := strconv.ParseBool(value)
+	if err != nil {
+		return err
+	}
+
+	*v = b
+	return nil
+}
+
+// annotationEnabled tells if the runtime configuration allows pods to
+// override their configuration with the key annotation.
+func annotationEnabled(runtime RuntimeConfig, key string) bool {
+	name := strings.TrimPrefix(key, vcAnnotations.ConfigAnnotationsPrefix)
+
+	for _, pattern := range runtime.EnableAnnotations {
+		if matched, _ := filepath.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// addConfigAnnotations overrides the sandbox configuration with the
+// configuration annotations of the pod. Annotations the runtime
+// configuration does not enable are rejected.
+func addConfigAnnotations(ocispec CompatOCISpec, runtime RuntimeConfig, config *vc.SandboxConfig) error {
+	for key, value := range ocispec.Annotations {
+		if !strings.HasPrefix(key, vcAnnotations.ConfigAnnotationsPrefix) {
+			continue
+		}
+
+		apply, ok := configAnnotations[key]
+		if !ok {
+			return fmt.Errorf("Unknown configuration annotation %s", key)
+		}
+
+		if !annotationEnabled(runtime, key) {
+			return fmt.Errorf("Annotation %s is not enabled by the runtime configuration", key)
+		}
+
+		if err := apply(config, value); err != nil {
+			return fmt.Errorf("Invalid %s annotation %q: %v", key, value, err)
+		}
+	}
+
+	hypervisorConfig := config.HypervisorConfig
+	if hypervisorConfig.DefaultMaxVCPUs > 0 && hypervisorConfig.NumVCPUs > hypervisorConfig.DefaultMaxVCPUs {
+		return fmt.Errorf("Sandbox vCPUs (%d) exceed the maximum number of vCPUs (%d)",
+			hypervisorConfig.NumVCPUs, hypervisorConfig.DefaultMaxVCPUs)
+	}
+
+	return nil
+}
+
 // SandboxConfig converts an OCI compatible runtime configuration file
 // to a virtcontainers sandbox configuration structure.
 func SandboxConfig(ocispec CompatOCISpec, runtime RuntimeConfig, bundlePath, cid, console string, detach, systemdCgroup bool) (vc.SandboxConfig, error) {
@@ -500,10 +792,16 @@ func SandboxConfig(ocispec CompatOCISpec, runtime RuntimeConfig, bundlePath, cid
 		SystemdCgroup: systemdCgroup,
 
 		DisableGuestSeccomp: runtime.DisableGuestSeccomp,
+
+		MonitorConfig: runtime.MonitorConfig,
 	}
 
 	addAssetAnnotations(ocispec, &sandboxConfig)
 
+	if err := addConfigAnnotations(ocispec, runtime, &sandboxConfig); err != nil {
+		return vc.SandboxConfig{}, err
+	}
+
 	return sandboxConfig, nil
 }
 
@@ -13,6 +13,7 @@ import (
 	"path"
 	"path/filepath"
 	"reflect"
+	goruntime "runtime"
 	"strconv"
 	"testing"
 
@@ -839,6 +840,188 @@ func TestGetShmSizeBindMounted(t *testing.T) {
 	assert.Equal(t, shmSize, uint64(size))
 }
 
+func TestNetworkConfigL2Interfaces(t *testing.T) {
+	assert := assert.New(t)
+
+	ocispec := CompatOCISpec{Spec: specs.Spec{Linux: &specs.Linux{}}}
+
+	netConf, err := networkConfig(ocispec, RuntimeConfig{})
+	assert.NoError(err)
+	assert.Empty(netConf.L2Interfaces)
+
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.NetL2Interfaces: "eth1, bond0,,eth2.100",
+	}
+	netConf, err = networkConfig(ocispec, RuntimeConfig{})
+	assert.NoError(err)
+	assert.Equal([]string{"eth1", "bond0", "eth2.100"}, netConf.L2Interfaces)
+}
+
+func TestNetworkConfigBandwidth(t *testing.T) {
+	assert := assert.New(t)
+
+	ocispec := CompatOCISpec{Spec: specs.Spec{Linux: &specs.Linux{}}}
+	runtime := RuntimeConfig{IngressBandwidth: 1000000, EgressBandwidth: 2000000}
+
+	netConf, err := networkConfig(ocispec, runtime)
+	assert.NoError(err)
+	assert.Equal(uint64(1000000), netConf.IngressBandwidth)
+	assert.Equal(uint64(2000000), netConf.EgressBandwidth)
+
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.IngressBandwidth: "10M",
+	}
+	netConf, err = networkConfig(ocispec, runtime)
+	assert.NoError(err)
+	assert.Equal(uint64(10000000), netConf.IngressBandwidth)
+	assert.Equal(uint64(2000000), netConf.EgressBandwidth)
+
+	ocispec.Annotations[vcAnnotations.EgressBandwidth] = "10Mbit"
+	_, err = networkConfig(ocispec, runtime)
+	assert.Error(err)
+}
+
+func TestParseBandwidth(t *testing.T) {
+	assert := assert.New(t)
+
+	for value, expected := range map[string]uint64{
+		"0":     0,
+		"1000":  1000,
+		"10k":   10000,
+		"1.5M":  1500000,
+		"2G":    2000000000,
+		"1Ki":   1024,
+		"100Mi": 100 * 1024 * 1024,
+	} {
+		bandwidth, err := parseBandwidth(value)
+		assert.NoError(err, value)
+		assert.Equal(expected, bandwidth, value)
+	}
+
+	for _, value := range []string{"", "M", "10m", "10 M", "-1M", "1e3", "100E"} {
+		_, err := parseBandwidth(value)
+		assert.Error(err, value)
+	}
+}
+
+func TestAddConfigAnnotations(t *testing.T) {
+	assert := assert.New(t)
+
+	runtime := RuntimeConfig{
+		EnableAnnotations: []string{"hypervisor.default_*", "hypervisor.kernel_params", "agent.long_live_conn"},
+	}
+
+	kernelParams := []vc.Param{{Key: "quiet"}}
+	config := vc.SandboxConfig{
+		HypervisorConfig: vc.HypervisorConfig{
+			NumVCPUs:        1,
+			DefaultMaxVCPUs: 8,
+			MemorySize:      2048,
+			KernelParams:    kernelParams,
+		},
+		AgentConfig: vc.KataAgentConfig{},
+	}
+
+	var ocispec CompatOCISpec
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.KernelPath:      "/not/a/config/annotation",
+		vcAnnotations.DefaultVCPUs:    "4",
+		vcAnnotations.DefaultMemory:   "4096",
+		vcAnnotations.DefaultMaxVCPUs: "4",
+		vcAnnotations.KernelParams:    "debug foo=bar",
+		vcAnnotations.LongLiveConn:    "true",
+	}
+
+	// The vCPUs do not exceed the physical CPUs.
+	vcpus := uint32(4)
+	if numCPUs := uint32(goruntime.NumCPU()); vcpus > numCPUs {
+		vcpus = numCPUs
+	}
+
+	assert.NoError(addConfigAnnotations(ocispec, runtime, &config))
+	assert.Equal(vcpus, config.HypervisorConfig.NumVCPUs)
+	assert.Equal(vcpus, config.HypervisorConfig.DefaultMaxVCPUs)
+	assert.Equal(uint32(4096), config.HypervisorConfig.MemorySize)
+	assert.Equal([]vc.Param{{Key: "quiet"}, {Key: "debug"}, {Key: "foo", Value: "bar"}}, config.HypervisorConfig.KernelParams)
+	assert.Equal([]vc.Param{{Key: "quiet"}}, kernelParams)
+	assert.True(config.AgentConfig.(vc.KataAgentConfig).LongLiveConn)
+
+	// Not enabled
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.HugePages: "true",
+	}
+	assert.Error(addConfigAnnotations(ocispec, runtime, &config))
+	assert.False(config.HypervisorConfig.HugePages)
+
+	// Unknown
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.ConfigAnnotationsPrefix + "hypervisor.default_vcpu": "2",
+	}
+	assert.Error(addConfigAnnotations(ocispec, runtime, &config))
+
+	// Invalid values
+	for _, value := range []string{"0", "-1", "two"} {
+		ocispec.Annotations = map[string]string{
+			vcAnnotations.DefaultVCPUs: value,
+		}
+		assert.Error(addConfigAnnotations(ocispec, runtime, &config))
+	}
+
+	// Too small a memory
+	for _, value := range []string{"0", "4"} {
+		ocispec.Annotations = map[string]string{
+			vcAnnotations.DefaultMemory: value,
+		}
+		assert.Error(addConfigAnnotations(ocispec, runtime, &config))
+	}
+	assert.Equal(uint32(4096), config.HypervisorConfig.MemorySize)
+
+	// The maximum vCPUs do not exceed the physical CPUs either
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.DefaultVCPUs:    "1",
+		vcAnnotations.DefaultMaxVCPUs: "100000",
+	}
+	assert.NoError(addConfigAnnotations(ocispec, runtime, &config))
+	assert.Equal(uint32(goruntime.NumCPU()), config.HypervisorConfig.DefaultMaxVCPUs)
+
+	// More vCPUs than the maximum
+	if goruntime.NumCPU() > 1 {
+		config.HypervisorConfig.DefaultMaxVCPUs = 1
+		ocispec.Annotations = map[string]string{
+			vcAnnotations.DefaultVCPUs: "2",
+		}
+		assert.Error(addConfigAnnotations(ocispec, runtime, &config))
+	}
+	config.HypervisorConfig.NumVCPUs = vcpus
+	config.HypervisorConfig.DefaultMaxVCPUs = vcpus
+
+	// Not a kata agent
+	config.AgentConfig = vc.HyperConfig{}
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.LongLiveConn: "true",
+	}
+	assert.Error(addConfigAnnotations(ocispec, runtime, &config))
+
+	runtime.EnableAnnotations = []string{"hypervisor.*"}
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.BlockDeviceDriver: "virtio-blk",
+		vcAnnotations.MachineType:       "q35",
+	}
+	assert.NoError(addConfigAnnotations(ocispec, runtime, &config))
+	assert.Equal("virtio-blk", config.HypervisorConfig.BlockDeviceDriver)
+	assert.Equal("q35", config.HypervisorConfig.HypervisorMachineType)
+
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.MemSlots: "0",
+	}
+	assert.Error(addConfigAnnotations(ocispec, runtime, &config))
+
+	ocispec.Annotations = map[string]string{
+		vcAnnotations.BlockDeviceDriver: "floppy",
+	}
+	assert.Error(addConfigAnnotations(ocispec, runtime, &config))
+}
+
 func TestMain(m *testing.M) {
 	/* Create temp bundle directory if necessary */
 	err := os.MkdirAll(tempBundlePath, dirMode)
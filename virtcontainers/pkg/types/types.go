@@ -28,6 +28,17 @@ type Interface struct {
 	// library, regarding each type of link. Here is a non exhaustive
 	// list: "veth", "macvtap", "vlan", "macvlan", "tap", ...
 	LinkType string
+	// VlanID is the VLAN ID of a "vlan" interface. The VLAN tagging is
+	// done by the host link, the guest interface sends and receives
+	// untagged frames.
+	VlanID int
+}
+
+// Bandwidth describes the bandwidth limits, in bits per second, of the
+// network interfaces. Zero is unlimited.
+type Bandwidth struct {
+	Ingress uint64
+	Egress  uint64
 }
 
 // Route describes a network route.
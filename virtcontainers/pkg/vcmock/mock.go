@@ -56,6 +56,15 @@ func (m *VCMock) CreateSandbox(ctx context.Context, sandboxConfig vc.SandboxConf
 	return nil, fmt.Errorf("%s: %s (%+v): sandboxConfig: %v", mockErrorPrefix, getSelf(), m, sandboxConfig)
 }
 
+// RestoreSandbox implements the VC function of the same name.
+func (m *VCMock) RestoreSandbox(ctx context.Context, sandboxConfig vc.SandboxConfig, checkpointDir string) (vc.VCSandbox, error) {
+	if m.RestoreSandboxFunc != nil {
+		return m.RestoreSandboxFunc(ctx, sandboxConfig, checkpointDir)
+	}
+
+	return nil, fmt.Errorf("%s: %s (%+v): sandboxConfig: %v checkpointDir: %v", mockErrorPrefix, getSelf(), m, sandboxConfig, checkpointDir)
+}
+
 // DeleteSandbox implements the VC function of the same name.
 func (m *VCMock) DeleteSandbox(ctx context.Context, sandboxID string) (vc.VCSandbox, error) {
 	if m.DeleteSandboxFunc != nil {
@@ -272,6 +281,24 @@ func (m *VCMock) RemoveInterface(ctx context.Context, sandboxID string, inf *vcT
 	return nil, fmt.Errorf("%s: %s (%+v): sandboxID: %v", mockErrorPrefix, getSelf(), m, sandboxID)
 }
 
+// UpdateInterface implements the VC function of the same name.
+func (m *VCMock) UpdateInterface(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	if m.UpdateInterfaceFunc != nil {
+		return m.UpdateInterfaceFunc(ctx, sandboxID, inf)
+	}
+
+	return nil, fmt.Errorf("%s: %s (%+v): sandboxID: %v", mockErrorPrefix, getSelf(), m, sandboxID)
+}
+
+// UpdateBandwidth implements the VC function of the same name.
+func (m *VCMock) UpdateBandwidth(ctx context.Context, sandboxID string, bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	if m.UpdateBandwidthFunc != nil {
+		return m.UpdateBandwidthFunc(ctx, sandboxID, bw)
+	}
+
+	return nil, fmt.Errorf("%s: %s (%+v): sandboxID: %v", mockErrorPrefix, getSelf(), m, sandboxID)
+}
+
 // ListInterfaces implements the VC function of the same name.
 func (m *VCMock) ListInterfaces(ctx context.Context, sandboxID string) ([]*vcTypes.Interface, error) {
 	if m.ListInterfacesFunc != nil {
@@ -143,6 +143,33 @@ func TestVCMockCreateSandbox(t *testing.T) {
 	assert.True(IsMockError(err))
 }
 
+func TestVCMockRestoreSandbox(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &VCMock{}
+	assert.Nil(m.RestoreSandboxFunc)
+
+	ctx := context.Background()
+	_, err := m.RestoreSandbox(ctx, vc.SandboxConfig{}, "/checkpoint")
+	assert.Error(err)
+	assert.True(IsMockError(err))
+
+	m.RestoreSandboxFunc = func(ctx context.Context, sandboxConfig vc.SandboxConfig, checkpointDir string) (vc.VCSandbox, error) {
+		return &Sandbox{}, nil
+	}
+
+	sandbox, err := m.RestoreSandbox(ctx, vc.SandboxConfig{}, "/checkpoint")
+	assert.NoError(err)
+	assert.Equal(sandbox, &Sandbox{})
+
+	// reset
+	m.RestoreSandboxFunc = nil
+
+	_, err = m.RestoreSandbox(ctx, vc.SandboxConfig{}, "/checkpoint")
+	assert.Error(err)
+	assert.True(IsMockError(err))
+}
+
 func TestVCMockDeleteSandbox(t *testing.T) {
 	assert := assert.New(t)
 
@@ -791,6 +818,60 @@ func TestVCMockRemoveInterface(t *testing.T) {
 	assert.True(IsMockError(err))
 }
 
+func TestVCMockUpdateInterface(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &VCMock{}
+	config := &vc.SandboxConfig{}
+	assert.Nil(m.UpdateInterfaceFunc)
+
+	ctx := context.Background()
+	_, err := m.UpdateInterface(ctx, config.ID, nil)
+	assert.Error(err)
+	assert.True(IsMockError(err))
+
+	m.UpdateInterfaceFunc = func(ctx context.Context, sid string, inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+		return nil, nil
+	}
+
+	_, err = m.UpdateInterface(ctx, config.ID, nil)
+	assert.NoError(err)
+
+	// reset
+	m.UpdateInterfaceFunc = nil
+
+	_, err = m.UpdateInterface(ctx, config.ID, nil)
+	assert.Error(err)
+	assert.True(IsMockError(err))
+}
+
+func TestVCMockUpdateBandwidth(t *testing.T) {
+	assert := assert.New(t)
+
+	m := &VCMock{}
+	config := &vc.SandboxConfig{}
+	assert.Nil(m.UpdateBandwidthFunc)
+
+	ctx := context.Background()
+	_, err := m.UpdateBandwidth(ctx, config.ID, nil)
+	assert.Error(err)
+	assert.True(IsMockError(err))
+
+	m.UpdateBandwidthFunc = func(ctx context.Context, sid string, bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+		return nil, nil
+	}
+
+	_, err = m.UpdateBandwidth(ctx, config.ID, nil)
+	assert.NoError(err)
+
+	// reset
+	m.UpdateBandwidthFunc = nil
+
+	_, err = m.UpdateBandwidth(ctx, config.ID, nil)
+	assert.Error(err)
+	assert.True(IsMockError(err))
+}
+
 func TestVCMockListInterfaces(t *testing.T) {
 	assert := assert.New(t)
 
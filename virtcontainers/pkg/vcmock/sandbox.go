@@ -42,6 +42,16 @@ func (s *Sandbox) GetNetNs() string {
 	return s.MockNetNs
 }
 
+// GetHypervisorPid implements the VCSandbox function of the same name.
+func (s *Sandbox) GetHypervisorPid() (int, error) {
+	return s.MockHypervisorPid, nil
+}
+
+// GetVCPUThreadIDs implements the VCSandbox function of the same name.
+func (s *Sandbox) GetVCPUThreadIDs() ([]int, error) {
+	return s.MockVCPUThreadIDs, nil
+}
+
 // GetAllContainers implements the VCSandbox function of the same name.
 func (s *Sandbox) GetAllContainers() []vc.VCContainer {
 	var ifa = make([]vc.VCContainer, len(s.MockContainers))
@@ -88,6 +98,11 @@ func (s *Sandbox) Resume() error {
 	return nil
 }
 
+// Checkpoint implements the VCSandbox function of the same name.
+func (s *Sandbox) Checkpoint(dir string) error {
+	return nil
+}
+
 // Delete implements the VCSandbox function of the same name.
 func (s *Sandbox) Delete() error {
 	return nil
@@ -125,7 +140,7 @@ func (s *Sandbox) StatusContainer(contID string) (vc.ContainerStatus, error) {
 
 // StatsContainer implements the VCSandbox function of the same name.
 func (s *Sandbox) StatsContainer(contID string) (vc.ContainerStats, error) {
-	return vc.ContainerStats{}, nil
+	return vc.ContainerStats{NetworkStats: s.MockNetworkStats}, nil
 }
 
 // PauseContainer implements the VCSandbox function of the same name.
@@ -198,6 +213,16 @@ func (s *Sandbox) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, e
 	return nil, nil
 }
 
+// UpdateInterface implements the VCSandbox function of the same name.
+func (s *Sandbox) UpdateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	return nil, nil
+}
+
+// UpdateBandwidth implements the VCSandbox function of the same name.
+func (s *Sandbox) UpdateBandwidth(bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	return nil, nil
+}
+
 // ListInterfaces implements the VCSandbox function of the same name.
 func (s *Sandbox) ListInterfaces() ([]*vcTypes.Interface, error) {
 	return nil, nil
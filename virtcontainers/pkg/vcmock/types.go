@@ -20,11 +20,14 @@ import (
 
 // Sandbox is a fake Sandbox type used for testing
 type Sandbox struct {
-	MockID          string
-	MockURL         string
-	MockAnnotations map[string]string
-	MockContainers  []*Container
-	MockNetNs       string
+	MockID            string
+	MockURL           string
+	MockAnnotations   map[string]string
+	MockContainers    []*Container
+	MockNetNs         string
+	MockHypervisorPid int
+	MockVCPUThreadIDs []int
+	MockNetworkStats  []*vc.NetworkStats
 }
 
 // Container is a fake Container type used for testing
@@ -50,6 +53,7 @@ type VCMock struct {
 	FetchSandboxFunc   func(ctx context.Context, sandboxID string) (vc.VCSandbox, error)
 	PauseSandboxFunc   func(ctx context.Context, sandboxID string) (vc.VCSandbox, error)
 	ResumeSandboxFunc  func(ctx context.Context, sandboxID string) (vc.VCSandbox, error)
+	RestoreSandboxFunc func(ctx context.Context, sandboxConfig vc.SandboxConfig, checkpointDir string) (vc.VCSandbox, error)
 	RunSandboxFunc     func(ctx context.Context, sandboxConfig vc.SandboxConfig) (vc.VCSandbox, error)
 	StartSandboxFunc   func(ctx context.Context, sandboxID string) (vc.VCSandbox, error)
 	StatusSandboxFunc  func(ctx context.Context, sandboxID string) (vc.SandboxStatus, error)
@@ -72,6 +76,8 @@ type VCMock struct {
 
 	AddInterfaceFunc    func(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error)
 	RemoveInterfaceFunc func(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	UpdateInterfaceFunc func(ctx context.Context, sandboxID string, inf *vcTypes.Interface) (*vcTypes.Interface, error)
+	UpdateBandwidthFunc func(ctx context.Context, sandboxID string, bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error)
 	ListInterfacesFunc  func(ctx context.Context, sandboxID string) ([]*vcTypes.Interface, error)
 	UpdateRoutesFunc    func(ctx context.Context, sandboxID string, routes []*vcTypes.Route) ([]*vcTypes.Route, error)
 	ListRoutesFunc      func(ctx context.Context, sandboxID string) ([]*vcTypes.Route, error)
@@ -10,12 +10,16 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 	"time"
 	"unsafe"
@@ -38,6 +42,10 @@ import (
 const romFile = ""
 
 type qmpChannel struct {
+	// Mutex serializes the QMP connection setup and shutdown, which
+	// can be requested from several goroutines.
+	sync.Mutex
+
 	ctx     context.Context
 	path    string
 	qmp     *govmmQemu.QMP
@@ -58,6 +66,11 @@ type QemuState struct {
 	HotpluggedMemory     int
 	UUID                 string
 	HotplugVFIOOnRootBus bool
+	// BalloonedMemory is the memory in MiB given back to the host with
+	// the balloon when the VM memory was resized down.
+	BalloonedMemory int
+	// VirtiofsdPid is the pid of the virtio-fs daemon of the VM.
+	VirtiofsdPid int
 }
 
 // qemu is an Hypervisor interface implementation for the Linux qemu hypervisor.
@@ -83,19 +96,54 @@ type qemu struct {
 	ctx context.Context
 
 	nvdimmCount int
+
+	// eventsLock protects events, the VM events subscriber.
+	eventsLock sync.Mutex
+	events     chan<- hypervisorEvent
+
+	// balloonLock protects the balloon size, set by both the memory
+	// resize and the memory reclaim.
+	balloonLock sync.Mutex
+
+	// reclaimedMemory is the memory in MiB unused by the guest and
+	// reclaimed with the balloon.
+	reclaimedMemory uint32
+
+	// balloonStopCh stops the memory reclaim, and balloonWg waits for
+	// it to be stopped.
+	balloonStopCh chan struct{}
+	balloonWg     sync.WaitGroup
+
+	// sharedFSPath is the host directory shared with virtio-fs.
+	sharedFSPath string
+
+	// virtiofsdLock protects the pid of the virtio-fs daemon, which is
+	// reset when the daemon is stopped.
+	virtiofsdLock sync.Mutex
 }
 
 const (
 	consoleSocket = "console.sock"
 	qmpSocket     = "qmp.sock"
 
+	// qmpAuxSocket is the QMP socket used for the commands the QMP
+	// client of govmm does not provide, see qmpAuxExecute.
+	qmpAuxSocket = "qmp-aux.sock"
+
 	qmpCapErrMsg                      = "Failed to negoatiate QMP capabilities"
 	qmpCapMigrationBypassSharedMemory = "bypass-shared-memory"
 	qmpExecCatCmd                     = "exec:cat"
 	qmpMigrationWaitTimeout           = 5 * time.Second
+	qmpCheckpointWaitTimeout          = 5 * time.Minute
+	qmpHotunplugTimeout               = 10 * time.Second
+
+	// qmpMemoryDeviceDIMM is the type of the pc-dimm memory devices
+	// reported by query-memory-devices.
+	qmpMemoryDeviceDIMM = "dimm"
 
 	scsiControllerID = "scsi0"
 	rngID            = "rng0"
+	balloonID        = "balloon0"
 )
 
 var qemuMajorVersion int
@@ -315,6 +363,10 @@ func (q *qemu) qmpSocketPath(id string) (string, error) {
 	return utils.BuildSocketPath(store.RunVMStoragePath, id, qmpSocket)
 }
 
+func (q *qemu) qmpAuxSocketPath(id string) (string, error) {
+	return utils.BuildSocketPath(store.RunVMStoragePath, id, qmpAuxSocket)
+}
+
 func (q *qemu) getQemuMachine() (govmmQemu.Machine, error) {
 	machine, err := q.arch.machine()
 	if err != nil {
@@ -359,6 +411,11 @@ func (q *qemu) createQmpSocket() ([]govmmQemu.QMPSocket, error) {
 		path: monitorSockPath,
 	}
 
+	auxSockPath, err := q.qmpAuxSocketPath(q.id)
+	if err != nil {
+		return nil, err
+	}
+
 	return []govmmQemu.QMPSocket{
 		{
 			Type:   "unix",
@@ -366,6 +423,12 @@ func (q *qemu) createQmpSocket() ([]govmmQemu.QMPSocket, error) {
 			Server: true,
 			NoWait: true,
 		},
+		{
+			Type:   "unix",
+			Name:   auxSockPath,
+			Server: true,
+			NoWait: true,
+		},
 	}, nil
 }
 
@@ -395,6 +458,10 @@ func (q *qemu) buildDevices(initrdPath string) ([]govmmQemu.Device, *govmmQemu.I
 		devices, ioThread = q.arch.appendSCSIController(devices, q.config.EnableIOThreads)
 	}
 
+	if q.config.EnableBalloon {
+		devices = q.arch.appendBalloonDevice(devices, q.balloonStatsInterval())
+	}
+
 	return devices, ioThread, nil
 
 }
@@ -416,9 +483,38 @@ func (q *qemu) setupTemplate(knobs *govmmQemu.Knobs, memory *govmmQemu.Memory) g
 		}
 	}
 
+	// A checkpoint carries the whole guest memory in its migration
+	// stream, so there is no file backed memory to map here. When block
+	// drives have to be plugged back first, the stream is read from a
+	// FIFO the checkpoint is only written to once they are.
+	if q.config.BootFromCheckpoint {
+		incoming.MigrationType = govmmQemu.MigrationExec
+		incoming.Exec = "cat " + q.config.DevicesStatePath
+		if len(q.config.CheckpointBlockDrives) > 0 {
+			incoming.Exec = "cat " + q.checkpointFIFOPath()
+		}
+	}
+
 	return incoming
 }
 
+// setupSharedMemory backs the guest memory with a shared file when the
+// virtio-fs daemon has to map it. Huge pages are always shared.
+func (q *qemu) setupSharedMemory(knobs *govmmQemu.Knobs, memory *govmmQemu.Memory) {
+	if q.config.SharedFS != config.VirtioFS || q.config.HugePages {
+		return
+	}
+
+	if knobs.MemPrealloc {
+		q.Logger().Warn("The guest memory cannot be preallocated with virtio-fs")
+		knobs.MemPrealloc = false
+	}
+
+	knobs.FileBackedMem = true
+	knobs.FileBackedMemShared = true
+	memory.Path = virtioFSMemoryPath
+}
+
 // createSandbox is the Hypervisor sandbox creation implementation for govmmQemu.
 func (q *qemu) createSandbox(ctx context.Context, id string, hypervisorConfig *HypervisorConfig, store *store.VCStore) error {
 	// Save the tracing context
@@ -472,6 +568,8 @@ func (q *qemu) createSandbox(ctx context.Context, id string, hypervisorConfig *H
 
 	incoming := q.setupTemplate(&knobs, &memory)
 
+	q.setupSharedMemory(&knobs, &memory)
+
 	rtc := govmmQemu.RTC{
 		Base:     "utc",
 		DriftFix: "slew",
@@ -536,6 +634,9 @@ func (q *qemu) createSandbox(ctx context.Context, id string, hypervisorConfig *H
 	}
 	qemuConfig.Devices = q.arch.appendRNGDevice(qemuConfig.Devices, rngDev)
 
+	// Record the guest panics
+	qemuConfig.Devices = q.arch.appendPVPanic(qemuConfig.Devices)
+
 	q.qemuConfig = qemuConfig
 
 	return nil
@@ -580,13 +681,47 @@ func (q *qemu) startSandbox(timeout int) error {
 		}
 	}()
 
+	if q.config.SharedFS == config.VirtioFS {
+		if err = q.startVirtiofsd(); err != nil {
+			return err
+		}
+		defer func() {
+			if err != nil {
+				q.stopVirtiofsd()
+			}
+		}()
+	}
+
+	restoreDrives := q.config.BootFromCheckpoint && len(q.config.CheckpointBlockDrives) > 0
+	if restoreDrives {
+		if err = syscall.Mkfifo(q.checkpointFIFOPath(), 0600); err != nil {
+			return err
+		}
+		defer os.Remove(q.checkpointFIFOPath())
+	}
+
 	var strErr string
 	strErr, err = govmmQemu.LaunchQemu(q.qemuConfig, newQMPLogger())
 	if err != nil {
 		return fmt.Errorf("%s", strErr)
 	}
 
-	return q.waitSandbox(timeout)
+	if err = q.waitSandbox(timeout); err != nil {
+		return err
+	}
+
+	if restoreDrives {
+		if err = q.restoreBlockDrives(); err != nil {
+			return err
+		}
+	}
+
+	// The reclaim is an optimization, the VM can run without it.
+	if err := q.startBalloonReclaim(); err != nil {
+		q.Logger().WithError(err).Warn("Could not start the guest memory reclaim")
+	}
+
+	return nil
 }
 
 // waitSandbox will wait for the Sandbox's VM to be up and running.
@@ -649,8 +784,11 @@ func (q *qemu) stopSandbox() error {
 	defer span.Finish()
 
 	defer q.cleanupVM()
+	defer q.stopVirtiofsd()
 	q.Logger().Info("Stopping Sandbox")
 
+	q.stopBalloonReclaim()
+
 	err := q.qmpSetup()
 	if err != nil {
 		return err
@@ -665,6 +803,68 @@ func (q *qemu) stopSandbox() error {
 	return nil
 }
 
+func (q *qemu) virtiofsdSocketPath() string {
+	return filepath.Join(store.RunVMStoragePath, q.id, virtiofsdSocket)
+}
+
+// startVirtiofsd starts the virtio-fs daemon serving the shared directory,
+// which must be running before QEMU connects to it.
+func (q *qemu) startVirtiofsd() error {
+	if q.sharedFSPath == "" {
+		return fmt.Errorf("No shared directory for virtio-fs")
+	}
+
+	v := &virtiofsd{
+		path:       q.config.VirtioFSDaemon,
+		socketPath: q.virtiofsdSocketPath(),
+		sourcePath: q.sharedFSPath,
+		cache:      q.config.VirtioFSCache,
+		debug:      q.config.Debug,
+		logger:     q.Logger().WithField("subsystem", "virtiofsd"),
+	}
+
+	pid, err := v.start(q.virtiofsdExited)
+	if err != nil {
+		return err
+	}
+
+	q.virtiofsdLock.Lock()
+	q.state.VirtiofsdPid = pid
+	q.virtiofsdLock.Unlock()
+
+	return q.store.Store(store.Hypervisor, q.state)
+}
+
+// virtiofsdExited kills QEMU when the virtio-fs daemon exits while the VM
+// runs: the guest cannot work without its shared file system, and the
+// sandbox monitor reports the end of the VM.
+func (q *qemu) virtiofsdExited(err error) {
+	q.virtiofsdLock.Lock()
+	stopped := q.state.VirtiofsdPid == 0
+	q.virtiofsdLock.Unlock()
+
+	if stopped {
+		return
+	}
+
+	q.Logger().WithError(err).Error("virtiofsd exited, killing the VM")
+
+	if pid := q.pid(); pid > 0 {
+		syscall.Kill(pid, syscall.SIGKILL)
+	}
+}
+
+func (q *qemu) stopVirtiofsd() {
+	q.virtiofsdLock.Lock()
+	pid := q.state.VirtiofsdPid
+	q.state.VirtiofsdPid = 0
+	q.virtiofsdLock.Unlock()
+
+	if err := stopVirtiofsd(pid, q.virtiofsdSocketPath()); err != nil {
+		q.Logger().WithError(err).WithField("pid", pid).Warn("Could not stop virtiofsd")
+	}
+}
+
 func (q *qemu) cleanupVM() error {
 
 	// cleanup vm path
@@ -714,15 +914,26 @@ func (q *qemu) togglePauseSandbox(pause bool) error {
 }
 
 func (q *qemu) qmpSetup() error {
+	q.qmpMonitorCh.Lock()
+	defer q.qmpMonitorCh.Unlock()
+
 	if q.qmpMonitorCh.qmp != nil {
 		return nil
 	}
 
-	cfg := govmmQemu.QMPConfig{Logger: newQMPLogger()}
+	// Auto-closed by the QMP loop.
+	qmpEvents := make(chan govmmQemu.QMPEvent)
+
+	cfg := govmmQemu.QMPConfig{
+		Logger:  newQMPLogger(),
+		EventCh: qmpEvents,
+	}
 
 	// Auto-closed by QMPStart().
 	disconnectCh := make(chan struct{})
 
+	go q.forwardQMPEvents(qmpEvents, disconnectCh)
+
 	qmp, _, err := govmmQemu.QMPStart(q.qmpMonitorCh.ctx, q.qmpMonitorCh.path, cfg, disconnectCh)
 	if err != nil {
 		q.Logger().WithError(err).Error("Failed to connect to QEMU instance")
@@ -741,7 +952,68 @@ func (q *qemu) qmpSetup() error {
 	return nil
 }
 
+// forwardQMPEvents forwards the VM lifecycle events received on a QMP
+// connection to the events subscriber, until the connection is closed.
+func (q *qemu) forwardQMPEvents(qmpEvents <-chan govmmQemu.QMPEvent, disconnectCh <-chan struct{}) {
+	for {
+		select {
+		case <-disconnectCh:
+			return
+		case ev, ok := <-qmpEvents:
+			if !ok {
+				return
+			}
+
+			var event hypervisorEvent
+
+			switch ev.Name {
+			case "SHUTDOWN":
+				event = hypervisorEvent{
+					kind:    vmShutdownEvent,
+					details: fmt.Sprintf("VM shutdown (reason: %v)", ev.Data["reason"]),
+				}
+			case "GUEST_PANICKED":
+				event = hypervisorEvent{
+					kind:    guestPanicEvent,
+					details: fmt.Sprintf("guest panicked (action: %v)", ev.Data["action"]),
+				}
+			default:
+				continue
+			}
+
+			q.Logger().WithField("event", ev.Name).Info("QMP event received")
+
+			q.eventsLock.Lock()
+			if q.events != nil {
+				select {
+				case q.events <- event:
+				default:
+				}
+			}
+			q.eventsLock.Unlock()
+		}
+	}
+}
+
+// subscribeEvents sets the VM events subscriber, and makes sure a QMP
+// connection is opened to receive them. A nil events channel removes the
+// subscriber.
+func (q *qemu) subscribeEvents(events chan<- hypervisorEvent) error {
+	q.eventsLock.Lock()
+	q.events = events
+	q.eventsLock.Unlock()
+
+	if events == nil {
+		return nil
+	}
+
+	return q.qmpSetup()
+}
+
 func (q *qemu) qmpShutdown() {
+	q.qmpMonitorCh.Lock()
+	defer q.qmpMonitorCh.Unlock()
+
 	if q.qmpMonitorCh.qmp != nil {
 		q.qmpMonitorCh.qmp.Shutdown()
 		// wait on disconnected channel to be sure that the qmp channel has
@@ -805,12 +1077,7 @@ func (q *qemu) hotplugAddBlockDevice(drive *config.BlockDrive, op operation, dev
 		return nil
 	}
 
-	if q.config.BlockDeviceCacheSet {
-		err = q.qmpMonitorCh.qmp.ExecuteBlockdevAddWithCache(q.qmpMonitorCh.ctx, drive.File, drive.ID, q.config.BlockDeviceCacheDirect, q.config.BlockDeviceCacheNoflush)
-	} else {
-		err = q.qmpMonitorCh.qmp.ExecuteBlockdevAdd(q.qmpMonitorCh.ctx, drive.File, drive.ID)
-	}
-	if err != nil {
+	if err = q.blockdevAdd(drive); err != nil {
 		return err
 	}
 
@@ -847,6 +1114,89 @@ func (q *qemu) hotplugAddBlockDevice(drive *config.BlockDrive, op operation, dev
 	return nil
 }
 
+func (q *qemu) blockdevAdd(drive *config.BlockDrive) error {
+	if q.config.BlockDeviceCacheSet {
+		return q.qmpMonitorCh.qmp.ExecuteBlockdevAddWithCache(q.qmpMonitorCh.ctx, drive.File, drive.ID, q.config.BlockDeviceCacheDirect, q.config.BlockDeviceCacheNoflush)
+	}
+
+	return q.qmpMonitorCh.qmp.ExecuteBlockdevAdd(q.qmpMonitorCh.ctx, drive.File, drive.ID)
+}
+
+// checkpointFIFOPath is the FIFO the checkpoint of a VM with block drives
+// to plug back is restored through.
+func (q *qemu) checkpointFIFOPath() string {
+	return filepath.Join(store.RunVMStoragePath, q.id, "checkpoint.fifo")
+}
+
+// bridgeOfDevice returns the address and the bridge a device is plugged
+// into.
+func (q *qemu) bridgeOfDevice(ID string) (string, types.PCIBridge, error) {
+	for _, b := range q.state.Bridges {
+		for addr, devID := range b.Address {
+			if devID == ID {
+				return fmt.Sprintf("%02x", addr), b, nil
+			}
+		}
+	}
+
+	return "", types.PCIBridge{}, fmt.Errorf("Device %s is not plugged into any bridge", ID)
+}
+
+// restoreBlockDrives plugs the block drives of a VM restored from a
+// checkpoint back at the addresses they had in the checkpointed VM, and
+// then feeds the checkpoint to the incoming migration waiting for them.
+func (q *qemu) restoreBlockDrives() error {
+	if err := q.qmpSetup(); err != nil {
+		return err
+	}
+
+	for i := range q.config.CheckpointBlockDrives {
+		if err := q.restoreBlockDrive(&q.config.CheckpointBlockDrives[i]); err != nil {
+			return err
+		}
+	}
+
+	state, err := os.Open(q.config.DevicesStatePath)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	fifo, err := os.OpenFile(q.checkpointFIFOPath(), os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer fifo.Close()
+
+	_, err = io.Copy(fifo, state)
+
+	return err
+}
+
+func (q *qemu) restoreBlockDrive(drive *config.BlockDrive) error {
+	devID := "virtio-" + drive.ID
+
+	if err := q.blockdevAdd(drive); err != nil {
+		return err
+	}
+
+	if q.config.BlockDeviceDriver == config.VirtioBlock {
+		addr, bridge, err := q.bridgeOfDevice(drive.ID)
+		if err != nil {
+			return err
+		}
+
+		return q.qmpMonitorCh.qmp.ExecutePCIDeviceAdd(q.qmpMonitorCh.ctx, drive.ID, devID, "virtio-blk-pci", addr, bridge.ID, romFile, true, q.arch.runNested())
+	}
+
+	scsiID, lun, err := utils.GetSCSIIdLun(drive.Index)
+	if err != nil {
+		return err
+	}
+
+	return q.qmpMonitorCh.qmp.ExecuteSCSIDeviceAdd(q.qmpMonitorCh.ctx, drive.ID, devID, "scsi-hd", scsiControllerID+".0", romFile, scsiID, lun, true, q.arch.runNested())
+}
+
 func (q *qemu) hotplugBlockDevice(drive *config.BlockDrive, op operation) error {
 	err := q.qmpSetup()
 	if err != nil {
@@ -949,61 +1299,114 @@ func (q *qemu) hotAddNetDevice(name, hardAddr string, VMFds, VhostFds []*os.File
 	return q.qmpMonitorCh.qmp.ExecuteNetdevAddByFds(q.qmpMonitorCh.ctx, "tap", name, VMFdNames, VhostFdNames)
 }
 
-func (q *qemu) hotplugNetDevice(endpoint Endpoint, op operation) error {
-	err := q.qmpSetup()
+// hotAddVirtioNetDevice plugs the virtio-net device devID of the netdev
+// netdevID into a bridge, in the slot slotID.
+func (q *qemu) hotAddVirtioNetDevice(endpoint Endpoint, netdevID, devID, slotID string) error {
+	addr, bridge, err := q.addDeviceToBridge(slotID)
 	if err != nil {
 		return err
 	}
-	var tap TapInterface
+	pciAddr := fmt.Sprintf("%02x/%s", bridge.Addr, addr)
+	endpoint.SetPciAddr(pciAddr)
 
-	switch endpoint.Type() {
-	case VethEndpointType:
-		drive := endpoint.(*VethEndpoint)
-		tap = drive.NetPair.TapInterface
-	case TapEndpointType:
-		drive := endpoint.(*TapEndpoint)
-		tap = drive.TapInterface
-	default:
-		return fmt.Errorf("this endpoint is not supported")
+	var machine govmmQemu.Machine
+	machine, err = q.getQemuMachine()
+	if err != nil {
+		return err
+	}
+	if machine.Type == QemuCCWVirtio {
+		return q.qmpMonitorCh.qmp.ExecuteNetCCWDeviceAdd(q.qmpMonitorCh.ctx, netdevID, devID, endpoint.HardwareAddr(), addr, bridge.ID, int(q.config.NumVCPUs))
+	}
+	return q.qmpMonitorCh.qmp.ExecuteNetPCIDeviceAdd(q.qmpMonitorCh.ctx, netdevID, devID, endpoint.HardwareAddr(), addr, bridge.ID, romFile, int(q.config.NumVCPUs), q.arch.runNested())
+}
+
+// hotDelVirtioNetDevice unplugs the virtio-net device devID from the slot
+// slotID, and removes its netdev netdevID.
+func (q *qemu) hotDelVirtioNetDevice(netdevID, devID, slotID string) error {
+	if err := q.removeDeviceFromBridge(slotID); err != nil {
+		return err
 	}
 
-	devID := "virtio-" + tap.ID
-	if op == addDevice {
+	if err := q.qmpMonitorCh.qmp.ExecuteDeviceDel(q.qmpMonitorCh.ctx, devID); err != nil {
+		return err
+	}
+	if err := q.qmpMonitorCh.qmp.ExecuteNetdevDel(q.qmpMonitorCh.ctx, netdevID); err != nil {
+		return err
+	}
 
-		if err = q.hotAddNetDevice(tap.Name, endpoint.HardwareAddr(), tap.VMFds, tap.VhostFds); err != nil {
-			return err
+	return nil
+}
+
+// hotplugVhostUserNetDevice plugs a vhost-user-net device, connected to
+// the socket of the endpoint, or unplugs it.
+func (q *qemu) hotplugVhostUserNetDevice(endpoint *VhostUserEndpoint, op operation) error {
+	netdevID := utils.MakeNameID("net", endpoint.Name(), maxDevIDSize)
+	charDevID := utils.MakeNameID("char", endpoint.Name(), maxDevIDSize)
+	devID := utils.MakeNameID("virtio", endpoint.Name(), maxDevIDSize)
+
+	if op == addDevice {
+		// The vhost-user backend maps the guest memory, which cannot
+		// be shared once the VM is started.
+		if !q.config.HugePages && q.config.SharedFS != config.VirtioFS {
+			return fmt.Errorf("Cannot hotplug vhost-user network device %s, the guest memory is not shared: huge pages must be enabled", endpoint.Name())
 		}
 
-		addr, bridge, err := q.addDeviceToBridge(tap.ID)
-		if err != nil {
+		if err := q.qmpMonitorCh.qmp.ExecuteCharDevUnixSocketAdd(q.qmpMonitorCh.ctx, charDevID, endpoint.SocketPath, false, false); err != nil {
 			return err
 		}
-		pciAddr := fmt.Sprintf("%02x/%s", bridge.Addr, addr)
-		endpoint.SetPciAddr(pciAddr)
 
-		var machine govmmQemu.Machine
-		machine, err = q.getQemuMachine()
-		if err != nil {
+		if err := q.qmpMonitorCh.qmp.ExecuteNetdevChardevAdd(q.qmpMonitorCh.ctx, "vhost-user", netdevID, charDevID, 0); err != nil {
 			return err
 		}
-		if machine.Type == QemuCCWVirtio {
-			return q.qmpMonitorCh.qmp.ExecuteNetCCWDeviceAdd(q.qmpMonitorCh.ctx, tap.Name, devID, endpoint.HardwareAddr(), addr, bridge.ID, int(q.config.NumVCPUs))
-		}
-		return q.qmpMonitorCh.qmp.ExecuteNetPCIDeviceAdd(q.qmpMonitorCh.ctx, tap.Name, devID, endpoint.HardwareAddr(), addr, bridge.ID, romFile, int(q.config.NumVCPUs), q.arch.runNested())
+
+		return q.hotAddVirtioNetDevice(endpoint, netdevID, devID, devID)
 	}
 
-	if err := q.removeDeviceFromBridge(tap.ID); err != nil {
+	if err := q.hotDelVirtioNetDevice(netdevID, devID, devID); err != nil {
 		return err
 	}
 
-	if err := q.qmpMonitorCh.qmp.ExecuteDeviceDel(q.qmpMonitorCh.ctx, devID); err != nil {
+	return q.deleteCharDev(charDevID)
+}
+
+func (q *qemu) hotplugNetDevice(endpoint Endpoint, op operation) error {
+	err := q.qmpSetup()
+	if err != nil {
 		return err
 	}
-	if err := q.qmpMonitorCh.qmp.ExecuteNetdevDel(q.qmpMonitorCh.ctx, tap.Name); err != nil {
-		return err
+
+	var (
+		netdevID string
+		slotID   string
+		vmFds    []*os.File
+		vhostFds []*os.File
+	)
+
+	switch ep := endpoint.(type) {
+	case *VethEndpoint, *BridgedMacvlanEndpoint, *IPVlanEndpoint, *VlanEndpoint:
+		tap := ep.NetworkPair().TapInterface
+		netdevID, slotID, vmFds, vhostFds = tap.Name, tap.ID, tap.VMFds, tap.VhostFds
+	case *TapEndpoint:
+		tap := ep.TapInterface
+		netdevID, slotID, vmFds, vhostFds = tap.Name, tap.ID, tap.VMFds, tap.VhostFds
+	case *MacvtapEndpoint:
+		netdevID, slotID, vmFds, vhostFds = ep.Name(), ep.Name(), ep.VMFds, ep.VhostFds
+	case *VhostUserEndpoint:
+		return q.hotplugVhostUserNetDevice(ep, op)
+	default:
+		return fmt.Errorf("this endpoint is not supported")
 	}
 
-	return nil
+	devID := "virtio-" + slotID
+	if op == addDevice {
+		if err = q.hotAddNetDevice(netdevID, endpoint.HardwareAddr(), vmFds, vhostFds); err != nil {
+			return err
+		}
+
+		return q.hotAddVirtioNetDevice(endpoint, netdevID, devID, slotID)
+	}
+
+	return q.hotDelVirtioNetDevice(netdevID, devID, slotID)
 }
 
 func (q *qemu) hotplugDevice(devInfo interface{}, devType deviceType, op operation) (interface{}, error) {
@@ -1028,11 +1431,15 @@ func (q *qemu) hotplugDevice(devInfo interface{}, devType deviceType, op operati
 	}
 }
 
-func (q *qemu) hotplugAddDevice(devInfo interface{}, devType deviceType) (interface{}, error) {
+func (q *qemu) hotplugAddDevice(devInfo interface{}, devType deviceType) (data interface{}, err error) {
 	span, _ := q.trace("hotplugAddDevice")
 	defer span.Finish()
 
-	data, err := q.hotplugDevice(devInfo, devType, addDevice)
+	defer func(start time.Time) {
+		observeHotplug(devType, addDevice, start, err)
+	}(time.Now())
+
+	data, err = q.hotplugDevice(devInfo, devType, addDevice)
 	if err != nil {
 		return data, err
 	}
@@ -1040,11 +1447,15 @@ func (q *qemu) hotplugAddDevice(devInfo interface{}, devType deviceType) (interf
 	return data, q.store.Store(store.Hypervisor, q.state)
 }
 
-func (q *qemu) hotplugRemoveDevice(devInfo interface{}, devType deviceType) (interface{}, error) {
+func (q *qemu) hotplugRemoveDevice(devInfo interface{}, devType deviceType) (data interface{}, err error) {
 	span, _ := q.trace("hotplugRemoveDevice")
 	defer span.Finish()
 
-	data, err := q.hotplugDevice(devInfo, devType, removeDevice)
+	defer func(start time.Time) {
+		observeHotplug(devType, removeDevice, start, err)
+	}(time.Now())
+
+	data, err = q.hotplugDevice(devInfo, devType, removeDevice)
 	if err != nil {
 		return data, err
 	}
@@ -1151,9 +1562,13 @@ func (q *qemu) hotplugRemoveCPUs(amount uint32) (uint32, error) {
 	}
 
 	for i := uint32(0); i < amount; i++ {
-		// get the last vCPUs and try to remove it
+		// get the last vCPUs and try to remove it, the guest may refuse
+		// to eject it and never complete the removal.
 		cpu := q.state.HotpluggedVCPUs[len(q.state.HotpluggedVCPUs)-1]
-		if err := q.qmpMonitorCh.qmp.ExecuteDeviceDel(q.qmpMonitorCh.ctx, cpu.ID); err != nil {
+		ctx, cancel := context.WithTimeout(q.qmpMonitorCh.ctx, qmpHotunplugTimeout)
+		err := q.qmpMonitorCh.qmp.ExecuteDeviceDel(ctx, cpu.ID)
+		cancel()
+		if err != nil {
 			_ = q.store.Store(store.Hypervisor, q.state)
 			return i, fmt.Errorf("failed to hotunplug CPUs, only %d CPUs were hotunplugged: %v", i, err)
 		}
@@ -1191,9 +1606,7 @@ func (q *qemu) hotplugMemory(memDev *memoryDevice, op operation) (int, error) {
 	switch op {
 	case removeDevice:
 		memLog.WithField("operation", "remove").Debugf("Requested to remove memory: %d MB", memDev.sizeMB)
-		// Dont fail but warn that this is not supported.
-		memLog.Warn("hot-remove VM memory not supported")
-		return 0, nil
+		return q.hotplugRemoveMemory(memDev)
 	case addDevice:
 		memLog.WithField("operation", "add").Debugf("Requested to add memory: %d MB", memDev.sizeMB)
 		maxMem, err := q.hostMemMB()
@@ -1233,7 +1646,12 @@ func (q *qemu) hotplugAddMemory(memDev *memoryDevice) (int, error) {
 		}
 		memDev.slot = maxSlot + 1
 	}
-	err = q.qmpMonitorCh.qmp.ExecHotplugMemory(q.qmpMonitorCh.ctx, "memory-backend-ram", "mem"+strconv.Itoa(memDev.slot), "", memDev.sizeMB)
+	memID := "mem" + strconv.Itoa(memDev.slot)
+	if q.config.SharedFS == config.VirtioFS {
+		err = q.hotplugSharedMemory(memID, memDev.sizeMB)
+	} else {
+		err = q.qmpMonitorCh.qmp.ExecHotplugMemory(q.qmpMonitorCh.ctx, "memory-backend-ram", memID, "", memDev.sizeMB)
+	}
 	if err != nil {
 		q.Logger().WithError(err).Error("hotplug memory")
 		return 0, err
@@ -1243,6 +1661,135 @@ func (q *qemu) hotplugAddMemory(memDev *memoryDevice) (int, error) {
 	return memDev.sizeMB, q.store.Store(store.Hypervisor, q.state)
 }
 
+// hotplugSharedMemory hot adds sizeMB of memory backed by a shared file, as
+// the rest of the guest memory when the virtio-fs daemon has to map it. The
+// QMP client of govmm only hot adds memory backed by anonymous memory.
+func (q *qemu) hotplugSharedMemory(id string, sizeMB int) error {
+	socketPath, err := q.qmpAuxSocketPath(q.id)
+	if err != nil {
+		return err
+	}
+
+	memPath := virtioFSMemoryPath
+	if q.config.HugePages {
+		memPath = hugePagesMemoryPath
+	}
+
+	if _, err := qmpAuxExecute(socketPath, "object-add", map[string]interface{}{
+		"qom-type": "memory-backend-file",
+		"id":       id,
+		"props": map[string]interface{}{
+			"size":     uint64(sizeMB) << utils.MibToBytesShift,
+			"mem-path": memPath,
+			"share":    true,
+		},
+	}); err != nil {
+		return err
+	}
+
+	if _, err := qmpAuxExecute(socketPath, "device_add", map[string]interface{}{
+		"driver": "pc-dimm",
+		"id":     "dimm" + id,
+		"memdev": id,
+	}); err != nil {
+		if err := q.deleteObject(id); err != nil {
+			q.Logger().WithError(err).WithField("memdev", id).Warn("Could not delete the memory backend")
+		}
+		return err
+	}
+
+	return nil
+}
+
+// hotplugRemoveMemory removes the memory device plugged in the slot of
+// memDev, which the guest offlines when ejecting it.
+func (q *qemu) hotplugRemoveMemory(memDev *memoryDevice) (int, error) {
+	memoryDevices, err := q.qmpMonitorCh.qmp.ExecQueryMemoryDevices(q.qmpMonitorCh.ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to query memory devices: %v", err)
+	}
+
+	for _, device := range memoryDevices {
+		if device.Type != qmpMemoryDeviceDIMM || device.Data.Slot != memDev.slot {
+			continue
+		}
+
+		// The guest refuses to eject memory it still uses, in which
+		// case the removal never completes.
+		ctx, cancel := context.WithTimeout(q.qmpMonitorCh.ctx, qmpHotunplugTimeout)
+		err := q.qmpMonitorCh.qmp.ExecuteDeviceDel(ctx, device.Data.ID)
+		cancel()
+		if err != nil {
+			return 0, fmt.Errorf("failed to hot remove memory device %s: %v", device.Data.ID, err)
+		}
+
+		// The memory backend, which holds the host memory, can only be
+		// deleted once its device is gone.
+		if err := q.deleteObject(path.Base(device.Data.Memdev)); err != nil {
+			q.Logger().WithError(err).WithField("memdev", device.Data.Memdev).Warn("Could not delete the memory backend")
+		}
+
+		sizeMB := int(device.Data.Size >> utils.MibToBytesShift)
+		q.state.HotpluggedMemory -= sizeMB
+
+		// The removed memory no longer needs to be ballooned.
+		q.balloonLock.Lock()
+		if q.state.BalloonedMemory > 0 {
+			if q.state.BalloonedMemory > sizeMB {
+				q.state.BalloonedMemory -= sizeMB
+			} else {
+				q.state.BalloonedMemory = 0
+			}
+			if err := q.setBalloonSize(); err != nil {
+				q.Logger().WithError(err).Warn("Could not resize the memory balloon")
+			}
+		}
+		q.balloonLock.Unlock()
+
+		return sizeMB, q.store.Store(store.Hypervisor, q.state)
+	}
+
+	return 0, fmt.Errorf("no memory device found in slot %d", memDev.slot)
+}
+
+// hotpluggedResources returns the number of hot added vCPUs, and the hot
+// added memory devices, the highest addressed first.
+func (q *qemu) hotpluggedResources() (uint32, []*memoryDevice, error) {
+	vcpus := uint32(len(q.state.HotpluggedVCPUs))
+
+	if q.state.HotpluggedMemory == 0 {
+		return vcpus, nil, nil
+	}
+
+	if err := q.qmpSetup(); err != nil {
+		return 0, nil, err
+	}
+
+	memoryDevices, err := q.qmpMonitorCh.qmp.ExecQueryMemoryDevices(q.qmpMonitorCh.ctx)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to query memory devices: %v", err)
+	}
+
+	var memDevs []*memoryDevice
+	for _, device := range memoryDevices {
+		if device.Type != qmpMemoryDeviceDIMM || !device.Data.Hotplugged {
+			continue
+		}
+
+		memDevs = append(memDevs, &memoryDevice{
+			slot:   device.Data.Slot,
+			sizeMB: int(device.Data.Size >> utils.MibToBytesShift),
+			addr:   device.Data.Addr,
+		})
+	}
+
+	sort.Slice(memDevs, func(i, j int) bool {
+		return memDevs[i].addr > memDevs[j].addr
+	})
+
+	return vcpus, memDevs, nil
+}
+
 func (q *qemu) pauseSandbox() error {
 	span, _ := q.trace("pauseSandbox")
 	defer span.Finish()
@@ -1265,7 +1812,18 @@ func (q *qemu) addDevice(devInfo interface{}, devType deviceType) error {
 
 	switch v := devInfo.(type) {
 	case types.Volume:
-		q.qemuConfig.Devices = q.arch.append9PVolume(q.qemuConfig.Devices, v)
+		if q.config.SharedFS == config.VirtioFS {
+			q.sharedFSPath = v.HostPath
+			q.qemuConfig.Devices, err = q.arch.appendVhostUserDevice(q.qemuConfig.Devices, config.VhostUserDeviceAttrs{
+				DevID:      v.MountTag,
+				SocketPath: q.virtiofsdSocketPath(),
+				Type:       config.VhostUserFS,
+				Tag:        v.MountTag,
+				CacheSize:  q.config.VirtioFSCacheSize,
+			})
+		} else {
+			q.qemuConfig.Devices = q.arch.append9PVolume(q.qemuConfig.Devices, v)
+		}
 	case types.Socket:
 		q.qemuConfig.Devices = q.arch.appendSocket(q.qemuConfig.Devices, v)
 	case kataVSOCK:
@@ -1318,13 +1876,35 @@ func (q *qemu) saveSandbox() error {
 		}
 	}
 
-	err = q.qmpMonitorCh.qmp.ExecSetMigrateArguments(q.qmpMonitorCh.ctx, fmt.Sprintf("%s>%s", qmpExecCatCmd, q.config.DevicesStatePath))
+	return q.migrateToFile(q.config.DevicesStatePath, qmpMigrationWaitTimeout)
+}
+
+// checkpointSandbox saves the VM memory and device state to statePath.
+// Unlike saveSandbox, the guest memory is always part of the migration
+// stream so that the VM can be restored without any template files.
+func (q *qemu) checkpointSandbox(statePath string) error {
+	span, _ := q.trace("checkpointSandbox")
+	defer span.Finish()
+
+	q.Logger().WithField("state-path", statePath).Info("checkpoint sandbox")
+
+	if err := q.qmpSetup(); err != nil {
+		return err
+	}
+
+	return q.migrateToFile(statePath, qmpCheckpointWaitTimeout)
+}
+
+// migrateToFile migrates the VM state into path and waits for the
+// migration to complete.
+func (q *qemu) migrateToFile(path string, timeout time.Duration) error {
+	err := q.qmpMonitorCh.qmp.ExecSetMigrateArguments(q.qmpMonitorCh.ctx, fmt.Sprintf("%s>%s", qmpExecCatCmd, path))
 	if err != nil {
 		q.Logger().WithError(err).Error("exec migration")
 		return err
 	}
 
-	t := time.NewTimer(qmpMigrationWaitTimeout)
+	t := time.NewTimer(timeout)
 	defer t.Stop()
 	for {
 		status, err := q.qmpMonitorCh.qmp.ExecuteQueryMigration(q.qmpMonitorCh.ctx)
@@ -1336,10 +1916,15 @@ func (q *qemu) saveSandbox() error {
 			break
 		}
 
+		if status.Status == "failed" {
+			q.Logger().WithField("migration-status", status).Error("qemu migration failed")
+			return fmt.Errorf("qemu migration to %s failed", path)
+		}
+
 		select {
 		case <-t.C:
 			q.Logger().WithField("migration-status", status).Error("timeout waiting for qemu migration")
-			return fmt.Errorf("timed out after %d seconds waiting for qemu migration", qmpMigrationWaitTimeout)
+			return fmt.Errorf("timed out after %v waiting for qemu migration", timeout)
 		default:
 			// migration in progress
 			q.Logger().WithField("migration-status", status).Debug("migration in progress")
@@ -1360,67 +1945,89 @@ func (q *qemu) disconnect() {
 // resizeMemory get a request to update the VM memory to reqMemMB
 // Memory update is managed with two approaches
 // Add memory to VM:
-// When memory is required to be added we hotplug memory
+// When memory is required to be added we hotplug memory, after deflating
+// the balloon if it was inflated.
 // Remove Memory from VM/ Return memory to host.
 //
 // Memory unplug can be slow and it cannot be guaranteed.
 // Additionally, the unplug has not small granularly it has to be
 // the memory to remove has to be at least the size of one slot.
-// To return memory back we are resizing the VM memory balloon.
+// The sandbox removes the memory devices it can before resizing, and
+// to return the remaining memory back we are resizing the VM memory
+// balloon, when enabled.
 // A longer term solution is evaluate solutions like virtio-mem
 func (q *qemu) resizeMemory(reqMemMB uint32, memoryBlockSizeMB uint32) (uint32, error) {
+	q.balloonLock.Lock()
+	defer q.balloonLock.Unlock()
 
-	currentMemory := q.config.MemorySize + uint32(q.state.HotpluggedMemory)
+	currentMemory := q.config.MemorySize + uint32(q.state.HotpluggedMemory) - uint32(q.state.BalloonedMemory)
 	err := q.qmpSetup()
 	if err != nil {
 		return 0, err
 	}
 	switch {
 	case currentMemory < reqMemMB:
-		//hotplug
-		addMemMB := reqMemMB - currentMemory
-		memHotplugMB, err := calcHotplugMemMiBSize(addMemMB, memoryBlockSizeMB)
-		if err != nil {
-			return currentMemory, err
+		// The guest needs more memory, return it what was reclaimed
+		// and ballooned before hotplugging any.
+		q.reclaimedMemory = 0
+		if q.state.BalloonedMemory > 0 {
+			deflateMemMB := reqMemMB - currentMemory
+			if deflateMemMB > uint32(q.state.BalloonedMemory) {
+				deflateMemMB = uint32(q.state.BalloonedMemory)
+			}
+			q.state.BalloonedMemory -= int(deflateMemMB)
+			currentMemory += deflateMemMB
 		}
 
-		addMemDevice := &memoryDevice{
-			sizeMB: int(memHotplugMB),
-		}
-		data, err := q.hotplugAddDevice(addMemDevice, memoryDev)
-		if err != nil {
-			return currentMemory, err
-		}
-		memoryAdded, ok := data.(int)
-		if !ok {
-			return currentMemory, fmt.Errorf("Could not get the memory added, got %+v", data)
-		}
-		currentMemory += uint32(memoryAdded)
-	case currentMemory > reqMemMB:
-		//hotunplug
-		addMemMB := currentMemory - reqMemMB
-		memHotunplugMB, err := calcHotplugMemMiBSize(addMemMB, memoryBlockSizeMB)
-		if err != nil {
-			return currentMemory, err
+		if currentMemory < reqMemMB {
+			//hotplug
+			addMemMB := reqMemMB - currentMemory
+			memHotplugMB, err := calcHotplugMemMiBSize(addMemMB, memoryBlockSizeMB)
+			if err != nil {
+				return currentMemory, err
+			}
+
+			addMemDevice := &memoryDevice{
+				sizeMB: int(memHotplugMB),
+			}
+			data, err := q.hotplugAddDevice(addMemDevice, memoryDev)
+			if err != nil {
+				return currentMemory, err
+			}
+			memoryAdded, ok := data.(int)
+			if !ok {
+				return currentMemory, fmt.Errorf("Could not get the memory added, got %+v", data)
+			}
+			currentMemory += uint32(memoryAdded)
 		}
 
-		addMemDevice := &memoryDevice{
-			sizeMB: int(memHotunplugMB),
+		if q.config.EnableBalloon {
+			if err := q.setBalloonSize(); err != nil {
+				return currentMemory, err
+			}
+			if err := q.store.Store(store.Hypervisor, q.state); err != nil {
+				return currentMemory, err
+			}
 		}
-		data, err := q.hotplugRemoveDevice(addMemDevice, memoryDev)
-		if err != nil {
+	case currentMemory > reqMemMB && q.config.EnableBalloon:
+		// Inflate the balloon
+		q.state.BalloonedMemory += int(currentMemory - reqMemMB)
+		if err := q.setBalloonSize(); err != nil {
+			q.state.BalloonedMemory -= int(currentMemory - reqMemMB)
 			return currentMemory, err
 		}
-		memoryRemoved, ok := data.(int)
-		if !ok {
-			return currentMemory, fmt.Errorf("Could not get the memory removed, got %+v", data)
-		}
-		//FIXME: This is to check memory hotplugRemoveDevice reported 0, as this is not supported.
-		// In the future if this is implemented this validation should be removed.
-		if memoryRemoved != 0 {
-			return currentMemory, fmt.Errorf("memory hot unplug is not supported, something went wrong")
+		if err := q.store.Store(store.Hypervisor, q.state); err != nil {
+			return currentMemory, err
 		}
-		currentMemory -= uint32(memoryRemoved)
+		currentMemory = reqMemMB
+	case currentMemory > reqMemMB:
+		// Memory is hot removed by whole devices, which the guest
+		// has to be able to offline, see Sandbox.removeResources. What
+		// remains can only be returned with the balloon.
+		q.Logger().WithFields(logrus.Fields{
+			"current-memory-mb":   currentMemory,
+			"requested-memory-mb": reqMemMB,
+		}).Debug("Memory cannot be removed without the balloon")
 	}
 
 	// currentMemory is the current memory (updated) of the VM, return to caller to allow verify
@@ -1579,6 +2186,12 @@ func (q *qemu) resizeVCPUs(reqVCPUs uint32) (currentVCPUs uint32, newVCPUs uint3
 	return currentVCPUs, newVCPUs, nil
 }
 
+// setBlockRateLimiter is a no-op, the IO of QEMU drives can only be
+// constrained through the block IO controller of the host cgroups.
+func (q *qemu) setBlockRateLimiter(drive *config.BlockDrive, bandwidth, iops uint64) error {
+	return nil
+}
+
 func (q *qemu) cleanup() error {
 	span, _ := q.trace("cleanup")
 	defer span.Finish()
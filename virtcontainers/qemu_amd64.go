@@ -111,6 +111,8 @@ func (q *qemuAmd64) capabilities() types.Capabilities {
 	}
 
 	caps.SetMultiQueueSupport()
+	caps.SetPauseSupport()
+	caps.SetSnapshotSupport()
 
 	return caps
 }
@@ -161,3 +163,7 @@ func (q *qemuAmd64) appendImage(devices []govmmQemu.Device, path string) ([]govm
 func (q *qemuAmd64) appendBridges(devices []govmmQemu.Device, bridges []types.PCIBridge) []govmmQemu.Device {
 	return genericAppendBridges(devices, bridges, q.machineType)
 }
+
+func (q *qemuAmd64) appendPVPanic(devices []govmmQemu.Device) []govmmQemu.Device {
+	return append(devices, pvpanicDevice{})
+}
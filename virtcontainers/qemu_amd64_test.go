@@ -177,3 +177,14 @@ func TestQemuAmd64AppendBridges(t *testing.T) {
 
 	assert.Equal(expectedOut, devices)
 }
+
+func TestQemuAmd64AppendPVPanic(t *testing.T) {
+	assert := assert.New(t)
+
+	amd64 := newTestQemu(QemuPC)
+
+	devices := amd64.appendPVPanic(nil)
+	assert.Equal([]govmmQemu.Device{pvpanicDevice{}}, devices)
+	assert.True(devices[0].Valid())
+	assert.Equal([]string{"-device", "pvpanic"}, devices[0].QemuParams(nil))
+}
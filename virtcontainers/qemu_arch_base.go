@@ -10,6 +10,7 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"strings"
 
 	govmmQemu "github.com/intel/govmm/qemu"
 
@@ -95,6 +96,14 @@ type qemuArch interface {
 	// appendRNGDevice appends a RNG device to devices
 	appendRNGDevice(devices []govmmQemu.Device, rngDevice config.RNGDev) []govmmQemu.Device
 
+	// appendPVPanic appends a pvpanic device to devices, if the
+	// architecture supports it
+	appendPVPanic(devices []govmmQemu.Device) []govmmQemu.Device
+
+	// appendBalloonDevice appends a memory balloon device to devices,
+	// reporting the guest memory statistics every statsInterval seconds
+	appendBalloonDevice(devices []govmmQemu.Device, statsInterval uint64) []govmmQemu.Device
+
 	// handleImagePath handles the Hypervisor Config image path
 	handleImagePath(config HypervisorConfig)
 
@@ -233,6 +242,8 @@ func (q *qemuArchBase) capabilities() types.Capabilities {
 	var caps types.Capabilities
 	caps.SetBlockDeviceHotplugSupport()
 	caps.SetMultiQueueSupport()
+	caps.SetPauseSupport()
+	caps.SetSnapshotSupport()
 	return caps
 }
 
@@ -450,7 +461,7 @@ func networkModelToQemuType(model NetInterworkingModel) govmmQemu.NetDeviceType
 
 func (q *qemuArchBase) appendNetwork(devices []govmmQemu.Device, endpoint Endpoint) []govmmQemu.Device {
 	switch ep := endpoint.(type) {
-	case *VethEndpoint, *BridgedMacvlanEndpoint, *IPVlanEndpoint:
+	case *VethEndpoint, *BridgedMacvlanEndpoint, *IPVlanEndpoint, *VlanEndpoint:
 		netPair := ep.NetworkPair()
 		devices = append(devices,
 			govmmQemu.NetDevice{
@@ -525,6 +536,18 @@ func (q *qemuArchBase) appendVhostUserDevice(devices []govmmQemu.Device, attr co
 	case config.VhostUserSCSI:
 		qemuVhostUserDevice.TypeDevID = utils.MakeNameID("scsi", attr.DevID, maxDevIDSize)
 	case config.VhostUserBlk:
+	case config.VhostUserFS:
+		// govmm does not provide virtio-fs devices.
+		devices = append(devices,
+			vhostUserFSDevice{
+				CharDevID:  utils.MakeNameID("char", attr.DevID, maxDevIDSize),
+				SocketPath: attr.SocketPath,
+				Tag:        attr.Tag,
+				CacheSize:  attr.CacheSize,
+			},
+		)
+
+		return devices, nil
 	}
 
 	qemuVhostUserDevice.VhostUserType = govmmQemu.DeviceDriver(attr.Type)
@@ -561,6 +584,97 @@ func (q *qemuArchBase) appendRNGDevice(devices []govmmQemu.Device, rngDev config
 	return devices
 }
 
+// vhostUserFSDevice is a virtio-fs device, served by the vhost-user daemon
+// listening on SocketPath.
+type vhostUserFSDevice struct {
+	CharDevID  string
+	SocketPath string
+
+	// Tag is the virtio-fs volume tag, used to mount it in the guest.
+	Tag string
+
+	// CacheSize is the DAX cache size in MiB, no DAX cache when zero.
+	CacheSize uint32
+}
+
+func (d vhostUserFSDevice) Valid() bool {
+	return d.CharDevID != "" && d.SocketPath != "" && d.Tag != ""
+}
+
+func (d vhostUserFSDevice) QemuParams(config *govmmQemu.Config) []string {
+	charParams := []string{
+		"socket",
+		fmt.Sprintf("id=%s", d.CharDevID),
+		fmt.Sprintf("path=%s", d.SocketPath),
+	}
+
+	devParams := []string{
+		"vhost-user-fs-pci",
+		fmt.Sprintf("chardev=%s", d.CharDevID),
+		fmt.Sprintf("tag=%s", d.Tag),
+	}
+	if d.CacheSize > 0 {
+		devParams = append(devParams, fmt.Sprintf("cache-size=%dM", d.CacheSize))
+	}
+	devParams = append(devParams, "romfile=")
+
+	return []string{
+		"-chardev", strings.Join(charParams, ","),
+		"-device", strings.Join(devParams, ","),
+	}
+}
+
+// pvpanicDevice reports the guest kernel panics to QEMU, which emits a
+// GUEST_PANICKED QMP event for each of them.
+type pvpanicDevice struct{}
+
+func (d pvpanicDevice) Valid() bool {
+	return true
+}
+
+func (d pvpanicDevice) QemuParams(config *govmmQemu.Config) []string {
+	return []string{"-device", "pvpanic"}
+}
+
+// appendPVPanic does not append anything, the pvpanic device being an ISA
+// device that only some architectures provide.
+func (q *qemuArchBase) appendPVPanic(devices []govmmQemu.Device) []govmmQemu.Device {
+	return devices
+}
+
+// balloonDevice is a memory balloon device which, when statsInterval is set,
+// has the guest report its memory statistics every statsInterval seconds.
+type balloonDevice struct {
+	govmmQemu.BalloonDevice
+	statsInterval uint64
+}
+
+func (d balloonDevice) QemuParams(config *govmmQemu.Config) []string {
+	params := d.BalloonDevice.QemuParams(config)
+	if d.statsInterval > 0 && len(params) > 0 {
+		params[len(params)-1] += fmt.Sprintf(",guest-stats-polling-interval=%d", d.statsInterval)
+	}
+
+	return params
+}
+
+func (q *qemuArchBase) appendBalloonDevice(devices []govmmQemu.Device, statsInterval uint64) []govmmQemu.Device {
+	devices = append(devices,
+		balloonDevice{
+			BalloonDevice: govmmQemu.BalloonDevice{
+				ID: balloonID,
+				// Let the guest take the ballooned memory back
+				// rather than being killed by its OOM killer.
+				DeflateOnOOM:  true,
+				DisableModern: q.nestedRun,
+			},
+			statsInterval: statsInterval,
+		},
+	)
+
+	return devices
+}
+
 func (q *qemuArchBase) handleImagePath(config HypervisorConfig) {
 	if config.ImagePath != "" {
 		q.kernelParams = append(q.kernelParams, kernelRootParams...)
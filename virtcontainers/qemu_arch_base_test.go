@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"net"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	govmmQemu "github.com/intel/govmm/qemu"
@@ -140,6 +141,8 @@ func TestQemuArchBaseCapabilities(t *testing.T) {
 
 	c := qemuArchBase.capabilities()
 	assert.True(c.IsBlockDeviceHotplugSupported())
+	assert.True(c.IsPauseSupported())
+	assert.True(c.IsSnapshotSupported())
 }
 
 func TestQemuArchBaseBridges(t *testing.T) {
@@ -403,6 +406,31 @@ func TestQemuArchBaseAppendVhostUserDevice(t *testing.T) {
 	testQemuArchBaseAppend(t, vhostUserDevice, expectedOut)
 }
 
+func TestQemuArchBaseAppendVhostUserFSDevice(t *testing.T) {
+	assert := assert.New(t)
+	qemuArchBase := newQemuArchBase()
+
+	attrs := config.VhostUserDeviceAttrs{
+		Type:      config.VhostUserFS,
+		Tag:       "kataShared",
+		CacheSize: 1024,
+	}
+	attrs.DevID = "kataShared"
+	attrs.SocketPath = "/run/vc/vm/foo/vhost-fs.sock"
+
+	devices, err := qemuArchBase.appendVhostUserDevice(nil, attrs)
+	assert.NoError(err)
+	assert.Len(devices, 1)
+	assert.True(devices[0].Valid())
+
+	assert.Equal([]string{
+		"-chardev", "socket,id=char-kataShared,path=/run/vc/vm/foo/vhost-fs.sock",
+		"-device", "vhost-user-fs-pci,chardev=char-kataShared,tag=kataShared,cache-size=1024M,romfile=",
+	}, devices[0].QemuParams(&govmmQemu.Config{}))
+
+	assert.False(vhostUserFSDevice{}.Valid())
+}
+
 func TestQemuArchBaseAppendVFIODevice(t *testing.T) {
 	bdf := "02:10.1"
 
@@ -438,6 +466,33 @@ func TestQemuArchBaseAppendSCSIController(t *testing.T) {
 	assert.NotNil(ioThread)
 }
 
+func TestQemuArchBaseAppendBalloonDevice(t *testing.T) {
+	assert := assert.New(t)
+	qemuArchBase := newQemuArchBase()
+
+	expectedOut := []govmmQemu.Device{
+		balloonDevice{
+			BalloonDevice: govmmQemu.BalloonDevice{
+				ID:           balloonID,
+				DeflateOnOOM: true,
+			},
+			statsInterval: 2,
+		},
+	}
+
+	devices := qemuArchBase.appendBalloonDevice(nil, 2)
+	assert.Equal(expectedOut, devices)
+
+	params := devices[0].QemuParams(&govmmQemu.Config{})
+	assert.Len(params, 2)
+	assert.Contains(params[1], "deflate-on-oom=on")
+	assert.True(strings.HasSuffix(params[1], ",guest-stats-polling-interval=2"))
+
+	devices = qemuArchBase.appendBalloonDevice(nil, 0)
+	params = devices[0].QemuParams(&govmmQemu.Config{})
+	assert.NotContains(params[1], "guest-stats-polling-interval")
+}
+
 func TestQemuArchBaseAppendNetwork(t *testing.T) {
 	var devices []govmmQemu.Device
 	assert := assert.New(t)
@@ -0,0 +1,227 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/utils"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// balloonQOMPath is the QOM path of the balloon device, where its
+	// guest memory statistics are exposed.
+	balloonQOMPath = "/machine/peripheral/" + balloonID
+
+	// balloonMinReserveMiB is the minimum amount of free memory left to
+	// the guest by the memory reclaim.
+	balloonMinReserveMiB = 128
+
+	// balloonReserveRatio is the fraction of the guest memory, if bigger
+	// than balloonMinReserveMiB, left free to the guest by the reclaim.
+	balloonReserveRatio = 10
+
+	// balloonReclaimStepMiB is the granularity of the reclaim, so that the
+	// balloon is not resized for every small change of the guest usage.
+	balloonReclaimStepMiB = 64
+)
+
+// balloonReclaimTarget returns the amount of memory in MiB to reclaim from a
+// guest of guestMemMiB, with reclaimedMiB already reclaimed and freeMiB left
+// available to the guest. A reserve of free memory is kept in the guest: the
+// reclaim grows when the guest has more than the reserve and a step free, and
+// shrinks when it has less than the reserve.
+func balloonReclaimTarget(guestMemMiB, reclaimedMiB, freeMiB uint32) uint32 {
+	reserve := guestMemMiB / balloonReserveRatio
+	if reserve < balloonMinReserveMiB {
+		reserve = balloonMinReserveMiB
+	}
+
+	if reserve >= guestMemMiB {
+		return 0
+	}
+
+	switch {
+	case freeMiB >= reserve+balloonReclaimStepMiB:
+		excess := freeMiB - reserve
+		reclaimedMiB += excess - excess%balloonReclaimStepMiB
+	case freeMiB < reserve:
+		deficit := reserve - freeMiB
+		deficit += (balloonReclaimStepMiB - deficit%balloonReclaimStepMiB) % balloonReclaimStepMiB
+		if deficit > reclaimedMiB {
+			deficit = reclaimedMiB
+		}
+		reclaimedMiB -= deficit
+	}
+
+	if reclaimedMiB > guestMemMiB-reserve {
+		reclaimedMiB = guestMemMiB - reserve
+	}
+
+	return reclaimedMiB
+}
+
+// balloonGuestFreeMemory returns, in MiB, the memory available to the guest
+// from the statistics reported by the balloon driver. It returns false if the
+// guest has not reported any statistics yet.
+func balloonGuestFreeMemory(guestStats interface{}) (uint32, bool) {
+	stats, ok := guestStats.(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	if lastUpdate, ok := stats["last-update"].(float64); !ok || lastUpdate == 0 {
+		return 0, false
+	}
+
+	values, ok := stats["stats"].(map[string]interface{})
+	if !ok {
+		return 0, false
+	}
+
+	// Older guest kernels do not report the available memory, which
+	// includes the reclaimable caches, and QEMU reports -1 for it.
+	for _, name := range []string{"stat-available-memory", "stat-free-memory"} {
+		if value, ok := values[name].(float64); ok && value >= 0 {
+			return uint32(uint64(value) >> utils.MibToBytesShift), true
+		}
+	}
+
+	return 0, false
+}
+
+// balloonTarget returns the balloon target in MiB, the memory a guest of
+// guestMemMiB is left with once takenMiB are ballooned and reclaimed. The
+// guest is never left with less than balloonMinReserveMiB, whatever the
+// memory taken.
+func balloonTarget(guestMemMiB, takenMiB uint32) uint32 {
+	if guestMemMiB <= balloonMinReserveMiB {
+		return guestMemMiB
+	}
+
+	if takenMiB > guestMemMiB-balloonMinReserveMiB {
+		takenMiB = guestMemMiB - balloonMinReserveMiB
+	}
+
+	return guestMemMiB - takenMiB
+}
+
+// balloonStatsInterval returns the interval in seconds the guest reports its
+// memory statistics at, or 0 if the memory reclaim is disabled. The guest
+// reports them at most every second.
+func (q *qemu) balloonStatsInterval() uint64 {
+	if !q.config.EnableBalloon || q.config.BalloonReclaimInterval <= 0 {
+		return 0
+	}
+
+	interval := uint64(q.config.BalloonReclaimInterval / time.Second)
+	if interval == 0 {
+		interval = 1
+	}
+
+	return interval
+}
+
+// setBalloonSize sets the balloon target, the memory the guest is left with,
+// from the ballooned and reclaimed memory. It must be called with the
+// balloon lock held.
+func (q *qemu) setBalloonSize() error {
+	memory := q.config.MemorySize + uint32(q.state.HotpluggedMemory)
+	target := balloonTarget(memory, uint32(q.state.BalloonedMemory)+q.reclaimedMemory)
+
+	q.Logger().WithFields(logrus.Fields{
+		"balloon-target-mb": target,
+		"ballooned-memory":  q.state.BalloonedMemory,
+		"reclaimed-memory":  q.reclaimedMemory,
+	}).Debug("Resizing the memory balloon")
+
+	if err := q.qmpSetup(); err != nil {
+		return err
+	}
+
+	return q.qmpMonitorCh.qmp.ExecuteBalloon(q.qmpMonitorCh.ctx, uint64(target)<<utils.MibToBytesShift)
+}
+
+// startBalloonReclaim starts reclaiming periodically, with the balloon, the
+// memory the guest does not use.
+func (q *qemu) startBalloonReclaim() error {
+	if q.balloonStatsInterval() == 0 {
+		return nil
+	}
+
+	socketPath, err := q.qmpAuxSocketPath(q.id)
+	if err != nil {
+		return err
+	}
+
+	q.balloonStopCh = make(chan struct{})
+	q.balloonWg.Add(1)
+	go q.balloonReclaimLoop(q.balloonStopCh, socketPath)
+
+	return nil
+}
+
+// stopBalloonReclaim stops the memory reclaim, if started, and waits for it
+// to be stopped so that it does not race with the QMP teardown.
+func (q *qemu) stopBalloonReclaim() {
+	if q.balloonStopCh == nil {
+		return
+	}
+
+	close(q.balloonStopCh)
+	q.balloonWg.Wait()
+	q.balloonStopCh = nil
+}
+
+func (q *qemu) balloonReclaimLoop(stopCh <-chan struct{}, socketPath string) {
+	defer q.balloonWg.Done()
+
+	ticker := time.NewTicker(q.config.BalloonReclaimInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stopCh:
+			return
+		case <-ticker.C:
+			if err := q.reclaimGuestMemory(socketPath); err != nil {
+				q.Logger().WithError(err).Debug("Could not reclaim the guest memory")
+			}
+		}
+	}
+}
+
+// reclaimGuestMemory resizes the balloon according to the memory the guest
+// reports as available.
+func (q *qemu) reclaimGuestMemory(socketPath string) error {
+	guestStats, err := qmpAuxExecute(socketPath, "qom-get", map[string]interface{}{
+		"path":     balloonQOMPath,
+		"property": "guest-stats",
+	})
+	if err != nil {
+		return err
+	}
+
+	free, ok := balloonGuestFreeMemory(guestStats)
+	if !ok {
+		return nil
+	}
+
+	q.balloonLock.Lock()
+	defer q.balloonLock.Unlock()
+
+	guestMem := balloonTarget(q.config.MemorySize+uint32(q.state.HotpluggedMemory), uint32(q.state.BalloonedMemory))
+
+	reclaimed := balloonReclaimTarget(guestMem, q.reclaimedMemory, free)
+	if reclaimed == q.reclaimedMemory {
+		return nil
+	}
+
+	q.reclaimedMemory = reclaimed
+
+	return q.setBalloonSize()
+}
@@ -0,0 +1,95 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBalloonReclaimTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	// A 2048MiB guest keeps a 204MiB reserve.
+	type testData struct {
+		reclaimed uint32
+		free      uint32
+		expected  uint32
+	}
+
+	data := []testData{
+		// Less than a step above the reserve.
+		{0, 250, 0},
+		// The excess is reclaimed by steps.
+		{0, 500, 256},
+		{256, 250, 256},
+		// Below the reserve, memory is given back by steps.
+		{256, 200, 192},
+		{256, 0, 0},
+		{0, 100, 0},
+		// The reserve is never reclaimed.
+		{0, 4096, 1844},
+	}
+
+	for _, d := range data {
+		assert.Equal(d.expected, balloonReclaimTarget(2048, d.reclaimed, d.free), "%+v", d)
+	}
+
+	// Small guests keep the minimum reserve.
+	assert.Equal(uint32(0), balloonReclaimTarget(256, 0, 180))
+	assert.Equal(uint32(64), balloonReclaimTarget(256, 0, 200))
+	assert.Equal(uint32(0), balloonReclaimTarget(128, 0, 128))
+}
+
+func TestBalloonGuestFreeMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	// No statistics reported yet.
+	_, ok := balloonGuestFreeMemory(map[string]interface{}{
+		"last-update": float64(0),
+		"stats": map[string]interface{}{
+			"stat-free-memory": float64(-1),
+		},
+	})
+	assert.False(ok)
+
+	_, ok = balloonGuestFreeMemory("unexpected")
+	assert.False(ok)
+
+	free, ok := balloonGuestFreeMemory(map[string]interface{}{
+		"last-update": float64(1550000000),
+		"stats": map[string]interface{}{
+			"stat-available-memory": float64(512 << 20),
+			"stat-free-memory":      float64(256 << 20),
+		},
+	})
+	assert.True(ok)
+	assert.Equal(uint32(512), free)
+
+	// Fall back on the free memory for older guest kernels.
+	free, ok = balloonGuestFreeMemory(map[string]interface{}{
+		"last-update": float64(1550000000),
+		"stats": map[string]interface{}{
+			"stat-available-memory": float64(-1),
+			"stat-free-memory":      float64(256 << 20),
+		},
+	})
+	assert.True(ok)
+	assert.Equal(uint32(256), free)
+}
+
+func TestBalloonTarget(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal(uint32(1536), balloonTarget(2048, 512))
+	assert.Equal(uint32(2048), balloonTarget(2048, 0))
+
+	// The guest keeps the minimum reserve, whatever the memory taken.
+	assert.Equal(uint32(balloonMinReserveMiB), balloonTarget(2048, 2048))
+	assert.Equal(uint32(balloonMinReserveMiB), balloonTarget(2048, 4096))
+	assert.Equal(uint32(64), balloonTarget(64, 32))
+}
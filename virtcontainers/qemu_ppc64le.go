@@ -98,6 +98,8 @@ func (q *qemuPPC64le) capabilities() types.Capabilities {
 	}
 
 	caps.SetMultiQueueSupport()
+	caps.SetPauseSupport()
+	caps.SetSnapshotSupport()
 
 	return caps
 }
@@ -0,0 +1,104 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+)
+
+// qmpAuxTimeout bounds the execution of a command on the auxiliary QMP
+// socket.
+const qmpAuxTimeout = 5 * time.Second
+
+// qmpAuxExecute executes the QMP command through the auxiliary QMP socket at
+// socketPath, and returns its result. The QMP client of govmm only provides
+// a fixed set of commands, and QEMU only accepts one client per QMP socket,
+// hence an auxiliary socket for the other commands, with a connection per
+// command.
+func qmpAuxExecute(socketPath, command string, args map[string]interface{}) (interface{}, error) {
+	conn, err := net.DialTimeout("unix", socketPath, qmpAuxTimeout)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(qmpAuxTimeout)); err != nil {
+		return nil, err
+	}
+
+	dec := json.NewDecoder(conn)
+	enc := json.NewEncoder(conn)
+
+	// QEMU greets every client, before accepting any command.
+	var greeting map[string]interface{}
+	if err := dec.Decode(&greeting); err != nil {
+		return nil, err
+	}
+	if _, ok := greeting["QMP"]; !ok {
+		return nil, fmt.Errorf("Unexpected QMP greeting: %v", greeting)
+	}
+
+	if _, err := qmpExecute(enc, dec, "qmp_capabilities", nil); err != nil {
+		return nil, err
+	}
+
+	return qmpExecute(enc, dec, command, args)
+}
+
+// qmpExecute executes the QMP command and returns its result, skipping the
+// events received meanwhile.
+func qmpExecute(enc *json.Encoder, dec *json.Decoder, command string, args map[string]interface{}) (interface{}, error) {
+	cmd := map[string]interface{}{"execute": command}
+	if args != nil {
+		cmd["arguments"] = args
+	}
+
+	if err := enc.Encode(cmd); err != nil {
+		return nil, err
+	}
+
+	for {
+		var response map[string]interface{}
+		if err := dec.Decode(&response); err != nil {
+			return nil, err
+		}
+
+		if result, ok := response["return"]; ok {
+			return result, nil
+		}
+
+		if qmpErr, ok := response["error"]; ok {
+			return nil, fmt.Errorf("QMP command %s failed: %v", command, qmpErr)
+		}
+	}
+}
+
+// deleteObject deletes the QOM object id, such as the memory backend of a
+// removed memory device.
+func (q *qemu) deleteObject(id string) error {
+	socketPath, err := q.qmpAuxSocketPath(q.id)
+	if err != nil {
+		return err
+	}
+
+	_, err = qmpAuxExecute(socketPath, "object-del", map[string]interface{}{"id": id})
+	return err
+}
+
+// deleteCharDev removes the character device id, which must not be used by a
+// device anymore. The QMP client of govmm does not remove character devices.
+func (q *qemu) deleteCharDev(id string) error {
+	socketPath, err := q.qmpAuxSocketPath(q.id)
+	if err != nil {
+		return err
+	}
+
+	_, err = qmpAuxExecute(socketPath, "chardev-remove", map[string]interface{}{"id": id})
+	return err
+}
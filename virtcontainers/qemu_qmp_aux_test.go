@@ -0,0 +1,181 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
+	"github.com/kata-containers/runtime/virtcontainers/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// serveQMP accepts a QMP client on l, and replies to its command with
+// responses, after the capabilities negotiation. The command is sent to cmds
+// when set.
+func serveQMP(l net.Listener, cmds chan<- map[string]interface{}, responses ...string) {
+	conn, err := l.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	dec := json.NewDecoder(conn)
+	fmt.Fprintln(conn, `{"QMP": {"version": {}, "capabilities": []}}`)
+
+	var cmd map[string]interface{}
+	if dec.Decode(&cmd) != nil {
+		return
+	}
+	fmt.Fprintln(conn, `{"return": {}}`)
+
+	if dec.Decode(&cmd) != nil {
+		return
+	}
+	if cmds != nil {
+		cmds <- cmd
+	}
+	for _, r := range responses {
+		fmt.Fprintln(conn, r)
+	}
+}
+
+func TestQmpAuxExecute(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "qmp-aux")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, qmpAuxSocket)
+	l, err := net.Listen("unix", socketPath)
+	assert.NoError(err)
+	defer l.Close()
+
+	// The events received before the result are skipped.
+	go serveQMP(l, nil, `{"event": "BALLOON_CHANGE", "data": {"actual": 1}}`, `{"return": {"last-update": 1}}`)
+
+	result, err := qmpAuxExecute(socketPath, "qom-get", map[string]interface{}{
+		"path":     balloonQOMPath,
+		"property": "guest-stats",
+	})
+	assert.NoError(err)
+	assert.Equal(map[string]interface{}{"last-update": float64(1)}, result)
+
+	go serveQMP(l, nil, `{"error": {"class": "GenericError", "desc": "object 'mem0' is in use"}}`)
+
+	_, err = qmpAuxExecute(socketPath, "object-del", map[string]interface{}{"id": "mem0"})
+	assert.Error(err)
+
+	_, err = qmpAuxExecute(filepath.Join(dir, "missing.sock"), "object-del", nil)
+	assert.Error(err)
+}
+
+func TestQemuHotplugSharedMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "qmp-aux")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRunVMStoragePath := store.RunVMStoragePath
+	store.RunVMStoragePath = dir
+	defer func() {
+		store.RunVMStoragePath = savedRunVMStoragePath
+	}()
+
+	q := &qemu{
+		id: "shared-mem",
+		config: HypervisorConfig{
+			SharedFS: config.VirtioFS,
+		},
+	}
+
+	socketPath, err := q.qmpAuxSocketPath(q.id)
+	assert.NoError(err)
+	assert.NoError(os.MkdirAll(filepath.Dir(socketPath), store.DirMode))
+
+	l, err := net.Listen("unix", socketPath)
+	assert.NoError(err)
+	defer l.Close()
+
+	cmds := make(chan map[string]interface{}, 3)
+	go func() {
+		serveQMP(l, cmds, `{"return": {}}`)
+		serveQMP(l, cmds, `{"return": {}}`)
+	}()
+
+	assert.NoError(q.hotplugSharedMemory("mem1", 128))
+
+	cmd := <-cmds
+	assert.Equal("object-add", cmd["execute"])
+	args := cmd["arguments"].(map[string]interface{})
+	assert.Equal("memory-backend-file", args["qom-type"])
+	assert.Equal("mem1", args["id"])
+	props := args["props"].(map[string]interface{})
+	assert.Equal(virtioFSMemoryPath, props["mem-path"])
+	assert.Equal(true, props["share"])
+	assert.Equal(float64(128<<20), props["size"])
+
+	cmd = <-cmds
+	assert.Equal("device_add", cmd["execute"])
+	args = cmd["arguments"].(map[string]interface{})
+	assert.Equal("pc-dimm", args["driver"])
+	assert.Equal("mem1", args["memdev"])
+
+	// The memory backend is deleted when the DIMM cannot be added.
+	go func() {
+		serveQMP(l, cmds, `{"return": {}}`)
+		serveQMP(l, cmds, `{"error": {"class": "GenericError", "desc": "no free slot"}}`)
+		serveQMP(l, cmds, `{"return": {}}`)
+	}()
+
+	assert.Error(q.hotplugSharedMemory("mem2", 128))
+	<-cmds
+	<-cmds
+	cmd = <-cmds
+	assert.Equal("object-del", cmd["execute"])
+	assert.Equal("mem2", cmd["arguments"].(map[string]interface{})["id"])
+}
+
+func TestQemuDeleteCharDev(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "qmp-aux")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	savedRunVMStoragePath := store.RunVMStoragePath
+	store.RunVMStoragePath = dir
+	defer func() {
+		store.RunVMStoragePath = savedRunVMStoragePath
+	}()
+
+	q := &qemu{id: "chardev"}
+
+	socketPath, err := q.qmpAuxSocketPath(q.id)
+	assert.NoError(err)
+	assert.NoError(os.MkdirAll(filepath.Dir(socketPath), store.DirMode))
+
+	l, err := net.Listen("unix", socketPath)
+	assert.NoError(err)
+	defer l.Close()
+
+	cmds := make(chan map[string]interface{}, 1)
+	go serveQMP(l, cmds, `{"return": {}}`)
+
+	assert.NoError(q.deleteCharDev("char-vhost-user"))
+
+	cmd := <-cmds
+	assert.Equal("chardev-remove", cmd["execute"])
+	assert.Equal("char-vhost-user", cmd["arguments"].(map[string]interface{})["id"])
+}
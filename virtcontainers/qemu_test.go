@@ -16,8 +16,10 @@ import (
 	"testing"
 
 	govmmQemu "github.com/intel/govmm/qemu"
+	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -251,6 +253,76 @@ func TestQemuAddDeviceFsDev(t *testing.T) {
 	testQemuAddDevice(t, volume, fsDev, expectedOut)
 }
 
+func TestQemuAddDeviceVirtioFS(t *testing.T) {
+	mountTag := "testMountTag"
+	hostPath := "testHostPath"
+
+	q := &qemu{
+		ctx:  context.Background(),
+		id:   "testSandbox",
+		arch: &qemuArchBase{},
+		config: HypervisorConfig{
+			SharedFS:          config.VirtioFS,
+			VirtioFSCacheSize: 1024,
+		},
+	}
+
+	volume := types.Volume{
+		MountTag: mountTag,
+		HostPath: hostPath,
+	}
+
+	err := q.addDevice(volume, fsDev)
+	assert.NoError(t, err)
+
+	expectedOut := []govmmQemu.Device{
+		vhostUserFSDevice{
+			SocketPath: filepath.Join(store.RunVMStoragePath, q.id, virtiofsdSocket),
+			CharDevID:  utils.MakeNameID("char", mountTag, maxDevIDSize),
+			Tag:        mountTag,
+			CacheSize:  1024,
+		},
+	}
+
+	assert.Equal(t, expectedOut, q.qemuConfig.Devices)
+	assert.Equal(t, hostPath, q.sharedFSPath)
+}
+
+func TestQemuSetupSharedMemory(t *testing.T) {
+	assert := assert.New(t)
+
+	q := &qemu{
+		config: HypervisorConfig{
+			SharedFS: config.VirtioFS,
+		},
+	}
+
+	knobs := govmmQemu.Knobs{MemPrealloc: true}
+	memory := govmmQemu.Memory{Size: "1024M"}
+	q.setupSharedMemory(&knobs, &memory)
+
+	assert.False(knobs.MemPrealloc)
+	assert.True(knobs.FileBackedMem)
+	assert.True(knobs.FileBackedMemShared)
+	assert.Equal(virtioFSMemoryPath, memory.Path)
+
+	// Huge pages are already shared
+	q.config.HugePages = true
+	knobs = govmmQemu.Knobs{HugePages: true}
+	memory = govmmQemu.Memory{Size: "1024M"}
+	q.setupSharedMemory(&knobs, &memory)
+
+	assert.Equal(govmmQemu.Knobs{HugePages: true}, knobs)
+	assert.Empty(memory.Path)
+
+	// 9p
+	q.config = HypervisorConfig{}
+	knobs = govmmQemu.Knobs{}
+	q.setupSharedMemory(&knobs, &memory)
+
+	assert.Equal(govmmQemu.Knobs{}, knobs)
+}
+
 func TestQemuAddDeviceSerialPortDev(t *testing.T) {
 	deviceID := "channelTest"
 	id := "charchTest"
@@ -393,9 +465,26 @@ func TestHotplugUnsupportedDeviceType(t *testing.T) {
 	}
 	q.store = vcStore
 
-	_, err = q.hotplugAddDevice(&memoryDevice{0, 128}, fsDev)
+	_, err = q.hotplugAddDevice(&memoryDevice{slot: 0, sizeMB: 128}, fsDev)
 	assert.Error(err)
-	_, err = q.hotplugRemoveDevice(&memoryDevice{0, 128}, fsDev)
+	_, err = q.hotplugRemoveDevice(&memoryDevice{slot: 0, sizeMB: 128}, fsDev)
+	assert.Error(err)
+}
+
+func TestQemuHotplugNetDevice(t *testing.T) {
+	assert := assert.New(t)
+
+	q := &qemu{
+		ctx:    context.Background(),
+		config: newQemuConfig(),
+	}
+	q.qmpMonitorCh.qmp = &govmmQemu.QMP{}
+
+	// A vhost-user device needs the guest memory to be shared
+	err := q.hotplugNetDevice(&VhostUserEndpoint{IfaceName: "eth1"}, addDevice)
+	assert.Error(err)
+
+	err = q.hotplugNetDevice(&PhysicalEndpoint{IfaceName: "eth1"}, addDevice)
 	assert.Error(err)
 }
 
@@ -482,3 +571,74 @@ func TestQemuAddDeviceToBridge(t *testing.T) {
 	exceptErr = errors.New("failed to get available address from bridges")
 	assert.Equal(exceptErr, err)
 }
+
+func TestQemuBridgeOfDevice(t *testing.T) {
+	assert := assert.New(t)
+
+	config := newQemuConfig()
+	config.DefaultBridges = defaultBridges
+	config.HypervisorMachineType = QemuPC
+	q := &qemu{
+		config: config,
+		arch:   newQemuArch(config),
+	}
+	q.state.Bridges = q.arch.bridges(q.config.DefaultBridges)
+
+	_, _, err := q.addDeviceToBridge("qemu-bridge-1")
+	assert.NoError(err)
+	addr, bridge, err := q.addDeviceToBridge("qemu-bridge-2")
+	assert.NoError(err)
+
+	// The address a device was plugged at is found back.
+	foundAddr, foundBridge, err := q.bridgeOfDevice("qemu-bridge-2")
+	assert.NoError(err)
+	assert.Equal(addr, foundAddr)
+	assert.Equal(bridge.ID, foundBridge.ID)
+
+	_, _, err = q.bridgeOfDevice("qemu-bridge-3")
+	assert.Error(err)
+}
+
+func TestQemuForwardQMPEvents(t *testing.T) {
+	assert := assert.New(t)
+
+	q := &qemu{}
+
+	events := make(chan hypervisorEvent, 1)
+	q.events = events
+
+	qmpEvents := make(chan govmmQemu.QMPEvent)
+	disconnectCh := make(chan struct{})
+	done := make(chan struct{})
+
+	go func() {
+		q.forwardQMPEvents(qmpEvents, disconnectCh)
+		close(done)
+	}()
+
+	// Not a VM lifecycle event
+	qmpEvents <- govmmQemu.QMPEvent{Name: "DEVICE_DELETED"}
+
+	qmpEvents <- govmmQemu.QMPEvent{
+		Name: "GUEST_PANICKED",
+		Data: map[string]interface{}{"action": "pause"},
+	}
+	e := <-events
+	assert.Equal(guestPanicEvent, e.kind)
+
+	qmpEvents <- govmmQemu.QMPEvent{
+		Name: "SHUTDOWN",
+		Data: map[string]interface{}{"guest": true, "reason": "guest-shutdown"},
+	}
+	e = <-events
+	assert.Equal(vmShutdownEvent, e.kind)
+	assert.Contains(e.details, "guest-shutdown")
+
+	// Events are dropped without subscriber.
+	assert.NoError(q.subscribeEvents(nil))
+	qmpEvents <- govmmQemu.QMPEvent{Name: "SHUTDOWN"}
+	assert.Len(events, 0)
+
+	close(disconnectCh)
+	<-done
+}
@@ -14,6 +14,7 @@ import (
 	"os"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/containernetworking/plugins/pkg/ns"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
@@ -100,6 +101,9 @@ type SandboxConfig struct {
 	SystemdCgroup bool
 
 	DisableGuestSeccomp bool
+
+	// MonitorConfig is the configuration of the sandbox monitor.
+	MonitorConfig MonitorConfig
 }
 
 func (s *Sandbox) trace(name string) (opentracing.Span, context.Context) {
@@ -227,6 +231,30 @@ func (s *Sandbox) GetNetNs() string {
 	return s.networkNS.NetNsPath
 }
 
+// GetHypervisorPid returns the pid of the sandbox hypervisor process.
+func (s *Sandbox) GetHypervisorPid() (int, error) {
+	if s.hypervisor == nil {
+		return -1, fmt.Errorf("Sandbox %s has no hypervisor", s.id)
+	}
+
+	return s.hypervisor.pid(), nil
+}
+
+// GetVCPUThreadIDs returns the host thread IDs of the sandbox vCPUs, or
+// nil if the hypervisor does not report them.
+func (s *Sandbox) GetVCPUThreadIDs() ([]int, error) {
+	if s.hypervisor == nil {
+		return nil, fmt.Errorf("Sandbox %s has no hypervisor", s.id)
+	}
+
+	tids, err := s.hypervisor.getThreadIDs()
+	if err != nil || tids == nil {
+		return nil, err
+	}
+
+	return tids.vcpus, nil
+}
+
 // GetAllContainers returns all containers.
 func (s *Sandbox) GetAllContainers() []VCContainer {
 	ifa := make([]VCContainer, len(s.containers))
@@ -735,6 +763,7 @@ func (s *Sandbox) startNetworkMonitor() error {
 		debug:      s.config.NetworkConfig.NetmonConfig.Debug,
 		logLevel:   logLevel,
 		runtime:    binPath,
+		apiSocket:  s.config.NetworkConfig.NetmonConfig.APISocket,
 		sandboxID:  s.id,
 	}
 
@@ -836,15 +865,23 @@ func (s *Sandbox) AddInterface(inf *vcTypes.Interface) (*vcTypes.Interface, erro
 		return nil, err
 	}
 
-	endpoint, err := createEndpoint(netInfo, len(s.networkNS.Endpoints), s.config.NetworkConfig.InterworkingModel)
-	if err != nil {
-		return nil, err
-	}
-
-	endpoint.SetProperties(netInfo)
+	// The endpoint is created from the network namespace, as the
+	// physical and macvtap ones depend on the interface link.
+	var endpoint Endpoint
 	if err := doNetNS(s.networkNS.NetNsPath, func(_ ns.NetNS) error {
+		endpoint, err = createEndpoint(netInfo, len(s.networkNS.Endpoints), s.config.NetworkConfig.InterworkingModel)
+		if err != nil {
+			return err
+		}
+
+		endpoint.SetProperties(netInfo)
+
 		s.Logger().WithField("endpoint-type", endpoint.Type()).Info("Hot attaching endpoint")
-		return endpoint.HotAttach(s.hypervisor)
+		if err := endpoint.HotAttach(s.hypervisor); err != nil {
+			return err
+		}
+
+		return setEndpointBandwidth(endpoint, s.config.NetworkConfig.IngressBandwidth, s.config.NetworkConfig.EgressBandwidth)
 	}); err != nil {
 		return nil, err
 	}
@@ -878,6 +915,68 @@ func (s *Sandbox) RemoveInterface(inf *vcTypes.Interface) (*vcTypes.Interface, e
 	return nil, nil
 }
 
+// UpdateInterface updates the addresses and the MTU of a nic of the
+// sandbox, identified by its hardware address.
+func (s *Sandbox) UpdateInterface(inf *vcTypes.Interface) (*vcTypes.Interface, error) {
+	for _, endpoint := range s.networkNS.Endpoints {
+		if endpoint.HardwareAddr() != inf.HwAddr {
+			continue
+		}
+
+		netInfo, err := s.generateNetInfo(inf)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := doNetNS(s.networkNS.NetNsPath, func(_ ns.NetNS) error {
+			return setEndpointMTU(endpoint, netInfo.Iface.MTU)
+		}); err != nil {
+			return nil, err
+		}
+
+		// Keep the link type and attributes of the endpoint, only the
+		// addresses and the MTU are updated.
+		properties := endpoint.Properties()
+		properties.Iface.MTU = netInfo.Iface.MTU
+		properties.Addrs = netInfo.Addrs
+		endpoint.SetProperties(properties)
+
+		if err := s.store.Store(store.Network, s.networkNS); err != nil {
+			return nil, err
+		}
+
+		inf.PciAddr = endpoint.PciAddr()
+		return s.agent.updateInterface(inf)
+	}
+
+	return nil, fmt.Errorf("Interface %s (%s) not found in the sandbox", inf.Name, inf.HwAddr)
+}
+
+// UpdateBandwidth updates the bandwidth limits, in bits per second, of the
+// sandbox nics.
+func (s *Sandbox) UpdateBandwidth(bw *vcTypes.Bandwidth) (*vcTypes.Bandwidth, error) {
+	if err := doNetNS(s.networkNS.NetNsPath, func(_ ns.NetNS) error {
+		for _, endpoint := range s.networkNS.Endpoints {
+			if err := setEndpointBandwidth(endpoint, bw.Ingress, bw.Egress); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	// The limits apply to the nics added later as well.
+	s.config.NetworkConfig.IngressBandwidth = bw.Ingress
+	s.config.NetworkConfig.EgressBandwidth = bw.Egress
+	if err := s.store.Store(store.Configuration, *(s.config)); err != nil {
+		return nil, err
+	}
+
+	return bw, nil
+}
+
 // ListInterfaces lists all nics and their configurations in the sandbox.
 func (s *Sandbox) ListInterfaces() ([]*vcTypes.Interface, error) {
 	return s.agent.listInterfaces()
@@ -900,6 +999,8 @@ func (s *Sandbox) startVM() error {
 
 	s.Logger().Info("Starting VM")
 
+	start := time.Now()
+
 	if err := s.network.Run(s.networkNS.NetNsPath, func() error {
 		if s.factory != nil {
 			vm, err := s.factory.GetVM(ctx, VMConfig{
@@ -946,6 +1047,9 @@ func (s *Sandbox) startVM() error {
 	}
 
 	s.Logger().Info("VM started")
+	observeBootPhase(bootPhaseVM, start)
+
+	start = time.Now()
 
 	// Once the hypervisor is done starting the sandbox,
 	// we want to guarantee that it is manageable.
@@ -956,6 +1060,7 @@ func (s *Sandbox) startVM() error {
 	}
 
 	s.Logger().Info("Agent started in the sandbox")
+	observeBootPhase(bootPhaseAgent, start)
 
 	return nil
 }
@@ -965,6 +1070,12 @@ func (s *Sandbox) stopVM() error {
 	span, _ := s.trace("stopVM")
 	defer span.Finish()
 
+	// The VM is about to go away, stop the monitor so that its
+	// watchers do not take it for a crash.
+	if s.monitor != nil {
+		s.monitor.stop()
+	}
+
 	s.Logger().Info("Stopping sandbox in the VM")
 	if err := s.agent.stopSandbox(s); err != nil {
 		s.Logger().WithError(err).WithField("sandboxid", s.id).Warning("Agent did not stop sandbox")
@@ -1132,6 +1243,13 @@ func (s *Sandbox) DeleteContainer(containerID string) (VCContainer, error) {
 		return nil, err
 	}
 
+	// Give the resources of the container back to the host. The
+	// container is gone already, failing to do so does not fail its
+	// deletion.
+	if err := s.updateResources(); err != nil {
+		s.Logger().WithError(err).WithField("container", containerID).Warn("Could not shrink the sandbox resources after deleting the container")
+	}
+
 	return c, nil
 }
 
@@ -1221,6 +1339,7 @@ func (s *Sandbox) StatsContainer(containerID string) (ContainerStats, error) {
 	if err != nil {
 		return ContainerStats{}, err
 	}
+
 	return *stats, nil
 }
 
@@ -1337,6 +1456,11 @@ func (s *Sandbox) Stop() error {
 
 // Pause pauses the sandbox
 func (s *Sandbox) Pause() error {
+	caps := s.hypervisor.capabilities()
+	if !caps.IsPauseSupported() {
+		return fmt.Errorf("Pausing the sandbox is not supported by hypervisor %s", s.config.HypervisorType)
+	}
+
 	if err := s.hypervisor.pauseSandbox(); err != nil {
 		return err
 	}
@@ -1354,6 +1478,11 @@ func (s *Sandbox) Pause() error {
 
 // Resume resumes the sandbox
 func (s *Sandbox) Resume() error {
+	caps := s.hypervisor.capabilities()
+	if !caps.IsPauseSupported() {
+		return fmt.Errorf("Resuming the sandbox is not supported by hypervisor %s", s.config.HypervisorType)
+	}
+
 	if err := s.hypervisor.resumeSandbox(); err != nil {
 		return err
 	}
@@ -1625,6 +1754,16 @@ func (s *Sandbox) updateResources() error {
 	sandboxMemoryByte := int64(s.hypervisor.hypervisorConfig().MemorySize) << utils.MibToBytesShift
 	sandboxMemoryByte += s.calculateSandboxMemory()
 
+	// Give back the vCPUs and memory devices the sandbox does not need
+	// anymore. The vCPUs the guest keeps are not removed when resizing.
+	currentVCPUs, err := s.removeResources(sandboxVCPUs, uint32(sandboxMemoryByte>>utils.MibToBytesShift))
+	if err != nil {
+		return err
+	}
+	if sandboxVCPUs < currentVCPUs {
+		sandboxVCPUs = currentVCPUs
+	}
+
 	// Update VCPUs
 	s.Logger().WithField("cpus-sandbox", sandboxVCPUs).Debugf("Request to hypervisor to update vCPUs")
 	oldCPUs, newCPUs, err := s.hypervisor.resizeVCPUs(sandboxVCPUs)
@@ -1653,6 +1792,87 @@ func (s *Sandbox) updateResources() error {
 	return nil
 }
 
+// removeResources hot removes the vCPUs and the memory devices above
+// reqVCPUs and reqMemMB, and returns the resulting number of vCPUs. The
+// guest kernel offlines the resources it is asked to eject, and refuses to
+// eject the ones it cannot offline, in which case the VM keeps them and they
+// are onlined back. An error is only returned if the guest could not be
+// brought back to a consistent state.
+func (s *Sandbox) removeResources(reqVCPUs, reqMemMB uint32) (uint32, error) {
+	hotpluggedVCPUs, memDevs, err := s.hypervisor.hotpluggedResources()
+	if err != nil {
+		return 0, err
+	}
+
+	hConfig := s.hypervisor.hypervisorConfig()
+
+	currentVCPUs := hConfig.NumVCPUs + hotpluggedVCPUs
+	if currentVCPUs > reqVCPUs && hotpluggedVCPUs > 0 {
+		removeVCPUs := currentVCPUs - reqVCPUs
+		if removeVCPUs > hotpluggedVCPUs {
+			removeVCPUs = hotpluggedVCPUs
+		}
+
+		removed, err := s.removeVCPUs(removeVCPUs)
+		currentVCPUs -= removed
+		if err != nil {
+			return currentVCPUs, err
+		}
+	}
+
+	currentMemMB := hConfig.MemorySize
+	for _, memDev := range memDevs {
+		currentMemMB += uint32(memDev.sizeMB)
+	}
+
+	for _, memDev := range memDevs {
+		if currentMemMB-uint32(memDev.sizeMB) < reqMemMB {
+			continue
+		}
+
+		removed, err := s.removeMemory(memDev)
+		if err != nil {
+			return currentVCPUs, err
+		}
+		if removed {
+			currentMemMB -= uint32(memDev.sizeMB)
+		}
+	}
+
+	return currentVCPUs, nil
+}
+
+// removeVCPUs hot removes vcpus vCPUs, and returns the number of vCPUs
+// removed.
+func (s *Sandbox) removeVCPUs(vcpus uint32) (uint32, error) {
+	data, err := s.hypervisor.hotplugRemoveDevice(vcpus, cpuDev)
+	removed, _ := data.(uint32)
+	if err != nil || removed < vcpus {
+		s.Logger().WithError(err).WithFields(logrus.Fields{
+			"vcpus":   vcpus,
+			"removed": removed,
+		}).Warn("Could not remove vCPUs")
+		// The guest may have offlined the vCPUs it did not eject.
+		return removed, s.agent.onlineCPUMem(vcpus-removed, true)
+	}
+
+	return removed, nil
+}
+
+// removeMemory hot removes memDev, and returns whether it was removed.
+func (s *Sandbox) removeMemory(memDev *memoryDevice) (bool, error) {
+	if _, err := s.hypervisor.hotplugRemoveDevice(memDev, memoryDev); err != nil {
+		// The guest cannot offline, hence eject, memory still in use.
+		s.Logger().WithError(err).WithFields(logrus.Fields{
+			"memory-slot":    memDev.slot,
+			"memory-size-mb": memDev.sizeMB,
+		}).Warn("Could not remove memory")
+		return false, s.agent.onlineCPUMem(0, false)
+	}
+
+	return true, nil
+}
+
 func (s *Sandbox) calculateSandboxMemory() int64 {
 	memorySandbox := int64(0)
 	for _, c := range s.config.Containers {
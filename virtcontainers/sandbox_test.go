@@ -8,6 +8,7 @@ package virtcontainers
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -19,14 +20,17 @@ import (
 	"syscall"
 	"testing"
 
+	"github.com/containernetworking/plugins/pkg/ns"
 	"github.com/kata-containers/runtime/virtcontainers/device/config"
 	"github.com/kata-containers/runtime/virtcontainers/device/drivers"
 	"github.com/kata-containers/runtime/virtcontainers/device/manager"
 	"github.com/kata-containers/runtime/virtcontainers/pkg/annotations"
+	vcTypes "github.com/kata-containers/runtime/virtcontainers/pkg/types"
 	"github.com/kata-containers/runtime/virtcontainers/store"
 	"github.com/kata-containers/runtime/virtcontainers/types"
 	specs "github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
 	"golang.org/x/sys/unix"
 )
 
@@ -1554,6 +1558,138 @@ func TestGetNetNs(t *testing.T) {
 	assert.Equal(t, netNs, expected)
 }
 
+func TestSandboxUpdateInterface(t *testing.T) {
+	assert := assert.New(t)
+
+	netNSPath, err := createNetNS()
+	assert.NoError(err)
+	defer deleteNetNS(netNSPath)
+
+	// The host side of the endpoint, whose MTU is updated as well.
+	err = doNetNS(netNSPath, func(_ ns.NetNS) error {
+		if err := netlink.LinkAdd(&netlink.Tuntap{
+			LinkAttrs: netlink.LinkAttrs{Name: "tap0_kata"},
+			Mode:      netlink.TUNTAP_MODE_TAP,
+		}); err != nil {
+			return err
+		}
+
+		return netlink.LinkAdd(&netlink.Bridge{
+			LinkAttrs: netlink.LinkAttrs{Name: "br0_kata"},
+		})
+	})
+	assert.NoError(err)
+
+	endpoint := &VethEndpoint{
+		NetPair: NetworkInterfacePair{
+			Name: "br0_kata",
+			TAPIface: NetworkInterface{
+				Name:     "tap0_kata",
+				HardAddr: "02:00:ca:fe:00:48",
+			},
+			NetInterworkingModel: NetXConnectBridgedModel,
+		},
+		EndpointProperties: NetworkInfo{
+			Iface: NetlinkIface{
+				LinkAttrs: netlink.LinkAttrs{
+					Name: "eth0",
+					MTU:  1500,
+				},
+				Type: "veth",
+			},
+		},
+		PCIAddr: "01/02",
+	}
+
+	s := &Sandbox{
+		id:    testSandboxID,
+		agent: &noopAgent{},
+		networkNS: NetworkNamespace{
+			NetNsPath: netNSPath,
+			Endpoints: []Endpoint{endpoint},
+		},
+		ctx: context.Background(),
+	}
+
+	vcStore, err := store.NewVCSandboxStore(s.ctx, s.id)
+	assert.NoError(err)
+	s.store = vcStore
+	defer vcStore.Delete()
+
+	inf := &vcTypes.Interface{
+		Name:   "eth0",
+		Mtu:    9000,
+		HwAddr: "02:00:ca:fe:00:48",
+		IPAddresses: []*vcTypes.IPAddress{
+			{Family: netlink.FAMILY_V4, Address: "172.17.0.2", Mask: "16"},
+			{Family: netlink.FAMILY_V6, Address: "fd00::2", Mask: "64"},
+		},
+	}
+
+	_, err = s.UpdateInterface(inf)
+	assert.NoError(err)
+	assert.Equal("01/02", inf.PciAddr)
+
+	properties := endpoint.Properties()
+	assert.Equal(9000, properties.Iface.MTU)
+	assert.Equal("veth", properties.Iface.Type)
+	assert.Len(properties.Addrs, 2)
+	assert.Equal("172.17.0.2/16", properties.Addrs[0].IPNet.String())
+	assert.Equal("fd00::2/64", properties.Addrs[1].IPNet.String())
+
+	err = doNetNS(netNSPath, func(_ ns.NetNS) error {
+		for _, name := range []string{"tap0_kata", "br0_kata"} {
+			link, err := netlink.LinkByName(name)
+			if err != nil {
+				return err
+			}
+			assert.Equal(9000, link.Attrs().MTU)
+		}
+
+		return nil
+	})
+	assert.NoError(err)
+
+	// Unknown interface
+	inf.HwAddr = "02:00:ca:fe:00:49"
+	_, err = s.UpdateInterface(inf)
+	assert.Error(err)
+}
+
+func TestSandboxUpdateBandwidth(t *testing.T) {
+	assert := assert.New(t)
+
+	s := &Sandbox{
+		id:     testSandboxID,
+		config: &SandboxConfig{},
+		networkNS: NetworkNamespace{
+			// The bandwidth of a tap endpoint is not limited.
+			Endpoints: []Endpoint{&TapEndpoint{}},
+		},
+		ctx: context.Background(),
+	}
+
+	vcStore, err := store.NewVCSandboxStore(s.ctx, s.id)
+	assert.NoError(err)
+	s.store = vcStore
+	defer vcStore.Delete()
+
+	bw, err := s.UpdateBandwidth(&vcTypes.Bandwidth{Ingress: 1000000, Egress: 2000000})
+	assert.NoError(err)
+	assert.Equal(&vcTypes.Bandwidth{Ingress: 1000000, Egress: 2000000}, bw)
+	assert.Equal(uint64(1000000), s.config.NetworkConfig.IngressBandwidth)
+	assert.Equal(uint64(2000000), s.config.NetworkConfig.EgressBandwidth)
+
+	// The macvtap interworking model only limits the egress bandwidth.
+	s.networkNS.Endpoints = []Endpoint{&VethEndpoint{
+		NetPair: NetworkInterfacePair{NetInterworkingModel: NetXConnectMacVtapModel},
+	}}
+	_, err = s.UpdateBandwidth(&vcTypes.Bandwidth{Ingress: 1000000})
+	assert.Error(err)
+	assert.Equal(uint64(1000000), s.config.NetworkConfig.IngressBandwidth)
+	assert.Equal(uint64(2000000), s.config.NetworkConfig.EgressBandwidth)
+}
+
 func TestStartNetworkMonitor(t *testing.T) {
 	trueBinPath, err := exec.LookPath("true")
 	assert.Nil(t, err)
@@ -1680,3 +1816,58 @@ func TestSandboxUpdateResources(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// resizeTestAgent records the vCPUs and memory onlined.
+type resizeTestAgent struct {
+	noopAgent
+
+	onlinedVCPUs uint32
+	onlinedMem   bool
+}
+
+func (a *resizeTestAgent) onlineCPUMem(cpus uint32, cpuOnly bool) error {
+	a.onlinedVCPUs += cpus
+	a.onlinedMem = a.onlinedMem || !cpuOnly
+	return nil
+}
+
+func TestSandboxRemoveResources(t *testing.T) {
+	assert := assert.New(t)
+
+	// The mock hypervisor has no vCPUs nor memory but the hot added ones.
+	memDevs := []*memoryDevice{
+		{slot: 2, sizeMB: 256, addr: 0x180000000},
+		{slot: 1, sizeMB: 1024, addr: 0x140000000},
+		{slot: 0, sizeMB: 512, addr: 0x100000000},
+	}
+
+	h := &mockHypervisor{
+		hotpluggedVCPUs:  3,
+		hotpluggedMemory: append([]*memoryDevice{}, memDevs...),
+	}
+	a := &resizeTestAgent{}
+	s := &Sandbox{
+		ctx:        context.Background(),
+		hypervisor: h,
+		agent:      a,
+	}
+
+	// Only the devices that fit in the 1000MiB to remove are removed.
+	vcpus, err := s.removeResources(2, 792)
+	assert.NoError(err)
+	assert.Equal(uint32(2), vcpus)
+	assert.Equal(uint32(2), h.hotpluggedVCPUs)
+	assert.Equal([]*memoryDevice{memDevs[1]}, h.hotpluggedMemory)
+	assert.Zero(a.onlinedVCPUs)
+	assert.False(a.onlinedMem)
+
+	// The resources the guest does not eject are onlined back.
+	h.hotunplugErr = errors.New("guest did not eject the device")
+	vcpus, err = s.removeResources(1, 0)
+	assert.NoError(err)
+	assert.Equal(uint32(2), vcpus)
+	assert.Equal(uint32(1), a.onlinedVCPUs)
+	assert.True(a.onlinedMem)
+	assert.Equal(uint32(2), h.hotpluggedVCPUs)
+	assert.Len(h.hotpluggedMemory, 1)
+}
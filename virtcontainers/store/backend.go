@@ -14,16 +14,20 @@ type backendType string
 
 const (
 	filesystemBackend backendType = "filesystem"
+	boltBackend       backendType = "bolt"
 )
 
 const (
 	filesystemScheme string = "file"
+	boltScheme       string = "bolt"
 )
 
 func schemeToBackendType(scheme string) (backendType, error) {
 	switch scheme {
 	case filesystemScheme:
 		return filesystemBackend, nil
+	case boltScheme:
+		return boltBackend, nil
 	}
 
 	return "", fmt.Errorf("Unsupported scheme %s", scheme)
@@ -38,6 +42,8 @@ func newBackend(scheme string) (backend, error) {
 	switch t {
 	case filesystemBackend:
 		return &filesystem{}, nil
+	case boltBackend:
+		return &boltStore{}, nil
 	}
 
 	return nil, fmt.Errorf("Unsupported scheme %s", scheme)
@@ -0,0 +1,464 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kata-containers/runtime/virtcontainers/pkg/uuid"
+	opentracing "github.com/opentracing/opentracing-go"
+	"github.com/sirupsen/logrus"
+	bolt "go.etcd.io/bbolt"
+)
+
+const (
+	// boltDatabaseExt is the extension of the bolt database files.
+	// A bolt Store URL path is made of the database file path followed
+	// by the path of the Store bucket in the database, for example
+	// bolt:///run/vc/sbs/<sandboxID>.db/<sandboxID>/<containerID>
+	boltDatabaseExt = ".db"
+
+	// boltOpenTimeout is how long we wait for another process to
+	// release a database.
+	boltOpenTimeout = 10 * time.Second
+)
+
+// boltDatabase is a database opened by the process, and the file it was
+// opened from.
+type boltDatabase struct {
+	db   *bolt.DB
+	file os.FileInfo
+}
+
+// boltDatabases holds the databases opened by the process. Opening a
+// database costs more than most transactions, so it is kept open, and
+// locked against the other processes by bolt, until it is deleted or the
+// process exits.
+var boltDatabases = struct {
+	sync.Mutex
+	dbs map[string]boltDatabase
+}{
+	dbs: make(map[string]boltDatabase),
+}
+
+// boltStore is a Store backend keeping all items into a bolt key/value
+// database, one bucket per Store. Every item update is atomic.
+// Each sandbox has its own database, holding its container buckets, so
+// that processes handling different sandboxes do not wait on each other.
+// Raw items and item locks are still regular files, and are created under
+// the directory the filesystem backend would use for the same Store.
+type boltStore struct {
+	ctx context.Context
+
+	dbPath  string
+	buckets []string
+
+	path    string
+	rawPath string
+
+	lockTokens map[string]*os.File
+}
+
+// Logger returns a logrus logger appropriate for logging Store bolt messages
+func (b *boltStore) logger() *logrus.Entry {
+	return storeLog.WithFields(logrus.Fields{
+		"subsystem": "store",
+		"backend":   "bolt",
+		"database":  b.dbPath,
+		"bucket":    b.bucketPath(),
+	})
+}
+
+func (b *boltStore) trace(name string) (opentracing.Span, context.Context) {
+	if b.ctx == nil {
+		b.logger().WithField("type", "bug").Error("trace called before context set")
+		b.ctx = context.Background()
+	}
+
+	span, ctx := opentracing.StartSpanFromContext(b.ctx, name)
+
+	span.SetTag("subsystem", "store")
+	span.SetTag("type", "bolt")
+	span.SetTag("path", b.path)
+
+	return span, ctx
+}
+
+// splitBoltPath splits a bolt Store path into its database file path
+// and its bucket path.
+func splitBoltPath(path string) (string, []string, error) {
+	elems := strings.Split(filepath.Clean(path), string(filepath.Separator))
+
+	for i, e := range elems {
+		if !strings.HasSuffix(e, boltDatabaseExt) {
+			continue
+		}
+
+		buckets := elems[i+1:]
+		if len(buckets) == 0 {
+			break
+		}
+
+		return string(filepath.Separator) + filepath.Join(elems[:i+1]...), buckets, nil
+	}
+
+	return "", nil, fmt.Errorf("Invalid bolt store path %s, expecting <database%s>/<bucket>", path, boltDatabaseExt)
+}
+
+func (b *boltStore) bucketPath() string {
+	return strings.Join(b.buckets, "/")
+}
+
+func (b *boltStore) notExist(key string) error {
+	return &os.PathError{
+		Op:   "load",
+		Path: filepath.Join(b.dbPath, b.bucketPath(), key),
+		Err:  syscall.ENOENT,
+	}
+}
+
+// open returns the database of the Store, opening it if the process has
+// not yet. A database removed since, by another process, is opened again.
+func (b *boltStore) open() (*bolt.DB, error) {
+	boltDatabases.Lock()
+	defer boltDatabases.Unlock()
+
+	if opened, ok := boltDatabases.dbs[b.dbPath]; ok {
+		if file, err := os.Stat(b.dbPath); err == nil && os.SameFile(file, opened.file) {
+			return opened.db, nil
+		}
+
+		opened.db.Close()
+		delete(boltDatabases.dbs, b.dbPath)
+	}
+
+	// The sandboxes do not survive a host crash, and nor do their
+	// items need to: transactions are not synced to disk.
+	db, err := bolt.Open(b.dbPath, 0640, &bolt.Options{
+		Timeout: boltOpenTimeout,
+		NoSync:  true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Stat(b.dbPath)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	boltDatabases.dbs[b.dbPath] = boltDatabase{
+		db:   db,
+		file: file,
+	}
+
+	return db, nil
+}
+
+// close closes the database of the Store, if the process has opened it.
+func (b *boltStore) close() error {
+	boltDatabases.Lock()
+	defer boltDatabases.Unlock()
+
+	opened, ok := boltDatabases.dbs[b.dbPath]
+	if !ok {
+		return nil
+	}
+
+	delete(boltDatabases.dbs, b.dbPath)
+
+	return opened.db.Close()
+}
+
+// update runs fn in a read-write transaction, on the Store bucket.
+// Buckets are created as needed.
+func (b *boltStore) update(fn func(bucket *bolt.Bucket) error) error {
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+
+	return db.Update(func(tx *bolt.Tx) error {
+		bucket, err := tx.CreateBucketIfNotExists([]byte(b.buckets[0]))
+		if err != nil {
+			return err
+		}
+
+		for _, name := range b.buckets[1:] {
+			if bucket, err = bucket.CreateBucketIfNotExists([]byte(name)); err != nil {
+				return err
+			}
+		}
+
+		return fn(bucket)
+	})
+}
+
+// view runs fn in a read-only transaction, on the Store bucket.
+func (b *boltStore) view(key string, fn func(bucket *bolt.Bucket) error) error {
+	// bolt would create a missing database.
+	if _, err := os.Stat(b.dbPath); os.IsNotExist(err) {
+		return b.notExist(key)
+	}
+
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+
+	return db.View(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket([]byte(b.buckets[0]))
+
+		for _, name := range b.buckets[1:] {
+			if bucket == nil {
+				break
+			}
+			bucket = bucket.Bucket([]byte(name))
+		}
+
+		if bucket == nil {
+			return b.notExist(key)
+		}
+
+		return fn(bucket)
+	})
+}
+
+func (b *boltStore) new(ctx context.Context, path string, host string) error {
+	dbPath, buckets, err := splitBoltPath(path)
+	if err != nil {
+		return err
+	}
+
+	b.ctx = ctx
+	b.dbPath = dbPath
+	b.buckets = buckets
+	b.path = filepath.Join(append([]string{filepath.Dir(dbPath)}, buckets...)...)
+	b.rawPath = filepath.Join(b.path, "raw")
+	b.lockTokens = make(map[string]*os.File)
+
+	b.logger().Debugf("New bolt store backend for %s", path)
+
+	if err := os.MkdirAll(filepath.Dir(b.dbPath), DirMode); err != nil {
+		return err
+	}
+
+	// The Store directory is only used for raw items, but other
+	// virtcontainers components expect to find it.
+	if err := os.MkdirAll(b.rawPath, DirMode); err != nil {
+		return err
+	}
+
+	return b.update(func(bucket *bolt.Bucket) error {
+		return nil
+	})
+}
+
+func (b *boltStore) delete() error {
+	b.logger().Debug("Deleting bucket")
+
+	db, err := b.open()
+	if err != nil {
+		return err
+	}
+
+	err = db.Update(func(tx *bolt.Tx) error {
+		last := len(b.buckets) - 1
+
+		if last == 0 {
+			err := tx.DeleteBucket([]byte(b.buckets[0]))
+			if err == bolt.ErrBucketNotFound {
+				return nil
+			}
+			return err
+		}
+
+		// container buckets are nested into the sandbox one
+
+		parent := tx.Bucket([]byte(b.buckets[0]))
+		for _, name := range b.buckets[1:last] {
+			if parent == nil {
+				break
+			}
+			parent = parent.Bucket([]byte(name))
+		}
+
+		if parent == nil {
+			return nil
+		}
+
+		err := parent.DeleteBucket([]byte(b.buckets[last]))
+		if err == bolt.ErrBucketNotFound {
+			return nil
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	// The database is only shared by the Stores of the sandbox.
+	if len(b.buckets) == 1 {
+		if err := b.close(); err != nil {
+			return err
+		}
+
+		if err := os.Remove(b.dbPath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	return os.RemoveAll(b.path)
+}
+
+func (b *boltStore) load(item Item, data interface{}) error {
+	span, _ := b.trace("load")
+	defer span.Finish()
+
+	span.SetTag("item", item)
+
+	key, err := itemToFile(item)
+	if err != nil {
+		return err
+	}
+
+	return b.view(key, func(bucket *bolt.Bucket) error {
+		value := bucket.Get([]byte(key))
+		if value == nil {
+			return b.notExist(key)
+		}
+
+		return json.Unmarshal(value, data)
+	})
+}
+
+func (b *boltStore) store(item Item, data interface{}) error {
+	span, _ := b.trace("store")
+	defer span.Finish()
+
+	span.SetTag("item", item)
+
+	key, err := itemToFile(item)
+	if err != nil {
+		return err
+	}
+
+	jsonOut, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("Could not marshall data: %s", err)
+	}
+
+	return b.update(func(bucket *bolt.Bucket) error {
+		return bucket.Put([]byte(key), jsonOut)
+	})
+}
+
+// storeRaw stores already marshalled items, indexed by their
+// filesystem backend file name, in a single transaction.
+func (b *boltStore) storeRaw(items map[string][]byte) error {
+	return b.update(func(bucket *bolt.Bucket) error {
+		for key, value := range items {
+			if err := bucket.Put([]byte(key), value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (b *boltStore) raw(id string) (string, error) {
+	span, _ := b.trace("raw")
+	defer span.Finish()
+
+	span.SetTag("id", id)
+
+	if err := os.MkdirAll(b.rawPath, DirMode); err != nil {
+		return "", err
+	}
+
+	// We must use the item ID.
+	if id != "" {
+		filePath := filepath.Join(b.rawPath, id)
+		file, err := os.Create(filePath)
+		if err != nil {
+			return "", err
+		}
+		defer file.Close()
+
+		return filesystemScheme + "://" + file.Name(), nil
+	}
+
+	// Generate a random temporary file.
+	file, err := ioutil.TempFile(b.rawPath, "raw-")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	return filesystemScheme + "://" + file.Name(), nil
+}
+
+// lock takes a lock on item. As with the filesystem backend, the lock is a
+// flock on the item file, here an empty file only used for locking, so
+// that it is released when its holder exits.
+func (b *boltStore) lock(item Item, exclusive bool) (string, error) {
+	key, err := itemToFile(item)
+	if err != nil {
+		return "", err
+	}
+
+	if err := os.MkdirAll(b.path, DirMode); err != nil {
+		return "", err
+	}
+
+	itemFile, err := os.OpenFile(filepath.Join(b.path, key), os.O_RDONLY|os.O_CREATE, 0640)
+	if err != nil {
+		return "", err
+	}
+
+	var lockType int
+	if exclusive {
+		lockType = syscall.LOCK_EX
+	} else {
+		lockType = syscall.LOCK_SH
+	}
+
+	if err := syscall.Flock(int(itemFile.Fd()), lockType); err != nil {
+		itemFile.Close()
+		return "", err
+	}
+
+	token := uuid.Generate().String()
+	b.lockTokens[token] = itemFile
+
+	return token, nil
+}
+
+func (b *boltStore) unlock(item Item, token string) error {
+	itemFile := b.lockTokens[token]
+	if itemFile == nil {
+		return fmt.Errorf("No lock for token %s", token)
+	}
+
+	if err := syscall.Flock(int(itemFile.Fd()), syscall.LOCK_UN); err != nil {
+		return err
+	}
+
+	itemFile.Close()
+	delete(b.lockTokens, token)
+
+	return nil
+}
@@ -0,0 +1,284 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package store
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var boltDBPath = "/tmp/root1/sandbox.db"
+var boltRootPath = filepath.Join(boltDBPath, "sandbox")
+
+func TestStoreBoltSplitPath(t *testing.T) {
+	assert := assert.New(t)
+
+	db, buckets, err := splitBoltPath("/run/vc/sbs/sandbox.db/sandbox/container")
+	assert.NoError(err)
+	assert.Equal("/run/vc/sbs/sandbox.db", db)
+	assert.Equal([]string{"sandbox", "container"}, buckets)
+
+	_, _, err = splitBoltPath("/run/vc/sbs.db")
+	assert.Error(err)
+
+	_, _, err = splitBoltPath("/run/vc/sbs/sandbox")
+	assert.Error(err)
+}
+
+func TestStoreBoltStoreLoad(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Remove(boltDBPath)
+
+	b := boltStore{}
+	err := b.new(context.Background(), boltRootPath, "")
+	defer b.delete()
+	assert.NoError(err)
+
+	newData := TestNoopStructure{}
+	err = b.load(State, &newData)
+	assert.True(os.IsNotExist(err))
+
+	data := TestNoopStructure{
+		Field1: "value1",
+		Field2: "value2",
+	}
+
+	err = b.store(State, data)
+	assert.NoError(err)
+
+	err = b.load(State, &newData)
+	assert.NoError(err)
+	assert.Equal(data, newData)
+
+	// Nested container bucket
+	c := boltStore{}
+	err = c.new(context.Background(), filepath.Join(boltRootPath, "container"), "")
+	assert.NoError(err)
+
+	err = c.load(State, &newData)
+	assert.True(os.IsNotExist(err))
+
+	err = c.store(State, data)
+	assert.NoError(err)
+
+	// Deleting the sandbox bucket deletes the container one.
+	err = b.delete()
+	assert.NoError(err)
+
+	err = c.load(State, &newData)
+	assert.True(os.IsNotExist(err))
+
+	_, err = os.Stat(b.path)
+	assert.True(os.IsNotExist(err))
+
+	// The sandbox database is removed with the sandbox bucket.
+	_, err = os.Stat(boltDBPath)
+	assert.True(os.IsNotExist(err))
+}
+
+func TestStoreBoltRaw(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Remove(boltDBPath)
+
+	b := boltStore{}
+	err := b.new(context.Background(), boltRootPath, "")
+	defer b.delete()
+	assert.NoError(err)
+
+	path, err := b.raw("roah")
+	assert.NoError(err)
+	assert.Equal(filesystemScheme+"://"+filepath.Join("/tmp/root1", "sandbox", "raw", "roah"), path)
+}
+
+func TestStoreBoltLock(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Remove(boltDBPath)
+
+	b := boltStore{}
+	err := b.new(context.Background(), boltRootPath, "")
+	defer b.delete()
+	assert.NoError(err)
+
+	// Take 2 shared locks
+	token1, err := b.lock(Lock, false)
+	assert.NoError(err)
+
+	token2, err := b.lock(Lock, false)
+	assert.NoError(err)
+
+	assert.NoError(b.unlock(Lock, token1))
+	assert.NoError(b.unlock(Lock, token2))
+	assert.Error(b.unlock(Lock, token2))
+
+	// Take 1 exclusive lock
+	token, err := b.lock(Lock, true)
+	assert.NoError(err)
+
+	assert.NoError(b.unlock(Lock, token))
+	assert.Error(b.unlock(Lock, token))
+}
+
+func TestStoreBoltLockExclusive(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Remove(boltDBPath)
+
+	b := boltStore{}
+	err := b.new(context.Background(), boltRootPath, "")
+	defer b.delete()
+	assert.NoError(err)
+
+	token, err := b.lock(Lock, true)
+	assert.NoError(err)
+
+	// A shared lock waits for the exclusive one to be released.
+	locked := make(chan string)
+	go func() {
+		token, err := b.lock(Lock, false)
+		assert.NoError(err)
+		locked <- token
+	}()
+
+	select {
+	case <-locked:
+		assert.Fail("shared lock taken while locked exclusively")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	assert.NoError(b.unlock(Lock, token))
+
+	select {
+	case token = <-locked:
+		assert.NoError(b.unlock(Lock, token))
+	case <-time.After(5 * time.Second):
+		assert.Fail("shared lock not taken once the exclusive one is released")
+	}
+}
+
+func TestStoreBoltDatabaseOpen(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Remove(boltDBPath)
+
+	b := boltStore{}
+	err := b.new(context.Background(), boltRootPath, "")
+	assert.NoError(err)
+
+	// The database is kept open.
+	db, err := b.open()
+	assert.NoError(err)
+
+	reopened, err := b.open()
+	assert.NoError(err)
+	assert.True(db == reopened)
+
+	// It is opened again once removed by another process.
+	assert.NoError(os.Remove(boltDBPath))
+
+	reopened, err = b.open()
+	assert.NoError(err)
+	assert.False(db == reopened)
+
+	// And closed with the sandbox bucket.
+	assert.NoError(b.delete())
+
+	boltDatabases.Lock()
+	_, ok := boltDatabases.dbs[boltDBPath]
+	boltDatabases.Unlock()
+	assert.False(ok)
+}
+
+func TestStoreMigrateToBolt(t *testing.T) {
+	assert := assert.New(t)
+
+	sandboxID := "migrated-sandbox"
+	containerID := "migrated-container"
+
+	data := TestNoopStructure{
+		Field1: "value1",
+		Field2: "value2",
+	}
+
+	err := SetBackend("filesystem")
+	assert.NoError(err)
+
+	ctx := context.Background()
+
+	s, err := NewVCSandboxStore(ctx, sandboxID)
+	assert.NoError(err)
+	assert.NoError(s.Store(Configuration, data))
+	assert.NoError(s.Store(State, data))
+
+	c, err := NewVCContainerStore(ctx, sandboxID, containerID)
+	assert.NoError(err)
+	assert.NoError(c.Store(Process, data))
+
+	// Release the filesystem Stores from the manager
+	stores.removeStore(SandboxConfigurationRoot(sandboxID))
+	stores.removeStore(SandboxRuntimeRoot(sandboxID))
+	stores.removeStore(ContainerConfigurationRoot(sandboxID, containerID))
+	stores.removeStore(ContainerRuntimeRoot(sandboxID, containerID))
+
+	migrated, err := MigrateToBolt(ctx)
+	assert.NoError(err)
+	assert.Equal([]string{sandboxID}, migrated)
+
+	_, err = os.Stat(filepath.Join(RunStoragePath, sandboxID, StateFile))
+	assert.True(os.IsNotExist(err))
+
+	_, err = os.Stat(filepath.Join(RunStoragePath, sandboxID, containerID, ProcessFile))
+	assert.True(os.IsNotExist(err))
+
+	err = SetBackend("bolt")
+	assert.NoError(err)
+	defer SetBackend("filesystem")
+
+	s, err = NewVCSandboxStore(ctx, sandboxID)
+	assert.NoError(err)
+	defer s.Delete()
+
+	var newData TestNoopStructure
+	assert.NoError(s.Load(Configuration, &newData))
+	assert.Equal(data, newData)
+
+	newData = TestNoopStructure{}
+	assert.NoError(s.Load(State, &newData))
+	assert.Equal(data, newData)
+
+	c, err = NewVCContainerStore(ctx, sandboxID, containerID)
+	assert.NoError(err)
+
+	newData = TestNoopStructure{}
+	assert.NoError(c.Load(Process, &newData))
+	assert.Equal(data, newData)
+
+	// The database files sit next to the filesystem storage paths.
+	_, err = os.Stat(filepath.Join(RunStoragePath, sandboxID+boltDatabaseExt))
+	assert.NoError(err)
+
+	entries, err := ioutil.ReadDir(filepath.Join(RunStoragePath, sandboxID))
+	assert.NoError(err)
+	for _, e := range entries {
+		assert.True(e.IsDir(), "unexpected file %s", e.Name())
+	}
+}
+
+func TestStoreSetBackend(t *testing.T) {
+	assert := assert.New(t)
+	defer SetBackend("")
+
+	assert.Error(SetBackend("foo"))
+
+	assert.NoError(SetBackend("bolt"))
+	assert.Equal(boltScheme+"://"+filepath.Join(ConfigStoragePath, "sandbox.db", "sandbox"), SandboxConfigurationRoot("sandbox"))
+
+	assert.NoError(SetBackend(""))
+	assert.Equal(filesystemScheme+"://"+filepath.Join(ConfigStoragePath, "sandbox"), SandboxConfigurationRoot("sandbox"))
+}
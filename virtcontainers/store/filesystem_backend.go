@@ -63,6 +63,15 @@ const SandboxPathSuffix = "sbs"
 // VMPathSuffix is the suffix used for guest VMs.
 const VMPathSuffix = "vm"
 
+// ConsolePathSuffix is the suffix used for the guest consoles logs.
+const ConsolePathSuffix = "console"
+
+// MetricsPathSuffix is the suffix used for the shims metrics sockets.
+const MetricsPathSuffix = "metrics"
+
+// NetworkPathSuffix is the suffix used for the network management sockets.
+const NetworkPathSuffix = "network"
+
 // ConfigStoragePath is the sandbox configuration directory.
 // It will contain one config.json file for each created sandbox.
 var ConfigStoragePath = filepath.Join("/var/lib", StoragePathSuffix, SandboxPathSuffix)
@@ -75,6 +84,20 @@ var RunStoragePath = filepath.Join("/run", StoragePathSuffix, SandboxPathSuffix)
 // It will contain all guest vm sockets and shared mountpoints.
 var RunVMStoragePath = filepath.Join("/run", StoragePathSuffix, VMPathSuffix)
 
+// RunConsoleStoragePath is the guest consoles logs directory.
+// It will contain one directory for each sandbox, which is kept once
+// the sandbox is deleted for post-mortem analysis.
+var RunConsoleStoragePath = filepath.Join("/run", StoragePathSuffix, ConsolePathSuffix)
+
+// RunMetricsStoragePath is the shims metrics sockets directory.
+// It will contain one Prometheus endpoint socket for each running sandbox.
+var RunMetricsStoragePath = filepath.Join("/run", StoragePathSuffix, MetricsPathSuffix)
+
+// RunNetworkStoragePath is the network management sockets directory.
+// It will contain one socket for each sandbox whose runtime serves the
+// network API.
+var RunNetworkStoragePath = filepath.Join("/run", StoragePathSuffix, NetworkPathSuffix)
+
 func itemToFile(item Item) (string, error) {
 	switch item {
 	case Configuration:
@@ -7,6 +7,7 @@ package store
 
 import (
 	"context"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"sync"
@@ -221,7 +222,32 @@ func (s *Store) Load(item Item, data interface{}) error {
 	s.RLock()
 	defer s.RUnlock()
 
-	return s.backend.load(item, data)
+	var raw json.RawMessage
+	if err := s.backend.load(item, &raw); err != nil {
+		return err
+	}
+
+	itemData, err := unwrapItem(item, raw)
+	if err != nil {
+		return err
+	}
+
+	return json.Unmarshal(itemData, data)
+}
+
+// version returns the version of a stored item.
+func (s *Store) version(item Item) (uint, error) {
+	s.RLock()
+	defer s.RUnlock()
+
+	var raw json.RawMessage
+	if err := s.backend.load(item, &raw); err != nil {
+		return 0, err
+	}
+
+	version, _ := itemVersion(raw)
+
+	return version, nil
 }
 
 // Store stores a virtcontainers item into a Store.
@@ -231,10 +257,15 @@ func (s *Store) Store(item Item, data interface{}) error {
 
 	span.SetTag("item", item)
 
+	versioned, err := wrapItem(data)
+	if err != nil {
+		return err
+	}
+
 	s.Lock()
 	defer s.Unlock()
 
-	return s.backend.store(item, data)
+	return s.backend.store(item, versioned)
 }
 
 // Delete deletes all artifacts created by a Store.
@@ -0,0 +1,140 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package store
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// itemFiles returns the file names of all the filesystem backend data
+// items. The lock file holds no data and is left out.
+func itemFiles() []string {
+	var files []string
+	seen := make(map[string]bool)
+
+	for item := Configuration; item <= DeviceIDs; item++ {
+		file, err := itemToFile(item)
+		if err != nil || file == LockFile || seen[file] {
+			continue
+		}
+
+		seen[file] = true
+		files = append(files, file)
+	}
+
+	return files
+}
+
+// MigrateToBolt converts the filesystem Stores of every sandbox, and of
+// their containers, into bolt Stores. Each sandbox is migrated while
+// holding its filesystem Store lock, but the sandboxes should not be
+// running as a runtime process that does not take the lock, like the
+// shim v2, would keep on using the filesystem Stores.
+// The item files are removed once migrated, the raw items are kept.
+// It returns the IDs of the migrated sandboxes.
+func MigrateToBolt(ctx context.Context) ([]string, error) {
+	// the sandbox databases sit next to the sandbox directories
+	sandboxIDs, err := subdirs(ConfigStoragePath)
+	if err != nil {
+		return nil, err
+	}
+
+	migrated := []string{}
+
+	for _, id := range sandboxIDs {
+		if err := migrateSandboxToBolt(ctx, id); err != nil {
+			return migrated, fmt.Errorf("Could not migrate sandbox %s: %v", id, err)
+		}
+
+		migrated = append(migrated, id)
+	}
+
+	return migrated, nil
+}
+
+func migrateSandboxToBolt(ctx context.Context, id string) error {
+	// Lock the sandbox the way the filesystem backend users do.
+	lockStore := &filesystem{}
+	if err := lockStore.new(ctx, filepath.Join(RunStoragePath, id), ""); err != nil {
+		return err
+	}
+
+	token, err := lockStore.lock(Lock, true)
+	if err != nil {
+		return err
+	}
+
+	for _, root := range []string{ConfigStoragePath, RunStoragePath} {
+		if err := migrateDirToBolt(ctx, root, id, ""); err != nil {
+			lockStore.unlock(Lock, token)
+			return err
+		}
+	}
+
+	if err := lockStore.unlock(Lock, token); err != nil {
+		return err
+	}
+
+	return os.Remove(filepath.Join(RunStoragePath, id, LockFile))
+}
+
+// migrateDirToBolt migrates the filesystem Store at root/sandboxID/path,
+// and the ones below it, into the bolt database of the sandbox.
+func migrateDirToBolt(ctx context.Context, root, sandboxID, path string) error {
+	dir := filepath.Join(root, sandboxID, path)
+
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	items := make(map[string][]byte)
+	for _, file := range itemFiles() {
+		data, err := ioutil.ReadFile(filepath.Join(dir, file))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		items[file] = data
+	}
+
+	b := &boltStore{}
+	if err := b.new(ctx, boltStorePath(root, sandboxID, path), ""); err != nil {
+		return err
+	}
+
+	if err := b.storeRaw(items); err != nil {
+		return err
+	}
+
+	for file := range items {
+		if err := os.Remove(filepath.Join(dir, file)); err != nil {
+			return err
+		}
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || e.Name() == "raw" {
+			continue
+		}
+
+		if err := migrateDirToBolt(ctx, root, sandboxID, filepath.Join(path, e.Name())); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
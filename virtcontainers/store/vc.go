@@ -9,6 +9,7 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
+	"os"
 	"path/filepath"
 
 	"github.com/kata-containers/runtime/virtcontainers/device/api"
@@ -85,6 +86,20 @@ func NewVCContainerStore(ctx context.Context, sandboxID, containerID string) (*V
 	)
 }
 
+// NewVCCheckpointStore creates a virtcontainers Store for a sandbox or a
+// container, rooted under a checkpoint directory, with filesystem backend.
+// The id is the sandbox ID, or <sandboxID>/<containerID> for a container.
+func NewVCCheckpointStore(ctx context.Context, checkpointDir, id string) (*VCStore, error) {
+	if checkpointDir == "" {
+		return nil, fmt.Errorf("checkpoint directory can not be empty")
+	}
+
+	return NewVCStore(ctx,
+		filesystemScheme+"://"+filepath.Join(checkpointDir, "config", id),
+		filesystemScheme+"://"+filepath.Join(checkpointDir, "run", id),
+	)
+}
+
 // Store stores a virtcontainers item into the right Store.
 func (s *VCStore) Store(item Item, data interface{}) error {
 	return s.itemToStore(item).Store(item, data)
@@ -95,6 +110,28 @@ func (s *VCStore) Load(item Item, data interface{}) error {
 	return s.itemToStore(item).Load(item, data)
 }
 
+// Copy copies items from a VCStore into dst. Items are copied as raw
+// data so that both Stores can use different backends. Items that do not
+// exist in the source Store are skipped.
+func (s *VCStore) Copy(dst *VCStore, items []Item) error {
+	for _, item := range items {
+		var data json.RawMessage
+
+		if err := s.Load(item, &data); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+
+		if err := dst.Store(item, data); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // Delete deletes all artifacts created by a VCStore.
 // Both config and state Stores are also removed from the manager.
 func (s *VCStore) Delete() error {
@@ -219,11 +256,47 @@ func (s *VCStore) Unlock(token string) error {
 
 // Utilities for virtcontainers
 
+// storeScheme is the scheme of the sandbox and container Store URLs.
+var storeScheme = filesystemScheme
+
+// SetBackend selects the backend of the sandbox and container Stores.
+// Supported backends are "filesystem", the default, and "bolt".
+func SetBackend(name string) error {
+	switch backendType(name) {
+	case "", filesystemBackend:
+		storeScheme = filesystemScheme
+	case boltBackend:
+		storeScheme = boltScheme
+	default:
+		return fmt.Errorf("Unsupported store backend %s", name)
+	}
+
+	return nil
+}
+
+// storeURL returns the URL of a Store of the sandboxID sandbox rooted
+// under the root storage path.
+func storeURL(root, sandboxID string, elem ...string) string {
+	if storeScheme == boltScheme {
+		return storeScheme + "://" + boltStorePath(root, sandboxID, elem...)
+	}
+
+	return storeScheme + "://" + filepath.Join(append([]string{root, sandboxID}, elem...)...)
+}
+
+// boltStorePath returns the bolt Store path of the sandboxID sandbox
+// rooted under the root storage path. All the bolt Stores of a sandbox
+// share one database, next to the sandbox storage directory.
+func boltStorePath(root, sandboxID string, elem ...string) string {
+	return filepath.Join(append([]string{root, sandboxID + boltDatabaseExt, sandboxID}, elem...)...)
+}
+
 // SandboxConfigurationRoot returns a virtcontainers sandbox configuration root URL.
 // This will hold across host reboot persistent data about a sandbox configuration.
 // It should look like file:///var/lib/vc/sbs/<sandboxID>/
+// or bolt:///var/lib/vc/sbs/<sandboxID>.db/<sandboxID>/
 func SandboxConfigurationRoot(id string) string {
-	return filesystemScheme + "://" + filepath.Join(ConfigStoragePath, id)
+	return storeURL(ConfigStoragePath, id)
 }
 
 // SandboxConfigurationRootPath returns a virtcontainers sandbox configuration root path.
@@ -249,8 +322,9 @@ func SandboxConfigurationItemPath(id string, item Item) (string, error) {
 // This will hold data related to a sandbox run-time state that will not
 // be persistent across host reboots.
 // It should look like file:///run/vc/sbs/<sandboxID>/
+// or bolt:///run/vc/sbs/<sandboxID>.db/<sandboxID>/
 func SandboxRuntimeRoot(id string) string {
-	return filesystemScheme + "://" + filepath.Join(RunStoragePath, id)
+	return storeURL(RunStoragePath, id)
 }
 
 // SandboxRuntimeRootPath returns a virtcontainers sandbox runtime root path.
@@ -275,8 +349,9 @@ func SandboxRuntimeItemPath(id string, item Item) (string, error) {
 // ContainerConfigurationRoot returns a virtcontainers container configuration root URL.
 // This will hold across host reboot persistent data about a container configuration.
 // It should look like file:///var/lib/vc/sbs/<sandboxID>/<containerID>
+// or bolt:///var/lib/vc/sbs/<sandboxID>.db/<sandboxID>/<containerID>
 func ContainerConfigurationRoot(sandboxID, containerID string) string {
-	return filesystemScheme + "://" + filepath.Join(ConfigStoragePath, sandboxID, containerID)
+	return storeURL(ConfigStoragePath, sandboxID, containerID)
 }
 
 // ContainerConfigurationRootPath returns a virtcontainers container configuration root path.
@@ -288,8 +363,9 @@ func ContainerConfigurationRootPath(sandboxID, containerID string) string {
 // This will hold data related to a container run-time state that will not
 // be persistent across host reboots.
 // It should look like file:///run/vc/sbs/<sandboxID>/<containerID>/
+// or bolt:///run/vc/sbs/<sandboxID>.db/<sandboxID>/<containerID>/
 func ContainerRuntimeRoot(sandboxID, containerID string) string {
-	return filesystemScheme + "://" + filepath.Join(RunStoragePath, sandboxID, containerID)
+	return storeURL(RunStoragePath, sandboxID, containerID)
 }
 
 // ContainerRuntimeRootPath returns a virtcontainers container runtime root path.
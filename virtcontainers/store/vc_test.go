@@ -8,8 +8,12 @@ package store
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"testing"
 
+	"github.com/kata-containers/runtime/virtcontainers/types"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -116,3 +120,37 @@ func TestStoreVCNewVCContainerStore(t *testing.T) {
 	_, err = NewVCContainerStore(context.Background(), "", "foobar")
 	assert.NotNil(t, err)
 }
+
+func TestStoreVCCopy(t *testing.T) {
+	checkpointDir, err := ioutil.TempDir("", "checkpoint-")
+	assert.Nil(t, err)
+	defer os.RemoveAll(checkpointDir)
+
+	_, err = NewVCCheckpointStore(context.Background(), "", testSandboxID)
+	assert.NotNil(t, err)
+
+	src, err := NewVCSandboxStore(context.Background(), "copy-sandbox")
+	assert.Nil(t, err)
+	defer src.Delete()
+
+	dst, err := NewVCCheckpointStore(context.Background(), checkpointDir, "copy-sandbox")
+	assert.Nil(t, err)
+
+	state := types.State{State: types.StateRunning, BlockIndex: 3}
+	err = src.Store(State, state)
+	assert.Nil(t, err)
+
+	// Network has never been stored and must be skipped.
+	err = src.Copy(dst, []Item{State, Network})
+	assert.Nil(t, err)
+
+	copied, err := dst.LoadState()
+	assert.Nil(t, err)
+	assert.Equal(t, state, copied)
+
+	_, err = os.Stat(filepath.Join(checkpointDir, "run", "copy-sandbox", StateFile))
+	assert.Nil(t, err)
+
+	_, err = os.Stat(filepath.Join(checkpointDir, "run", "copy-sandbox", NetworkFile))
+	assert.True(t, os.IsNotExist(err))
+}
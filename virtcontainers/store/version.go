@@ -0,0 +1,387 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package store
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/kata-containers/runtime/virtcontainers/types"
+)
+
+// CurrentVersion is the version of the items stored by this runtime.
+// It must be bumped whenever the schema of an item changes, along with
+// the registration of the migration upgrading the previous version.
+//
+// Version 0 items are the ones stored before versioning was introduced.
+const CurrentVersion uint = 1
+
+const (
+	// versionKey is the field holding the version of an item. It is
+	// added next to the fields of the items stored as JSON objects, which
+	// runtimes predating versioning keep reading.
+	versionKey = "storeVersion"
+
+	// versionDataKey holds the data of the other items, wrapped in an
+	// object along with their version. Runtimes predating versioning fail
+	// to read them, instead of misreading them.
+	versionDataKey = "storeData"
+)
+
+// MigrationFunc upgrades the JSON data of an item from one version to
+// the next one.
+type MigrationFunc func(data json.RawMessage) (json.RawMessage, error)
+
+type migrationKey struct {
+	item Item
+	from uint
+}
+
+var migrations = struct {
+	sync.RWMutex
+	funcs map[migrationKey]MigrationFunc
+}{
+	funcs: make(map[migrationKey]MigrationFunc),
+}
+
+// RegisterMigration registers the function upgrading item from version
+// from to version from+1. Migrations only need to be registered for the
+// versions that changed the item schema, the data is kept as is
+// otherwise.
+func RegisterMigration(item Item, from uint, fn MigrationFunc) error {
+	if from >= CurrentVersion {
+		return fmt.Errorf("Cannot register a migration from version %d, current version is %d", from, CurrentVersion)
+	}
+
+	migrations.Lock()
+	defer migrations.Unlock()
+
+	key := migrationKey{item, from}
+	if _, ok := migrations.funcs[key]; ok {
+		return fmt.Errorf("Migration of %s from version %d already registered", item, from)
+	}
+
+	migrations.funcs[key] = fn
+
+	return nil
+}
+
+func migration(item Item, from uint) MigrationFunc {
+	migrations.RLock()
+	defer migrations.RUnlock()
+
+	return migrations.funcs[migrationKey{item, from}]
+}
+
+// wrapItem marshals data, along with the current version.
+func wrapItem(data interface{}) (json.RawMessage, error) {
+	jsonData, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("Could not marshall data: %s", err)
+	}
+
+	// There is nothing to misread in a null item.
+	if bytes.Equal(jsonData, []byte("null")) {
+		return jsonData, nil
+	}
+
+	version := fmt.Sprintf(`{"%s":%d`, versionKey, CurrentVersion)
+
+	if !bytes.HasPrefix(jsonData, []byte("{")) {
+		return json.RawMessage(fmt.Sprintf(`%s,"%s":%s}`, version, versionDataKey, jsonData)), nil
+	}
+
+	if bytes.Equal(jsonData, []byte("{}")) {
+		return json.RawMessage(version + "}"), nil
+	}
+
+	return json.RawMessage(version + "," + string(jsonData[1:])), nil
+}
+
+// itemVersion returns the version of a stored item, and its data.
+func itemVersion(raw json.RawMessage) (uint, json.RawMessage) {
+	// Items stored before versioning can be anything, not only objects.
+	if !bytes.HasPrefix(bytes.TrimSpace(raw), []byte("{")) {
+		return 0, raw
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &fields); err != nil {
+		return 0, raw
+	}
+
+	var version uint
+	if err := json.Unmarshal(fields[versionKey], &version); err != nil {
+		return 0, raw
+	}
+
+	if data, ok := fields[versionDataKey]; ok {
+		return version, data
+	}
+
+	delete(fields, versionKey)
+
+	data, err := json.Marshal(fields)
+	if err != nil {
+		return 0, raw
+	}
+
+	return version, data
+}
+
+// unwrapItem returns the data of a stored item, upgraded to the current
+// version.
+func unwrapItem(item Item, raw json.RawMessage) (json.RawMessage, error) {
+	version, data := itemVersion(raw)
+
+	if version > CurrentVersion {
+		return nil, fmt.Errorf("%s item version %d is newer than the supported version %d", item, version, CurrentVersion)
+	}
+
+	for ; version < CurrentVersion; version++ {
+		fn := migration(item, version)
+		if fn == nil {
+			continue
+		}
+
+		var err error
+		if data, err = fn(data); err != nil {
+			return nil, fmt.Errorf("Could not migrate %s item from version %d: %v", item, version, err)
+		}
+	}
+
+	return data, nil
+}
+
+// versionedItems are the items whose version is reported and upgraded.
+// DeviceIDs is left out, it shares its storage with Devices.
+var versionedItems = []Item{
+	Configuration,
+	State,
+	Network,
+	Hypervisor,
+	Agent,
+	Process,
+	Mounts,
+	Devices,
+}
+
+// Versions returns the version of every item found in the VCStore.
+func (s *VCStore) Versions() (map[Item]uint, error) {
+	versions := make(map[Item]uint)
+
+	for _, item := range versionedItems {
+		version, err := s.itemToStore(item).version(item)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		versions[item] = version
+	}
+
+	return versions, nil
+}
+
+// Upgrade stores back every outdated item of the VCStore, upgraded to
+// the current version, and returns the item versions before the upgrade.
+// The caller is expected to hold the sandbox lock.
+func (s *VCStore) Upgrade() (map[Item]uint, error) {
+	versions, err := s.Versions()
+	if err != nil {
+		return nil, err
+	}
+
+	for item, version := range versions {
+		if version == CurrentVersion {
+			continue
+		}
+
+		var data json.RawMessage
+
+		if err := s.Load(item, &data); err != nil {
+			return nil, err
+		}
+
+		if err := s.Store(item, data); err != nil {
+			return nil, err
+		}
+	}
+
+	return versions, nil
+}
+
+// VersionReport describes the item versions of a sandbox, or container,
+// VCStore.
+type VersionReport struct {
+	SandboxID   string
+	ContainerID string
+	Versions    map[Item]uint
+
+	// Skipped is set when the items were not upgraded, the sandbox
+	// being live.
+	Skipped bool
+}
+
+// Outdated returns true if some of the items are not at the current version.
+func (r VersionReport) Outdated() bool {
+	for _, v := range r.Versions {
+		if v != CurrentVersion {
+			return true
+		}
+	}
+
+	return false
+}
+
+// CheckVersions reports the item versions of all the sandboxes and
+// containers VCStores.
+func CheckVersions(ctx context.Context) ([]VersionReport, error) {
+	return walkVersions(ctx, false)
+}
+
+// UpgradeVersions upgrades the items of all the sandboxes and containers
+// VCStores to the current version, and reports their versions before the
+// upgrade. The live sandboxes are skipped: their runtime, which does not
+// take the sandbox lock when it is a shim v2, may store them concurrently.
+// Their items are upgraded when loaded anyway, and stored back at the
+// current version with their next update.
+func UpgradeVersions(ctx context.Context) ([]VersionReport, error) {
+	return walkVersions(ctx, true)
+}
+
+// subdirs returns the sorted sub-directories of dir, the raw items
+// one excepted.
+func subdirs(dir string) ([]string, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return []string{}, nil
+		}
+		return nil, err
+	}
+
+	var names []string
+	for _, e := range entries {
+		if e.IsDir() && e.Name() != "raw" {
+			names = append(names, e.Name())
+		}
+	}
+
+	sort.Strings(names)
+
+	return names, nil
+}
+
+func walkVersions(ctx context.Context, upgrade bool) ([]VersionReport, error) {
+	var reports []VersionReport
+
+	sandboxIDs, err := subdirs(ConfigStoragePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, sandboxID := range sandboxIDs {
+		sandboxReports, err := sandboxVersions(ctx, sandboxID, upgrade)
+		reports = append(reports, sandboxReports...)
+		if err != nil {
+			return reports, fmt.Errorf("Sandbox %s: %v", sandboxID, err)
+		}
+	}
+
+	return reports, nil
+}
+
+func sandboxVersions(ctx context.Context, sandboxID string, upgrade bool) ([]VersionReport, error) {
+	var reports []VersionReport
+
+	containerIDs, err := subdirs(SandboxConfigurationRootPath(sandboxID))
+	if err != nil {
+		return nil, err
+	}
+
+	sandboxStore, err := NewVCSandboxStore(ctx, sandboxID)
+	if err != nil {
+		return nil, err
+	}
+
+	skipped := false
+	if upgrade {
+		live, err := sandboxLive(sandboxStore)
+		if err != nil {
+			return nil, err
+		}
+		if live {
+			upgrade = false
+			skipped = true
+		}
+	}
+
+	if upgrade {
+		token, err := sandboxStore.Lock()
+		if err != nil {
+			return nil, err
+		}
+		defer sandboxStore.Unlock(token)
+	}
+
+	versions := func(s *VCStore) (map[Item]uint, error) {
+		if upgrade {
+			return s.Upgrade()
+		}
+		return s.Versions()
+	}
+
+	report := VersionReport{
+		SandboxID: sandboxID,
+		Skipped:   skipped,
+	}
+	if report.Versions, err = versions(sandboxStore); err != nil {
+		return reports, err
+	}
+	reports = append(reports, report)
+
+	for _, containerID := range containerIDs {
+		containerStore, err := NewVCContainerStore(ctx, sandboxID, containerID)
+		if err != nil {
+			return reports, err
+		}
+
+		report := VersionReport{
+			SandboxID:   sandboxID,
+			ContainerID: containerID,
+			Skipped:     skipped,
+		}
+		if report.Versions, err = versions(containerStore); err != nil {
+			return reports, err
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// sandboxLive tells if the sandbox of the VCStore is not stopped.
+func sandboxLive(s *VCStore) (bool, error) {
+	var state types.State
+
+	if err := s.Load(State, &state); err != nil {
+		if os.IsNotExist(err) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return state.State != "" && state.State != types.StateStopped, nil
+}
@@ -0,0 +1,243 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package store
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/kata-containers/runtime/virtcontainers/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStoreVersionWrapUnwrap(t *testing.T) {
+	assert := assert.New(t)
+
+	data := TestNoopStructure{
+		Field1: "value1",
+		Field2: "value2",
+	}
+
+	raw, err := wrapItem(data)
+	assert.NoError(err)
+
+	// Runtimes predating versioning read the objects as before.
+	var oldData TestNoopStructure
+	assert.NoError(json.Unmarshal(raw, &oldData))
+	assert.Equal(data, oldData)
+
+	version, _ := itemVersion(raw)
+	assert.Equal(CurrentVersion, version)
+
+	itemData, err := unwrapItem(State, raw)
+	assert.NoError(err)
+
+	var newData TestNoopStructure
+	assert.NoError(json.Unmarshal(itemData, &newData))
+	assert.Equal(data, newData)
+
+	// The version is not mistaken for a map entry.
+	mounts := map[string]TestNoopStructure{"foo": data}
+	raw, err = wrapItem(mounts)
+	assert.NoError(err)
+	itemData, err = unwrapItem(Mounts, raw)
+	assert.NoError(err)
+	var newMounts map[string]TestNoopStructure
+	assert.NoError(json.Unmarshal(itemData, &newMounts))
+	assert.Equal(mounts, newMounts)
+
+	raw, err = wrapItem(map[string]string{})
+	assert.NoError(err)
+	assert.Equal(fmt.Sprintf(`{"storeVersion":%d}`, CurrentVersion), string(raw))
+	itemData, err = unwrapItem(Mounts, raw)
+	assert.NoError(err)
+	assert.Equal("{}", string(itemData))
+
+	// Runtimes predating versioning fail to read the other items.
+	devices := []string{"foo", "bar"}
+	raw, err = wrapItem(devices)
+	assert.NoError(err)
+	var oldDevices []string
+	assert.Error(json.Unmarshal(raw, &oldDevices))
+
+	version, _ = itemVersion(raw)
+	assert.Equal(CurrentVersion, version)
+	itemData, err = unwrapItem(Devices, raw)
+	assert.NoError(err)
+	var newDevices []string
+	assert.NoError(json.Unmarshal(itemData, &newDevices))
+	assert.Equal(devices, newDevices)
+
+	raw, err = wrapItem(nil)
+	assert.NoError(err)
+	assert.Equal("null", string(raw))
+}
+
+func TestStoreVersionLegacyItems(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, raw := range []string{expectedFilesystemData, `"running"`, `[1, 2]`, `{}`} {
+		version, data := itemVersion(json.RawMessage(raw))
+		assert.Equal(uint(0), version, raw)
+		assert.Equal(raw, string(data))
+
+		data, err := unwrapItem(State, json.RawMessage(raw))
+		assert.NoError(err, raw)
+		assert.Equal(raw, string(data))
+	}
+}
+
+func TestStoreVersionTooRecent(t *testing.T) {
+	raw := fmt.Sprintf(`{"storeVersion":%d}`, CurrentVersion+1)
+
+	_, err := unwrapItem(State, json.RawMessage(raw))
+	assert.Error(t, err)
+}
+
+func TestStoreVersionMigration(t *testing.T) {
+	assert := assert.New(t)
+
+	fn := func(data json.RawMessage) (json.RawMessage, error) {
+		var old map[string]string
+		if err := json.Unmarshal(data, &old); err != nil {
+			return nil, err
+		}
+
+		return json.Marshal(TestNoopStructure{
+			Field1: old["OldField"],
+		})
+	}
+
+	assert.NoError(RegisterMigration(Agent, 0, fn))
+	defer delete(migrations.funcs, migrationKey{Agent, 0})
+
+	assert.Error(RegisterMigration(Agent, 0, fn))
+	assert.Error(RegisterMigration(Agent, CurrentVersion, fn))
+
+	data, err := unwrapItem(Agent, json.RawMessage(`{"OldField":"value1"}`))
+	assert.NoError(err)
+
+	var newData TestNoopStructure
+	assert.NoError(json.Unmarshal(data, &newData))
+	assert.Equal("value1", newData.Field1)
+
+	// Current items are not migrated.
+	data, err = unwrapItem(Agent, json.RawMessage(fmt.Sprintf(`{"storeVersion":%d,"Field1":"value2"}`, CurrentVersion)))
+	assert.NoError(err)
+	assert.NoError(json.Unmarshal(data, &newData))
+	assert.Equal("value2", newData.Field1)
+
+	_, err = unwrapItem(Agent, json.RawMessage(`"invalid"`))
+	assert.Error(err)
+}
+
+func TestStoreVersionUpgrade(t *testing.T) {
+	assert := assert.New(t)
+
+	sandboxID := "versioned-sandbox"
+	containerID := "versioned-container"
+	ctx := context.Background()
+
+	data := TestNoopStructure{
+		Field1: "value1",
+		Field2: "value2",
+	}
+
+	s, err := NewVCSandboxStore(ctx, sandboxID)
+	assert.NoError(err)
+	defer s.Delete()
+
+	c, err := NewVCContainerStore(ctx, sandboxID, containerID)
+	assert.NoError(err)
+	defer c.Delete()
+
+	assert.NoError(s.Store(Configuration, data))
+
+	// Items written by a runtime without versioning
+	err = ioutil.WriteFile(filepath.Join(RunStoragePath, sandboxID, StateFile), []byte(expectedFilesystemData), 0640)
+	assert.NoError(err)
+	err = ioutil.WriteFile(filepath.Join(RunStoragePath, sandboxID, containerID, ProcessFile), []byte(expectedFilesystemData), 0640)
+	assert.NoError(err)
+
+	var newData TestNoopStructure
+	assert.NoError(s.Load(State, &newData))
+	assert.Equal(data, newData)
+
+	reports, err := CheckVersions(ctx)
+	assert.NoError(err)
+
+	var sandboxReport, containerReport *VersionReport
+	for i, r := range reports {
+		if r.SandboxID != sandboxID {
+			continue
+		}
+		if r.ContainerID == containerID {
+			containerReport = &reports[i]
+		} else if r.ContainerID == "" {
+			sandboxReport = &reports[i]
+		}
+	}
+
+	assert.NotNil(sandboxReport)
+	assert.NotNil(containerReport)
+	assert.True(sandboxReport.Outdated())
+	assert.Equal(map[Item]uint{Configuration: CurrentVersion, State: 0}, sandboxReport.Versions)
+	assert.Equal(map[Item]uint{Process: 0}, containerReport.Versions)
+
+	_, err = UpgradeVersions(ctx)
+	assert.NoError(err)
+
+	versions, err := s.Versions()
+	assert.NoError(err)
+	assert.Equal(map[Item]uint{Configuration: CurrentVersion, State: CurrentVersion}, versions)
+
+	versions, err = c.Versions()
+	assert.NoError(err)
+	assert.Equal(map[Item]uint{Process: CurrentVersion}, versions)
+
+	newData = TestNoopStructure{}
+	assert.NoError(c.Load(Process, &newData))
+	assert.Equal(data, newData)
+}
+
+func TestStoreVersionUpgradeLiveSandbox(t *testing.T) {
+	assert := assert.New(t)
+
+	sandboxID := "live-sandbox"
+	ctx := context.Background()
+
+	s, err := NewVCSandboxStore(ctx, sandboxID)
+	assert.NoError(err)
+	defer s.Delete()
+
+	// A running sandbox stored by a runtime without versioning
+	err = ioutil.WriteFile(filepath.Join(RunStoragePath, sandboxID, StateFile), []byte(`{"state":"running"}`), 0640)
+	assert.NoError(err)
+
+	reports, err := UpgradeVersions(ctx)
+	assert.NoError(err)
+
+	var report *VersionReport
+	for i, r := range reports {
+		if r.SandboxID == sandboxID {
+			report = &reports[i]
+		}
+	}
+	assert.NotNil(report)
+	assert.True(report.Skipped)
+
+	versions, err := s.Versions()
+	assert.NoError(err)
+	assert.Equal(map[Item]uint{State: 0}, versions)
+
+	var state types.State
+	assert.NoError(s.Load(State, &state))
+	assert.Equal(types.StateRunning, state.State)
+}
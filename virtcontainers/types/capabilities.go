@@ -10,6 +10,10 @@ const (
 	blockDeviceHotplugSupport
 	multiQueueSupport
 	fsSharingUnsupported
+	pauseSupport
+	snapshotSupport
+	blockRateLimiterSupport
+	hybridVsockSupport
 )
 
 // Capabilities describe a virtcontainers hypervisor capabilities
@@ -66,3 +70,48 @@ func (caps *Capabilities) IsFsSharingSupported() bool {
 func (caps *Capabilities) SetFsSharingUnsupported() {
 	caps.flags |= fsSharingUnsupported
 }
+
+// IsPauseSupported tells if an hypervisor supports pausing and resuming the VM.
+func (caps *Capabilities) IsPauseSupported() bool {
+	return caps.flags&pauseSupport != 0
+}
+
+// SetPauseSupport sets the VM pause and resume capability to true.
+func (caps *Capabilities) SetPauseSupport() {
+	caps.flags |= pauseSupport
+}
+
+// IsSnapshotSupported tells if an hypervisor supports saving the VM state
+// to, and restoring it from, a snapshot.
+func (caps *Capabilities) IsSnapshotSupported() bool {
+	return caps.flags&snapshotSupport != 0
+}
+
+// SetSnapshotSupport sets the VM snapshot capability to true.
+func (caps *Capabilities) SetSnapshotSupport() {
+	caps.flags |= snapshotSupport
+}
+
+// IsBlockRateLimiterSupported tells if an hypervisor supports limiting the
+// bandwidth and operations of a block device once it is plugged.
+func (caps *Capabilities) IsBlockRateLimiterSupported() bool {
+	return caps.flags&blockRateLimiterSupport != 0
+}
+
+// SetBlockRateLimiterSupport sets the block device rate limiter capability
+// to true.
+func (caps *Capabilities) SetBlockRateLimiterSupport() {
+	caps.flags |= blockRateLimiterSupport
+}
+
+// IsHybridVsockSupported tells if an hypervisor provides the vsock the agent
+// is reached through as a unix socket on the host, rather than through the
+// vhost-vsock device.
+func (caps *Capabilities) IsHybridVsockSupported() bool {
+	return caps.flags&hybridVsockSupport != 0
+}
+
+// SetHybridVsockSupport sets the hybrid vsock capability to true.
+func (caps *Capabilities) SetHybridVsockSupport() {
+	caps.flags |= hybridVsockSupport
+}
@@ -48,3 +48,59 @@ func TestFsSharingCapability(t *testing.T) {
 		t.Fatal()
 	}
 }
+
+func TestPauseCapability(t *testing.T) {
+	var caps Capabilities
+
+	if caps.IsPauseSupported() {
+		t.Fatal()
+	}
+
+	caps.SetPauseSupport()
+
+	if !caps.IsPauseSupported() {
+		t.Fatal()
+	}
+}
+
+func TestSnapshotCapability(t *testing.T) {
+	var caps Capabilities
+
+	if caps.IsSnapshotSupported() {
+		t.Fatal()
+	}
+
+	caps.SetSnapshotSupport()
+
+	if !caps.IsSnapshotSupported() {
+		t.Fatal()
+	}
+}
+
+func TestBlockRateLimiterCapability(t *testing.T) {
+	var caps Capabilities
+
+	if caps.IsBlockRateLimiterSupported() {
+		t.Fatal()
+	}
+
+	caps.SetBlockRateLimiterSupport()
+
+	if !caps.IsBlockRateLimiterSupported() {
+		t.Fatal()
+	}
+}
+
+func TestHybridVsockCapability(t *testing.T) {
+	var caps Capabilities
+
+	if caps.IsHybridVsockSupported() {
+		t.Fatal()
+	}
+
+	caps.SetHybridVsockSupport()
+
+	if !caps.IsHybridVsockSupported() {
+		t.Fatal()
+	}
+}
@@ -96,14 +96,23 @@ func (endpoint *VhostUserEndpoint) Detach(netNsCreated bool, netNsPath string) e
 	return nil
 }
 
-// HotAttach for vhostuser endpoint not supported yet
+// HotAttach for vhostuser endpoint hot plugs a vhost-user-net device,
+// connected to the endpoint socket, into the hypervisor.
 func (endpoint *VhostUserEndpoint) HotAttach(h hypervisor) error {
-	return fmt.Errorf("VhostUserEndpoint does not support Hot attach")
+	if _, err := h.hotplugAddDevice(endpoint, netDev); err != nil {
+		networkLogger().WithError(err).Error("Error attach vhostuser ep")
+		return err
+	}
+	return nil
 }
 
-// HotDetach for vhostuser endpoint not supported yet
+// HotDetach for vhostuser endpoint hot unplugs the vhost-user-net device.
 func (endpoint *VhostUserEndpoint) HotDetach(h hypervisor, netNsCreated bool, netNsPath string) error {
-	return fmt.Errorf("VhostUserEndpoint does not support Hot detach")
+	if _, err := h.hotplugRemoveDevice(endpoint, netDev); err != nil {
+		networkLogger().WithError(err).Error("Error detach vhostuser ep")
+		return err
+	}
+	return nil
 }
 
 // Create a vhostuser endpoint
@@ -6,6 +6,7 @@
 package virtcontainers
 
 import (
+	"errors"
 	"fmt"
 	"net"
 	"os"
@@ -113,7 +114,7 @@ func TestVhostUserEndpoint_HotAttach(t *testing.T) {
 	h := &mockHypervisor{}
 
 	err := v.HotAttach(h)
-	assert.Error(err)
+	assert.NoError(err)
 }
 
 func TestVhostUserEndpoint_HotDetach(t *testing.T) {
@@ -127,6 +128,10 @@ func TestVhostUserEndpoint_HotDetach(t *testing.T) {
 	h := &mockHypervisor{}
 
 	err := v.HotDetach(h, true, "")
+	assert.NoError(err)
+
+	h.hotunplugErr = errors.New("hot unplug failed")
+	err = v.HotDetach(h, true, "")
 	assert.Error(err)
 }
 
@@ -129,6 +129,8 @@ func TestMain(m *testing.M) {
 	// allow the tests to run without affecting the host system.
 	store.ConfigStoragePath = filepath.Join(testDir, store.StoragePathSuffix, "config")
 	store.RunStoragePath = filepath.Join(testDir, store.StoragePathSuffix, "run")
+	store.RunConsoleStoragePath = filepath.Join(testDir, store.StoragePathSuffix, "console")
+	store.RunMetricsStoragePath = filepath.Join(testDir, store.StoragePathSuffix, "metrics")
 
 	// set now that configStoragePath has been overridden.
 	sandboxDirConfig = filepath.Join(store.ConfigStoragePath, testSandboxID)
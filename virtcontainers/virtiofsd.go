@@ -0,0 +1,164 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// virtiofsdSocket is the vhost-user socket of the virtio-fs daemon,
+	// in the VM directory.
+	virtiofsdSocket = "vhost-fs.sock"
+
+	// virtiofsdStartTimeout is how long the virtio-fs daemon is given to
+	// create its socket.
+	virtiofsdStartTimeout = 5 * time.Second
+
+	// virtioFSMemoryPath is where the file backing the guest memory is
+	// created, when it is shared with the virtio-fs daemon.
+	virtioFSMemoryPath = "/dev/shm"
+
+	// hugePagesMemoryPath is where the file backing the guest memory is
+	// created when it is allocated from huge pages.
+	hugePagesMemoryPath = "/dev/hugepages"
+
+	// defaultVirtioFSCache is the cache mode of the virtio-fs daemon
+	// when none is configured.
+	defaultVirtioFSCache = "always"
+)
+
+// virtiofsd is the virtio-fs vhost-user daemon of a VM, which serves the
+// sandbox shared directory to the vhost-user-fs device of QEMU.
+type virtiofsd struct {
+	path       string
+	socketPath string
+	sourcePath string
+	cache      string
+	debug      bool
+	logger     *logrus.Entry
+}
+
+func (v *virtiofsd) args() []string {
+	cache := v.cache
+	if cache == "" {
+		cache = defaultVirtioFSCache
+	}
+
+	args := []string{
+		// Stay in the foreground, the daemon is supervised.
+		"-f",
+		"--syslog",
+		"-o", virtiofsdSocketOption(v.socketPath),
+		"-o", "source=" + v.sourcePath,
+		"-o", "cache=" + cache,
+	}
+
+	if v.debug {
+		args = append(args, "-d")
+	}
+
+	return args
+}
+
+// start starts the daemon and waits for its socket, so that QEMU can be
+// started. onExit is called if the daemon exits afterwards, with the
+// error it exited with.
+func (v *virtiofsd) start(onExit func(error)) (int, error) {
+	if _, err := os.Stat(v.sourcePath); err != nil {
+		return 0, fmt.Errorf("virtio-fs shared directory: %v", err)
+	}
+
+	os.Remove(v.socketPath)
+
+	cmd := exec.Command(v.path, v.args()...)
+
+	// The daemon outlives the runtime process which started it, as QEMU
+	// does.
+	cmd.SysProcAttr = &syscall.SysProcAttr{
+		Setsid: true,
+	}
+
+	v.logger.WithField("args", cmd.Args).Info("Starting virtiofsd")
+
+	if err := cmd.Start(); err != nil {
+		return 0, err
+	}
+
+	exited := make(chan error, 1)
+	go func() {
+		exited <- cmd.Wait()
+	}()
+
+	timeout := time.After(virtiofsdStartTimeout)
+
+	for {
+		if _, err := os.Stat(v.socketPath); err == nil {
+			break
+		}
+
+		select {
+		case err := <-exited:
+			return 0, fmt.Errorf("virtiofsd exited before creating its socket: %v", err)
+		case <-timeout:
+			cmd.Process.Kill()
+			return 0, fmt.Errorf("virtiofsd did not create its socket after %v", virtiofsdStartTimeout)
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+
+	go func() {
+		onExit(<-exited)
+	}()
+
+	return cmd.Process.Pid, nil
+}
+
+func virtiofsdSocketOption(socketPath string) string {
+	return "vhost_user_socket=" + socketPath
+}
+
+// stopVirtiofsd stops the daemon of pid, serving socketPath. Nothing is
+// signalled if pid no longer is this daemon, the pid having been reused after
+// it exited.
+func stopVirtiofsd(pid int, socketPath string) error {
+	if pid <= 0 {
+		return nil
+	}
+
+	cmdline, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/cmdline", pid))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	isDaemon := false
+	for _, arg := range strings.Split(string(cmdline), "\x00") {
+		if arg == virtiofsdSocketOption(socketPath) {
+			isDaemon = true
+			break
+		}
+	}
+	if !isDaemon {
+		return nil
+	}
+
+	if err := syscall.Kill(pid, syscall.SIGTERM); err != nil && err != syscall.ESRCH {
+		return err
+	}
+
+	return nil
+}
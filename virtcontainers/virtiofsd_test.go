@@ -0,0 +1,106 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVirtiofsdArgs(t *testing.T) {
+	assert := assert.New(t)
+
+	v := &virtiofsd{
+		socketPath: "/run/vc/vm/foo/vhost-fs.sock",
+		sourcePath: "/run/kata-containers/shared/sandboxes/foo",
+	}
+
+	assert.Equal([]string{
+		"-f",
+		"--syslog",
+		"-o", "vhost_user_socket=/run/vc/vm/foo/vhost-fs.sock",
+		"-o", "source=/run/kata-containers/shared/sandboxes/foo",
+		"-o", "cache=" + defaultVirtioFSCache,
+	}, v.args())
+
+	v.cache = "none"
+	v.debug = true
+	args := v.args()
+	assert.Contains(args, "cache=none")
+	assert.Equal("-d", args[len(args)-1])
+}
+
+func TestVirtiofsdStart(t *testing.T) {
+	assert := assert.New(t)
+
+	dir, err := ioutil.TempDir("", "virtiofsd-")
+	assert.NoError(err)
+	defer os.RemoveAll(dir)
+
+	socketPath := filepath.Join(dir, virtiofsdSocket)
+	daemon := filepath.Join(dir, "virtiofsd")
+
+	// Creates the socket given by "-o vhost_user_socket=" and waits,
+	// keeping its arguments in its command line.
+	assert.NoError(ioutil.WriteFile(daemon, []byte(`#!/bin/sh
+touch "`+socketPath+`"
+trap 'kill $!; exit' TERM
+sleep 60 &
+wait
+`), 0755))
+
+	v := &virtiofsd{
+		path:       daemon,
+		socketPath: socketPath,
+		sourcePath: filepath.Join(dir, "missing"),
+		logger:     virtLog.WithField("subsystem", "virtiofsd"),
+	}
+
+	exited := make(chan error, 1)
+	onExit := func(err error) {
+		exited <- err
+	}
+
+	_, err = v.start(onExit)
+	assert.Error(err)
+
+	v.sourcePath = dir
+	pid, err := v.start(onExit)
+	assert.NoError(err)
+	assert.True(pid > 0)
+	assert.NoError(syscall.Kill(pid, 0))
+
+	// Not the daemon serving this socket
+	assert.NoError(stopVirtiofsd(pid, filepath.Join(dir, "other.sock")))
+	assert.NoError(syscall.Kill(pid, 0))
+
+	assert.NoError(stopVirtiofsd(pid, socketPath))
+
+	select {
+	case <-exited:
+	case <-time.After(5 * time.Second):
+		assert.Fail("virtiofsd did not exit")
+	}
+
+	// Already stopped
+	assert.NoError(stopVirtiofsd(pid, socketPath))
+	assert.NoError(stopVirtiofsd(0, socketPath))
+
+	// Exits without creating its socket
+	os.Remove(socketPath)
+	assert.NoError(ioutil.WriteFile(daemon, []byte("#!/bin/sh\nexit 1\n"), 0755))
+
+	_, err = v.start(func(error) {
+		t.Error("onExit called before the daemon started")
+	})
+	assert.Error(err)
+}
@@ -0,0 +1,174 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"fmt"
+
+	"github.com/containernetworking/plugins/pkg/ns"
+	"github.com/vishvananda/netlink"
+)
+
+// VlanEndpoint represents a VLAN link that is bridged to the VM.
+// The VLAN tagging stays on the host: as for the processes using the VLAN
+// link in the network namespace, the VM sends and receives untagged frames,
+// which the VLAN link tags on the parent link. The agent cannot create VLAN
+// links in the guest.
+type VlanEndpoint struct {
+	NetPair            NetworkInterfacePair
+	EndpointProperties NetworkInfo
+	EndpointType       EndpointType
+	PCIAddr            string
+
+	// VlanID and ParentLink are the VLAN ID and the name of the parent
+	// link of the VLAN link.
+	VlanID     int
+	ParentLink string
+}
+
+func createVlanNetworkEndpoint(idx int, ifName string, interworkingModel NetInterworkingModel) (*VlanEndpoint, error) {
+	if idx < 0 {
+		return &VlanEndpoint{}, fmt.Errorf("invalid network endpoint index: %d", idx)
+	}
+
+	netPair, err := createNetworkInterfacePair(idx, ifName, interworkingModel)
+	if err != nil {
+		return nil, err
+	}
+
+	endpoint := &VlanEndpoint{
+		NetPair:      netPair,
+		EndpointType: VlanEndpointType,
+	}
+	if ifName != "" {
+		endpoint.NetPair.VirtIface.Name = ifName
+	}
+
+	return endpoint, nil
+}
+
+// vlanLinkInfo returns the VLAN ID and the name of the parent link of the
+// VLAN link ifName, from the current network namespace.
+func vlanLinkInfo(ifName string) (int, string, error) {
+	link, err := netlink.LinkByName(ifName)
+	if err != nil {
+		return 0, "", err
+	}
+
+	vlan, ok := link.(*netlink.Vlan)
+	if !ok {
+		return 0, "", fmt.Errorf("Interface %s is not a VLAN link", ifName)
+	}
+
+	// The parent link may be in another network namespace.
+	parent := ""
+	if parentLink, err := netlink.LinkByIndex(vlan.ParentIndex); err == nil {
+		parent = parentLink.Attrs().Name
+	}
+
+	return vlan.VlanId, parent, nil
+}
+
+// Properties returns properties of the interface.
+func (endpoint *VlanEndpoint) Properties() NetworkInfo {
+	return endpoint.EndpointProperties
+}
+
+// Name returns name of the VLAN interface in the network pair.
+func (endpoint *VlanEndpoint) Name() string {
+	return endpoint.NetPair.VirtIface.Name
+}
+
+// HardwareAddr returns the mac address that is assigned to the tap interface
+// in th network pair.
+func (endpoint *VlanEndpoint) HardwareAddr() string {
+	return endpoint.NetPair.TAPIface.HardAddr
+}
+
+// Type identifies the endpoint as a VLAN endpoint.
+func (endpoint *VlanEndpoint) Type() EndpointType {
+	return endpoint.EndpointType
+}
+
+// SetProperties sets the properties for the endpoint.
+func (endpoint *VlanEndpoint) SetProperties(properties NetworkInfo) {
+	endpoint.EndpointProperties = properties
+}
+
+// PciAddr returns the PCI address of the endpoint.
+func (endpoint *VlanEndpoint) PciAddr() string {
+	return endpoint.PCIAddr
+}
+
+// SetPciAddr sets the PCI address of the endpoint.
+func (endpoint *VlanEndpoint) SetPciAddr(pciAddr string) {
+	endpoint.PCIAddr = pciAddr
+}
+
+// NetworkPair returns the network pair of the endpoint.
+func (endpoint *VlanEndpoint) NetworkPair() *NetworkInterfacePair {
+	return &endpoint.NetPair
+}
+
+// Attach for the VLAN endpoint bridges the network pair and adds the
+// tap interface of the network pair to the hypervisor.
+func (endpoint *VlanEndpoint) Attach(h hypervisor) error {
+	if err := xConnectVMNetwork(endpoint, h); err != nil {
+		networkLogger().WithError(err).Error("Error bridging VLAN ep")
+		return err
+	}
+
+	return h.addDevice(endpoint, netDev)
+}
+
+// Detach for the VLAN endpoint tears down the tap and bridge created for
+// the VLAN interface.
+func (endpoint *VlanEndpoint) Detach(netNsCreated bool, netNsPath string) error {
+	// The network namespace would have been deleted at this point
+	// if it has not been created by virtcontainers.
+	if !netNsCreated {
+		return nil
+	}
+
+	return doNetNS(netNsPath, func(_ ns.NetNS) error {
+		return xDisconnectVMNetwork(endpoint)
+	})
+}
+
+// HotAttach for the VLAN endpoint bridges the network pair and hot plugs
+// the tap interface of the network pair into the hypervisor.
+func (endpoint *VlanEndpoint) HotAttach(h hypervisor) error {
+	if err := xConnectVMNetwork(endpoint, h); err != nil {
+		networkLogger().WithError(err).Error("Error bridging VLAN ep")
+		return err
+	}
+
+	if _, err := h.hotplugAddDevice(endpoint, netDev); err != nil {
+		networkLogger().WithError(err).Error("Error attach VLAN ep")
+		return err
+	}
+	return nil
+}
+
+// HotDetach for the VLAN endpoint tears down the tap and bridge created
+// for the interface, and hot unplugs the tap interface.
+func (endpoint *VlanEndpoint) HotDetach(h hypervisor, netNsCreated bool, netNsPath string) error {
+	if !netNsCreated {
+		return nil
+	}
+
+	if err := doNetNS(netNsPath, func(_ ns.NetNS) error {
+		return xDisconnectVMNetwork(endpoint)
+	}); err != nil {
+		networkLogger().WithError(err).Warn("Error un-bridging VLAN ep")
+	}
+
+	if _, err := h.hotplugRemoveDevice(endpoint, netDev); err != nil {
+		networkLogger().WithError(err).Error("Error detach VLAN ep")
+		return err
+	}
+	return nil
+}
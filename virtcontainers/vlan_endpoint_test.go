@@ -0,0 +1,120 @@
+// Copyright (c) 2019 Intel Corporation
+//
+// SPDX-License-Identifier: Apache-2.0
+//
+
+package virtcontainers
+
+import (
+	"net"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vishvananda/netlink"
+)
+
+func TestCreateVlanEndpoint(t *testing.T) {
+	macAddr := net.HardwareAddr{0x02, 0x00, 0xCA, 0xFE, 0x00, 0x04}
+
+	expected := &VlanEndpoint{
+		NetPair: NetworkInterfacePair{
+			TapInterface: TapInterface{
+				ID:   "uniqueTestID-4",
+				Name: "br4_kata",
+				TAPIface: NetworkInterface{
+					Name: "tap4_kata",
+				},
+			},
+			VirtIface: NetworkInterface{
+				Name:     "eth4",
+				HardAddr: macAddr.String(),
+			},
+			NetInterworkingModel: DefaultNetInterworkingModel,
+		},
+		EndpointType: VlanEndpointType,
+	}
+
+	result, err := createVlanNetworkEndpoint(4, "", DefaultNetInterworkingModel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the resulting ID  will be random - so let's overwrite to test the rest of the flow
+	result.NetPair.ID = "uniqueTestID-4"
+
+	// the resulting mac address will be random - so lets overwrite it
+	result.NetPair.VirtIface.HardAddr = macAddr.String()
+
+	if reflect.DeepEqual(result, expected) == false {
+		t.Fatalf("\nGot: %+v, \n\nExpected: %+v", result, expected)
+	}
+}
+
+func TestVlanLinkInfo(t *testing.T) {
+	if os.Geteuid() != 0 {
+		t.Skip(testDisabledAsNonRoot)
+	}
+
+	assert := assert.New(t)
+
+	vlanSupported := true
+	err := doNewNetNS(func() error {
+		parent := &netlink.Dummy{LinkAttrs: netlink.LinkAttrs{Name: "parent0"}}
+		if err := netlink.LinkAdd(parent); err != nil {
+			if err == syscall.EOPNOTSUPP {
+				vlanSupported = false
+				return nil
+			}
+			return err
+		}
+
+		vlan := &netlink.Vlan{
+			LinkAttrs: netlink.LinkAttrs{
+				Name:        "parent0.42",
+				ParentIndex: parent.Attrs().Index,
+			},
+			VlanId: 42,
+		}
+		if err := netlink.LinkAdd(vlan); err != nil {
+			if err == syscall.EOPNOTSUPP {
+				vlanSupported = false
+				return nil
+			}
+			return err
+		}
+
+		id, parentName, err := vlanLinkInfo("parent0.42")
+		assert.NoError(err)
+		assert.Equal(42, id)
+		assert.Equal("parent0", parentName)
+
+		_, _, err = vlanLinkInfo("parent0")
+		assert.Error(err)
+
+		return nil
+	})
+	assert.NoError(err)
+
+	if !vlanSupported {
+		t.Skip("Dummy or VLAN links not supported by the kernel")
+	}
+}
+
+func TestGenerateInterfacesAndRoutesVlanID(t *testing.T) {
+	assert := assert.New(t)
+
+	endpoint, err := createVlanNetworkEndpoint(0, "eth0", DefaultNetInterworkingModel)
+	assert.NoError(err)
+	endpoint.VlanID = 42
+
+	ifaces, _, err := generateInterfacesAndRoutes(NetworkNamespace{
+		NetNsPath: "/proc/self/ns/net",
+		Endpoints: []Endpoint{endpoint},
+	})
+	assert.NoError(err)
+	assert.Len(ifaces, 1)
+	assert.Equal(42, ifaces[0].VlanID)
+}
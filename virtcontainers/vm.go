@@ -185,6 +185,7 @@ func NewVM(ctx context.Context, config VMConfig) (*VM, error) {
 		}
 	}()
 
+	config.HypervisorConfig.BootForFactory = true
 	if err = hypervisor.createSandbox(ctx, id, &config.HypervisorConfig, vcStore); err != nil {
 		return nil, err
 	}
@@ -309,18 +310,36 @@ func (v *VM) logger() logrus.FieldLogger {
 // Pause pauses a VM.
 func (v *VM) Pause() error {
 	v.logger().Info("pause vm")
+
+	caps := v.hypervisor.capabilities()
+	if !caps.IsPauseSupported() {
+		return fmt.Errorf("Pausing the VM is not supported by its hypervisor")
+	}
+
 	return v.hypervisor.pauseSandbox()
 }
 
 // Save saves a VM to persistent disk.
 func (v *VM) Save() error {
 	v.logger().Info("save vm")
+
+	caps := v.hypervisor.capabilities()
+	if !caps.IsSnapshotSupported() {
+		return fmt.Errorf("Saving the VM is not supported by its hypervisor")
+	}
+
 	return v.hypervisor.saveSandbox()
 }
 
 // Resume resumes a paused VM.
 func (v *VM) Resume() error {
 	v.logger().Info("resume vm")
+
+	caps := v.hypervisor.capabilities()
+	if !caps.IsPauseSupported() {
+		return fmt.Errorf("Resuming the VM is not supported by its hypervisor")
+	}
+
 	return v.hypervisor.resumeSandbox()
 }
 
@@ -373,7 +392,7 @@ func (v *VM) AddCPUs(num uint32) error {
 func (v *VM) AddMemory(numMB uint32) error {
 	if numMB > 0 {
 		v.logger().Infof("hot adding %d MB memory", numMB)
-		dev := &memoryDevice{1, int(numMB)}
+		dev := &memoryDevice{slot: 1, sizeMB: int(numMB)}
 		if _, err := v.hypervisor.hotplugAddDevice(dev, memoryDev); err != nil {
 			return err
 		}
@@ -10,6 +10,7 @@ import (
 	"io/ioutil"
 	"testing"
 
+	"github.com/kata-containers/runtime/virtcontainers/types"
 	"github.com/kata-containers/runtime/virtcontainers/utils"
 	"github.com/stretchr/testify/assert"
 )
@@ -130,3 +131,33 @@ func TestVMConfigGrpc(t *testing.T) {
 
 	assert.True(utils.DeepCompare(config, *config2))
 }
+
+type noPauseHypervisor struct {
+	mockHypervisor
+}
+
+func (h *noPauseHypervisor) capabilities() types.Capabilities {
+	return types.Capabilities{}
+}
+
+func TestVMUnsupportedOperations(t *testing.T) {
+	assert := assert.New(t)
+
+	vm := &VM{
+		id:         "vm",
+		hypervisor: &noPauseHypervisor{},
+	}
+
+	assert.Error(vm.Pause())
+	assert.Error(vm.Resume())
+	assert.Error(vm.Save())
+
+	s := &Sandbox{
+		id:         "sandbox",
+		hypervisor: &noPauseHypervisor{},
+		config:     &SandboxConfig{},
+	}
+
+	assert.Error(s.Pause())
+	assert.Error(s.Resume())
+}